@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// GuestCartPrefix is the key prefix for anonymous visitors' carts
+const GuestCartPrefix = "cart:guest:"
+
+// GuestCartDuration is how long a guest cart survives without changes
+const GuestCartDuration = 30 * 24 * time.Hour
+
+// guestCartRetries bounds retries when concurrent requests change the same guest cart
+const guestCartRetries = 5
+
+// ErrGuestCartConflict is returned when a guest cart kept changing under an update
+var ErrGuestCartConflict = errors.New("guest cart changed concurrently")
+
+// GuestCart is an anonymous visitor's cart as stored in Redis
+type GuestCart struct {
+	NextID uint            `json:"next_id"` // Line IDs are per cart and never reused
+	Items  []GuestCartItem `json:"items"`
+}
+
+// GuestCartItem is one line of a guest cart
+type GuestCartItem struct {
+	ID         uint      `json:"id"`
+	ProductID  uint      `json:"product_id"`
+	Quantity   int       `json:"quantity"`
+	Variations string    `json:"variations,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// GuestCartsAvailable reports whether guest carts can be kept in Redis
+func GuestCartsAvailable() bool {
+	return Client != nil
+}
+
+// GetGuestCart retrieves a guest cart; a cart that doesn't exist is returned empty
+func GetGuestCart(guestID string) (*GuestCart, error) {
+	if Client == nil {
+		return nil, errors.New("redis not available")
+	}
+	return readGuestCart(Client, GuestCartPrefix+guestID)
+}
+
+// UpdateGuestCart applies update to a guest cart and stores the result, refreshing its
+// expiry. Concurrent updates to the same cart are retried so no change is lost.
+func UpdateGuestCart(guestID string, update func(cart *GuestCart) error) error {
+	if Client == nil {
+		return errors.New("redis not available")
+	}
+	key := GuestCartPrefix + guestID
+
+	for attempt := 0; attempt < guestCartRetries; attempt++ {
+		err := Client.Watch(ctx, func(tx *redis.Tx) error {
+			cart, err := readGuestCart(tx, key)
+			if err != nil {
+				return err
+			}
+			if err := update(cart); err != nil {
+				return err
+			}
+			data, err := json.Marshal(cart)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				if len(cart.Items) == 0 {
+					pipe.Del(ctx, key)
+				} else {
+					pipe.Set(ctx, key, data, GuestCartDuration)
+				}
+				return nil
+			})
+			return err
+		}, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return ErrGuestCartConflict
+}
+
+// DeleteGuestCart removes a guest cart
+func DeleteGuestCart(guestID string) error {
+	return Delete(GuestCartPrefix + guestID)
+}
+
+func readGuestCart(client redis.Cmdable, key string) (*GuestCart, error) {
+	cart := &GuestCart{}
+	data, err := client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return cart, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(data), cart); err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
@@ -18,6 +18,8 @@ type Config struct {
 	RedisHost    string
 	RedisPort    string
 	RedisPassword string
+	SecretsKey   string // Encrypts secret settings such as gateway keys
+	SecretsPreviousKeys string // Comma-separated keys rotated out, still used to decrypt
 }
 
 func LoadConfig() *Config {
@@ -37,6 +39,8 @@ func LoadConfig() *Config {
 		RedisHost:    getEnv("REDIS_HOST", "localhost"),
 		RedisPort:    getEnv("REDIS_PORT", "6379"),
 		RedisPassword: getEnv("REDIS_PASSWORD", ""),
+		SecretsKey:   getEnv("SECRETS_KEY", ""),
+		SecretsPreviousKeys: getEnv("SECRETS_PREVIOUS_KEYS", ""),
 	}
 }
 
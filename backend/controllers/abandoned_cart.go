@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"ecom-backend/database"
+	"ecom-backend/models"
+	"ecom-backend/money"
+	"ecom-backend/pricing"
+	"ecom-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// abandonedCartWindow is how long a recovery link works, and how long after abandonment an
+// order from the same customer still counts as a recovered sale
+const abandonedCartWindow = 14 * 24 * time.Hour
+
+// RecoverCart restores an abandoned cart from the link in its recovery email. Items still on
+// sale are merged back into the owner's cart; guests receive a cart token for it.
+func RecoverCart(c *gin.Context) {
+	var event models.AbandonedCart
+	if err := database.DB.Where("token_hash = ?", utils.HashToken(c.Param("token"))).First(&event).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recovery link is invalid"})
+		return
+	}
+	if event.ConvertedAt != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "This cart has already been checked out"})
+		return
+	}
+	if event.EmailSentAt == nil || time.Since(*event.EmailSentAt) > abandonedCartWindow {
+		c.JSON(http.StatusGone, gin.H{"error": "This recovery link has expired"})
+		return
+	}
+
+	owner := cartOwner{UserID: event.UserID, GuestID: event.GuestID}
+	restored := []models.AbandonedCartItem{}
+	skipped := []models.AbandonedCartItem{}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, item := range event.CartItems() {
+			ok, err := restoreCartLine(tx, owner, item)
+			if err != nil {
+				return err
+			}
+			if ok {
+				restored = append(restored, item)
+			} else {
+				skipped = append(skipped, item)
+			}
+		}
+		if event.RecoveredAt == nil {
+			return tx.Model(&event).Update("recovered_at", time.Now()).Error
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore cart"})
+		return
+	}
+
+	response := gin.H{
+		"message":     fmt.Sprintf("Restored %d items to your cart", len(restored)),
+		"restored":    restored,
+		"skipped":     skipped,
+		"coupon_code": event.CouponCode,
+	}
+	if owner.UserID == nil {
+		response["cart_token"] = setCartToken(c, owner.GuestID)
+	} else if current, ok := currentCartOwner(c, false); !ok || current.UserID == nil || *current.UserID != *owner.UserID {
+		// The cart was restored to the customer's account; they see it once signed in
+		response["login_required"] = true
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// restoreCartLine puts one snapshot line back into a cart, keeping the larger quantity when
+// the cart already holds it. It reports false when the product or its options are gone.
+func restoreCartLine(tx *gorm.DB, owner cartOwner, item models.AbandonedCartItem) (bool, error) {
+	var product models.Product
+	if err := tx.First(&product, item.ProductID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	resolved, err := pricing.ResolveVariations(tx, product.ID, item.Variations)
+	if err != nil {
+		if _, ok := err.(*pricing.SelectionError); ok {
+			return false, nil
+		}
+		return false, err
+	}
+
+	variationsJSON := SerializeVariations(resolved.Selections)
+	existing, exists, err := findCartLine(tx, owner, product.ID, variationsJSON)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		if existing.Quantity >= item.Quantity {
+			return true, nil
+		}
+		existing.Quantity = item.Quantity
+		return true, saveCartLine(tx, owner, &existing)
+	}
+
+	cartItem := models.Cart{
+		ProductID:  product.ID,
+		Quantity:   item.Quantity,
+		Variations: variationsJSON,
+	}
+	return true, saveCartLine(tx, owner, &cartItem)
+}
+
+// markAbandonedCartConverted credits an order to the owner's most recent abandoned cart, if
+// it was abandoned recently enough to count as recovered
+func markAbandonedCartConverted(tx *gorm.DB, owner cartOwner, orderID uint) error {
+	var event models.AbandonedCart
+	err := owner.scope(tx).Where("converted_at IS NULL AND created_at > ?", time.Now().Add(-abandonedCartWindow)).
+		Order("created_at DESC").First(&event).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Model(&event).Updates(map[string]interface{}{"converted_at": time.Now(), "converted_order_id": orderID}).Error
+}
+
+// GetAbandonedCartReport returns abandoned cart and recovery conversion figures for carts
+// abandoned in a date range, defaulting to the last 30 days (admin only)
+func GetAbandonedCartReport(c *gin.Context) {
+	fromDate := time.Now().AddDate(0, 0, -30)
+	toDate := time.Now()
+	var err error
+	if from := c.Query("from"); from != "" {
+		if fromDate, err = time.Parse("2006-01-02", from); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date format. Use YYYY-MM-DD"})
+			return
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if toDate, err = time.Parse("2006-01-02", to); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date format. Use YYYY-MM-DD"})
+			return
+		}
+		toDate = toDate.Add(24*time.Hour - time.Second)
+	}
+
+	var totals struct {
+		Abandoned          int64
+		Emailed            int64
+		Recovered          int64
+		Converted          int64
+		RecoveredConverted int64
+		AbandonedValue     money.Money
+	}
+	if err := database.DB.Model(&models.AbandonedCart{}).
+		Select(`COUNT(*) AS abandoned,
+			COUNT(email_sent_at) AS emailed,
+			COUNT(recovered_at) AS recovered,
+			COUNT(converted_at) AS converted,
+			COUNT(*) FILTER (WHERE recovered_at IS NOT NULL AND converted_at IS NOT NULL) AS recovered_converted,
+			COALESCE(SUM(cart_value), 0) AS abandoned_value`).
+		Where("created_at BETWEEN ? AND ?", fromDate, toDate).
+		Scan(&totals).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build abandoned cart report"})
+		return
+	}
+
+	// Revenue from orders placed after following a recovery link, in the base currency
+	var recoveredRevenue money.Money
+	if err := database.DB.Table("abandoned_carts").
+		Joins("JOIN orders ON orders.id = abandoned_carts.converted_order_id").
+		Where("abandoned_carts.deleted_at IS NULL AND abandoned_carts.recovered_at IS NOT NULL").
+		Where("abandoned_carts.created_at BETWEEN ? AND ?", fromDate, toDate).
+		Select("COALESCE(SUM(" + baseCurrencySQL("orders.total") + "), 0)").
+		Scan(&recoveredRevenue).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build abandoned cart report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":                fromDate.Format("2006-01-02"),
+		"to":                  toDate.Format("2006-01-02"),
+		"abandoned":           totals.Abandoned,
+		"emailed":             totals.Emailed,
+		"recovered":           totals.Recovered,
+		"converted":           totals.Converted,
+		"recovered_converted": totals.RecoveredConverted,
+		"email_rate":          percentOf(totals.Emailed, totals.Abandoned),
+		"recovery_rate":       percentOf(totals.Recovered, totals.Emailed),
+		"conversion_rate":     percentOf(totals.Converted, totals.Abandoned),
+		"recovery_conversion": percentOf(totals.RecoveredConverted, totals.Recovered),
+		"abandoned_value":     totals.AbandonedValue,
+		"recovered_revenue":   recoveredRevenue,
+		"currency":            pricing.BaseCurrencyCode(database.DB),
+	})
+}
+
+// percentOf returns part as a percentage of whole, or 0 when whole is 0
+func percentOf(part, whole int64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole) * 100
+}
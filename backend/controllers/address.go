@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"ecom-backend/database"
+	"ecom-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AddressRequest struct {
+	Label      string `json:"label"`
+	Address    string `json:"address" binding:"required"`
+	City       string `json:"city" binding:"required"`
+	State      string `json:"state"`
+	PostalCode string `json:"postal_code" binding:"required"`
+	Country    string `json:"country" binding:"required"`
+	Phone      string `json:"phone"`
+	IsDefault  bool   `json:"is_default"`
+}
+
+// GetAddresses returns the authenticated user's saved addresses, default first
+func GetAddresses(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var addresses []models.ShippingAddress
+	if err := database.DB.Where("user_id = ?", userID).
+		Order("is_default DESC, updated_at DESC").Find(&addresses).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch addresses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"addresses": addresses})
+}
+
+// CreateAddress saves a new address. The first address saved becomes the default.
+func CreateAddress(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var req AddressRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	address := models.ShippingAddress{
+		UserID:     userID.(uint),
+		Label:      req.Label,
+		Address:    req.Address,
+		City:       req.City,
+		State:      req.State,
+		PostalCode: req.PostalCode,
+		Country:    req.Country,
+		Phone:      req.Phone,
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.ShippingAddress{}).Where("user_id = ?", address.UserID).Count(&count).Error; err != nil {
+			return err
+		}
+		address.IsDefault = req.IsDefault || count == 0
+		if address.IsDefault {
+			if err := clearDefaultAddress(tx, address.UserID); err != nil {
+				return err
+			}
+		}
+		return tx.Create(&address).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save address"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Address saved", "address": address})
+}
+
+// UpdateAddress updates one of the authenticated user's addresses
+func UpdateAddress(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var req AddressRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var address models.ShippingAddress
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&address).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+		return
+	}
+
+	address.Label = req.Label
+	address.Address = req.Address
+	address.City = req.City
+	address.State = req.State
+	address.PostalCode = req.PostalCode
+	address.Country = req.Country
+	address.Phone = req.Phone
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Unsetting the default is done by choosing another default, so only promote here
+		if req.IsDefault && !address.IsDefault {
+			if err := clearDefaultAddress(tx, address.UserID); err != nil {
+				return err
+			}
+			address.IsDefault = true
+		}
+		return tx.Save(&address).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Address updated", "address": address})
+}
+
+// SetDefaultAddress makes one of the authenticated user's addresses their default
+func SetDefaultAddress(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var address models.ShippingAddress
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&address).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := clearDefaultAddress(tx, address.UserID); err != nil {
+			return err
+		}
+		address.IsDefault = true
+		return tx.Model(&address).Update("is_default", true).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update default address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Default address updated", "address": address})
+}
+
+// DeleteAddress deletes one of the authenticated user's addresses. If it was the default,
+// the most recently updated remaining address takes its place.
+func DeleteAddress(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var address models.ShippingAddress
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&address).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&address).Error; err != nil {
+			return err
+		}
+		if !address.IsDefault {
+			return nil
+		}
+
+		var next models.ShippingAddress
+		if err := tx.Where("user_id = ?", address.UserID).Order("updated_at DESC").First(&next).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil
+			}
+			return err
+		}
+		return tx.Model(&next).Update("is_default", true).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Address deleted"})
+}
+
+// clearDefaultAddress unsets the user's current default address
+func clearDefaultAddress(tx *gorm.DB, userID uint) error {
+	return tx.Model(&models.ShippingAddress{}).Where("user_id = ? AND is_default = ?", userID, true).
+		Update("is_default", false).Error
+}
+
+// loadSavedAddress loads a saved address for checkout, making sure it belongs to the customer
+func loadSavedAddress(userID *uint, addressID uint) (*models.ShippingAddress, error) {
+	if userID == nil {
+		return nil, errors.New("Sign in to use a saved address")
+	}
+	var address models.ShippingAddress
+	if err := database.DB.Where("id = ? AND user_id = ?", addressID, *userID).First(&address).Error; err != nil {
+		return nil, errors.New("Address not found")
+	}
+	return &address, nil
+}
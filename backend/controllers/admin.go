@@ -3,14 +3,17 @@ package controllers
 import (
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"ecom-backend/cache"
 	"ecom-backend/database"
 	"ecom-backend/models"
+	"ecom-backend/money"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // AdminDashboardStats returns dashboard statistics
@@ -19,7 +22,7 @@ func AdminDashboardStats(c *gin.Context) {
 		TotalUsers    int64   `json:"total_users"`
 		TotalProducts int64   `json:"total_products"`
 		TotalOrders   int64   `json:"total_orders"`
-		TotalRevenue  float64 `json:"total_revenue"`
+		TotalRevenue  money.Money `json:"total_revenue"`
 		PendingOrders int64   `json:"pending_orders"`
 		LowStockItems int64   `json:"low_stock_items"`
 	}
@@ -29,7 +32,7 @@ func AdminDashboardStats(c *gin.Context) {
 	database.DB.Model(&models.Order{}).Count(&stats.TotalOrders)
 	database.DB.Model(&models.Order{}).Where("status = ?", "pending").Count(&stats.PendingOrders)
 	database.DB.Model(&models.Product{}).Where("stock < ?", 10).Count(&stats.LowStockItems)
-	database.DB.Model(&models.Order{}).Select("COALESCE(SUM(total), 0)").Scan(&stats.TotalRevenue)
+	database.DB.Model(&models.Order{}).Select("COALESCE(SUM(" + baseCurrencySQL("total") + "), 0)").Scan(&stats.TotalRevenue)
 
 	c.JSON(http.StatusOK, stats)
 }
@@ -75,13 +78,13 @@ func GetCustomer(c *gin.Context) {
 
 	// Calculate stats
 	var ordersCount int64
-	var totalSpent float64
+	var totalSpent money.Money
 	database.DB.Model(&models.Order{}).
 		Where("user_id = ?", customer.ID).
 		Count(&ordersCount)
 	database.DB.Model(&models.Order{}).
 		Where("user_id = ?", customer.ID).
-		Select("COALESCE(SUM(total), 0)").
+		Select("COALESCE(SUM(" + baseCurrencySQL("total") + "), 0)").
 		Scan(&totalSpent)
 
 	c.JSON(http.StatusOK, gin.H{
@@ -184,7 +187,18 @@ func GetChats(c *gin.Context) {
 // GetAllOrders returns all orders (admin only)
 func GetAllOrders(c *gin.Context) {
 	var orders []models.Order
-	if err := database.DB.Preload("User").Preload("Items.Product").Order("created_at DESC").Find(&orders).Error; err != nil {
+	query := database.DB.Preload("User").Preload("Items.Product").Order("created_at DESC")
+
+	// Search by order number, order ID or guest contact details
+	if search := strings.TrimSpace(c.Query("search")); search != "" {
+		query = query.Where("order_number ILIKE ? OR id::text = ? OR guest_email ILIKE ? OR guest_name ILIKE ?",
+			"%"+search+"%", strings.TrimPrefix(search, "#"), "%"+search+"%", "%"+search+"%")
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Find(&orders).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
 		return
 	}
@@ -192,29 +206,45 @@ func GetAllOrders(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"orders": orders})
 }
 
-// UpdateOrderStatus updates order status
+// UpdateOrderStatus moves an order to a new status, enforcing the order state machine
 func UpdateOrderStatus(c *gin.Context) {
 	var req struct {
 		Status string `json:"status" binding:"required"`
+		Note   string `json:"note"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	orderID := c.Param("id")
+	if !isValidOrderStatus(req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+
 	var order models.Order
-	if err := database.DB.First(&order, orderID).Error; err != nil {
+	if err := orderByIDOrNumber(database.DB, c.Param("id")).First(&order).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
 	}
 
-	order.Status = req.Status
-	if err := database.DB.Save(&order).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order"})
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the order so a concurrent cancel or status change can't run the same side effects
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, order.ID).Error; err != nil {
+			return err
+		}
+		return transitionOrderStatus(tx, &order, req.Status, currentActorID(c), req.Note)
+	})
+	if err != nil {
+		respondOrderTransitionError(c, err)
 		return
 	}
 
+	if userID, exists := c.Get("userID"); exists {
+		LogAction(userID.(uint), "update_status", "order", order.ID, gin.H{"status": order.Status}, c)
+	}
+	settleOrderPayments(order)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Order status updated", "order": order})
 }
 
@@ -223,19 +253,33 @@ func CreateProduct(c *gin.Context) {
 	var req struct {
 		Name        string  `json:"name" binding:"required"`
 		Description string  `json:"description"`
-		Price       float64 `json:"price" binding:"required"`
+		Price       money.Money `json:"price" binding:"required"`
 		Image       string  `json:"image"`
 		Images      string  `json:"images"`
 		DisplayType string  `json:"display_type"`
 		SKU         string  `json:"sku"`
 		Stock       int     `json:"stock"`
+		InventoryPolicy string `json:"inventory_policy"` // deny (default), backorder or preorder
+		AvailableAt *time.Time `json:"available_at"`      // Required for pre-orders
 		CategoryID  uint    `json:"category_id" binding:"required"`
+		Weight      float64 `json:"weight"`
+		Length      float64 `json:"length"`
+		Width       float64 `json:"width"`
+		Height      float64 `json:"height"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	if req.InventoryPolicy == "" {
+		req.InventoryPolicy = models.InventoryPolicyDeny
+	}
+	if msg := validateInventoryPolicy(req.InventoryPolicy, req.AvailableAt); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
 	product := models.Product{
 		Name:        req.Name,
 		Description: req.Description,
@@ -245,7 +289,13 @@ func CreateProduct(c *gin.Context) {
 		DisplayType: req.DisplayType,
 		SKU:         req.SKU,
 		Stock:       req.Stock,
+		InventoryPolicy: req.InventoryPolicy,
+		AvailableAt: req.AvailableAt,
 		CategoryID:  req.CategoryID,
+		Weight:      req.Weight,
+		Length:      req.Length,
+		Width:       req.Width,
+		Height:      req.Height,
 	}
 	if product.DisplayType == "" {
 		product.DisplayType = "single"
@@ -281,14 +331,20 @@ func UpdateProduct(c *gin.Context) {
 	var req struct {
 		Name        string  `json:"name"`
 		Description string  `json:"description"`
-		Price       float64 `json:"price"`
+		Price       money.Money `json:"price"`
 		Image       string  `json:"image"`
 		Images      string  `json:"images"`
 		DisplayType string  `json:"display_type"`
 		SKU         string  `json:"sku"`
 		Stock       *int    `json:"stock"` // Use pointer to distinguish between 0 and not provided
 		PosStock    *int    `json:"pos_stock"` // Use pointer to distinguish between 0 and not provided
+		InventoryPolicy string `json:"inventory_policy"`
+		AvailableAt *time.Time `json:"available_at"`
 		CategoryID  uint    `json:"category_id"`
+		Weight      *float64 `json:"weight"`
+		Length      *float64 `json:"length"`
+		Width       *float64 `json:"width"`
+		Height      *float64 `json:"height"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -301,7 +357,7 @@ func UpdateProduct(c *gin.Context) {
 	if req.Description != "" {
 		product.Description = req.Description
 	}
-	if req.Price > 0 {
+	if req.Price.IsPositive() {
 		product.Price = req.Price
 	}
 	if req.Image != "" {
@@ -322,9 +378,33 @@ func UpdateProduct(c *gin.Context) {
 	if req.PosStock != nil {
 		product.PosStock = *req.PosStock
 	}
+	if req.InventoryPolicy != "" {
+		product.InventoryPolicy = req.InventoryPolicy
+	} else if product.InventoryPolicy == "" {
+		product.InventoryPolicy = models.InventoryPolicyDeny
+	}
+	if req.AvailableAt != nil {
+		product.AvailableAt = req.AvailableAt
+	}
+	if msg := validateInventoryPolicy(product.InventoryPolicy, product.AvailableAt); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
 	if req.CategoryID > 0 {
 		product.CategoryID = req.CategoryID
 	}
+	if req.Weight != nil {
+		product.Weight = *req.Weight
+	}
+	if req.Length != nil {
+		product.Length = *req.Length
+	}
+	if req.Width != nil {
+		product.Width = *req.Width
+	}
+	if req.Height != nil {
+		product.Height = *req.Height
+	}
 
 	if err := database.DB.Save(&product).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
@@ -391,13 +471,14 @@ func GetTopProducts(c *gin.Context) {
 		ProductID   uint    `json:"product_id"`
 		ProductName string  `json:"product_name"`
 		TotalSold   int64   `json:"total_sold"`
-		TotalRevenue float64 `json:"total_revenue"`
+		TotalRevenue money.Money `json:"total_revenue"`
 		Image       string  `json:"image"`
 	}
 
 	database.DB.Table("order_items").
-		Select("order_items.product_id, products.name as product_name, SUM(order_items.quantity) as total_sold, SUM(order_items.quantity * order_items.price) as total_revenue, products.image").
+		Select("order_items.product_id, products.name as product_name, SUM(order_items.quantity) as total_sold, SUM(" + baseCurrencySQL("order_items.quantity * order_items.price") + ") as total_revenue, products.image").
 		Joins("JOIN products ON products.id = order_items.product_id").
+		Joins("JOIN orders ON orders.id = order_items.order_id").
 		Group("order_items.product_id, products.name, products.image").
 		Order("total_sold DESC").
 		Limit(5).
@@ -431,12 +512,12 @@ func GetSalesChartData(c *gin.Context) {
 	
 	var salesData []struct {
 		Date  string  `json:"date"`
-		Sales float64 `json:"sales"`
+		Sales money.Money `json:"sales"`
 	}
 
 	// Group by date and sum total
 	database.DB.Model(&models.Order{}).
-		Select("DATE(created_at) as date, COALESCE(SUM(total), 0) as sales").
+		Select("DATE(created_at) as date, COALESCE(SUM(" + baseCurrencySQL("total") + "), 0) as sales").
 		Where("created_at >= ?", startDate).
 		Group("DATE(created_at)").
 		Order("date ASC").
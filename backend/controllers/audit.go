@@ -14,6 +14,14 @@ import (
 
 // LogAction logs an audit action
 func LogAction(userID uint, action, entityType string, entityID uint, changes interface{}, c *gin.Context) {
+	// Secret settings never reach the audit log
+	switch values := changes.(type) {
+	case gin.H:
+		changes = database.RedactSecrets(values)
+	case map[string]interface{}:
+		changes = database.RedactSecrets(values)
+	}
+
 	var changesJSON []byte
 	var err error
 	if changes != nil {
@@ -68,7 +68,7 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
+	response := gin.H{
 		"message": "User created successfully",
 		"token":   token,
 		"user": gin.H{
@@ -77,7 +77,12 @@ func Register(c *gin.Context) {
 			"name":  user.Name,
 			"role":  user.Role,
 		},
-	})
+		"claimable_guest_orders": countClaimableGuestOrders(user.Email), // Claim with POST /api/orders/claim and the lookup token
+	}
+	if merge := mergeGuestCart(c, user.ID); merge != nil {
+		response["cart_merge"] = merge
+	}
+	c.JSON(http.StatusCreated, response)
 }
 
 func Login(c *gin.Context) {
@@ -108,7 +113,7 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"message": "Login successful",
 		"token":   token,
 		"user": gin.H{
@@ -117,7 +122,11 @@ func Login(c *gin.Context) {
 			"name":  user.Name,
 			"role":  user.Role, // Include role in response
 		},
-	})
+	}
+	if merge := mergeGuestCart(c, user.ID); merge != nil {
+		response["cart_merge"] = merge
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func GetProfile(c *gin.Context) {
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"ecom-backend/database"
+	"ecom-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// claimAvailableStock takes up to quantity units from a product's website stock and its
+// selected options' stock, never taking any of them below zero or taking units reserved for
+// unpaid orders. Rows are locked so concurrent checkouts and allocations see each other's
+// claims. It returns the units taken.
+func claimAvailableStock(tx *gorm.DB, productID uint, options []models.VariationOption, quantity int) (int, error) {
+	var product models.Product
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "stock").First(&product, productID).Error; err != nil {
+		return 0, err
+	}
+	reserved, err := reservedProductStock(tx, productID)
+	if err != nil {
+		return 0, err
+	}
+	available := min(quantity, product.Stock-reserved)
+
+	for _, option := range options {
+		var locked models.VariationOption
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "stock").First(&locked, option.ID).Error; err != nil {
+			return 0, err
+		}
+		reserved, err := reservedOptionStock(tx, option.ID)
+		if err != nil {
+			return 0, err
+		}
+		available = min(available, locked.Stock-reserved)
+	}
+	if available <= 0 {
+		return 0, nil
+	}
+
+	if err := deductProductStock(tx, productID, "website", available); err != nil {
+		return 0, err
+	}
+	for _, option := range options {
+		if err := deductOptionStock(tx, option.ID, available); err != nil {
+			return 0, err
+		}
+	}
+	return available, nil
+}
+
+// allocateBackorders fills waiting backordered order items for a product from its website
+// stock, oldest order first. It returns the IDs of orders that received stock.
+func allocateBackorders(tx *gorm.DB, productID uint) ([]uint, error) {
+	var items []models.OrderItem
+	if err := tx.Joins("JOIN orders ON orders.id = order_items.order_id AND orders.deleted_at IS NULL").
+		Where("order_items.product_id = ? AND order_items.backordered_qty > 0", productID).
+		Where("orders.status NOT IN ?", []string{models.OrderStatusCancelled, models.OrderStatusRefunded}).
+		Order("orders.created_at ASC, order_items.id ASC").
+		Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	var orderIDs []uint
+	for _, item := range items {
+		options, err := lookupSelectedOptions(tx, productID, ParseVariations(item.Variations))
+		if err != nil {
+			return nil, err
+		}
+		allocated, err := claimAvailableStock(tx, productID, options, item.BackorderedQty)
+		if err != nil {
+			return nil, err
+		}
+		if allocated == 0 {
+			// Product stock may be exhausted, or only this item's option is short
+			continue
+		}
+
+		if err := tx.Model(&models.OrderItem{}).Where("id = ?", item.ID).
+			Update("backordered_qty", gorm.Expr("backordered_qty - ?", allocated)).Error; err != nil {
+			return nil, err
+		}
+		if len(orderIDs) == 0 || orderIDs[len(orderIDs)-1] != item.OrderID {
+			orderIDs = append(orderIDs, item.OrderID)
+		}
+	}
+	return orderIDs, nil
+}
+
+// GetBackorderedOrders returns orders with items waiting on stock, oldest first (admin only)
+func GetBackorderedOrders(c *gin.Context) {
+	query := database.DB.Model(&models.Order{}).
+		Where("status NOT IN ?", []string{models.OrderStatusCancelled, models.OrderStatusRefunded}).
+		Where("EXISTS (SELECT 1 FROM order_items WHERE order_items.order_id = orders.id AND order_items.backordered_qty > 0 AND order_items.deleted_at IS NULL)")
+	if productID := c.Query("product_id"); productID != "" {
+		query = query.Where("EXISTS (SELECT 1 FROM order_items WHERE order_items.order_id = orders.id AND order_items.backordered_qty > 0 AND order_items.product_id = ?)", productID)
+	}
+	if c.Query("preorder") == "true" {
+		query = query.Where("EXISTS (SELECT 1 FROM order_items WHERE order_items.order_id = orders.id AND order_items.backordered_qty > 0 AND order_items.is_preorder = ?)", true)
+	}
+
+	var orders []models.Order
+	if err := query.Preload("User").Preload("Items", "backordered_qty > 0").Preload("Items.Product").
+		Order("created_at ASC").Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch backordered orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"orders": orders})
+}
+
+// validateInventoryPolicy returns why a product's inventory policy can't be saved, or ""
+func validateInventoryPolicy(policy string, availableAt *time.Time) string {
+	if !models.ValidInventoryPolicy(policy) {
+		return "Inventory policy must be deny, backorder or preorder"
+	}
+	if policy == models.InventoryPolicyPreorder && availableAt == nil {
+		return "Pre-order products need an expected availability date"
+	}
+	return ""
+}
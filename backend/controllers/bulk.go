@@ -8,6 +8,8 @@ import (
 	"ecom-backend/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // BulkDeleteProducts deletes multiple products (admin only)
@@ -53,37 +55,53 @@ func BulkUpdateProductStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%d products updated", len(req.IDs))})
 }
 
-// BulkUpdateOrderStatus updates status for multiple orders (admin only)
+// BulkUpdateOrderStatus updates status for multiple orders (admin only).
+// Each order is moved through the state machine on its own; orders that can't make the
+// transition are reported back instead of failing the whole batch.
 func BulkUpdateOrderStatus(c *gin.Context) {
 	var req struct {
 		IDs    []uint `json:"ids" binding:"required"`
 		Status string `json:"status" binding:"required"`
+		Note   string `json:"note"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	validStatuses := []string{"pending", "processing", "shipped", "completed", "cancelled"}
-	isValid := false
-	for _, s := range validStatuses {
-		if req.Status == s {
-			isValid = true
-			break
-		}
-	}
-	if !isValid {
+	if !isValidOrderStatus(req.Status) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
 		return
 	}
 
-	if err := database.DB.Model(&models.Order{}).
-		Where("id IN ?", req.IDs).
-		Update("status", req.Status).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update orders"})
+	var orders []models.Order
+	if err := database.DB.Where("id IN ?", req.IDs).Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%d orders updated", len(req.IDs))})
-}
+	actorID := currentActorID(c)
+	updated := make([]uint, 0)
+	failed := make([]gin.H, 0)
+	for i := range orders {
+		order := &orders[i]
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(order, order.ID).Error; err != nil {
+				return err
+			}
+			return transitionOrderStatus(tx, order, req.Status, actorID, req.Note)
+		})
+		if err != nil {
+			failed = append(failed, gin.H{"id": order.ID, "status": order.Status, "error": err.Error()})
+			continue
+		}
+		updated = append(updated, order.ID)
+		settleOrderPayments(*order)
+	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("%d orders updated", len(updated)),
+		"updated": updated,
+		"failed":  failed,
+	})
+}
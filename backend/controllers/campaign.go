@@ -1,11 +1,13 @@
 package controllers
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
 	"ecom-backend/database"
 	"ecom-backend/models"
+	"ecom-backend/money"
 
 	"github.com/gin-gonic/gin"
 )
@@ -211,17 +213,21 @@ func GetCampaignStats(c *gin.Context) {
 	database.DB.Where("coupon_code = ? OR notes LIKE ?", campaign.Code, "%"+campaign.Code+"%").Find(&orders)
 
 	// Calculate unique visitors
-	uniqueUserIDs := make(map[uint]bool)
+	uniqueUserIDs := make(map[string]bool)
 	for _, order := range orders {
-		uniqueUserIDs[order.UserID] = true
+		if order.UserID != nil {
+			uniqueUserIDs[fmt.Sprint(*order.UserID)] = true
+		} else {
+			uniqueUserIDs["guest:"+order.GuestEmail] = true
+		}
 	}
 	uniqueVisitors := len(uniqueUserIDs)
 
 	// Calculate totals
 	totalOrders := len(orders)
-	totalRevenue := 0.0
+	var totalRevenue money.Money
 	for _, order := range orders {
-		totalRevenue += order.Total
+		totalRevenue = totalRevenue.Add(order.ExchangeRate.ToBase(order.Total))
 	}
 
 	// Mock cart additions (in real app, this would come from analytics)
@@ -1,13 +1,16 @@
 package controllers
 
 import (
-	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"ecom-backend/database"
 	"ecom-backend/models"
+	"ecom-backend/money"
+	"ecom-backend/pricing"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type AddToCartRequest struct {
@@ -17,26 +20,28 @@ type AddToCartRequest struct {
 }
 
 func GetCart(c *gin.Context) {
-	userID, _ := c.Get("userID")
+	owner, ok := currentCartOwner(c, false)
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"items": []models.Cart{}, "total": 0})
+		return
+	}
 
-	var cartItems []models.Cart
-	if err := database.DB.Preload("Product").Preload("Product.Category").
-		Where("user_id = ?", userID).Find(&cartItems).Error; err != nil {
+	cartItems, err := loadCart(database.DB, owner)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
 		return
 	}
 
-	var total float64
-	for _, item := range cartItems {
-		itemPrice := item.Product.Price
-		// Parse variations and apply price modifiers if any
-		if item.Variations != "" {
-			var variations map[string]string
-			json.Unmarshal([]byte(item.Variations), &variations)
-			// Note: Price modifiers would need to be fetched from variation options
-			// For now, we'll just use the base price
-		}
-		total += itemPrice * float64(item.Quantity)
+	products := make([]*models.Product, len(cartItems))
+	for i := range cartItems {
+		products[i] = &cartItems[i].Product
+	}
+	showAvailableStock(database.DB, products...)
+
+	var total money.Money
+	for i := range cartItems {
+		priceCartItem(database.DB, &cartItems[i])
+		total = total.Add(cartItems[i].LineTotal)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -45,8 +50,26 @@ func GetCart(c *gin.Context) {
 	})
 }
 
+// priceCartItem fills in a cart line's unit price (base price plus variation modifiers) and
+// flags lines whose selections are no longer valid or in stock
+func priceCartItem(db *gorm.DB, item *models.Cart) {
+	item.UnitPrice = item.Product.Price
+	resolved, err := pricing.ResolveVariations(db, item.ProductID, ParseVariations(item.Variations))
+	if err != nil {
+		item.Issue = err.Error()
+	} else {
+		item.UnitPrice = item.UnitPrice.Add(resolved.PriceModifier)
+		if err := resolved.CheckOptionStock(item.Quantity); err != nil && !item.Product.AllowsBackorder() {
+			item.Issue = err.Error()
+		}
+	}
+	if item.Product.Stock < item.Quantity && item.Issue == "" && !item.Product.AllowsBackorder() {
+		item.Issue = "Insufficient stock"
+	}
+	item.LineTotal = item.UnitPrice.Mul(item.Quantity)
+}
+
 func AddToCart(c *gin.Context) {
-	userID, _ := c.Get("userID")
 	var req AddToCartRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -60,62 +83,84 @@ func AddToCart(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
+	showAvailableStock(database.DB, &product)
 
-	// Check stock
-	if product.Stock < req.Quantity {
+	// Check stock, unless the product can be backordered or pre-ordered
+	if !product.AllowsBackorder() && product.Stock < req.Quantity {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient stock"})
 		return
 	}
 
-	// Serialize variations to JSON string
-	variationsJSON := ""
-	if req.Variations != nil && len(req.Variations) > 0 {
-		variationsBytes, _ := json.Marshal(req.Variations)
-		variationsJSON = string(variationsBytes)
+	// Validate variation selections against the product's options
+	resolved, err := pricing.ResolveVariations(database.DB, product.ID, req.Variations)
+	if err != nil {
+		if _, ok := err.(*pricing.SelectionError); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate variations"})
+		return
+	}
+
+	owner, ok := currentCartOwner(c, true)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start cart"})
+		return
 	}
 
+	// Serialize canonical selections so equivalent choices land on the same cart line
+	variationsJSON := SerializeVariations(resolved.Selections)
+
 	// Check if item with same variations already in cart
-	var existingCart models.Cart
-	query := database.DB.Where("user_id = ? AND product_id = ?", userID, req.ProductID)
-	if variationsJSON != "" {
-		query = query.Where("variations = ?", variationsJSON)
-	} else {
-		query = query.Where("variations IS NULL OR variations = ''")
+	existingCart, exists, err := findCartLine(database.DB, owner, req.ProductID, variationsJSON)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
+		return
 	}
-	
-	if err := query.First(&existingCart).Error; err == nil {
+	if exists {
 		// Update quantity
 		newQuantity := existingCart.Quantity + req.Quantity
-		if newQuantity > product.Stock {
+		if !product.AllowsBackorder() && newQuantity > product.Stock {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient stock"})
 			return
 		}
+		if err := resolved.CheckOptionStock(newQuantity); err != nil && !product.AllowsBackorder() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		existingCart.Quantity = newQuantity
-		database.DB.Save(&existingCart)
+		if err := saveCartLine(database.DB, owner, &existingCart); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart"})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{"message": "Cart updated", "cart": existingCart})
 		return
 	}
 
+	if err := resolved.CheckOptionStock(req.Quantity); err != nil && !product.AllowsBackorder() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Create new cart item
 	cartItem := models.Cart{
-		UserID:     userID.(uint),
 		ProductID:  req.ProductID,
 		Quantity:   req.Quantity,
 		Variations: variationsJSON,
 	}
 
-	if err := database.DB.Create(&cartItem).Error; err != nil {
+	if err := saveCartLine(database.DB, owner, &cartItem); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add to cart"})
 		return
 	}
 
-	database.DB.Preload("Product").First(&cartItem, cartItem.ID)
+	cartItem.Product = product
+	priceCartItem(database.DB, &cartItem)
 	c.JSON(http.StatusCreated, gin.H{"message": "Added to cart", "cart": cartItem})
 }
 
 func UpdateCartItem(c *gin.Context) {
-	userID, _ := c.Get("userID")
-	id := c.Param("id")
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
 	var req struct {
 		Quantity int `json:"quantity" binding:"required,min=1"`
 	}
@@ -125,32 +170,54 @@ func UpdateCartItem(c *gin.Context) {
 		return
 	}
 
-	var cartItem models.Cart
-	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&cartItem).Error; err != nil {
+	owner, ok := currentCartOwner(c, false)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart item not found"})
+		return
+	}
+
+	cartItem, err := findCartLineByID(database.DB, owner, uint(id))
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Cart item not found"})
 		return
 	}
 
-	// Check stock
+	// Check stock, unless the product can be backordered or pre-ordered
 	var product models.Product
 	database.DB.First(&product, cartItem.ProductID)
-	if product.Stock < req.Quantity {
+	showAvailableStock(database.DB, &product)
+	if !product.AllowsBackorder() && product.Stock < req.Quantity {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient stock"})
 		return
 	}
+	if resolved, err := pricing.ResolveVariations(database.DB, product.ID, ParseVariations(cartItem.Variations)); err == nil && !product.AllowsBackorder() {
+		if err := resolved.CheckOptionStock(req.Quantity); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	cartItem.Quantity = req.Quantity
-	database.DB.Save(&cartItem)
+	if err := saveCartLine(database.DB, owner, &cartItem); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart"})
+		return
+	}
 
-	database.DB.Preload("Product").First(&cartItem, cartItem.ID)
+	cartItem.Product = product
+	priceCartItem(database.DB, &cartItem)
 	c.JSON(http.StatusOK, gin.H{"message": "Cart updated", "cart": cartItem})
 }
 
 func RemoveFromCart(c *gin.Context) {
-	userID, _ := c.Get("userID")
-	id := c.Param("id")
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
 
-	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Cart{}).Error; err != nil {
+	owner, ok := currentCartOwner(c, false)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart item not found"})
+		return
+	}
+
+	if err := deleteCartLine(database.DB, owner, uint(id)); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Cart item not found"})
 		return
 	}
@@ -159,9 +226,13 @@ func RemoveFromCart(c *gin.Context) {
 }
 
 func ClearCart(c *gin.Context) {
-	userID, _ := c.Get("userID")
+	owner, ok := currentCartOwner(c, false)
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"message": "Cart cleared"})
+		return
+	}
 
-	if err := database.DB.Where("user_id = ?", userID).Delete(&models.Cart{}).Error; err != nil {
+	if err := clearCart(database.DB, owner); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear cart"})
 		return
 	}
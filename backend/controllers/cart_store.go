@@ -0,0 +1,282 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"ecom-backend/cache"
+	"ecom-backend/config"
+	"ecom-backend/models"
+	"ecom-backend/pricing"
+	"ecom-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// cartTokenCookie carries the signed guest cart token for browsers
+const cartTokenCookie = utils.CartTokenCookie
+
+// Reasons a past order line or guest cart line couldn't be copied into a cart in full
+const (
+	cartLineProductUnavailable = "product_unavailable"
+	cartLineOptionUnavailable  = "option_unavailable"
+	cartLineOutOfStock         = "out_of_stock"
+	cartLineQuantityReduced    = "quantity_reduced"
+)
+
+// cached reports whether the owner's cart is kept in Redis. Guest carts are while Redis is
+// up; user carts, and guest carts when Redis is down, are carts rows.
+func (o cartOwner) cached() bool {
+	return o.UserID == nil && cache.GuestCartsAvailable()
+}
+
+// loadCart returns the owner's cart lines with their products and categories loaded
+func loadCart(db *gorm.DB, owner cartOwner) ([]models.Cart, error) {
+	var items []models.Cart
+	if !owner.cached() {
+		err := owner.scope(db.Preload("Product").Preload("Product.Category")).Order("id ASC").Find(&items).Error
+		return items, err
+	}
+
+	cart, err := cache.GetGuestCart(owner.GuestID)
+	if err != nil {
+		return nil, err
+	}
+	productIDs := make([]uint, 0, len(cart.Items))
+	for _, line := range cart.Items {
+		items = append(items, guestCartLine(owner, line))
+		productIDs = append(productIDs, line.ProductID)
+	}
+	if len(productIDs) == 0 {
+		return items, nil
+	}
+
+	var products []models.Product
+	if err := db.Preload("Category").Where("id IN ?", productIDs).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Product, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+	}
+	for i := range items {
+		items[i].Product = byID[items[i].ProductID]
+	}
+	return items, nil
+}
+
+// findCartLine returns the owner's cart line for a product with the given serialized
+// variations, reporting false when the cart doesn't hold it
+func findCartLine(db *gorm.DB, owner cartOwner, productID uint, variationsJSON string) (models.Cart, bool, error) {
+	if !owner.cached() {
+		var line models.Cart
+		query := owner.scope(db).Where("product_id = ?", productID)
+		if variationsJSON != "" {
+			query = query.Where("variations = ?", variationsJSON)
+		} else {
+			query = query.Where("variations IS NULL OR variations = ''")
+		}
+		if err := query.First(&line).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return models.Cart{}, false, nil
+			}
+			return models.Cart{}, false, err
+		}
+		return line, true, nil
+	}
+
+	cart, err := cache.GetGuestCart(owner.GuestID)
+	if err != nil {
+		return models.Cart{}, false, err
+	}
+	for _, line := range cart.Items {
+		if line.ProductID == productID && line.Variations == variationsJSON {
+			return guestCartLine(owner, line), true, nil
+		}
+	}
+	return models.Cart{}, false, nil
+}
+
+// findCartLineByID returns one of the owner's cart lines, or gorm.ErrRecordNotFound
+func findCartLineByID(db *gorm.DB, owner cartOwner, id uint) (models.Cart, error) {
+	if !owner.cached() {
+		var line models.Cart
+		err := owner.scope(db).Where("id = ?", id).First(&line).Error
+		return line, err
+	}
+
+	cart, err := cache.GetGuestCart(owner.GuestID)
+	if err != nil {
+		return models.Cart{}, err
+	}
+	for _, line := range cart.Items {
+		if line.ID == id {
+			return guestCartLine(owner, line), nil
+		}
+	}
+	return models.Cart{}, gorm.ErrRecordNotFound
+}
+
+// saveCartLine adds a new line (ID 0) to the owner's cart or updates an existing one's
+// quantity and variations
+func saveCartLine(db *gorm.DB, owner cartOwner, line *models.Cart) error {
+	line.UserID, line.GuestID = owner.UserID, owner.GuestID
+	if !owner.cached() {
+		if line.ID == 0 {
+			return db.Create(line).Error
+		}
+		return db.Save(line).Error
+	}
+
+	now := time.Now()
+	return cache.UpdateGuestCart(owner.GuestID, func(cart *cache.GuestCart) error {
+		if line.ID == 0 {
+			cart.NextID++
+			line.ID, line.CreatedAt, line.UpdatedAt = cart.NextID, now, now
+			cart.Items = append(cart.Items, cache.GuestCartItem{
+				ID:         line.ID,
+				ProductID:  line.ProductID,
+				Quantity:   line.Quantity,
+				Variations: line.Variations,
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			})
+			return nil
+		}
+		for i := range cart.Items {
+			if cart.Items[i].ID == line.ID {
+				cart.Items[i].Quantity = line.Quantity
+				cart.Items[i].Variations = line.Variations
+				cart.Items[i].UpdatedAt = now
+				line.UpdatedAt = now
+				return nil
+			}
+		}
+		return gorm.ErrRecordNotFound
+	})
+}
+
+// deleteCartLine removes one line from the owner's cart
+func deleteCartLine(db *gorm.DB, owner cartOwner, id uint) error {
+	if !owner.cached() {
+		return owner.scope(db).Where("id = ?", id).Delete(&models.Cart{}).Error
+	}
+	return cache.UpdateGuestCart(owner.GuestID, func(cart *cache.GuestCart) error {
+		for i := range cart.Items {
+			if cart.Items[i].ID == id {
+				cart.Items = append(cart.Items[:i], cart.Items[i+1:]...)
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// clearCart empties the owner's cart. Cached guest carts are cleared straight away, outside
+// any transaction db belongs to, so callers clear the cart as their last step.
+func clearCart(db *gorm.DB, owner cartOwner) error {
+	if !owner.cached() {
+		return owner.scope(db).Delete(&models.Cart{}).Error
+	}
+	return cache.DeleteGuestCart(owner.GuestID)
+}
+
+// addableQuantity returns how many of wanted units can be added to a cart line already
+// holding inCart units, limited by product and option stock unless the product takes backorders
+func addableQuantity(product models.Product, resolved *pricing.Variations, inCart, wanted int) int {
+	if product.AllowsBackorder() {
+		return wanted
+	}
+	available := product.Stock
+	for _, option := range resolved.Options {
+		available = min(available, option.Stock)
+	}
+	return min(wanted, available-inCart)
+}
+
+// cartLineAddition is the outcome of adding a product to a cart with addCartLine. Resolved
+// is nil when the selected options no longer resolve; Reason and Message are set when fewer
+// units than wanted were added.
+type cartLineAddition struct {
+	Resolved *pricing.Variations
+	Quantity int
+	Reason   string
+	Message  string
+}
+
+// addCartLine adds up to wanted units of product with the selected options to the owner's
+// cart, adding to a matching line when there is one. The quantity is limited by product and
+// option stock unless the product takes backorders.
+func addCartLine(tx *gorm.DB, owner cartOwner, product models.Product, selections map[string]string, wanted int) (cartLineAddition, error) {
+	var result cartLineAddition
+	resolved, err := pricing.ResolveVariations(tx, product.ID, selections)
+	if err != nil {
+		if _, ok := err.(*pricing.SelectionError); ok {
+			result.Reason, result.Message = cartLineOptionUnavailable, err.Error()
+			return result, nil
+		}
+		return result, err
+	}
+	result.Resolved = resolved
+
+	variationsJSON := SerializeVariations(resolved.Selections)
+	existing, exists, err := findCartLine(tx, owner, product.ID, variationsJSON)
+	if err != nil {
+		return result, err
+	}
+	quantity := addableQuantity(product, resolved, existing.Quantity, wanted)
+	if quantity <= 0 {
+		result.Reason, result.Message = cartLineOutOfStock, "Out of stock"
+		return result, nil
+	}
+	if quantity < wanted {
+		result.Reason = cartLineQuantityReduced
+		result.Message = fmt.Sprintf("Only %d more in stock", quantity)
+	}
+
+	if exists {
+		existing.Quantity += quantity
+		err = saveCartLine(tx, owner, &existing)
+	} else {
+		err = saveCartLine(tx, owner, &models.Cart{
+			ProductID:  product.ID,
+			Quantity:   quantity,
+			Variations: variationsJSON,
+		})
+	}
+	if err != nil {
+		return result, err
+	}
+	result.Quantity = quantity
+	return result, nil
+}
+
+// guestCartLine turns a cached guest cart line into a cart row
+func guestCartLine(owner cartOwner, line cache.GuestCartItem) models.Cart {
+	return models.Cart{
+		ID:         line.ID,
+		GuestID:    owner.GuestID,
+		ProductID:  line.ProductID,
+		Quantity:   line.Quantity,
+		Variations: line.Variations,
+		CreatedAt:  line.CreatedAt,
+		UpdatedAt:  line.UpdatedAt,
+	}
+}
+
+// setCartToken sends a guest's signed cart token in the X-Cart-Token header and in a cookie
+func setCartToken(c *gin.Context, guestID string) string {
+	token := utils.GenerateCartToken(guestID, config.LoadConfig().JWTSecret)
+	c.Header("X-Cart-Token", token)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(cartTokenCookie, token, int(cache.GuestCartDuration.Seconds()), "/", "", c.Request.TLS != nil, true)
+	return token
+}
+
+// clearCartToken tells the browser to forget its guest cart token
+func clearCartToken(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(cartTokenCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+}
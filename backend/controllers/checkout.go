@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"net/http"
+
+	"ecom-backend/database"
+	"ecom-backend/models"
+	"ecom-backend/pricing"
+	"ecom-backend/shipping"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CheckoutQuoteRequest struct {
+	AddressID        uint   `json:"address_id"` // Saved address to quote shipping and tax for
+	City             string `json:"city"`
+	State            string `json:"state"`
+	PostalCode       string `json:"postal_code"`
+	Country          string `json:"country"`
+	CouponCode       string `json:"coupon_code"`
+	ShippingMethodID uint   `json:"shipping_method_id"`
+	Currency         string `json:"currency"`
+	// Items to price instead of the cart, e.g. for a "buy now" button
+	Items []struct {
+		ProductID  uint              `json:"product_id" binding:"required"`
+		Quantity   int               `json:"quantity" binding:"required,min=1"`
+		Variations map[string]string `json:"variations"`
+	} `json:"items"`
+}
+
+// GetCheckoutQuote returns the itemised total the customer will be charged for their cart
+func GetCheckoutQuote(c *gin.Context) {
+	var req CheckoutQuoteRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.AddressID != 0 {
+		owner, _ := currentCartOwner(c, false)
+		saved, err := loadSavedAddress(owner.UserID, req.AddressID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.City, req.State, req.PostalCode, req.Country = saved.City, saved.State, saved.PostalCode, saved.Country
+	}
+
+	var lines []pricing.Line
+	if len(req.Items) > 0 {
+		for _, item := range req.Items {
+			var product models.Product
+			if err := database.DB.First(&product, item.ProductID).Error; err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+				return
+			}
+			lines = append(lines, pricing.Line{Product: product, Quantity: item.Quantity, Variations: item.Variations})
+		}
+	} else {
+		var cartItems []models.Cart
+		if owner, ok := currentCartOwner(c, false); ok {
+			var err error
+			if cartItems, err = loadCart(database.DB, owner); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
+				return
+			}
+		}
+		if len(cartItems) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty"})
+			return
+		}
+		for _, item := range cartItems {
+			lines = append(lines, pricing.Line{Product: item.Product, Quantity: item.Quantity, Variations: ParseVariations(item.Variations)})
+		}
+	}
+
+	currency, rate, err := pricing.ResolveCurrency(database.DB, req.Currency)
+	if err != nil {
+		respondPricingError(c, err)
+		return
+	}
+	quote, err := pricing.Calculate(database.DB, pricing.Request{
+		Lines:            lines,
+		CouponCode:       req.CouponCode,
+		Destination:      shipping.Destination{Country: req.Country, Region: req.State, City: req.City, PostalCode: req.PostalCode},
+		ShippingMethodID: req.ShippingMethodID,
+		Currency:         currency,
+		ExchangeRate:     rate,
+	})
+	if err != nil {
+		respondPricingError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"quote": quote})
+}
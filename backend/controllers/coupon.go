@@ -6,6 +6,7 @@ import (
 
 	"ecom-backend/database"
 	"ecom-backend/models"
+	"ecom-backend/money"
 
 	"github.com/gin-gonic/gin"
 )
@@ -40,9 +41,9 @@ func CreateCoupon(c *gin.Context) {
 	var req struct {
 		Code        string  `json:"code" binding:"required"`
 		Type        string  `json:"type" binding:"required"`
-		Value       float64 `json:"value" binding:"required"`
-		MinPurchase float64 `json:"min_purchase"`
-		MaxDiscount float64 `json:"max_discount"`
+		Value       money.Money `json:"value" binding:"required"`
+		MinPurchase money.Money `json:"min_purchase"`
+		MaxDiscount money.Money `json:"max_discount"`
 		UsageLimit  int     `json:"usage_limit"`
 		ValidFrom   string  `json:"valid_from" binding:"required"`
 		ValidUntil  string  `json:"valid_until" binding:"required"`
@@ -104,9 +105,9 @@ func UpdateCoupon(c *gin.Context) {
 	var req struct {
 		Code        string  `json:"code"`
 		Type        string  `json:"type"`
-		Value       float64 `json:"value"`
-		MinPurchase float64 `json:"min_purchase"`
-		MaxDiscount float64 `json:"max_discount"`
+		Value       money.Money `json:"value"`
+		MinPurchase money.Money `json:"min_purchase"`
+		MaxDiscount money.Money `json:"max_discount"`
 		UsageLimit  int     `json:"usage_limit"`
 		ValidFrom   string  `json:"valid_from"`
 		ValidUntil  string  `json:"valid_until"`
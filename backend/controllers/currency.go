@@ -0,0 +1,310 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"ecom-backend/database"
+	"ecom-backend/models"
+	"ecom-backend/money"
+	"ecom-backend/pricing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CurrencyRequest struct {
+	Code         string             `json:"code"`
+	Name         string             `json:"name"`
+	Symbol       string             `json:"symbol"`
+	Decimals     *int               `json:"decimals"`
+	ExchangeRate money.ExchangeRate `json:"exchange_rate"`
+	IsActive     *bool              `json:"is_active"`
+}
+
+// GetActiveCurrencies returns the currencies customers can shop in (public)
+func GetActiveCurrencies(c *gin.Context) {
+	var currencies []models.Currency
+	if err := database.DB.Where("is_active = ?", true).Order("code ASC").Find(&currencies).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch currencies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"base_currency": pricing.BaseCurrencyCode(database.DB),
+		"currencies":    currencies,
+	})
+}
+
+// GetCurrencies returns all currencies (admin only)
+func GetCurrencies(c *gin.Context) {
+	var currencies []models.Currency
+	if err := database.DB.Order("code ASC").Find(&currencies).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch currencies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"base_currency": pricing.BaseCurrencyCode(database.DB),
+		"currencies":    currencies,
+	})
+}
+
+// CreateCurrency adds a currency with its exchange rate (admin only)
+func CreateCurrency(c *gin.Context) {
+	var req CurrencyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	currency, exists := findCurrency(req.Code)
+	if exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Currency already exists"})
+		return
+	}
+	applyCurrencyRequest(&currency, req)
+	if msg := validateCurrency(currency); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := database.DB.Unscoped().Save(&currency).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create currency"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, currency)
+}
+
+// UpdateCurrency updates a currency's details or exchange rate (admin only)
+func UpdateCurrency(c *gin.Context) {
+	var currency models.Currency
+	if err := database.DB.First(&currency, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Currency not found"})
+		return
+	}
+
+	var req CurrencyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Code = "" // The code identifies the currency on past orders and can't change
+	applyCurrencyRequest(&currency, req)
+	if msg := validateCurrency(currency); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := database.DB.Save(&currency).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update currency"})
+		return
+	}
+
+	c.JSON(http.StatusOK, currency)
+}
+
+// DeleteCurrency removes a currency; orders already placed in it keep their currency (admin only)
+func DeleteCurrency(c *gin.Context) {
+	var currency models.Currency
+	if err := database.DB.First(&currency, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Currency not found"})
+		return
+	}
+	if currency.Code == pricing.BaseCurrencyCode(database.DB) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The base currency can't be deleted"})
+		return
+	}
+
+	if err := database.DB.Delete(&currency).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete currency"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Currency deleted successfully"})
+}
+
+// ImportExchangeRates updates exchange rates from a CSV file with "code,rate" rows; unknown
+// codes are added as new currencies (admin only)
+func ImportExchangeRates(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file provided"})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
+		return
+	}
+	defer src.Close()
+
+	reader := csv.NewReader(src)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse CSV"})
+		return
+	}
+
+	var updated, created int
+	var errors []string
+	for i, record := range records {
+		if len(record) < 2 {
+			errors = append(errors, fmt.Sprintf("Row %d: insufficient columns", i+1))
+			continue
+		}
+		code := strings.ToUpper(strings.TrimSpace(record[0]))
+		rate, err := money.ParseExchangeRate(record[1])
+		if err != nil {
+			// Skip a header row such as "code,rate"
+			if i == 0 {
+				continue
+			}
+			errors = append(errors, fmt.Sprintf("Row %d: invalid exchange rate %q", i+1, record[1]))
+			continue
+		}
+
+		currency, exists := findCurrency(code)
+		isNew := !exists
+		if currency.Name == "" {
+			currency.Name = code
+		}
+		currency.ExchangeRate = rate
+		if msg := validateCurrency(currency); msg != "" {
+			errors = append(errors, fmt.Sprintf("Row %d: %s", i+1, msg))
+			continue
+		}
+
+		if err := database.DB.Unscoped().Save(&currency).Error; err != nil {
+			errors = append(errors, fmt.Sprintf("Row %d: %s", i+1, err.Error()))
+			continue
+		}
+		if isNew {
+			created++
+		} else {
+			updated++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Updated %d exchange rates, added %d currencies", updated, created),
+		"updated": updated,
+		"created": created,
+		"errors":  errors,
+	})
+}
+
+// findCurrency loads a currency by code. When it doesn't exist it returns a new one with the
+// code's known symbol and decimals, reusing the row of a deleted currency so the code stays unique.
+func findCurrency(code string) (models.Currency, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	var currency models.Currency
+	if err := database.DB.Unscoped().Where("code = ?", code).First(&currency).Error; err == nil && !currency.DeletedAt.Valid {
+		return currency, true
+	}
+
+	currency = models.Currency{ID: currency.ID, CreatedAt: currency.CreatedAt, Code: code, Symbol: code + " ", Decimals: money.Scale, IsActive: true}
+	if rules, ok := money.LookupCurrency(code); ok {
+		currency.Symbol = rules.Symbol
+		currency.Decimals = rules.Decimals
+	}
+	return currency, false
+}
+
+// applyCurrencyRequest copies the fields set in a request onto a currency
+func applyCurrencyRequest(currency *models.Currency, req CurrencyRequest) {
+	if req.Code != "" {
+		currency.Code = strings.ToUpper(strings.TrimSpace(req.Code))
+	}
+	if req.Name != "" {
+		currency.Name = req.Name
+	}
+	if req.Symbol != "" {
+		currency.Symbol = req.Symbol
+	}
+	if req.Decimals != nil {
+		currency.Decimals = *req.Decimals
+	}
+	if req.ExchangeRate != 0 {
+		currency.ExchangeRate = req.ExchangeRate
+	}
+	if req.IsActive != nil {
+		currency.IsActive = *req.IsActive
+	}
+}
+
+// validateCurrency returns why a currency can't be saved, or "" if it can
+func validateCurrency(currency models.Currency) string {
+	switch {
+	case len(currency.Code) != 3:
+		return "Currency code must be a 3-letter ISO code"
+	case currency.Symbol == "":
+		return "Currency symbol is required"
+	case currency.Decimals < 0 || currency.Decimals > money.Scale:
+		return "Currency decimals must be between 0 and " + strconv.Itoa(money.Scale)
+	case !currency.ExchangeRate.IsPositive():
+		return "Exchange rate must be greater than 0"
+	}
+	return ""
+}
+
+// orderCurrency returns the rules for formatting an order's amounts in the currency it was
+// placed in, including currencies that have since been disabled or deleted
+func orderCurrency(order models.Order) money.Currency {
+	if order.Currency != "" {
+		var currency models.Currency
+		if err := database.DB.Unscoped().Where("code = ?", order.Currency).First(&currency).Error; err == nil {
+			return currency.Rules()
+		}
+		if rules, ok := money.LookupCurrency(order.Currency); ok {
+			return rules
+		}
+	}
+	base, err := pricing.BaseCurrency(database.DB)
+	if err != nil {
+		return money.DefaultCurrency
+	}
+	return base
+}
+
+// displayCurrency resolves the currency query parameter used to show prices in a customer's
+// currency. It reports false after responding with an error for unsupported currencies.
+func displayCurrency(c *gin.Context) (money.Currency, money.ExchangeRate, bool) {
+	currency, rate, err := pricing.ResolveCurrency(database.DB, c.Query("currency"))
+	if err != nil {
+		respondPricingError(c, err)
+		return money.Currency{}, 0, false
+	}
+	return currency, rate, true
+}
+
+// convertProductPrices converts product prices and variation price modifiers from the base
+// currency for display
+func convertProductPrices(products []models.Product, currency money.Currency, rate money.ExchangeRate) {
+	for i := range products {
+		convertProductPrice(&products[i], currency, rate)
+	}
+}
+
+// convertProductPrice converts one product's prices from the base currency for display
+func convertProductPrice(product *models.Product, currency money.Currency, rate money.ExchangeRate) {
+	product.Price = rate.Convert(product.Price, currency)
+	product.Currency = currency.Code
+	for i := range product.Variations {
+		for j := range product.Variations[i].Options {
+			option := &product.Variations[i].Options[j]
+			option.PriceModifier = rate.Convert(option.PriceModifier, currency)
+		}
+	}
+}
+
+// baseCurrencySQL converts an order amount column to the base currency in SQL, so revenue
+// across currencies can be summed. It expects the orders table's exchange_rate in scope.
+func baseCurrencySQL(amount string) string {
+	return "ROUND(" + amount + " / NULLIF(exchange_rate, 0), 2)"
+}
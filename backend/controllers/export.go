@@ -9,6 +9,7 @@ import (
 
 	"ecom-backend/database"
 	"ecom-backend/models"
+	"ecom-backend/money"
 
 	"github.com/gin-gonic/gin"
 )
@@ -43,8 +44,8 @@ func ExportOrdersCSV(c *gin.Context) {
 
 	// Write header - check error before committing status
 	if err := writer.Write([]string{
-		"Order ID", "Customer Name", "Customer Email", "Date", "Status",
-		"Total", "Address", "City", "Postal Code", "Country", "Items Count",
+		"Order ID", "Order Number", "Customer Name", "Customer Email", "Date", "Status",
+		"Total", "Currency", "Address", "City", "Postal Code", "Country", "Items Count",
 	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write CSV header"})
 		return
@@ -57,11 +58,13 @@ func ExportOrdersCSV(c *gin.Context) {
 	for _, order := range orders {
 		if err := writer.Write([]string{
 			strconv.Itoa(int(order.ID)),
-			order.User.Name,
-			order.User.Email,
+			order.OrderNumber,
+			orderCustomerName(order),
+			orderCustomerEmail(order),
 			order.CreatedAt.Format("2006-01-02 15:04:05"),
 			order.Status,
-			fmt.Sprintf("%.2f", order.Total),
+			order.Total.String(),
+			order.Currency,
 			order.Address,
 			order.City,
 			order.PostalCode,
@@ -102,9 +105,15 @@ func ExportOrdersPDF(c *gin.Context) {
 	html += "th,td{border:1px solid #ddd;padding:8px;text-align:left;}th{background-color:#f2f2f2;}</style></head><body>"
 	html += "<h1>Orders Report</h1><table><tr><th>Order ID</th><th>Customer</th><th>Date</th><th>Status</th><th>Total</th></tr>"
 
+	currencies := make(map[string]money.Currency)
 	for _, order := range orders {
-		html += fmt.Sprintf("<tr><td>#%d</td><td>%s</td><td>%s</td><td>%s</td><td>৳%.2f</td></tr>",
-			order.ID, order.User.Name, order.CreatedAt.Format("2006-01-02"), order.Status, order.Total)
+		currency, ok := currencies[order.Currency]
+		if !ok {
+			currency = orderCurrency(order)
+			currencies[order.Currency] = currency
+		}
+		html += fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>",
+			orderReference(order), orderCustomerName(order), order.CreatedAt.Format("2006-01-02"), order.Status, currency.Format(order.Total))
 	}
 
 	html += "</table></body></html>"
@@ -116,37 +125,41 @@ func ExportOrdersPDF(c *gin.Context) {
 
 // GenerateInvoice generates an invoice for an order (admin only)
 func GenerateInvoice(c *gin.Context) {
-	orderID := c.Param("id")
 	var order models.Order
 
-	if err := database.DB.Preload("User").Preload("Items.Product").
-		First(&order, orderID).Error; err != nil {
+	if err := orderByIDOrNumber(database.DB.Preload("User").Preload("Items.Product"), c.Param("id")).
+		First(&order).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
 	}
 
 	// Generate HTML invoice
-	html := "<!DOCTYPE html><html><head><title>Invoice #" + strconv.Itoa(int(order.ID)) + "</title>"
+	html := "<!DOCTYPE html><html><head><title>Invoice " + orderReference(order) + "</title>"
 	html += "<style>body{font-family:Arial;margin:40px;max-width:800px;}h1{color:#333;}"
 	html += "table{border-collapse:collapse;width:100%;margin:20px 0;}th,td{border:1px solid #ddd;padding:12px;}"
 	html += "th{background-color:#f2f2f2;}.total{font-size:18px;font-weight:bold;text-align:right;}"
 	html += ".header{display:flex;justify-content:space-between;margin-bottom:30px;}</style></head><body>"
 
-	html += "<div class='header'><div><h1>INVOICE</h1><p>Order #" + strconv.Itoa(int(order.ID)) + "</p></div>"
+	html += "<div class='header'><div><h1>INVOICE</h1><p>Order " + orderReference(order) + "</p></div>"
 	html += "<div><p><strong>Date:</strong> " + order.CreatedAt.Format("January 2, 2006") + "</p></div></div>"
 
-	html += "<div><h3>Bill To:</h3><p>" + order.User.Name + "<br>" + order.User.Email + "</p></div>"
+	html += "<div><h3>Bill To:</h3><p>" + orderCustomerName(order) + "<br>" + orderCustomerEmail(order) + "</p></div>"
 
 	html += "<div><h3>Shipping Address:</h3><p>" + order.Address + "<br>" + order.City + ", " + order.PostalCode + "<br>" + order.Country + "</p></div>"
 
+	currency := orderCurrency(order)
 	html += "<table><tr><th>Product</th><th>Quantity</th><th>Price</th><th>Total</th></tr>"
 	for _, item := range order.Items {
-		html += fmt.Sprintf("<tr><td>%s</td><td>%d</td><td>৳%.2f</td><td>৳%.2f</td></tr>",
-			item.Product.Name, item.Quantity, item.Price, item.Price*float64(item.Quantity))
+		html += fmt.Sprintf("<tr><td>%s</td><td>%d</td><td>%s</td><td>%s</td></tr>",
+			item.Product.Name, item.Quantity, currency.Format(item.Price), currency.Format(item.Price.Mul(item.Quantity)))
 	}
 	html += "</table>"
 
-	html += "<div class='total'><p>Total: ৳" + fmt.Sprintf("%.2f", order.Total) + "</p></div>"
+	if order.ShippingMethodName != "" {
+		html += fmt.Sprintf("<p><strong>Shipping Method:</strong> %s (%s)</p>", order.ShippingMethodName, currency.Format(order.Shipping))
+	}
+
+	html += "<div class='total'><p>Total: " + currency.Format(order.Total) + "</p></div>"
 	html += "<p style='margin-top:40px;'><strong>Status:</strong> " + order.Status + "</p>"
 	html += "</body></html>"
 
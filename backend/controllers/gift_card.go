@@ -0,0 +1,384 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ecom-backend/cache"
+	"ecom-backend/database"
+	"ecom-backend/models"
+	"ecom-backend/money"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errInsufficientBalance is returned when a gift card or wallet can't cover a debit
+var errInsufficientBalance = errors.New("insufficient balance")
+
+// giftCardCodeAlphabet leaves out characters that are easy to misread
+const giftCardCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+type GiftCardRequest struct {
+	Code           string      `json:"code"` // Optional; a random code is generated when empty
+	Amount         money.Money `json:"amount" binding:"required"`
+	ExpiresAt      string      `json:"expires_at"` // YYYY-MM-DD, optional
+	RecipientEmail string      `json:"recipient_email" binding:"omitempty,email"`
+	Note           string      `json:"note"`
+}
+
+type BalanceAdjustmentRequest struct {
+	Amount money.Money `json:"amount" binding:"required"` // Positive to add, negative to remove
+	Note   string      `json:"note" binding:"required"`
+}
+
+// GetGiftCards returns gift cards, optionally filtered by code or status (admin only)
+func GetGiftCards(c *gin.Context) {
+	query := database.DB.Order("created_at DESC")
+	if code := c.Query("code"); code != "" {
+		query = query.Where("code LIKE ?", "%"+normalizeGiftCardCode(code)+"%")
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var cards []models.GiftCard
+	if err := query.Find(&cards).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch gift cards"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"gift_cards": cards})
+}
+
+// GetGiftCard returns a gift card with its ledger (admin only)
+func GetGiftCard(c *gin.Context) {
+	var card models.GiftCard
+	if err := database.DB.Preload("Transactions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at DESC, id DESC")
+	}).First(&card, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift card not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, card)
+}
+
+// IssueGiftCard creates a gift card with an opening balance (admin only)
+func IssueGiftCard(c *gin.Context) {
+	var req GiftCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.Amount.IsPositive() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be greater than 0"})
+		return
+	}
+
+	card := models.GiftCard{
+		Code:           normalizeGiftCardCode(req.Code),
+		InitialBalance: req.Amount,
+		Status:         models.GiftCardActive,
+		RecipientEmail: req.RecipientEmail,
+		Note:           req.Note,
+		IssuedByID:     currentActorID(c),
+	}
+	if req.ExpiresAt != "" {
+		expiresAt, err := parseDateString(req.ExpiresAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expires_at date format. Use YYYY-MM-DD"})
+			return
+		}
+		// Valid through the whole of the expiry date
+		expiresAt = expiresAt.Add(24*time.Hour - time.Second)
+		card.ExpiresAt = &expiresAt
+	}
+	if card.Code == "" {
+		code, err := generateGiftCardCode()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate gift card code"})
+			return
+		}
+		card.Code = code
+	}
+
+	var existing int64
+	database.DB.Unscoped().Model(&models.GiftCard{}).Where("code = ?", card.Code).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Gift card code already exists"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&card).Error; err != nil {
+			return err
+		}
+		_, err := changeGiftCardBalance(tx, card.ID, req.Amount, models.GiftCardTransaction{
+			Type:    models.CreditIssue,
+			ActorID: card.IssuedByID,
+			Note:    req.Note,
+		})
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue gift card"})
+		return
+	}
+	card.Balance = req.Amount
+
+	LogAction(actorIDOrZero(c), "issue", "gift_card", card.ID, gin.H{"code": maskGiftCardCode(card.Code), "amount": req.Amount}, c)
+	c.JSON(http.StatusCreated, card)
+}
+
+// AdjustGiftCard adds to or removes from a gift card's balance (admin only)
+func AdjustGiftCard(c *gin.Context) {
+	var req BalanceAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Amount.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount can't be 0"})
+		return
+	}
+
+	var card models.GiftCard
+	if err := database.DB.First(&card, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift card not found"})
+		return
+	}
+	if card.Status == models.GiftCardVoided {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Gift card has been voided"})
+		return
+	}
+
+	before := card.Balance
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		card, err = changeGiftCardBalance(tx, card.ID, req.Amount, models.GiftCardTransaction{
+			Type:    models.CreditAdjust,
+			ActorID: currentActorID(c),
+			Note:    req.Note,
+		})
+		return err
+	})
+	if err == errInsufficientBalance {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Adjustment would take the balance below 0"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust gift card"})
+		return
+	}
+
+	LogAction(actorIDOrZero(c), "adjust", "gift_card", card.ID, gin.H{"amount": req.Amount, "balance_before": before, "balance_after": card.Balance, "note": req.Note}, c)
+	c.JSON(http.StatusOK, card)
+}
+
+// VoidGiftCard cancels a gift card and writes off its remaining balance (admin only)
+func VoidGiftCard(c *gin.Context) {
+	var req struct {
+		Note string `json:"note"`
+	}
+	c.ShouldBindJSON(&req)
+
+	var card models.GiftCard
+	if err := database.DB.First(&card, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift card not found"})
+		return
+	}
+	if card.Status == models.GiftCardVoided {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Gift card has already been voided"})
+		return
+	}
+
+	before := card.Balance
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&card, card.ID).Error; err != nil {
+			return err
+		}
+		if card.Balance.IsPositive() {
+			var err error
+			card, err = changeGiftCardBalance(tx, card.ID, card.Balance.Neg(), models.GiftCardTransaction{
+				Type:    models.CreditVoid,
+				ActorID: currentActorID(c),
+				Note:    req.Note,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		card.Status = models.GiftCardVoided
+		return tx.Model(&card).Update("status", models.GiftCardVoided).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to void gift card"})
+		return
+	}
+
+	LogAction(actorIDOrZero(c), "void", "gift_card", card.ID, gin.H{"balance_written_off": before, "note": req.Note}, c)
+	c.JSON(http.StatusOK, card)
+}
+
+// Failed gift card lookups from one IP address are capped, so codes can't be guessed through
+// the balance check, checkout or the POS
+const (
+	giftCardLookupFailureLimit  = 10
+	giftCardLookupFailureWindow = 15 * time.Minute
+)
+
+// giftCardLockoutError is returned for lookups from an IP address that tried too many
+// unknown codes
+type giftCardLockoutError struct {
+	RetryAfter int // Seconds until the lockout ends
+}
+
+func (e *giftCardLockoutError) Error() string {
+	return "Too many unknown gift card codes. Please try again later."
+}
+
+// lookupGiftCard is findRedeemableGiftCard for codes typed in by a caller: unknown codes count
+// against the caller's IP address, which is locked out once it has tried too many
+func lookupGiftCard(c *gin.Context, code string) (models.GiftCard, error) {
+	failuresKey := "gift_card_lookup_failures:" + c.ClientIP()
+	if failures, err := cache.GetInt(failuresKey); err == nil && failures >= giftCardLookupFailureLimit {
+		retryAfter := int(giftCardLookupFailureWindow.Seconds())
+		if ttl, err := cache.GetTTL(failuresKey); err == nil && ttl > 0 {
+			retryAfter = int(ttl.Seconds()) + 1
+		}
+		return models.GiftCard{}, &giftCardLockoutError{RetryAfter: retryAfter}
+	}
+
+	card, err := findRedeemableGiftCard(database.DB, code)
+	if err != nil && card.ID == 0 {
+		if failures, cacheErr := cache.Increment(failuresKey); cacheErr == nil && failures == 1 {
+			cache.Set(failuresKey, "1", giftCardLookupFailureWindow)
+		}
+	}
+	return card, err
+}
+
+// respondGiftCardLookupError answers a failed gift card lookup, with 429 for a locked out caller
+func respondGiftCardLookupError(c *gin.Context, err error, status int) {
+	if lockout, ok := err.(*giftCardLockoutError); ok {
+		c.Header("Retry-After", strconv.Itoa(lockout.RetryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": lockout.Error(), "retry_after": lockout.RetryAfter})
+		return
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+// CheckGiftCardBalance returns a gift card's balance and expiry for the holder of its code
+// (public). An IP address that looks up too many unknown codes is locked out for a while.
+func CheckGiftCardBalance(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	card, err := lookupGiftCard(c, req.Code)
+	if err != nil && card.ID == 0 {
+		respondGiftCardLookupError(c, err, http.StatusNotFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":       maskGiftCardCode(card.Code),
+		"balance":    card.Balance,
+		"expires_at": card.ExpiresAt,
+		"usable":     err == nil,
+	})
+}
+
+// findRedeemableGiftCard looks up a gift card by code. It returns an error saying why the card
+// can't be spent, along with the card itself when it exists.
+func findRedeemableGiftCard(db *gorm.DB, code string) (models.GiftCard, error) {
+	var card models.GiftCard
+	if err := db.Where("code = ?", normalizeGiftCardCode(code)).First(&card).Error; err != nil {
+		return models.GiftCard{}, errors.New("Gift card not found")
+	}
+	switch {
+	case card.Status == models.GiftCardVoided:
+		return card, errors.New("Gift card has been voided")
+	case card.ExpiresAt != nil && card.ExpiresAt.Before(time.Now()):
+		return card, errors.New("Gift card has expired")
+	case !card.Balance.IsPositive():
+		return card, errors.New("Gift card has no balance left")
+	}
+	return card, nil
+}
+
+// changeGiftCardBalance adds delta to a gift card's balance and records the change in its
+// ledger. Debits fail with errInsufficientBalance rather than take the balance below zero.
+func changeGiftCardBalance(tx *gorm.DB, cardID uint, delta money.Money, entry models.GiftCardTransaction) (models.GiftCard, error) {
+	var card models.GiftCard
+	query := tx.Model(&card).Clauses(clause.Returning{}).Where("id = ?", cardID)
+	if delta.IsNegative() {
+		query = query.Where("balance >= ?", delta.Neg())
+	}
+	result := query.Update("balance", gorm.Expr("balance + ?", delta))
+	if result.Error != nil {
+		return card, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return card, errInsufficientBalance
+	}
+
+	entry.GiftCardID = cardID
+	entry.Amount = delta
+	entry.BalanceAfter = card.Balance
+	return card, tx.Create(&entry).Error
+}
+
+// normalizeGiftCardCode uppercases a code and drops spaces, so codes can be typed loosely
+func normalizeGiftCardCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+}
+
+// generateGiftCardCode returns a random code such as GC-7KQ2-M9XD-4RTA
+func generateGiftCardCode() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	var code strings.Builder
+	code.WriteString("GC")
+	for i, v := range b {
+		if i%4 == 0 {
+			code.WriteByte('-')
+		}
+		code.WriteByte(giftCardCodeAlphabet[int(v)%len(giftCardCodeAlphabet)])
+	}
+	return code.String(), nil
+}
+
+// maskGiftCardCode hides all but the last four characters of a code, for receipts and logs
+func maskGiftCardCode(code string) string {
+	if len(code) <= 4 {
+		return code
+	}
+	return strings.Repeat("*", len(code)-4) + code[len(code)-4:]
+}
+
+// actorIDOrZero returns the authenticated user's ID for audit logs, or 0
+func actorIDOrZero(c *gin.Context) uint {
+	if id := currentActorID(c); id != nil {
+		return *id
+	}
+	return 0
+}
+
+// giftCardPaymentReference names a gift card on a payment record without exposing its code
+func giftCardPaymentReference(card models.GiftCard) string {
+	return fmt.Sprintf("Gift card %s", maskGiftCardCode(card.Code))
+}
@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"ecom-backend/config"
+	"ecom-backend/database"
+	"ecom-backend/models"
+	"ecom-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// cartOwner identifies whose cart a request works on: a signed-in user or a guest cart
+type cartOwner struct {
+	UserID  *uint
+	GuestID string
+}
+
+// scope restricts a cart query to the owner's rows
+func (o cartOwner) scope(db *gorm.DB) *gorm.DB {
+	if o.UserID != nil {
+		return db.Where("user_id = ?", *o.UserID)
+	}
+	return db.Where("guest_id = ? AND user_id IS NULL", o.GuestID)
+}
+
+// currentCartOwner returns the signed-in user, or the guest cart named by the X-Cart-Token
+// header or cart_token cookie. When start is set and a guest has no valid token, a new guest
+// cart is started and its token sent back in the X-Cart-Token header and the cookie.
+func currentCartOwner(c *gin.Context, start bool) (cartOwner, bool) {
+	if userID, exists := c.Get("userID"); exists {
+		if id, ok := userID.(uint); ok {
+			return cartOwner{UserID: &id}, true
+		}
+	}
+
+	if owner, ok := guestCartOwner(c); ok {
+		return owner, true
+	}
+	if !start {
+		return cartOwner{}, false
+	}
+
+	guestID, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return cartOwner{}, false
+	}
+	setCartToken(c, guestID)
+	return cartOwner{GuestID: guestID}, true
+}
+
+// guestCartOwner returns the guest cart named by a valid cart token in the request
+func guestCartOwner(c *gin.Context) (cartOwner, bool) {
+	token := c.GetHeader("X-Cart-Token")
+	if token == "" {
+		token, _ = c.Cookie(cartTokenCookie)
+	}
+	if token == "" {
+		return cartOwner{}, false
+	}
+	guestID, err := utils.ValidateCartToken(token, config.LoadConfig().JWTSecret)
+	if err != nil {
+		return cartOwner{}, false
+	}
+	return cartOwner{GuestID: guestID}, true
+}
+
+// orderCustomerName returns the account holder's name, or the name given at guest checkout
+func orderCustomerName(order models.Order) string {
+	if order.User != nil {
+		return order.User.Name
+	}
+	return order.GuestName
+}
+
+// orderCustomerEmail returns the account holder's email, or the email given at guest checkout
+func orderCustomerEmail(order models.Order) string {
+	if order.User != nil {
+		return order.User.Email
+	}
+	return order.GuestEmail
+}
+
+// GetOrderByLookupToken returns a guest order from the secure link sent after checkout (public)
+func GetOrderByLookupToken(c *gin.Context) {
+	token := c.Param("token")
+
+	var order models.Order
+	if err := database.DB.Preload("Items").Preload("Items.Product").Preload("Shipments").Preload("Shipments.Items").
+		Where("lookup_token_hash = ?", utils.HashToken(token)).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// ClaimGuestOrder moves a guest order into the signed-in account. The caller needs the
+// order's lookup token and an account registered with the same email as the guest order.
+func ClaimGuestOrder(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var order models.Order
+	if err := database.DB.Where("lookup_token_hash = ? AND user_id IS NULL", utils.HashToken(req.Token)).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found or already claimed"})
+		return
+	}
+
+	if !strings.EqualFold(order.GuestEmail, user.Email) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This order was placed with a different email address"})
+		return
+	}
+
+	// Another request may have claimed the order since it was read
+	result := database.DB.Model(&order).Where("user_id IS NULL").Update("user_id", user.ID)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim order"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order already claimed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Order added to your account", "order_id": order.ID})
+}
+
+// countClaimableGuestOrders returns how many unclaimed guest orders were placed with an email
+func countClaimableGuestOrders(email string) int64 {
+	var count int64
+	database.DB.Model(&models.Order{}).Where("user_id IS NULL AND LOWER(guest_email) = LOWER(?)", email).Count(&count)
+	return count
+}
+
+// CartMergeLine reports a guest cart line that couldn't be moved into the account's cart in full
+type CartMergeLine struct {
+	ProductID         uint              `json:"product_id"`
+	ProductName       string            `json:"product_name"`
+	Variations        map[string]string `json:"variations,omitempty"`
+	RequestedQuantity int               `json:"requested_quantity"`
+	Quantity          int               `json:"quantity"` // Quantity added to the account's cart
+	Reason            string            `json:"reason"`
+	Message           string            `json:"message"`
+}
+
+// mergeGuestCart moves the request's guest cart into a user's cart on login or registration.
+// Lines the user already has are added together, limited by product and option stock unless
+// the product takes backorders; lines whose product or options are gone are dropped. It
+// returns a summary for the response, or nil when there was no guest cart to merge.
+func mergeGuestCart(c *gin.Context, userID uint) gin.H {
+	guest, ok := guestCartOwner(c)
+	if !ok {
+		return nil
+	}
+	items, err := loadCart(database.DB, guest)
+	if err != nil {
+		log.Printf("Failed to load guest cart for merge: %v", err)
+		return nil
+	}
+	if len(items) == 0 {
+		clearCartToken(c)
+		return nil
+	}
+
+	owner := cartOwner{UserID: &userID}
+	merged := 0
+	adjusted := []CartMergeLine{}
+	skipped := []CartMergeLine{}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, item := range items {
+			line := CartMergeLine{
+				ProductID:         item.ProductID,
+				ProductName:       item.Product.Name,
+				Variations:        ParseVariations(item.Variations),
+				RequestedQuantity: item.Quantity,
+			}
+			quantity, err := mergeCartLine(tx, owner, item, &line)
+			if err != nil {
+				return err
+			}
+			line.Quantity = quantity
+			switch {
+			case quantity == 0:
+				skipped = append(skipped, line)
+			case quantity < item.Quantity:
+				merged++
+				adjusted = append(adjusted, line)
+			default:
+				merged++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// Keep the guest cart so the next sign-in can try again
+		log.Printf("Failed to merge guest cart into user %d: %v", userID, err)
+		return nil
+	}
+
+	if err := clearCart(database.DB, guest); err != nil {
+		log.Printf("Failed to clear merged guest cart: %v", err)
+	}
+	clearCartToken(c)
+	return gin.H{"merged": merged, "adjusted": adjusted, "skipped": skipped}
+}
+
+// mergeCartLine adds one guest cart line to the user's cart and returns the quantity added,
+// zero when the line was skipped
+func mergeCartLine(tx *gorm.DB, owner cartOwner, item models.Cart, line *CartMergeLine) (int, error) {
+	if item.Product.ID == 0 {
+		line.Reason, line.Message = cartLineProductUnavailable, "This product is no longer available"
+		return 0, nil
+	}
+	added, err := addCartLine(tx, owner, item.Product, line.Variations, item.Quantity)
+	if err != nil {
+		return 0, err
+	}
+	if added.Resolved != nil {
+		line.Variations = added.Resolved.Selections
+	}
+	line.Reason, line.Message = added.Reason, added.Message
+	return added.Quantity, nil
+}
@@ -9,6 +9,7 @@ import (
 
 	"ecom-backend/database"
 	"ecom-backend/models"
+	"ecom-backend/money"
 
 	"github.com/gin-gonic/gin"
 )
@@ -51,7 +52,7 @@ func ExportProductsCSV(c *gin.Context) {
 			strconv.Itoa(int(product.ID)),
 			product.Name,
 			product.Description,
-			fmt.Sprintf("%.2f", product.Price),
+			product.Price.String(),
 			product.SKU,
 			strconv.Itoa(product.Stock),
 			product.Category.Name,
@@ -103,7 +104,11 @@ func ImportProductsCSV(c *gin.Context) {
 			continue
 		}
 
-		price, _ := strconv.ParseFloat(record[3], 64)
+		price, err := money.Parse(record[3])
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("Row %d: invalid price %q", i+1, record[3]))
+			continue
+		}
 		stock, _ := strconv.Atoi(record[5])
 
 		// Find or create category
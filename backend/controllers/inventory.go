@@ -7,6 +7,7 @@ import (
 	"ecom-backend/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // AdjustStock adjusts product stock (admin only)
@@ -27,26 +28,48 @@ func AdjustStock(c *gin.Context) {
 		return
 	}
 
-	// Adjust stock
+	// Adjust stock, then hand any received stock to waiting backorders, oldest first
+	oldStock := product.Stock
 	newStock := product.Stock + req.Quantity
 	if newStock < 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Stock cannot be negative"})
 		return
 	}
 
-	product.Stock = newStock
-	if err := database.DB.Save(&product).Error; err != nil {
+	var allocatedOrders []uint
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Product{}).Where("id = ? AND stock + ? >= 0", product.ID, req.Quantity).
+			Update("stock", gorm.Expr("stock + ?", req.Quantity))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInsufficientStock
+		}
+		if req.Quantity <= 0 {
+			return nil
+		}
+		var err error
+		allocatedOrders, err = allocateBackorders(tx, product.ID)
+		return err
+	})
+	if err == errInsufficientStock {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Stock cannot be negative"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust stock"})
 		return
 	}
+	database.DB.First(&product, product.ID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":     "Stock adjusted successfully",
 		"product":     product,
-		"old_stock":   product.Stock - req.Quantity,
+		"old_stock":   oldStock,
 		"new_stock":   product.Stock,
 		"adjustment":  req.Quantity,
 		"reason":      req.Reason,
+		"backorders_allocated": allocatedOrders,
 	})
 }
-
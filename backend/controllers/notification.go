@@ -14,7 +14,7 @@ func GetNotifications(c *gin.Context) {
 	userID, _ := c.Get("userID")
 	
 	var notifications []models.Notification
-	query := database.DB.Where("user_id IS NULL OR user_id = ?", userID).Order("created_at DESC")
+	query := database.DB.Where("user_id IS NULL OR user_id = 0 OR user_id = ?", userID).Order("created_at DESC")
 	
 	// Optional: filter by read status
 	if read := c.Query("read"); read != "" {
@@ -68,7 +68,7 @@ func MarkNotificationAsRead(c *gin.Context) {
 	userID, _ := c.Get("userID")
 
 	var notification models.Notification
-	if err := database.DB.Where("id = ? AND (user_id IS NULL OR user_id = ?)", notificationID, userID).First(&notification).Error; err != nil {
+	if err := database.DB.Where("id = ? AND (user_id IS NULL OR user_id = 0 OR user_id = ?)", notificationID, userID).First(&notification).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
 		return
 	}
@@ -87,7 +87,7 @@ func MarkAllNotificationsAsRead(c *gin.Context) {
 	userID, _ := c.Get("userID")
 
 	if err := database.DB.Model(&models.Notification{}).
-		Where("(user_id IS NULL OR user_id = ?) AND read = ?", userID, false).
+		Where("(user_id IS NULL OR user_id = 0 OR user_id = ?) AND read = ?", userID, false).
 		Update("read", true).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notifications"})
 		return
@@ -101,7 +101,7 @@ func DeleteNotification(c *gin.Context) {
 	notificationID := c.Param("id")
 	userID, _ := c.Get("userID")
 
-	if err := database.DB.Where("id = ? AND (user_id IS NULL OR user_id = ?)", notificationID, userID).Delete(&models.Notification{}).Error; err != nil {
+	if err := database.DB.Where("id = ? AND (user_id IS NULL OR user_id = 0 OR user_id = ?)", notificationID, userID).Delete(&models.Notification{}).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete notification"})
 		return
 	}
@@ -1,26 +1,44 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
-	"strconv"
-	"time"
+	"strings"
 
 	"ecom-backend/database"
 	"ecom-backend/models"
+	"ecom-backend/money"
+	"ecom-backend/pricing"
+	"ecom-backend/shipping"
+	"ecom-backend/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type CreateOrderRequest struct {
-	Address    string `json:"address" binding:"required"`
-	City       string `json:"city" binding:"required"`
-	PostalCode string `json:"postal_code" binding:"required"`
-	Country    string `json:"country" binding:"required"`
+	AddressID  uint   `json:"address_id"` // Saved address to ship to instead of the fields below
+	Address    string `json:"address"`
+	City       string `json:"city"`
+	State      string `json:"state"` // Used for shipping zone matching
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
 	CouponCode string `json:"coupon_code"`
+	ShippingMethodID uint `json:"shipping_method_id"` // Optional; falls back to the flat shipping_cost setting
+	Currency   string `json:"currency"` // Currency to pay in; defaults to the store's base currency
+	// Gift card and store credit to pay with, applied in that order; amounts are optional caps
+	GiftCardCode      string      `json:"gift_card_code"`
+	GiftCardAmount    money.Money `json:"gift_card_amount"`
+	UseStoreCredit    bool        `json:"use_store_credit"`
+	StoreCreditAmount money.Money `json:"store_credit_amount"`
+	// Contact details, required for guest checkout
+	Email string `json:"email" binding:"omitempty,email"`
+	Name  string `json:"name"`
+	Phone string `json:"phone"`
 }
 
 func CreateOrder(c *gin.Context) {
-	userID, _ := c.Get("userID")
 	var req CreateOrderRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -28,9 +46,59 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
+	// Signed-in customers order from their cart; guests from the cart named by their cart token
+	owner, ok := currentCartOwner(c, false)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty"})
+		return
+	}
+	if owner.UserID == nil && (req.Email == "" || strings.TrimSpace(req.Name) == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email and name are required for guest checkout"})
+		return
+	}
+
+	// Ship to a saved address, snapshotting it onto the order, or to the address typed in
+	if req.AddressID != 0 {
+		saved, err := loadSavedAddress(owner.UserID, req.AddressID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Address, req.City, req.State = saved.Address, saved.City, saved.State
+		req.PostalCode, req.Country = saved.PostalCode, saved.Country
+		if req.Phone == "" {
+			req.Phone = saved.Phone
+		}
+	} else if req.Address == "" || req.City == "" || req.PostalCode == "" || req.Country == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Address, city, postal code and country are required"})
+		return
+	}
+
+	// Check gift card and store credit up front; they are debited when the order is placed
+	if req.GiftCardAmount.IsNegative() || req.StoreCreditAmount.IsNegative() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Gift card and store credit amounts can't be negative"})
+		return
+	}
+	var tenders []storedValueTender
+	if req.GiftCardCode != "" {
+		card, err := lookupGiftCard(c, req.GiftCardCode)
+		if err != nil {
+			respondGiftCardLookupError(c, err, http.StatusBadRequest)
+			return
+		}
+		tenders = append(tenders, storedValueTender{Method: models.PaymentMethodGiftCard, GiftCardID: card.ID, Limit: req.GiftCardAmount})
+	}
+	if req.UseStoreCredit {
+		if owner.UserID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sign in to pay with store credit"})
+			return
+		}
+		tenders = append(tenders, storedValueTender{Method: models.PaymentMethodStoreCredit, UserID: *owner.UserID, Limit: req.StoreCreditAmount})
+	}
+
 	// Get cart items
-	var cartItems []models.Cart
-	if err := database.DB.Preload("Product").Where("user_id = ?", userID).Find(&cartItems).Error; err != nil {
+	cartItems, err := loadCart(database.DB, owner)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
 		return
 	}
@@ -40,143 +108,264 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
-	// Calculate total and check stock
-	var subtotal float64
+	// Check stock, then price the cart with the same engine that serves checkout quotes.
+	// Products that take backorders or pre-orders may be ordered beyond their stock.
+	lines := make([]pricing.Line, 0, len(cartItems))
 	for _, item := range cartItems {
-		if item.Product.Stock < item.Quantity {
+		if !item.Product.AllowsBackorder() && item.Product.Stock < item.Quantity {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": "Insufficient stock for product: " + item.Product.Name,
 			})
 			return
 		}
-		subtotal += item.Product.Price * float64(item.Quantity)
+		lines = append(lines, pricing.Line{
+			Product:    item.Product,
+			Quantity:   item.Quantity,
+			Variations: ParseVariations(item.Variations),
+		})
 	}
 
-	// Get tax rate - try regional first, then fallback to settings
-	var taxRate float64
-	var taxRateModel models.TaxRate
-	
-	// Try to get regional tax rate (most specific match first)
-	// Try city match (country + city, with no specific region)
-	if req.City != "" {
-		if err := database.DB.Where("country = ? AND city = ? AND (region = '' OR region IS NULL)", req.Country, req.City).First(&taxRateModel).Error; err == nil {
-			taxRate = taxRateModel.Rate
+	currency, rate, err := pricing.ResolveCurrency(database.DB, req.Currency)
+	if err != nil {
+		respondPricingError(c, err)
+		return
+	}
+	quote, err := pricing.Calculate(database.DB, pricing.Request{
+		Lines:            lines,
+		CouponCode:       req.CouponCode,
+		Destination:      shipping.Destination{Country: req.Country, Region: req.State, City: req.City, PostalCode: req.PostalCode},
+		ShippingMethodID: req.ShippingMethodID,
+		Currency:         currency,
+		ExchangeRate:     rate,
+	})
+	if err != nil {
+		respondPricingError(c, err)
+		return
+	}
+	for i, line := range quote.Lines {
+		if cartItems[i].Product.AllowsBackorder() {
+			continue
 		}
+		for _, option := range line.Options {
+			if option.Stock < cartItems[i].Quantity {
+				c.JSON(http.StatusBadRequest, gin.H{"error": cartItems[i].Product.Name + ": Insufficient stock for option: " + option.Value})
+				return
+			}
+		}
+	}
+
+	// Create order
+	order := models.Order{
+		UserID:     owner.UserID,
+		Status:     models.OrderStatusPending,
+		Address:    req.Address,
+		City:       req.City,
+		State:      req.State,
+		PostalCode: req.PostalCode,
+		Country:    req.Country,
+		Phone:      req.Phone,
 	}
-	
-	// Try country match if region didn't match
-	if taxRate == 0 {
-		if err := database.DB.Where("country = ? AND (region = '' OR region IS NULL) AND (city = '' OR city IS NULL)", req.Country).First(&taxRateModel).Error; err == nil {
-			taxRate = taxRateModel.Rate
+	quote.ApplyTo(&order)
+
+	// Stock for items that can't be backordered is held until the order goes ahead or is
+	// cancelled. The hold only expires once an online payment is started (see PayOrder), so
+	// cash on delivery and bank transfer orders keep their stock.
+	for _, item := range cartItems {
+		if !item.Product.AllowsBackorder() {
+			order.StockReserved = true
 		}
 	}
-	
-	// Fallback to default tax rate
-	if taxRate == 0 {
-		if err := database.DB.Where("is_default = ?", true).First(&taxRateModel).Error; err == nil {
-			taxRate = taxRateModel.Rate
+
+	// Guests get a secret lookup link instead of an account; only its hash is stored
+	var lookupToken string
+	if owner.UserID == nil {
+		token, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+			return
 		}
+		lookupToken = token
+		order.GuestEmail = strings.ToLower(strings.TrimSpace(req.Email))
+		order.GuestName = strings.TrimSpace(req.Name)
+		order.GuestPhone = req.Phone
+		order.LookupTokenHash = utils.HashToken(lookupToken)
 	}
-	
-	// Final fallback to settings
-	if taxRate == 0 {
-		var taxSetting models.Setting
-		if err := database.DB.Where("key = ?", "tax_rate").First(&taxSetting).Error; err == nil {
-			if rate, err := strconv.ParseFloat(taxSetting.Value, 64); err == nil {
-				taxRate = rate
+
+	// Place the order atomically: coupon usage, order, items, stock, gift card and store
+	// credit debits and cart either all commit or all roll back. Stock is reserved under row
+	// locks and coupon usage claimed with a conditional update so concurrent checkouts can't
+	// oversell.
+	var amountDue money.Money
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if quote.Coupon != nil {
+			if err := claimCouponUsage(tx, quote.Coupon.ID); err != nil {
+				return err
 			}
 		}
-	}
 
-	// Calculate tax
-	tax := subtotal * (taxRate / 100)
-
-	// Apply coupon if provided
-	var discount float64
-	var total float64
-	if req.CouponCode != "" {
-		var coupon models.Coupon
-		if err := database.DB.Where("code = ? AND is_active = ?", req.CouponCode, true).First(&coupon).Error; err == nil {
-			now := time.Now()
-			// Check validity period (inclusive start and end to match ValidateCoupon)
-			valid := !now.Before(coupon.ValidFrom) && !now.After(coupon.ValidUntil)
-			if valid && (coupon.UsageLimit == 0 || coupon.UsedCount < coupon.UsageLimit) {
-				if subtotal >= coupon.MinPurchase {
-					if coupon.Type == "percentage" {
-						discount = subtotal * (coupon.Value / 100)
-						if coupon.MaxDiscount > 0 && discount > coupon.MaxDiscount {
-							discount = coupon.MaxDiscount
-						}
-					} else {
-						discount = coupon.Value
-					}
-					// Increment coupon usage
-					coupon.UsedCount++
-					database.DB.Save(&coupon)
+		if err := assignOrderNumber(tx, &order, orderChannelWeb, ""); err != nil {
+			return err
+		}
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		if err := recordOrderStatus(tx, order.ID, "", order.Status, currentActorID(c), "Order placed"); err != nil {
+			return err
+		}
+
+		for i, cartItem := range cartItems {
+			line := quote.Lines[i]
+			orderItem := models.OrderItem{
+				OrderID:    order.ID,
+				ProductID:  cartItem.ProductID,
+				Quantity:   cartItem.Quantity,
+				Price:      line.UnitPrice,
+				Variations: SerializeVariations(line.Variations), // Preserve variations from cart
+			}
+
+			if cartItem.Product.AllowsBackorder() {
+				// Take what stock there is; the rest waits for AdjustStock to allocate it
+				allocated, err := claimAvailableStock(tx, cartItem.ProductID, line.Options, cartItem.Quantity)
+				if err != nil {
+					return err
+				}
+				orderItem.BackorderedQty = cartItem.Quantity - allocated
+				orderItem.IsPreorder = cartItem.Product.InventoryPolicy == models.InventoryPolicyPreorder
+				if orderItem.BackorderedQty > 0 || orderItem.IsPreorder {
+					orderItem.ExpectedAt = cartItem.Product.AvailableAt
+				}
+			}
+			if err := tx.Create(&orderItem).Error; err != nil {
+				return err
+			}
+			if !cartItem.Product.AllowsBackorder() {
+				// Hold the units until the order is paid; commitReservations deducts them then
+				if err := reserveStock(tx, orderItem, cartItem.Product, line.Options); err != nil {
+					return err
 				}
 			}
 		}
-	}
 
-	// Get shipping cost from settings
-	var shippingCost float64
-	var shippingSetting models.Setting
-	if err := database.DB.Where("key = ?", "shipping_cost").First(&shippingSetting).Error; err == nil {
-		if cost, err := strconv.ParseFloat(shippingSetting.Value, 64); err == nil {
-			shippingCost = cost
+		// Each tender covers what is still due; an order they cover in full is paid
+		amountDue = order.Total
+		var redeemed money.Money
+		for _, tender := range tenders {
+			want := amountDue
+			if tender.Limit.IsPositive() {
+				want = min(want, tender.Limit)
+			}
+			applied, err := redeemStoredValue(tx, &order, tender, want, currency, currentActorID(c))
+			if err != nil {
+				return err
+			}
+			amountDue = amountDue.Sub(applied)
+			redeemed = redeemed.Add(applied)
+		}
+		if redeemed.IsPositive() && !amountDue.IsPositive() {
+			if err := transitionOrderStatus(tx, &order, models.OrderStatusPaid, currentActorID(c), "Paid by gift card or store credit"); err != nil {
+				return err
+			}
+		}
+
+		if err := markAbandonedCartConverted(tx, owner, order.ID); err != nil {
+			return err
 		}
+
+		// Clear cart
+		return clearCart(tx, owner)
+	})
+	if err != nil {
+		if conflict, ok := err.(*orderConflictError); ok {
+			c.JSON(http.StatusConflict, gin.H{"error": conflict.Message})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+		return
 	}
 
-	// Calculate final total: subtotal - discount + tax + shipping
-	total = subtotal - discount + tax + shippingCost
+	// Load order with items
+	database.DB.Preload("Items").Preload("Items.Product").First(&order, order.ID)
 
-	// Create order
-	order := models.Order{
-		UserID:     userID.(uint),
-		Subtotal:   subtotal,
-		Tax:        tax,
-		Discount:   discount,
-		Shipping:   shippingCost,
-		Total:      total,
-		TaxRate:    taxRate,
-		Status:     "pending",
-		Address:    req.Address,
-		City:       req.City,
-		PostalCode: req.PostalCode,
-		Country:    req.Country,
+	response := gin.H{
+		"message":    "Order created successfully",
+		"order":      order,
+		"amount_due": amountDue,
+	}
+	if lookupToken != "" {
+		response["lookup_token"] = lookupToken
+		response["lookup_url"] = "/api/orders/lookup/" + lookupToken
 	}
+	c.JSON(http.StatusCreated, response)
+}
 
-	if err := database.DB.Create(&order).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+// respondPricingError reports a failed pricing.Calculate: bad input as 400, anything else as 500
+func respondPricingError(c *gin.Context, err error) {
+	if inputErr, ok := err.(*pricing.InputError); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": inputErr.Message})
 		return
 	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate order total"})
+}
 
-	// Create order items and update stock
-	for _, cartItem := range cartItems {
-		orderItem := models.OrderItem{
-			OrderID:    order.ID,
-			ProductID:  cartItem.ProductID,
-			Quantity:   cartItem.Quantity,
-			Price:      cartItem.Product.Price,
-			Variations: cartItem.Variations, // Preserve variations from cart
-		}
-		database.DB.Create(&orderItem)
+// errInsufficientStock is returned by deductProductStock when the product no longer has
+// enough stock to cover the requested quantity
+var errInsufficientStock = errors.New("insufficient stock")
 
-		// Update product stock
-		cartItem.Product.Stock -= cartItem.Quantity
-		database.DB.Save(&cartItem.Product)
-	}
+// orderConflictError reports a checkout that lost a race with another order, e.g. stock or
+// coupon usage ran out between validation and commit. It is surfaced as 409 Conflict.
+type orderConflictError struct {
+	Message string
+}
 
-	// Clear cart
-	database.DB.Where("user_id = ?", userID).Delete(&models.Cart{})
+func (e *orderConflictError) Error() string {
+	return e.Message
+}
 
-	// Load order with items
-	database.DB.Preload("Items").Preload("Items.Product").First(&order, order.ID)
+// stockColumn returns the product column holding the given stock type ("website" or "showroom")
+func stockColumn(stockType string) string {
+	if stockType == "showroom" {
+		return "pos_stock"
+	}
+	return "stock"
+}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "Order created successfully",
-		"order":   order,
-	})
+// deductProductStock decrements website or showroom stock only if enough is left, so two
+// concurrent orders can never both take the last unit. Website units reserved for unpaid
+// orders don't count as left.
+func deductProductStock(tx *gorm.DB, productID uint, stockType string, quantity int) error {
+	column := stockColumn(stockType)
+	available := column
+	if column == "stock" {
+		// Lock first so the update below sees reservations committed while it waited
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Find(&models.Product{}, productID).Error; err != nil {
+			return err
+		}
+		available = "stock - " + reservedProductSQL
+	}
+	result := tx.Model(&models.Product{}).
+		Where("id = ? AND "+available+" >= ?", productID, quantity).
+		Update(column, gorm.Expr(column+" - ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInsufficientStock
+	}
+	return nil
+}
+
+// claimCouponUsage increments a coupon's usage count unless its usage limit has been reached
+func claimCouponUsage(tx *gorm.DB, couponID uint) error {
+	result := tx.Model(&models.Coupon{}).
+		Where("id = ? AND (usage_limit IS NULL OR usage_limit = 0 OR used_count < usage_limit)", couponID).
+		Update("used_count", gorm.Expr("used_count + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &orderConflictError{Message: "Coupon usage limit reached"}
+	}
+	return nil
 }
 
 func GetOrders(c *gin.Context) {
@@ -197,8 +386,9 @@ func GetOrder(c *gin.Context) {
 	id := c.Param("id")
 
 	var order models.Order
-	if err := database.DB.Preload("Items").Preload("Items.Product").
-		Where("id = ? AND user_id = ?", id, userID).First(&order).Error; err != nil {
+	query := database.DB.Preload("Items").Preload("Items.Product").
+		Preload("Shipments", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC") }).Preload("Shipments.Items")
+	if err := orderByIDOrNumber(query, id).Where("user_id = ?", userID).First(&order).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
 	}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ecom-backend/database"
+	"ecom-backend/models"
+	"ecom-backend/money"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultCancellationWindowHours applies when the order_cancellation_window_hours setting is missing
+const defaultCancellationWindowHours = 24
+
+// cancellationWindow returns how long after placing an order a customer may cancel it.
+// A window of 0 turns self-service cancellation off.
+func cancellationWindow() time.Duration {
+	hours, err := strconv.ParseFloat(settingValue("order_cancellation_window_hours", ""), 64)
+	if err != nil || hours < 0 {
+		hours = defaultCancellationWindowHours
+	}
+	return time.Duration(hours * float64(time.Hour))
+}
+
+// customerCancellableStatuses are the statuses a customer may cancel from themselves. Once an
+// order is being prepared or has shipped, only an admin can cancel it.
+var customerCancellableStatuses = map[string]bool{
+	models.OrderStatusPending: true,
+	models.OrderStatusPartial: true,
+	models.OrderStatusPaid:    true,
+}
+
+// customerCanCancel reports whether a customer may cancel an order in the given status
+func customerCanCancel(status string) bool {
+	return customerCancellableStatuses[normalizeOrderStatus(status)]
+}
+
+// CancelOrder lets a customer cancel their own order while it hasn't shipped and is still
+// inside the cancellation window. Stock and coupon usage are released, a refund is raised
+// for anything already paid, and admins are notified.
+func CancelOrder(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	id := c.Param("id")
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	// The reason is optional, so an empty body is fine
+	c.ShouldBindJSON(&req)
+
+	var order models.Order
+	if err := orderByIDOrNumber(database.DB, id).Where("user_id = ?", userID).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	if order.IsPOS {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "In-store orders can't be cancelled online"})
+		return
+	}
+	if !customerCanCancel(order.Status) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order can no longer be cancelled"})
+		return
+	}
+	window := cancellationWindow()
+	if window == 0 || time.Since(order.CreatedAt) > window {
+		c.JSON(http.StatusConflict, gin.H{"error": "The cancellation window for this order has passed"})
+		return
+	}
+
+	note := "Cancelled by customer"
+	if req.Reason != "" {
+		note += ": " + req.Reason
+	}
+
+	var refund *models.Refund
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the order so a concurrent admin status change can't interleave
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, order.ID).Error; err != nil {
+			return err
+		}
+		if !customerCanCancel(order.Status) {
+			return &orderConflictError{Message: "Order can no longer be cancelled"}
+		}
+		paid, err := orderAmountPaid(tx, &order)
+		if err != nil {
+			return err
+		}
+
+		if err := transitionOrderStatus(tx, &order, models.OrderStatusCancelled, currentActorID(c), note); err != nil {
+			return err
+		}
+
+		if paid.IsPositive() {
+			refund = &models.Refund{
+				OrderID: order.ID,
+				Amount:  paid,
+				Reason:  note,
+				Status:  "approved",
+				Notes:   "Raised automatically when the customer cancelled the order",
+			}
+			if err := tx.Create(refund).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&models.Notification{
+			Type:    "order",
+			Title:   "Order cancelled",
+			Message: fmt.Sprintf("Order %s was cancelled by the customer", orderReference(order)),
+		}).Error
+	})
+	if err != nil {
+		respondOrderTransitionError(c, err)
+		return
+	}
+	settleOrderPayments(order)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Order cancelled",
+		"order":   order,
+		"refund":  refund,
+	})
+}
+
+// orderAmountPaid returns how much money has been collected for an order: the sum of its
+// payment records, or for orders marked paid without a recorded payment, whatever of the
+// total wasn't paid by gift card or store credit. Those are left out because cancelling
+// returns them to their balances instead.
+func orderAmountPaid(tx *gorm.DB, order *models.Order) (money.Money, error) {
+	var payments []models.Payment
+	if err := tx.Where("order_id = ? AND status = ?", order.ID, models.PaymentStatusCaptured).Find(&payments).Error; err != nil {
+		return 0, err
+	}
+	var paid, storedValue money.Money
+	for _, payment := range payments {
+		if isStoredValueMethod(payment.Method) {
+			storedValue = storedValue.Add(payment.Collected())
+		} else {
+			paid = paid.Add(payment.Collected())
+		}
+	}
+	if paid.IsPositive() {
+		return paid, nil
+	}
+
+	var markedPaid int64
+	if err := tx.Model(&models.OrderStatusHistory{}).
+		Where("order_id = ? AND to_status = ?", order.ID, models.OrderStatusPaid).Count(&markedPaid).Error; err != nil {
+		return 0, err
+	}
+	if remaining := order.Total.Sub(storedValue); (markedPaid > 0 || order.Status == models.OrderStatusPaid) && remaining.IsPositive() {
+		return remaining, nil
+	}
+	return 0, nil
+}
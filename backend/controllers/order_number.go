@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"ecom-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Order number channels, each with its own pattern setting and sequences
+const (
+	orderChannelWeb = "web"
+	orderChannelPOS = "pos"
+)
+
+// Default order number patterns, overridden by the order_number_pattern_web and
+// order_number_pattern_pos settings
+var defaultOrderNumberPatterns = map[string]string{
+	orderChannelWeb: "WEB-{year}-{seq:6}",
+	orderChannelPOS: "POS-{store}-{seq:6}",
+}
+
+// defaultStoreCode fills {store} when the POS settings don't name a store
+const defaultStoreCode = "MAIN"
+
+// orderNumberToken matches pattern placeholders such as {year} or {seq:6}
+var orderNumberToken = regexp.MustCompile(`\{(\w+)(?::(\d+))?\}`)
+
+// assignOrderNumber gives an order its customer-facing number. It must run in the
+// transaction that creates the order: the sequence row stays locked until commit, so
+// concurrent orders queue for the next value and a rolled-back order leaves no gap.
+func assignOrderNumber(tx *gorm.DB, order *models.Order, channel, store string) error {
+	pattern := orderNumberPattern(tx, channel)
+	if !strings.Contains(pattern, "{seq") {
+		pattern += "-{seq}"
+	}
+	if store == "" {
+		store = defaultStoreCode
+	}
+
+	// Everything but the sequence is rendered first; that prefix names the counter
+	now := time.Now()
+	prefix := renderOrderNumber(pattern, now, store, -1)
+	seq, err := nextOrderSequence(tx, channel+":"+prefix)
+	if err != nil {
+		return err
+	}
+	order.OrderNumber = renderOrderNumber(pattern, now, store, seq)
+	return nil
+}
+
+// orderNumberPattern returns the configured pattern for a channel
+func orderNumberPattern(tx *gorm.DB, channel string) string {
+	var setting models.Setting
+	if err := tx.Where("key = ?", "order_number_pattern_"+channel).First(&setting).Error; err == nil {
+		if pattern := strings.TrimSpace(setting.Value); pattern != "" {
+			return pattern
+		}
+	}
+	return defaultOrderNumberPatterns[channel]
+}
+
+// renderOrderNumber fills in a pattern's placeholders. A negative seq leaves "{seq}" in place,
+// giving the prefix that identifies the sequence.
+func renderOrderNumber(pattern string, now time.Time, store string, seq int64) string {
+	return orderNumberToken.ReplaceAllStringFunc(pattern, func(token string) string {
+		match := orderNumberToken.FindStringSubmatch(token)
+		switch match[1] {
+		case "year":
+			return now.Format("2006")
+		case "yy":
+			return now.Format("06")
+		case "month":
+			return now.Format("01")
+		case "day":
+			return now.Format("02")
+		case "store":
+			return strings.ToUpper(store)
+		case "seq":
+			if seq < 0 {
+				return "{seq}"
+			}
+			width, _ := strconv.Atoi(match[2])
+			return fmt.Sprintf("%0*d", width, seq)
+		}
+		return token
+	})
+}
+
+// nextOrderSequence increments and returns a named sequence, creating it on first use
+func nextOrderSequence(tx *gorm.DB, name string) (int64, error) {
+	if err := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "name"}}, DoNothing: true}).
+		Create(&models.OrderSequence{Name: name}).Error; err != nil {
+		return 0, err
+	}
+
+	var sequence models.OrderSequence
+	if err := tx.Model(&sequence).Clauses(clause.Returning{}).Where("name = ?", name).
+		Update("last_value", gorm.Expr("last_value + 1")).Error; err != nil {
+		return 0, err
+	}
+	return sequence.LastValue, nil
+}
+
+// posStoreCode returns the store code configured in the POS settings
+func posStoreCode(tx *gorm.DB) string {
+	var setting models.Setting
+	if err := tx.Where("key = ?", "pos_settings").First(&setting).Error; err != nil {
+		return defaultStoreCode
+	}
+	var settings map[string]interface{}
+	if err := json.Unmarshal([]byte(setting.Value), &settings); err != nil {
+		return defaultStoreCode
+	}
+	if code, ok := settings["store_code"].(string); ok && strings.TrimSpace(code) != "" {
+		return strings.TrimSpace(code)
+	}
+	return defaultStoreCode
+}
+
+// orderByIDOrNumber scopes an order query to the order named in a URL, which may be its
+// numeric ID or its order number
+func orderByIDOrNumber(db *gorm.DB, idOrNumber string) *gorm.DB {
+	if id, err := strconv.ParseUint(idOrNumber, 10, 64); err == nil {
+		return db.Where("orders.id = ? OR orders.order_number = ?", id, idOrNumber)
+	}
+	return db.Where("orders.order_number = ?", idOrNumber)
+}
+
+// orderReference returns how an order is named to people: its order number, or "#ID" for
+// orders placed before order numbers existed
+func orderReference(order models.Order) string {
+	if order.OrderNumber != "" {
+		return order.OrderNumber
+	}
+	return fmt.Sprintf("#%d", order.ID)
+}
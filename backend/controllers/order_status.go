@@ -0,0 +1,277 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"ecom-backend/database"
+	"ecom-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// orderStatusTransitions lists the statuses an order may move to from each status
+var orderStatusTransitions = map[string][]string{
+	models.OrderStatusPending:    {models.OrderStatusPaid, models.OrderStatusPartial, models.OrderStatusProcessing, models.OrderStatusCancelled},
+	models.OrderStatusPartial:    {models.OrderStatusPaid, models.OrderStatusCancelled},
+	models.OrderStatusPaid:       {models.OrderStatusProcessing, models.OrderStatusPartiallyShipped, models.OrderStatusShipped, models.OrderStatusDelivered, models.OrderStatusCancelled, models.OrderStatusPartiallyRefunded, models.OrderStatusRefunded},
+	models.OrderStatusProcessing: {models.OrderStatusPartiallyShipped, models.OrderStatusShipped, models.OrderStatusDelivered, models.OrderStatusCancelled, models.OrderStatusPartiallyRefunded, models.OrderStatusRefunded},
+	models.OrderStatusPartiallyShipped: {models.OrderStatusShipped, models.OrderStatusCancelled, models.OrderStatusPartiallyRefunded, models.OrderStatusRefunded},
+	models.OrderStatusShipped:    {models.OrderStatusDelivered, models.OrderStatusPartiallyRefunded, models.OrderStatusRefunded},
+	models.OrderStatusDelivered:  {models.OrderStatusPartiallyRefunded, models.OrderStatusRefunded},
+	// A partial refund doesn't stop fulfilment: the rest of the order can still ship
+	models.OrderStatusPartiallyRefunded: {models.OrderStatusPartiallyShipped, models.OrderStatusShipped, models.OrderStatusDelivered, models.OrderStatusRefunded},
+	models.OrderStatusCancelled:  {},
+	models.OrderStatusRefunded:   {},
+}
+
+// orderTransitionError reports a status change the state machine does not allow
+type orderTransitionError struct {
+	From string
+	To   string
+}
+
+func (e *orderTransitionError) Error() string {
+	return fmt.Sprintf("Cannot change order status from %s to %s", e.From, e.To)
+}
+
+// normalizeOrderStatus maps legacy status names onto the state machine
+func normalizeOrderStatus(status string) string {
+	status = strings.ToLower(strings.TrimSpace(status))
+	if status == models.OrderStatusCompleted {
+		return models.OrderStatusDelivered
+	}
+	return status
+}
+
+// isValidOrderStatus reports whether status is part of the order state machine
+func isValidOrderStatus(status string) bool {
+	_, ok := orderStatusTransitions[normalizeOrderStatus(status)]
+	return ok
+}
+
+// allowedOrderTransitions returns the statuses reachable from the given status
+func allowedOrderTransitions(from string) []string {
+	return orderStatusTransitions[normalizeOrderStatus(from)]
+}
+
+// canTransitionOrder reports whether an order may move from one status to another
+func canTransitionOrder(from, to string) bool {
+	for _, allowed := range allowedOrderTransitions(from) {
+		if allowed == normalizeOrderStatus(to) {
+			return true
+		}
+	}
+	return false
+}
+
+// currentActorID returns the authenticated user's ID for history records, or nil
+func currentActorID(c *gin.Context) *uint {
+	if userID, exists := c.Get("userID"); exists {
+		if id, ok := userID.(uint); ok {
+			return &id
+		}
+	}
+	return nil
+}
+
+// recordOrderStatus appends an entry to an order's status history
+func recordOrderStatus(tx *gorm.DB, orderID uint, from, to string, actorID *uint, note string) error {
+	return tx.Create(&models.OrderStatusHistory{
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   to,
+		ActorID:    actorID,
+		Note:       note,
+	}).Error
+}
+
+// transitionOrderStatus validates and applies a status change inside tx, runs its side
+// effects and records it in the order's history
+func transitionOrderStatus(tx *gorm.DB, order *models.Order, to string, actorID *uint, note string) error {
+	from := order.Status
+	to = normalizeOrderStatus(to)
+	if !canTransitionOrder(from, to) {
+		return &orderTransitionError{From: from, To: to}
+	}
+
+	if err := applyOrderTransitionEffects(tx, order, to); err != nil {
+		return err
+	}
+
+	// Only move the order if nobody else changed its status since it was read; the caller's
+	// transaction rolls the side effects back otherwise
+	result := tx.Model(&models.Order{}).Where("id = ? AND status = ?", order.ID, from).Update("status", to)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &orderConflictError{Message: "The order's status changed in the meantime; reload it and try again"}
+	}
+	order.Status = to
+
+	return recordOrderStatus(tx, order.ID, from, to, actorID, note)
+}
+
+// applyOrderTransitionEffects runs side effects for entering a status
+func applyOrderTransitionEffects(tx *gorm.DB, order *models.Order, to string) error {
+	switch to {
+	case models.OrderStatusCancelled:
+		if err := restockOrder(tx, order); err != nil {
+			return err
+		}
+		if err := returnStoredValue(tx, order); err != nil {
+			return err
+		}
+		return releaseCouponUsage(tx, order)
+	}
+
+	// Any other move out of pending means the order goes ahead: take its reserved units from stock
+	if order.StockReserved {
+		return commitReservations(tx, order)
+	}
+	return nil
+}
+
+// releaseCouponUsage gives back the coupon use claimed when the order was placed
+func releaseCouponUsage(tx *gorm.DB, order *models.Order) error {
+	if order.CouponID == nil {
+		return nil
+	}
+	return tx.Model(&models.Coupon{}).Where("id = ? AND used_count > 0", *order.CouponID).
+		Update("used_count", gorm.Expr("used_count - 1")).Error
+}
+
+// restockOrder returns an order's items, and their variation options, to the stock they were
+// taken from. Backordered units were never taken, so they are simply dropped from the waiting
+// list, and units of unpaid orders are only released from their reservations. Freed website
+// stock goes to other customers' backorders. Units that already shipped stay with the customer.
+func restockOrder(tx *gorm.DB, order *models.Order) error {
+	var items []models.OrderItem
+	if err := tx.Where("order_id = ?", order.ID).Find(&items).Error; err != nil {
+		return err
+	}
+
+	released, err := releaseReservations(tx, order)
+	if err != nil {
+		return err
+	}
+
+	// Units that already left in a shipment aren't on the shelf to go back
+	unshipped, _, err := unshippedQuantities(tx, order.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Model(&models.OrderItem{}).Where("order_id = ? AND backordered_qty > 0", order.ID).
+		Update("backordered_qty", 0).Error; err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if released[item.ID] {
+			if stockColumn(order.StockType) == "stock" {
+				if _, err := allocateBackorders(tx, item.ProductID); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		// Units a refund already returned to stock aren't returned again
+		quantity := min(item.Quantity-item.RestockedQty, unshipped[item.ID]) - item.BackorderedQty
+		if err := returnItemStock(tx, order, item, quantity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returnItemStock puts units of an order item back into the stock they were taken from,
+// with its variation options, and fills waiting backorders from them
+func returnItemStock(tx *gorm.DB, order *models.Order, item models.OrderItem, quantity int) error {
+	if quantity <= 0 {
+		return nil
+	}
+	column := stockColumn(order.StockType)
+	if err := tx.Model(&models.Product{}).Where("id = ?", item.ProductID).
+		Update(column, gorm.Expr(column+" + ?", quantity)).Error; err != nil {
+		return err
+	}
+
+	options, err := lookupSelectedOptions(tx, item.ProductID, ParseVariations(item.Variations))
+	if err != nil {
+		return err
+	}
+	for _, option := range options {
+		if err := tx.Model(&models.VariationOption{}).Where("id = ?", option.ID).
+			Update("stock", gorm.Expr("stock + ?", quantity)).Error; err != nil {
+			return err
+		}
+	}
+
+	if column == "stock" {
+		if _, err := allocateBackorders(tx, item.ProductID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// respondOrderTransitionError writes the response for a failed status change
+func respondOrderTransitionError(c *gin.Context, err error) {
+	if conflict, ok := err.(*orderConflictError); ok {
+		c.JSON(http.StatusConflict, gin.H{"error": conflict.Message})
+		return
+	}
+	if transitionErr, ok := err.(*orderTransitionError); ok {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   transitionErr.Error(),
+			"allowed": allowedOrderTransitions(transitionErr.From),
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
+}
+
+// GetOrderHistory returns the status timeline of one of the authenticated user's orders
+func GetOrderHistory(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	id := c.Param("id")
+
+	var order models.Order
+	if err := orderByIDOrNumber(database.DB, id).Where("user_id = ?", userID).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	var history []models.OrderStatusHistory
+	if err := database.DB.Where("order_id = ?", order.ID).Order("created_at ASC").Find(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": order.Status, "history": history})
+}
+
+// GetOrderHistoryAdmin returns the status timeline of any order, including who made each change (admin only)
+func GetOrderHistoryAdmin(c *gin.Context) {
+	var order models.Order
+	if err := orderByIDOrNumber(database.DB, c.Param("id")).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	var history []models.OrderStatusHistory
+	if err := database.DB.Preload("Actor").Where("order_id = ?", order.ID).Order("created_at ASC").Find(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":              order.Status,
+		"allowed_transitions": allowedOrderTransitions(order.Status),
+		"history":             history,
+	})
+}
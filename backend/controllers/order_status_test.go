@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"testing"
+
+	"ecom-backend/models"
+)
+
+func TestCanTransitionOrder(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{models.OrderStatusPending, models.OrderStatusPaid, true},
+		{models.OrderStatusPending, models.OrderStatusPartial, true},
+		{models.OrderStatusPending, models.OrderStatusProcessing, true},
+		{models.OrderStatusPending, models.OrderStatusCancelled, true},
+		{models.OrderStatusPending, models.OrderStatusShipped, false},
+		{models.OrderStatusPending, models.OrderStatusRefunded, false},
+
+		{models.OrderStatusPartial, models.OrderStatusPaid, true},
+		{models.OrderStatusPartial, models.OrderStatusCancelled, true},
+		{models.OrderStatusPartial, models.OrderStatusShipped, false},
+
+		{models.OrderStatusPaid, models.OrderStatusProcessing, true},
+		{models.OrderStatusPaid, models.OrderStatusPartiallyShipped, true},
+		{models.OrderStatusPaid, models.OrderStatusShipped, true},
+		{models.OrderStatusPaid, models.OrderStatusDelivered, true},
+		{models.OrderStatusPaid, models.OrderStatusCancelled, true},
+		{models.OrderStatusPaid, models.OrderStatusPartiallyRefunded, true},
+		{models.OrderStatusPaid, models.OrderStatusRefunded, true},
+		{models.OrderStatusPaid, models.OrderStatusPending, false},
+
+		{models.OrderStatusProcessing, models.OrderStatusPartiallyShipped, true},
+		{models.OrderStatusProcessing, models.OrderStatusShipped, true},
+		{models.OrderStatusProcessing, models.OrderStatusDelivered, true},
+		{models.OrderStatusProcessing, models.OrderStatusCancelled, true},
+		{models.OrderStatusProcessing, models.OrderStatusPartiallyRefunded, true},
+		{models.OrderStatusProcessing, models.OrderStatusRefunded, true},
+		{models.OrderStatusProcessing, models.OrderStatusPaid, false},
+
+		// A shipment can leave an order partially shipped, and a later one ships the rest
+		{models.OrderStatusPartiallyShipped, models.OrderStatusShipped, true},
+		{models.OrderStatusPartiallyShipped, models.OrderStatusCancelled, true},
+		{models.OrderStatusPartiallyShipped, models.OrderStatusPartiallyRefunded, true},
+		{models.OrderStatusPartiallyShipped, models.OrderStatusRefunded, true},
+		{models.OrderStatusPartiallyShipped, models.OrderStatusProcessing, false},
+
+		{models.OrderStatusShipped, models.OrderStatusDelivered, true},
+		{models.OrderStatusShipped, models.OrderStatusPartiallyRefunded, true},
+		{models.OrderStatusShipped, models.OrderStatusRefunded, true},
+		{models.OrderStatusShipped, models.OrderStatusCancelled, false},
+
+		{models.OrderStatusDelivered, models.OrderStatusPartiallyRefunded, true},
+		{models.OrderStatusDelivered, models.OrderStatusRefunded, true},
+		{models.OrderStatusDelivered, models.OrderStatusCancelled, false},
+
+		// A partial refund before delivery leaves the rest of the order to ship
+		{models.OrderStatusPartiallyRefunded, models.OrderStatusPartiallyShipped, true},
+		{models.OrderStatusPartiallyRefunded, models.OrderStatusShipped, true},
+		{models.OrderStatusPartiallyRefunded, models.OrderStatusDelivered, true},
+		{models.OrderStatusPartiallyRefunded, models.OrderStatusRefunded, true},
+		{models.OrderStatusPartiallyRefunded, models.OrderStatusCancelled, false},
+		{models.OrderStatusPartiallyRefunded, models.OrderStatusPending, false},
+
+		{models.OrderStatusCancelled, models.OrderStatusPending, false},
+		{models.OrderStatusCancelled, models.OrderStatusRefunded, false},
+		{models.OrderStatusRefunded, models.OrderStatusDelivered, false},
+
+		// Legacy and loosely formatted names map onto the state machine
+		{models.OrderStatusCompleted, models.OrderStatusRefunded, true},
+		{models.OrderStatusShipped, models.OrderStatusCompleted, true},
+		{" Paid ", "SHIPPED", true},
+		{"unknown", models.OrderStatusPaid, false},
+		{models.OrderStatusPaid, "unknown", false},
+	}
+	for _, tt := range tests {
+		if got := canTransitionOrder(tt.from, tt.to); got != tt.want {
+			t.Errorf("canTransitionOrder(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestEveryTransitionTargetIsAStatus(t *testing.T) {
+	for from, targets := range orderStatusTransitions {
+		for _, to := range targets {
+			if !isValidOrderStatus(to) {
+				t.Errorf("%s lists %s, which isn't an order status", from, to)
+			}
+			if to == from {
+				t.Errorf("%s lists itself as a transition", from)
+			}
+		}
+	}
+}
+
+func TestOrderTakesRefunds(t *testing.T) {
+	tests := map[string]bool{
+		models.OrderStatusPending:           false,
+		models.OrderStatusPartial:           false,
+		models.OrderStatusPaid:              true,
+		models.OrderStatusProcessing:        true,
+		models.OrderStatusPartiallyShipped:  true,
+		models.OrderStatusShipped:           true,
+		models.OrderStatusDelivered:         true,
+		models.OrderStatusCompleted:         true,
+		models.OrderStatusPartiallyRefunded: true,
+		models.OrderStatusCancelled:         true,
+		models.OrderStatusRefunded:          false,
+	}
+	for status, want := range tests {
+		if got := orderTakesRefunds(status); got != want {
+			t.Errorf("orderTakesRefunds(%q) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestCustomerCanCancel(t *testing.T) {
+	for status := range orderStatusTransitions {
+		want := status == models.OrderStatusPending || status == models.OrderStatusPartial || status == models.OrderStatusPaid
+		if got := customerCanCancel(status); got != want {
+			t.Errorf("customerCanCancel(%q) = %v, want %v", status, got, want)
+		}
+		// Whatever a customer may cancel, the state machine must allow too
+		if want && !canTransitionOrder(status, models.OrderStatusCancelled) {
+			t.Errorf("customers can cancel %s orders, but the state machine can't", status)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"ecom-backend/config"
+	"ecom-backend/database"
+	"ecom-backend/models"
+	"ecom-backend/money"
+	"ecom-backend/payments"
+	"ecom-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PayOrder starts an online payment for what is left to pay on an order, with the default
+// payment gateway or the active gateway named in the request. It returns the gateway's
+// hosted payment page to send the customer to. Guests name their order with its lookup token.
+// Starting a payment starts, or restarts, the clock on the order's stock reservation.
+func PayOrder(c *gin.Context) {
+	var req struct {
+		Gateway     string `json:"gateway"`
+		LookupToken string `json:"lookup_token"`
+	}
+	// Both fields are optional, so an empty body is fine
+	c.ShouldBindJSON(&req)
+
+	query := orderByIDOrNumber(database.DB.Preload("User"), c.Param("id"))
+	if req.LookupToken != "" {
+		query = query.Where("lookup_token_hash = ?", utils.HashToken(req.LookupToken))
+	} else if userID, exists := c.Get("userID"); exists {
+		query = query.Where("user_id = ?", userID)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign in or provide the order's lookup token"})
+		return
+	}
+	var order models.Order
+	if err := query.First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if order.IsPOS || order.Status != models.OrderStatusPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order is not awaiting payment"})
+		return
+	}
+
+	gateway := strings.ToLower(strings.TrimSpace(req.Gateway))
+	if gateway == "" {
+		gateway = payments.DefaultGateway()
+	}
+	if gateway == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Online payment is not available"})
+		return
+	}
+	provider, err := payments.Load(gateway)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Payment gateway %s is not available", gateway)})
+		return
+	}
+
+	collected, err := orderAmountCollected(database.DB, order.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payments"})
+		return
+	}
+	authorized, err := orderAmountAuthorized(database.DB, order.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payments"})
+		return
+	}
+	due := order.Total.Sub(collected).Sub(authorized)
+	if !due.IsPositive() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Nothing is left to pay on this order"})
+		return
+	}
+
+	// Earlier attempts the customer didn't finish are superseded by this one
+	payment := models.Payment{
+		OrderID: order.ID,
+		Method:  gateway,
+		Gateway: gateway,
+		Amount:  due,
+		Status:  models.PaymentStatusPending,
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Payment{}).Where("order_id = ? AND status = ?", order.ID, models.PaymentStatusPending).
+			Update("status", models.PaymentStatusCancelled).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&payment).Error; err != nil {
+			return err
+		}
+		return startReservationExpiry(tx, &order)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start payment"})
+		return
+	}
+
+	returnURL := apiBaseURL() + "/api/payments/" + strconv.FormatUint(uint64(payment.ID), 10) + "/return"
+	session, err := provider.CreateSession(c.Request.Context(), payments.SessionRequest{
+		PaymentID:   payment.ID,
+		OrderID:     order.ID,
+		OrderNumber: order.OrderNumber,
+		Description: "Order " + orderReference(order),
+		Amount:      due,
+		Currency:    orderCurrency(order),
+		Customer:    paymentCustomer(order),
+		ReturnURL:   returnURL,
+		CancelURL:   returnURL + "?cancelled=1",
+		NotifyURL:   database.GetSetting("payment_gateway_"+gateway+"_webhook_url", ""),
+	})
+	if err != nil {
+		log.Printf("Failed to start %s payment for order %d: %v", gateway, order.ID, err)
+		database.DB.Model(&payment).Update("status", models.PaymentStatusFailed)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "The payment gateway could not start the payment"})
+		return
+	}
+
+	payment.Reference = session.Reference
+	if err := database.DB.Model(&payment).Update("reference", session.Reference).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start payment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"payment":      payment,
+		"gateway":      gateway,
+		"redirect_url": session.RedirectURL,
+	})
+}
+
+// PaymentReturn is where gateways send the customer back to, after paying or giving up. The
+// payment is confirmed with the gateway and the customer is redirected to the store. Anyone
+// can call this URL, so only the gateway's answer changes the payment.
+func PaymentReturn(c *gin.Context) {
+	var payment models.Payment
+	if err := database.DB.Preload("Order").First(&payment, c.Param("id")).Error; err != nil || payment.Gateway == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+
+	if updated, err := confirmPayment(c.Request.Context(), payment); err != nil {
+		log.Printf("Failed to confirm payment %d: %v", payment.ID, err)
+	} else {
+		payment.Status = updated.Status
+	}
+
+	// A customer who gave up at the gateway is told so, but the payment stays pending until
+	// the gateway reports it, and the reservation sweeper cancels it if it never completes
+	status := payment.Status
+	if c.Query("cancelled") != "" && status == models.PaymentStatusPending {
+		status = models.PaymentStatusCancelled
+	}
+
+	target := strings.TrimRight(database.GetSetting("store_url", "http://localhost:10001"), "/") +
+		"/checkout/payment-result?" + url.Values{
+		"order":  {orderReference(payment.Order)},
+		"status": {status},
+	}.Encode()
+	c.Redirect(http.StatusSeeOther, target)
+}
+
+// confirmPayment asks the gateway for a payment's state and records it
+func confirmPayment(ctx context.Context, payment models.Payment) (models.Payment, error) {
+	if payment.Reference == "" {
+		return payment, errors.New("payment has no gateway reference")
+	}
+	provider, err := payments.Load(payment.Gateway)
+	if err != nil {
+		return payment, err
+	}
+	result, err := provider.Confirm(ctx, payment.Reference)
+	if err != nil {
+		return payment, err
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		payment, err = applyPaymentResult(tx, payment.ID, *result)
+		return err
+	})
+	return payment, err
+}
+
+// confirmPendingPayments checks with the gateways on an order's unfinished online payments
+func confirmPendingPayments(orderID uint) {
+	var pending []models.Payment
+	if err := database.DB.Where("order_id = ? AND status = ? AND gateway <> '' AND reference <> ''", orderID, models.PaymentStatusPending).
+		Find(&pending).Error; err != nil {
+		log.Printf("Failed to fetch pending payments for order %d: %v", orderID, err)
+		return
+	}
+	for _, payment := range pending {
+		if _, err := confirmPayment(context.Background(), payment); err != nil {
+			log.Printf("Failed to confirm payment %d: %v", payment.ID, err)
+		}
+	}
+}
+
+// applyPaymentResult records a gateway's report on a payment. Once captured payments cover
+// an order's total, the order moves to paid; once authorized and captured payments cover it,
+// a pending order goes ahead to processing and is captured when it ships. Refunds, whole or
+// partial, add to the payment's refunded amount; an order whose payments are all refunded
+// moves to refunded. A payment that completes after its order was
+// cancelled is flagged to admins.
+func applyPaymentResult(tx *gorm.DB, paymentID uint, result payments.Result) (models.Payment, error) {
+	var payment models.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, paymentID).Error; err != nil {
+		return payment, err
+	}
+	if result.Status == "" || result.Status == payment.Status {
+		return payment, nil
+	}
+	// A late or repeated report can't take a payment back to an earlier state
+	switch payment.Status {
+	case models.PaymentStatusRefunded, models.PaymentStatusVoided:
+		return payment, nil
+	case models.PaymentStatusCaptured:
+		if result.Status != models.PaymentStatusRefunded {
+			return payment, nil
+		}
+	case models.PaymentStatusAuthorized:
+		if result.Status == models.PaymentStatusPending {
+			return payment, nil
+		}
+		if result.Status == models.PaymentStatusCancelled {
+			result.Status = models.PaymentStatusVoided
+		}
+	}
+
+	updates := map[string]interface{}{"status": result.Status}
+	if result.TransactionID != "" && payment.TransactionID == "" {
+		updates["transaction_id"] = result.TransactionID
+	}
+	if result.Raw != "" {
+		updates["gateway_response"] = result.Raw
+	}
+	switch result.Status {
+	case models.PaymentStatusCaptured:
+		// A partial capture collects less than was authorized
+		captured := payment.Amount
+		if result.Amount.IsPositive() {
+			captured = min(captured, result.Amount)
+		}
+		updates["captured_amount"] = captured
+		updates["capture_id"] = payment.TransactionID
+		if result.TransactionID != "" {
+			updates["capture_id"] = result.TransactionID
+		}
+	case models.PaymentStatusRefunded:
+		// A refund we made ourselves was recorded when it was made
+		if result.RefundID != "" {
+			var recorded int64
+			if err := tx.Model(&models.RefundPayment{}).Where("payment_id = ? AND gateway_refund_id = ?", payment.ID, result.RefundID).
+				Count(&recorded).Error; err != nil {
+				return payment, err
+			}
+			if recorded > 0 {
+				return payment, nil
+			}
+		}
+		// The refund may be partial; the payment is refunded once nothing captured is left
+		refunded := payment.CapturedAmount
+		if result.Amount.IsPositive() {
+			refunded = min(payment.CapturedAmount, payment.RefundedAmount.Add(result.Amount))
+		}
+		updates["refunded_amount"] = refunded
+		if refunded < payment.CapturedAmount {
+			updates["status"] = payment.Status
+		}
+	}
+	if err := tx.Model(&payment).Updates(updates).Error; err != nil {
+		return payment, err
+	}
+	switch result.Status {
+	case models.PaymentStatusAuthorized, models.PaymentStatusCaptured, models.PaymentStatusRefunded:
+	default:
+		return payment, nil
+	}
+
+	var order models.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, payment.OrderID).Error; err != nil {
+		return payment, err
+	}
+	collected, err := orderAmountCollected(tx, order.ID)
+	if err != nil {
+		return payment, err
+	}
+
+	if result.Status == models.PaymentStatusRefunded {
+		// Refunded at the gateway, e.g. from its dashboard: an order left with nothing collected is refunded
+		if !collected.IsPositive() && canTransitionOrder(order.Status, models.OrderStatusRefunded) {
+			return payment, transitionOrderStatus(tx, &order, models.OrderStatusRefunded, nil, "Payment refunded via "+payment.Gateway)
+		}
+		return payment, nil
+	}
+
+	if order.Status == models.OrderStatusCancelled {
+		action := "needs refunding"
+		if result.Status == models.PaymentStatusAuthorized {
+			action = "needs voiding"
+		}
+		return payment, tx.Create(&models.Notification{
+			Type:    "order",
+			Title:   "Payment received for cancelled order",
+			Message: fmt.Sprintf("A %s payment via %s arrived after order %s was cancelled and %s", orderCurrency(order).Format(payment.Amount), payment.Gateway, orderReference(order), action),
+		}).Error
+	}
+
+	if result.Status == models.PaymentStatusAuthorized {
+		authorized, err := orderAmountAuthorized(tx, order.ID)
+		if err != nil {
+			return payment, err
+		}
+		if order.Status == models.OrderStatusPending && collected.Add(authorized) >= order.Total {
+			return payment, transitionOrderStatus(tx, &order, models.OrderStatusProcessing, nil, "Payment authorized via "+payment.Gateway)
+		}
+		return payment, nil
+	}
+
+	if (order.Status == models.OrderStatusPending || order.Status == models.OrderStatusPartial) && collected >= order.Total {
+		return payment, transitionOrderStatus(tx, &order, models.OrderStatusPaid, nil, "Paid online via "+payment.Gateway)
+	}
+	return payment, nil
+}
+
+// orderAmountCollected returns what an order's payments have captured and not refunded, in
+// the order's currency
+func orderAmountCollected(db *gorm.DB, orderID uint) (money.Money, error) {
+	var collected money.Money
+	err := db.Model(&models.Payment{}).Where("order_id = ?", orderID).
+		Select("COALESCE(SUM(captured_amount - refunded_amount), 0)").Scan(&collected).Error
+	return collected, err
+}
+
+// orderAmountAuthorized returns the sum of an order's payments authorized but not yet captured
+func orderAmountAuthorized(db *gorm.DB, orderID uint) (money.Money, error) {
+	var authorized money.Money
+	err := db.Model(&models.Payment{}).Where("order_id = ? AND status = ?", orderID, models.PaymentStatusAuthorized).
+		Select("COALESCE(SUM(amount), 0)").Scan(&authorized).Error
+	return authorized, err
+}
+
+// paymentCustomer returns the billing details gateways ask for
+func paymentCustomer(order models.Order) payments.Customer {
+	customer := payments.Customer{
+		Name:       order.GuestName,
+		Email:      order.GuestEmail,
+		Phone:      order.Phone,
+		Address:    order.Address,
+		City:       order.City,
+		PostalCode: order.PostalCode,
+		Country:    order.Country,
+	}
+	if order.User != nil {
+		customer.Name, customer.Email = order.User.Name, order.User.Email
+	}
+	if customer.Phone == "" {
+		customer.Phone = order.GuestPhone
+	}
+	return customer
+}
+
+// apiBaseURL returns the public address of this API, for links gateways call back to
+func apiBaseURL() string {
+	return strings.TrimRight(database.GetSetting("api_url", "http://localhost:"+config.LoadConfig().Port), "/")
+}
@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"ecom-backend/database"
+	"ecom-backend/models"
+	"ecom-backend/money"
+	"ecom-backend/payments"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PaymentSummary totals an order's payments by state, in the order's currency
+type PaymentSummary struct {
+	Total      money.Money `json:"total"`
+	Authorized money.Money `json:"authorized"` // Approved by a gateway but not yet captured
+	Captured   money.Money `json:"captured"`
+	Refunded   money.Money `json:"refunded"`
+	Paid       money.Money `json:"paid"`        // Captured less refunded
+	BalanceDue money.Money `json:"balance_due"` // Total less paid
+}
+
+// paymentActionError is a capture or void the payment's state doesn't allow, reported as
+// 409 Conflict
+type paymentActionError struct {
+	Message string
+}
+
+func (e *paymentActionError) Error() string {
+	return e.Message
+}
+
+// GetOrderPayments returns an order's payments with what has been authorized, paid and is
+// still due (admin only)
+func GetOrderPayments(c *gin.Context) {
+	var order models.Order
+	if err := orderByIDOrNumber(database.DB, c.Param("id")).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	var orderPayments []models.Payment
+	if err := database.DB.Where("order_id = ?", order.ID).Order("created_at ASC").Find(&orderPayments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"payments": orderPayments,
+		"summary":  summarizePayments(order.Total, orderPayments),
+	})
+}
+
+// CapturePayment collects an authorized online payment, in full or, when an amount is given,
+// partially. Gateways release whatever of the authorization isn't captured (admin only).
+func CapturePayment(c *gin.Context) {
+	var req struct {
+		Amount money.Money `json:"amount"` // Leave out to capture the full authorization
+	}
+	// The amount is optional, so an empty body is fine
+	c.ShouldBindJSON(&req)
+
+	var payment models.Payment
+	if err := database.DB.Preload("Order").First(&payment, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+	if req.Amount.IsNegative() || req.Amount > payment.Amount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Capture amount must be between 0 and the authorized " + orderCurrency(payment.Order).Format(payment.Amount)})
+		return
+	}
+
+	payment, err := capturePayment(c.Request.Context(), payment, req.Amount)
+	if err != nil {
+		respondPaymentActionError(c, err, "capture")
+		return
+	}
+
+	LogAction(actorIDOrZero(c), "capture", "payment", payment.ID, gin.H{
+		"order_id": payment.OrderID,
+		"amount":   payment.CapturedAmount,
+		"status":   payment.Status,
+	}, c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Payment captured", "payment": payment})
+}
+
+// VoidPayment releases an authorized online payment without collecting it (admin only)
+func VoidPayment(c *gin.Context) {
+	var payment models.Payment
+	if err := database.DB.Preload("Order").First(&payment, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+
+	payment, err := voidPayment(c.Request.Context(), payment)
+	if err != nil {
+		respondPaymentActionError(c, err, "void")
+		return
+	}
+
+	LogAction(actorIDOrZero(c), "void", "payment", payment.ID, gin.H{
+		"order_id": payment.OrderID,
+		"amount":   payment.Amount,
+		"status":   payment.Status,
+	}, c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Payment voided", "payment": payment})
+}
+
+// capturePayment asks the gateway to collect an authorized payment and records the result. A
+// zero amount captures the full authorization. The payment's Order must be loaded.
+func capturePayment(ctx context.Context, payment models.Payment, amount money.Money) (models.Payment, error) {
+	if payment.Status != models.PaymentStatusAuthorized {
+		return payment, &paymentActionError{Message: "Only authorized payments can be captured"}
+	}
+	provider, err := payments.Load(payment.Gateway)
+	if err != nil {
+		return payment, err
+	}
+	result, err := provider.Capture(ctx, payments.CaptureRequest{
+		Reference:     payment.Reference,
+		TransactionID: payment.TransactionID,
+		Amount:        amount,
+		Currency:      orderCurrency(payment.Order),
+	})
+	if err != nil {
+		return payment, err
+	}
+	return recordPaymentResult(payment.ID, *result)
+}
+
+// voidPayment asks the gateway to release an authorized payment and records the result
+func voidPayment(ctx context.Context, payment models.Payment) (models.Payment, error) {
+	if payment.Status != models.PaymentStatusAuthorized {
+		return payment, &paymentActionError{Message: "Only authorized payments can be voided"}
+	}
+	provider, err := payments.Load(payment.Gateway)
+	if err != nil {
+		return payment, err
+	}
+	result, err := provider.Void(ctx, payments.VoidRequest{
+		Reference:     payment.Reference,
+		TransactionID: payment.TransactionID,
+	})
+	if err != nil {
+		return payment, err
+	}
+	return recordPaymentResult(payment.ID, *result)
+}
+
+// recordPaymentResult applies a gateway's answer to a payment and returns the updated payment
+func recordPaymentResult(paymentID uint, result payments.Result) (models.Payment, error) {
+	var payment models.Payment
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := applyPaymentResult(tx, paymentID, result); err != nil {
+			return err
+		}
+		return tx.First(&payment, paymentID).Error
+	})
+	return payment, err
+}
+
+// settleOrderPayments captures an order's authorized payments once it ships and voids them
+// once it is cancelled. It calls the gateways, so it runs after the status change has been
+// committed; failures are flagged to admins, who can retry from the order's payments.
+func settleOrderPayments(order models.Order) {
+	capture := false
+	switch order.Status {
+	case models.OrderStatusPartiallyShipped, models.OrderStatusShipped, models.OrderStatusDelivered:
+		capture = true
+	case models.OrderStatusCancelled:
+	default:
+		return
+	}
+
+	var authorized []models.Payment
+	if err := database.DB.Preload("Order").Where("order_id = ? AND status = ?", order.ID, models.PaymentStatusAuthorized).
+		Find(&authorized).Error; err != nil {
+		log.Printf("Failed to fetch authorized payments for order %d: %v", order.ID, err)
+		return
+	}
+	for _, payment := range authorized {
+		action, err := "capture", error(nil)
+		if capture {
+			_, err = capturePayment(context.Background(), payment, 0)
+		} else {
+			action = "void"
+			_, err = voidPayment(context.Background(), payment)
+		}
+		if err == nil {
+			continue
+		}
+		log.Printf("Failed to %s payment %d: %v", action, payment.ID, err)
+		database.DB.Create(&models.Notification{
+			Type:    "order",
+			Title:   "Payment " + action + " failed",
+			Message: fmt.Sprintf("The %s payment via %s for order %s could not be %sed: %v", orderCurrency(order).Format(payment.Amount), payment.Gateway, orderReference(order), action, err),
+		})
+	}
+}
+
+// summarizePayments totals an order's payments by state
+func summarizePayments(total money.Money, orderPayments []models.Payment) PaymentSummary {
+	summary := PaymentSummary{Total: total}
+	for _, payment := range orderPayments {
+		if payment.Status == models.PaymentStatusAuthorized {
+			summary.Authorized = summary.Authorized.Add(payment.Amount)
+		}
+		summary.Captured = summary.Captured.Add(payment.CapturedAmount)
+		summary.Refunded = summary.Refunded.Add(payment.RefundedAmount)
+	}
+	summary.Paid = summary.Captured.Sub(summary.Refunded)
+	summary.BalanceDue = total.Sub(summary.Paid)
+	return summary
+}
+
+// respondPaymentActionError reports why a capture or void failed
+func respondPaymentActionError(c *gin.Context, err error, action string) {
+	var actionErr *paymentActionError
+	var gatewayErr *payments.GatewayError
+	switch {
+	case errors.As(err, &actionErr):
+		c.JSON(http.StatusConflict, gin.H{"error": actionErr.Message})
+	case errors.Is(err, payments.ErrNotSupported):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This payment gateway can't " + action + " payments"})
+	case errors.Is(err, payments.ErrNotConfigured), errors.Is(err, payments.ErrUnknownGateway):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Payment gateway not available"})
+	case errors.As(err, &gatewayErr):
+		c.JSON(http.StatusBadGateway, gin.H{"error": "The payment gateway declined the " + action + ": " + gatewayErr.Message})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action + " payment"})
+	}
+}
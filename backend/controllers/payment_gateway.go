@@ -6,6 +6,8 @@ import (
 
 	"ecom-backend/database"
 	"ecom-backend/models"
+	"ecom-backend/payments"
+	"ecom-backend/secrets"
 
 	"github.com/gin-gonic/gin"
 )
@@ -23,6 +25,9 @@ type PaymentGatewayConfig struct {
 	ClientID     string `json:"client_id,omitempty"`             // Client ID (for PayPal)
 	ClientSecret string `json:"client_secret,omitempty"`         // Client Secret (for PayPal)
 	WebhookURL   string `json:"webhook_url,omitempty"`           // Webhook URL for callbacks
+	WebhookSecret string `json:"webhook_secret,omitempty"`       // Webhook signing secret (for Stripe)
+	WebhookID    string `json:"webhook_id,omitempty"`            // Webhook ID (for PayPal signature verification)
+	CaptureMode  string `json:"capture_mode,omitempty"`          // automatic, or manual to authorize at checkout and capture on shipment
 	AdditionalConfig map[string]interface{} `json:"additional_config,omitempty"` // Additional gateway-specific config
 }
 
@@ -109,17 +114,22 @@ func GetPaymentGateways(c *gin.Context) {
 		"payment_gateway_stripe_public_key",
 		"payment_gateway_stripe_secret_key",
 		"payment_gateway_stripe_webhook_url",
+		"payment_gateway_stripe_webhook_secret",
+		"payment_gateway_stripe_capture_mode",
 		"payment_gateway_sslcommerz_active",
 		"payment_gateway_sslcommerz_test_mode",
 		"payment_gateway_sslcommerz_store_id",
 		"payment_gateway_sslcommerz_store_password",
 		"payment_gateway_sslcommerz_merchant_id",
 		"payment_gateway_sslcommerz_webhook_url",
+		"payment_gateway_sslcommerz_capture_mode",
 		"payment_gateway_paypal_active",
 		"payment_gateway_paypal_test_mode",
 		"payment_gateway_paypal_client_id",
 		"payment_gateway_paypal_client_secret",
 		"payment_gateway_paypal_webhook_url",
+		"payment_gateway_paypal_webhook_id",
+		"payment_gateway_paypal_capture_mode",
 		"payment_gateway_default", // Which gateway is set as default
 	}
 	
@@ -128,10 +138,13 @@ func GetPaymentGateways(c *gin.Context) {
 		return
 	}
 
-	// Convert to map for easier access
+	// Convert to map for easier access; secrets are only ever shown masked
 	settingsMap := make(map[string]string)
 	for _, setting := range settings {
 		settingsMap[setting.Key] = setting.Value
+		if database.IsSecretSetting(setting.Key) {
+			settingsMap[setting.Key] = database.MaskedSetting(setting.Key, setting.Value)
+		}
 	}
 
 	// Build gateway configurations
@@ -143,6 +156,8 @@ func GetPaymentGateways(c *gin.Context) {
 			PublicKey:    settingsMap["payment_gateway_stripe_public_key"],
 			SecretKey:    settingsMap["payment_gateway_stripe_secret_key"],
 			WebhookURL:   settingsMap["payment_gateway_stripe_webhook_url"],
+			WebhookSecret: settingsMap["payment_gateway_stripe_webhook_secret"],
+			CaptureMode:  captureMode(settingsMap["payment_gateway_stripe_capture_mode"]),
 		},
 		{
 			Gateway:      "sslcommerz",
@@ -152,6 +167,7 @@ func GetPaymentGateways(c *gin.Context) {
 			StorePassword: settingsMap["payment_gateway_sslcommerz_store_password"],
 			MerchantID:   settingsMap["payment_gateway_sslcommerz_merchant_id"],
 			WebhookURL:   settingsMap["payment_gateway_sslcommerz_webhook_url"],
+			CaptureMode:  captureMode(settingsMap["payment_gateway_sslcommerz_capture_mode"]),
 		},
 		{
 			Gateway:      "paypal",
@@ -160,6 +176,8 @@ func GetPaymentGateways(c *gin.Context) {
 			ClientID:     settingsMap["payment_gateway_paypal_client_id"],
 			ClientSecret: settingsMap["payment_gateway_paypal_client_secret"],
 			WebhookURL:   settingsMap["payment_gateway_paypal_webhook_url"],
+			WebhookID:    settingsMap["payment_gateway_paypal_webhook_id"],
+			CaptureMode:  captureMode(settingsMap["payment_gateway_paypal_capture_mode"]),
 		},
 	}
 
@@ -211,6 +229,9 @@ func UpdatePaymentGateway(c *gin.Context) {
 		if req.WebhookURL != "" {
 			settingsToSave["payment_gateway_stripe_webhook_url"] = req.WebhookURL
 		}
+		if req.WebhookSecret != "" {
+			settingsToSave["payment_gateway_stripe_webhook_secret"] = req.WebhookSecret
+		}
 	case "sslcommerz":
 		if req.StoreID != "" {
 			settingsToSave["payment_gateway_sslcommerz_store_id"] = req.StoreID
@@ -234,28 +255,46 @@ func UpdatePaymentGateway(c *gin.Context) {
 		if req.WebhookURL != "" {
 			settingsToSave["payment_gateway_paypal_webhook_url"] = req.WebhookURL
 		}
+		if req.WebhookID != "" {
+			settingsToSave["payment_gateway_paypal_webhook_id"] = req.WebhookID
+		}
+	}
+
+	switch req.CaptureMode {
+	case "":
+	case payments.CaptureAutomatic, payments.CaptureManual:
+		if req.CaptureMode == payments.CaptureManual && req.Gateway == payments.GatewaySSLCommerz {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "SSLCommerz captures payments at checkout and can't use manual capture"})
+			return
+		}
+		settingsToSave[fmt.Sprintf("payment_gateway_%s_capture_mode", req.Gateway)] = req.CaptureMode
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Capture mode must be automatic or manual"})
+		return
 	}
 
-	// Save settings
 	for key, value := range settingsToSave {
-		var setting models.Setting
-		result := database.DB.Where("key = ?", key).First(&setting)
-		
-		if result.Error != nil {
-			// Create new setting
-			setting = models.Setting{
-				Key:   key,
-				Value: value,
-				Type:  "string",
-			}
-			database.DB.Create(&setting)
-		} else {
-			// Update existing setting
-			setting.Value = value
-			database.DB.Save(&setting)
+		if secretsKeyMissing(key, value) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Gateway secrets can't be saved until SECRETS_KEY is configured"})
+			return
 		}
 	}
 
+	// Save settings. Secrets are write-only: a masked value sent back unchanged is skipped.
+	changes := make(map[string]interface{})
+	for key, value := range settingsToSave {
+		if database.IsSecretSetting(key) && secrets.IsMasked(value) {
+			continue
+		}
+		if err := database.SetSetting(key, value, "string"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save payment gateway settings"})
+			return
+		}
+		changes[key] = value
+	}
+
+	LogAction(actorIDOrZero(c), "update", "payment_gateway", 0, changes, c)
+
 	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Payment gateway %s updated successfully", req.Gateway)})
 }
 
@@ -302,6 +341,14 @@ func SetDefaultPaymentGateway(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Default payment gateway set to %s", req.Gateway)})
 }
 
+// captureMode returns a gateway's capture mode setting, automatic when unset
+func captureMode(value string) string {
+	if value == payments.CaptureManual {
+		return value
+	}
+	return payments.CaptureAutomatic
+}
+
 // Helper function to convert bool to string
 func boolToString(b bool) string {
 	if b {
@@ -0,0 +1,273 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ecom-backend/database"
+	"ecom-backend/models"
+	"ecom-backend/payments"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxWebhookBody caps the size of a webhook delivery we read
+const maxWebhookBody = 1 << 20
+
+// webhookClaimTimeout is how long a claimed event may stay processing before another
+// delivery or a replay may take it over, e.g. after a crash mid-way
+const webhookClaimTimeout = 10 * time.Minute
+
+// errWebhookInProgress is returned for an event another delivery or replay is applying
+var errWebhookInProgress = errors.New("webhook event is already being processed")
+
+// ReceivePaymentWebhook accepts a callback from a payment gateway. The delivery is verified
+// with the gateway's signature scheme, stored once per event ID, and applied to the payment
+// and order it concerns. Failures answer 500 so the gateway retries the delivery.
+func ReceivePaymentWebhook(c *gin.Context) {
+	gateway := c.Param("gateway")
+	provider, err := payments.Load(gateway)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment gateway not available"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	event, err := provider.ParseWebhook(c.Request.Context(), c.Request.Header, body)
+	if err != nil {
+		if errors.Is(err, payments.ErrInvalidSignature) {
+			log.Printf("Rejected %s webhook from %s: invalid signature", gateway, c.ClientIP())
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signature"})
+			return
+		}
+		var gatewayErr *payments.GatewayError
+		if errors.As(err, &gatewayErr) {
+			// Verification needs the gateway's API; let the gateway retry once it answers
+			log.Printf("Could not verify %s webhook: %v", gateway, err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Could not verify webhook"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	record := models.PaymentWebhookEvent{
+		Gateway:       gateway,
+		EventID:       event.ID,
+		Type:          event.Type,
+		Payload:       string(body),
+		Reference:     event.Reference,
+		TransactionID: event.TransactionID,
+		PaymentStatus: event.Status,
+		Amount:        event.Amount,
+		Currency:      event.Currency,
+		RefundID:      event.RefundID,
+		Status:        models.WebhookReceived,
+	}
+	result := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "gateway"}, {Name: "event_id"}},
+		DoNothing: true,
+	}).Create(&record)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store webhook"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		// A redelivery: apply it again only if the first attempt didn't get through
+		if err := database.DB.Where("gateway = ? AND event_id = ?", gateway, event.ID).First(&record).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load webhook"})
+			return
+		}
+		if record.Status != models.WebhookFailed && record.Status != models.WebhookReceived {
+			c.JSON(http.StatusOK, gin.H{"received": true, "duplicate": true})
+			return
+		}
+	}
+
+	if err := processWebhookEvent(c.Request.Context(), &record); err != nil {
+		if errors.Is(err, errWebhookInProgress) {
+			// The first delivery is still applying it and answers for both
+			c.JSON(http.StatusOK, gin.H{"received": true, "duplicate": true})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process webhook"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
+
+// GetPaymentWebhookEvents returns stored webhook events, newest first, optionally filtered
+// by gateway, status or payment (admin only)
+func GetPaymentWebhookEvents(c *gin.Context) {
+	query := database.DB.Model(&models.PaymentWebhookEvent{})
+	if gateway := c.Query("gateway"); gateway != "" {
+		query = query.Where("gateway = ?", gateway)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if paymentID := c.Query("payment_id"); paymentID != "" {
+		query = query.Where("payment_id = ?", paymentID)
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 50
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var events []models.PaymentWebhookEvent
+	if err := query.Omit("payload").Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhook events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (int(total) + limit - 1) / limit,
+		},
+	})
+}
+
+// GetPaymentWebhookEvent returns a stored webhook event with its raw payload (admin only)
+func GetPaymentWebhookEvent(c *gin.Context) {
+	var event models.PaymentWebhookEvent
+	if err := database.DB.First(&event, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook event not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, event)
+}
+
+// ReplayPaymentWebhookEvent applies a stored event again, e.g. after fixing what made it
+// fail. The event was verified when it arrived, so its signature isn't checked again (admin only).
+func ReplayPaymentWebhookEvent(c *gin.Context) {
+	var event models.PaymentWebhookEvent
+	if err := database.DB.First(&event, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook event not found"})
+		return
+	}
+	if event.Status == models.WebhookProcessed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Webhook event was already processed"})
+		return
+	}
+
+	previous := event.Status
+	err := processWebhookEvent(c.Request.Context(), &event)
+	if errors.Is(err, errWebhookInProgress) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Webhook event is being processed"})
+		return
+	}
+	LogAction(actorIDOrZero(c), "replay", "payment_webhook_event", event.ID, gin.H{"from": previous, "to": event.Status, "error": event.Error}, c)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Replay failed: " + event.Error, "event": event})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook event replayed", "event": event})
+}
+
+// processWebhookEvent applies a stored event to the payment it concerns and records the
+// outcome on the event. Events that report a payment still pending, such as an approved
+// PayPal order, are confirmed with the gateway, which also captures them where needed. The
+// event is claimed first, so concurrent deliveries of it can't apply it twice.
+func processWebhookEvent(ctx context.Context, event *models.PaymentWebhookEvent) error {
+	claim := database.DB.Model(&models.PaymentWebhookEvent{}).
+		Where("id = ? AND (status IN ? OR (status = ? AND updated_at < ?))", event.ID,
+			[]string{models.WebhookReceived, models.WebhookFailed, models.WebhookIgnored},
+			models.WebhookProcessing, time.Now().Add(-webhookClaimTimeout)).
+		Update("status", models.WebhookProcessing)
+	if claim.Error != nil {
+		return claim.Error
+	}
+	if claim.RowsAffected == 0 {
+		return errWebhookInProgress
+	}
+
+	event.Attempts++
+	event.Status, event.Error = models.WebhookReceived, ""
+
+	payment, err := webhookPayment(event)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		event.Status, event.Error = models.WebhookIgnored, "No payment matches this event"
+		err = nil
+	case err != nil:
+	case event.PaymentStatus == "":
+		event.PaymentID = &payment.ID
+		event.Status = models.WebhookIgnored
+	case event.PaymentStatus == models.PaymentStatusPending:
+		event.PaymentID = &payment.ID
+		_, err = confirmPayment(ctx, payment)
+	default:
+		event.PaymentID = &payment.ID
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			_, err := applyPaymentResult(tx, payment.ID, payments.Result{
+				Reference:     event.Reference,
+				TransactionID: event.TransactionID,
+				Status:        event.PaymentStatus,
+				Amount:        event.Amount,
+				Currency:      event.Currency,
+				RefundID:      event.RefundID,
+			})
+			return err
+		})
+	}
+
+	if err != nil {
+		event.Status, event.Error = models.WebhookFailed, err.Error()
+		log.Printf("Failed to process %s webhook %s: %v", event.Gateway, event.EventID, err)
+	} else if event.Status == models.WebhookReceived {
+		event.Status = models.WebhookProcessed
+	}
+	now := time.Now()
+	event.ProcessedAt = &now
+	if saveErr := database.DB.Save(event).Error; saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return err
+}
+
+// webhookPayment finds the payment an event is about, by gateway session, transaction or
+// capture ID
+func webhookPayment(event *models.PaymentWebhookEvent) (models.Payment, error) {
+	var payment models.Payment
+	if event.Reference == "" && event.TransactionID == "" {
+		return payment, gorm.ErrRecordNotFound
+	}
+	query := database.DB.Where("gateway = ?", event.Gateway)
+	switch {
+	case event.Reference != "" && event.TransactionID != "":
+		query = query.Where("reference = ? OR transaction_id = ? OR capture_id = ?", event.Reference, event.TransactionID, event.TransactionID)
+	case event.Reference != "":
+		query = query.Where("reference = ?", event.Reference)
+	default:
+		// Refunds name the capture, which differs from the authorization for manual captures
+		query = query.Where("transaction_id = ? OR capture_id = ?", event.TransactionID, event.TransactionID)
+	}
+	err := query.Order("id DESC").First(&payment).Error
+	return payment, err
+}
@@ -1,17 +1,20 @@
 package controllers
 
 import (
-	"encoding/json"
 	"log"
 	"net/http"
 	"strconv"
-	"time"
+	"strings"
 
 	"ecom-backend/database"
 	"ecom-backend/models"
+	"ecom-backend/money"
+	"ecom-backend/pricing"
+	"ecom-backend/shipping"
 	"ecom-backend/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type POSOrderRequest struct {
@@ -25,18 +28,19 @@ type POSOrderRequest struct {
 	Payments    []POSPayment           `json:"payments" binding:"required"` // Multiple payments
 	Notes       string                 `json:"notes"`
 	StockType   string                 `json:"stock_type"` // "website" or "showroom", defaults to "website"
+	StoreCode   string                 `json:"store_code"` // Till's store, for the order number; defaults to the POS settings' store_code
 }
 
 type POSPayment struct {
-	Method    string  `json:"method" binding:"required"` // cash, card, mobile, etc.
-	Amount    float64 `json:"amount" binding:"required,gt=0"`
-	Reference string  `json:"reference"` // Transaction reference, receipt number, etc.
+	Method    string  `json:"method" binding:"required"` // cash, card, mobile, gift_card, store_credit, etc.
+	Amount    money.Money `json:"amount" binding:"required,gt=0"`
+	Reference string  `json:"reference"` // Transaction reference, receipt number, etc.; the code for gift cards
 }
 
 type POSOrderItem struct {
 	ProductID  uint              `json:"product_id" binding:"required"`
 	Quantity   int               `json:"quantity" binding:"required,min=1"`
-	Price      float64           `json:"price" binding:"required"`
+	Price      money.Money       `json:"price" binding:"required"`
 	Variations map[string]string `json:"variations"`
 }
 
@@ -52,7 +56,7 @@ func CreatePOSOrder(c *gin.Context) {
 	// Debug: Log received payments
 	log.Printf("Received %d payments for POS order", len(req.Payments))
 	for i, payment := range req.Payments {
-		log.Printf("Payment %d: Method=%s, Amount=%.2f, Reference=%s", i+1, payment.Method, payment.Amount, payment.Reference)
+		log.Printf("Payment %d: Method=%s, Amount=%s, Reference=%s", i+1, payment.Method, payment.Amount, payment.Reference)
 	}
 
 	if len(req.Items) == 0 {
@@ -96,9 +100,10 @@ func CreatePOSOrder(c *gin.Context) {
 		stockType = "website"
 	}
 
-	// Calculate total and check stock
-	var total float64
-	for _, item := range req.Items {
+	// Check stock for the chosen stock type
+	products := make([]models.Product, len(req.Items))
+	lines := make([]pricing.Line, len(req.Items))
+	for i, item := range req.Items {
 		var product models.Product
 		if err := database.DB.First(&product, item.ProductID).Error; err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
@@ -119,33 +124,10 @@ func CreatePOSOrder(c *gin.Context) {
 			return
 		}
 
-		total += item.Price * float64(item.Quantity)
-	}
-
-	// Apply coupon if provided
-	var discount float64
-	if req.CouponCode != "" {
-		var coupon models.Coupon
-		if err := database.DB.Where("code = ? AND is_active = ?", req.CouponCode, true).First(&coupon).Error; err == nil {
-			now := time.Now()
-			// Check validity period (inclusive start and end to match ValidateCoupon)
-			valid := !now.Before(coupon.ValidFrom) && !now.After(coupon.ValidUntil)
-			if valid && (coupon.UsageLimit == 0 || coupon.UsedCount < coupon.UsageLimit) {
-				if total >= coupon.MinPurchase {
-					if coupon.Type == "percentage" {
-						discount = total * (coupon.Value / 100)
-						if coupon.MaxDiscount > 0 && discount > coupon.MaxDiscount {
-							discount = coupon.MaxDiscount
-						}
-					} else {
-						discount = coupon.Value
-					}
-					total -= discount
-					coupon.UsedCount++
-					database.DB.Save(&coupon)
-				}
-			}
-		}
+		// The cashier's price is kept as an override of the catalogue price
+		price := item.Price
+		products[i] = product
+		lines[i] = pricing.Line{Product: product, Quantity: item.Quantity, Variations: item.Variations, UnitPrice: &price}
 	}
 
 	// Set default values for walk-in customers
@@ -166,14 +148,42 @@ func CreatePOSOrder(c *gin.Context) {
 		country = "N/A"
 	}
 
+	// Price the sale with the same engine as web checkout. Counter sales carry no shipping
+	// and are always rung up in the base currency.
+	currency, err := pricing.BaseCurrency(database.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load currency"})
+		return
+	}
+	quote, err := pricing.Calculate(database.DB, pricing.Request{
+		Lines:       lines,
+		CouponCode:  req.CouponCode,
+		Destination: shipping.Destination{Country: req.Country, City: req.City, PostalCode: req.PostalCode},
+		InStore:     true,
+		Currency:    currency,
+	})
+	if err != nil {
+		respondPricingError(c, err)
+		return
+	}
+	for i, line := range quote.Lines {
+		for _, option := range line.Options {
+			if option.Stock < req.Items[i].Quantity {
+				c.JSON(http.StatusBadRequest, gin.H{"error": products[i].Name + ": Insufficient stock for option: " + option.Value})
+				return
+			}
+		}
+	}
+	total := quote.Total
+
 	// Validate payments
-	var totalPaid float64
+	var totalPaid money.Money
 	for _, payment := range req.Payments {
-		if payment.Amount <= 0 {
+		if !payment.Amount.IsPositive() {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Payment amount must be greater than 0"})
 			return
 		}
-		totalPaid += payment.Amount
+		totalPaid = totalPaid.Add(payment.Amount)
 	}
 
 	if totalPaid > total {
@@ -181,87 +191,156 @@ func CreatePOSOrder(c *gin.Context) {
 		return
 	}
 
-	// Determine order status based on payment
-	orderStatus := "pending"
+	// Gift cards and store credit must cover their payments; they are debited with the sale
+	tenders := make([]*storedValueTender, len(req.Payments))
+	for i, payment := range req.Payments {
+		var balance money.Money
+		switch payment.Method {
+		case models.PaymentMethodGiftCard:
+			card, err := lookupGiftCard(c, payment.Reference)
+			if err != nil {
+				respondGiftCardLookupError(c, err, http.StatusBadRequest)
+				return
+			}
+			balance = card.Balance
+			tenders[i] = &storedValueTender{Method: payment.Method, GiftCardID: card.ID}
+		case models.PaymentMethodStoreCredit:
+			if req.CustomerID == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Store credit needs a customer on the sale"})
+				return
+			}
+			if balance, err = storeCreditBalance(database.DB, userID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store credit"})
+				return
+			}
+			tenders[i] = &storedValueTender{Method: payment.Method, UserID: userID}
+		default:
+			continue
+		}
+		if balance < payment.Amount {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient " + strings.ReplaceAll(payment.Method, "_", " ") + " balance: " + currency.Format(balance) + " available"})
+			return
+		}
+	}
+
+	// Determine order status based on payment. Fully paid POS sales are handed over at the counter.
+	orderStatus := models.OrderStatusPending
 	if totalPaid >= total {
-		orderStatus = "completed"
+		orderStatus = models.OrderStatusDelivered
 	} else if totalPaid > 0 {
-		orderStatus = "partial"
+		orderStatus = models.OrderStatusPartial
 	}
 
 	// Create order
 	order := models.Order{
-		UserID:     userID,
-		Total:      total,
+		UserID:     &userID,
 		Status:     orderStatus,
 		Address:    address,
 		City:       city,
 		PostalCode: postalCode,
 		Country:    country,
 		IsPOS:      true, // Mark as POS order
+		StockType:  stockType,
 	}
+	quote.ApplyTo(&order)
 
-	if err := database.DB.Create(&order).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
-		return
-	}
+	// Create the order, payments, items and stock deductions atomically
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if quote.Coupon != nil {
+			if err := claimCouponUsage(tx, quote.Coupon.ID); err != nil {
+				return err
+			}
+		}
 
-	// Create payments
-	log.Printf("Creating %d payments for order ID %d", len(req.Payments), order.ID)
-	for i, payment := range req.Payments {
-		paymentRecord := models.Payment{
-			OrderID:   order.ID,
-			Method:    payment.Method,
-			Amount:    payment.Amount,
-			Reference: payment.Reference,
+		storeCode := req.StoreCode
+		if storeCode == "" {
+			storeCode = posStoreCode(tx)
 		}
-		if err := database.DB.Create(&paymentRecord).Error; err != nil {
-			log.Printf("Failed to create payment %d: %v", i+1, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment"})
-			return
+		if err := assignOrderNumber(tx, &order, orderChannelPOS, storeCode); err != nil {
+			return err
 		}
-		log.Printf("Created payment %d: ID=%d, Method=%s, Amount=%.2f", i+1, paymentRecord.ID, paymentRecord.Method, paymentRecord.Amount)
-	}
-
-	// Create order items and update stock
-	for _, item := range req.Items {
-		var product models.Product
-		database.DB.First(&product, item.ProductID)
-
-		// Serialize variations
-		variationsJSON := ""
-		if item.Variations != nil && len(item.Variations) > 0 {
-			variationsBytes, _ := json.Marshal(item.Variations)
-			variationsJSON = string(variationsBytes)
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		if err := recordOrderStatus(tx, order.ID, "", order.Status, currentActorID(c), "POS sale"); err != nil {
+			return err
 		}
 
-		orderItem := models.OrderItem{
-			OrderID:    order.ID,
-			ProductID:  item.ProductID,
-			Quantity:   item.Quantity,
-			Price:      item.Price,
-			Variations: variationsJSON,
+		// Create payments
+		log.Printf("Creating %d payments for order ID %d", len(req.Payments), order.ID)
+		for i, payment := range req.Payments {
+			if tender := tenders[i]; tender != nil {
+				applied, err := redeemStoredValue(tx, &order, *tender, payment.Amount, currency, currentActorID(c))
+				if err != nil {
+					return err
+				}
+				if applied < payment.Amount {
+					return &orderConflictError{Message: "Insufficient " + strings.ReplaceAll(payment.Method, "_", " ") + " balance"}
+				}
+				continue
+			}
+			paymentRecord := models.Payment{
+				OrderID:        order.ID,
+				Method:         payment.Method,
+				Amount:         payment.Amount,
+				CapturedAmount: payment.Amount,
+				Reference:      payment.Reference,
+			}
+			if err := tx.Create(&paymentRecord).Error; err != nil {
+				log.Printf("Failed to create payment %d: %v", i+1, err)
+				return err
+			}
+			log.Printf("Created payment %d: ID=%d, Method=%s, Amount=%s", i+1, paymentRecord.ID, paymentRecord.Method, paymentRecord.Amount)
 		}
-		database.DB.Create(&orderItem)
 
-		// Update appropriate stock field
-		if stockType == "showroom" {
-			product.PosStock -= item.Quantity
-		} else {
-			product.Stock -= item.Quantity
+		// Create order items and update stock
+		for i, item := range req.Items {
+			if err := deductProductStock(tx, item.ProductID, stockType, item.Quantity); err != nil {
+				if err == errInsufficientStock {
+					return &orderConflictError{Message: "Insufficient " + stockType + " stock for product: " + products[i].Name}
+				}
+				return err
+			}
+			for _, option := range quote.Lines[i].Options {
+				if err := deductOptionStock(tx, option.ID, item.Quantity); err != nil {
+					if err == errInsufficientStock {
+						return &orderConflictError{Message: "Insufficient stock for " + products[i].Name + " option: " + option.Value}
+					}
+					return err
+				}
+			}
+
+			orderItem := models.OrderItem{
+				OrderID:    order.ID,
+				ProductID:  item.ProductID,
+				Quantity:   item.Quantity,
+				Price:      quote.Lines[i].UnitPrice,
+				Variations: SerializeVariations(quote.Lines[i].Variations),
+			}
+			if err := tx.Create(&orderItem).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if conflict, ok := err.(*orderConflictError); ok {
+			c.JSON(http.StatusConflict, gin.H{"error": conflict.Message})
+			return
 		}
-		database.DB.Save(&product)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+		return
 	}
 
 	// Load order with items and payments
 	database.DB.Preload("Items").Preload("Items.Product").Preload("User").Preload("Payments").First(&order, order.ID)
 
 	// Calculate remaining balance
-	var totalPaidAmount float64
+	var totalPaidAmount money.Money
 	for _, payment := range order.Payments {
-		totalPaidAmount += payment.Amount
+		totalPaidAmount = totalPaidAmount.Add(payment.Collected())
 	}
-	remainingBalance := order.Total - totalPaidAmount
+	remainingBalance := order.Total.Sub(totalPaidAmount)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message":           "POS order created successfully",
@@ -271,4 +350,3 @@ func CreatePOSOrder(c *gin.Context) {
 		"is_fully_paid":      remainingBalance <= 0,
 	})
 }
-
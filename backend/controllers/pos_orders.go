@@ -6,6 +6,7 @@ import (
 
 	"ecom-backend/database"
 	"ecom-backend/models"
+	"ecom-backend/money"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,9 +21,9 @@ func GetPOSOrders(c *gin.Context) {
 		query = query.Where("status = ?", status)
 	}
 
-	// Search by order ID or customer name
+	// Search by order ID, order number or customer ID
 	if search := c.Query("search"); search != "" {
-		query = query.Where("id::text ILIKE ? OR user_id::text ILIKE ?", "%"+search+"%", "%"+search+"%")
+		query = query.Where("id::text ILIKE ? OR order_number ILIKE ? OR user_id::text ILIKE ?", "%"+search+"%", "%"+search+"%", "%"+search+"%")
 	}
 
 	// Pagination
@@ -42,18 +43,18 @@ func GetPOSOrders(c *gin.Context) {
 	// Calculate payment totals for each order
 	type OrderWithPayments struct {
 		models.Order
-		TotalPaid        float64 `json:"total_paid"`
-		RemainingBalance float64 `json:"remaining_balance"`
+		TotalPaid        money.Money `json:"total_paid"`
+		RemainingBalance money.Money `json:"remaining_balance"`
 		IsFullyPaid      bool    `json:"is_fully_paid"`
 	}
 
 	var ordersWithPayments []OrderWithPayments
 	for _, order := range orders {
-		var totalPaid float64
+		var totalPaid money.Money
 		for _, payment := range order.Payments {
-			totalPaid += payment.Amount
+			totalPaid = totalPaid.Add(payment.Collected())
 		}
-		remainingBalance := order.Total - totalPaid
+		remainingBalance := order.Total.Sub(totalPaid)
 		isFullyPaid := remainingBalance <= 0
 
 		ordersWithPayments = append(ordersWithPayments, OrderWithPayments{
@@ -77,25 +78,24 @@ func GetPOSOrders(c *gin.Context) {
 
 // GetPOSOrder returns a single POS order by ID (admin only)
 func GetPOSOrder(c *gin.Context) {
-	orderID := c.Param("id")
 	var order models.Order
 
-	if err := database.DB.Where("is_pos = ?", true).
+	if err := orderByIDOrNumber(database.DB, c.Param("id")).Where("is_pos = ?", true).
 		Preload("User").
 		Preload("Items").
 		Preload("Items.Product").
 		Preload("Payments").
-		First(&order, orderID).Error; err != nil {
+		First(&order).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "POS order not found"})
 		return
 	}
 
 	// Calculate payment totals
-	var totalPaid float64
+	var totalPaid money.Money
 	for _, payment := range order.Payments {
-		totalPaid += payment.Amount
+		totalPaid = totalPaid.Add(payment.Collected())
 	}
-	remainingBalance := order.Total - totalPaid
+	remainingBalance := order.Total.Sub(totalPaid)
 	isFullyPaid := remainingBalance <= 0
 
 	c.JSON(http.StatusOK, gin.H{
@@ -8,11 +8,18 @@ import (
 	"ecom-backend/cache"
 	"ecom-backend/database"
 	"ecom-backend/models"
+	"ecom-backend/money"
 
 	"github.com/gin-gonic/gin"
 )
 
 func GetProducts(c *gin.Context) {
+	// Prices are listed in the base currency unless another is requested
+	currency, rate, ok := displayCurrency(c)
+	if !ok {
+		return
+	}
+
 	// Build cache key from query parameters
 	cacheKey := buildProductsCacheKey(c)
 
@@ -20,7 +27,9 @@ func GetProducts(c *gin.Context) {
 	// We cache only simple listings without complex filters
 	if cacheKey != "" {
 		if cachedProducts, err := cache.GetProductsList(cacheKey); err == nil {
-			c.JSON(http.StatusOK, gin.H{"products": cachedProducts})
+			showAvailableStock(database.DB, productRefs(cachedProducts)...)
+			convertProductPrices(cachedProducts, currency, rate)
+			c.JSON(http.StatusOK, gin.H{"products": cachedProducts, "currency": currency.Code})
 			return
 		}
 	}
@@ -40,12 +49,12 @@ func GetProducts(c *gin.Context) {
 			"%"+search+"%", "%"+search+"%", "%"+search+"%")
 	}
 
-	// Filter by price range
-	if minPrice := c.Query("min_price"); minPrice != "" {
-		query = query.Where("price >= ?", minPrice)
+	// Filter by price range, given in the requested currency
+	if minPrice, err := money.Parse(c.Query("min_price")); err == nil {
+		query = query.Where("price >= ?", rate.ToBase(minPrice))
 	}
-	if maxPrice := c.Query("max_price"); maxPrice != "" {
-		query = query.Where("price <= ?", maxPrice)
+	if maxPrice, err := money.Parse(c.Query("max_price")); err == nil {
+		query = query.Where("price <= ?", rate.ToBase(maxPrice))
 	}
 
 	// Filter by stock status
@@ -81,9 +90,12 @@ func GetProducts(c *gin.Context) {
 	if cacheKey != "" && c.Query("search") == "" && c.Query("min_price") == "" && c.Query("max_price") == "" && page == 1 {
 		cache.SetProductsList(cacheKey, products)
 	}
+	showAvailableStock(database.DB, productRefs(products)...)
+	convertProductPrices(products, currency, rate)
 
 	c.JSON(http.StatusOK, gin.H{
 		"products": products,
+		"currency": currency.Code,
 		"pagination": gin.H{
 			"page":  page,
 			"limit": limit,
@@ -125,10 +137,17 @@ func GetProduct(c *gin.Context) {
 		return
 	}
 
+	currency, rate, ok := displayCurrency(c)
+	if !ok {
+		return
+	}
+
 	// Try to get from cache first
 	if cachedProduct, err := cache.GetProduct(uint(productID)); err == nil {
 		// Load variations from DB (cache might be stale for variations)
 		database.DB.Preload("Variations").Preload("Variations.Options").First(cachedProduct, id)
+		showAvailableStock(database.DB, cachedProduct)
+		convertProductPrice(cachedProduct, currency, rate)
 		c.JSON(http.StatusOK, cachedProduct)
 		return
 	}
@@ -142,6 +161,8 @@ func GetProduct(c *gin.Context) {
 
 	// Store in cache for future requests
 	cache.SetProduct(&product)
+	showAvailableStock(database.DB, &product)
+	convertProductPrice(&product, currency, rate)
 
 	c.JSON(http.StatusOK, product)
 }
@@ -1,11 +1,14 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"ecom-backend/database"
 	"ecom-backend/models"
+	"ecom-backend/money"
+	"ecom-backend/payments"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -17,7 +20,7 @@ func CreateRefundRequest(c *gin.Context) {
 	var req struct {
 		OrderID     uint    `json:"order_id" binding:"required"`
 		OrderItemID uint    `json:"order_item_id"` // Optional
-		Amount      float64 `json:"amount" binding:"required"`
+		Amount      money.Money `json:"amount" binding:"required"`
 		Reason      string  `json:"reason" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -32,9 +35,30 @@ func CreateRefundRequest(c *gin.Context) {
 		return
 	}
 
-	// Validate amount
-	if req.Amount > order.Total {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Refund amount cannot exceed order total"})
+	if req.OrderItemID != 0 {
+		var count int64
+		database.DB.Model(&models.OrderItem{}).Where("id = ? AND order_id = ?", req.OrderItemID, order.ID).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The item isn't part of this order"})
+			return
+		}
+	}
+
+	// Validate amount against what was paid and not yet refunded
+	if !req.Amount.IsPositive() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refund amount must be greater than 0"})
+		return
+	}
+	refundable, err := orderAmountRefundable(database.DB, &order, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check refundable amount"})
+		return
+	}
+	if req.Amount > refundable {
+		if refundable.IsNegative() {
+			refundable = 0
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refund amount cannot exceed the " + orderCurrency(order).Format(refundable) + " left to refund"})
 		return
 	}
 
@@ -43,7 +67,7 @@ func CreateRefundRequest(c *gin.Context) {
 		OrderItemID: req.OrderItemID,
 		Amount:      req.Amount,
 		Reason:      req.Reason,
-		Status:      "pending",
+		Status:      models.RefundStatusPending,
 	}
 
 	if err := database.DB.Create(&refund).Error; err != nil {
@@ -87,7 +111,9 @@ func GetAllRefunds(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"refunds": refunds})
 }
 
-// UpdateRefundStatus updates refund status (admin only)
+// UpdateRefundStatus updates refund status (admin only). Setting it to processed returns the
+// money through the order's payments or into store credit, optionally restocks the item and
+// notifies the customer.
 func UpdateRefundStatus(c *gin.Context) {
 	refundID := c.Param("id")
 	adminID, _ := c.Get("userID")
@@ -102,14 +128,43 @@ func UpdateRefundStatus(c *gin.Context) {
 	}
 
 	var req struct {
-		Status string `json:"status" binding:"required,oneof=pending approved rejected processed"`
-		Notes  string `json:"notes"`
+		Status          string `json:"status" binding:"required,oneof=pending approved rejected processed"`
+		Notes           string `json:"notes"`
+		RefundTo        string `json:"refund_to" binding:"omitempty,oneof=original store_credit"` // Used when processing
+		Restock         bool   `json:"restock"`                                                   // Used when processing: return the item to stock
+		RestockQuantity int    `json:"restock_quantity" binding:"min=0"`                          // Units to restock, all of the item when 0
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	if refund.Status == models.RefundStatusProcessed || refund.Status == models.RefundStatusProcessing {
+		c.JSON(http.StatusConflict, gin.H{"error": "This refund has already been processed"})
+		return
+	}
+
+	if req.Status == models.RefundStatusProcessed {
+		refund, err := processRefund(c.Request.Context(), refund, refundOptions{
+			ToStoreCredit:   req.RefundTo == models.PaymentMethodStoreCredit,
+			Restock:         req.Restock,
+			RestockQuantity: req.RestockQuantity,
+			Notes:           req.Notes,
+		}, adminID.(uint))
+		if err != nil {
+			respondRefundError(c, err)
+			return
+		}
+		LogAction(refund.ProcessedBy, "process", "refund", refund.ID, gin.H{
+			"order_id":         refund.OrderID,
+			"amount":           refund.Amount,
+			"method":           refund.Method,
+			"restock_quantity": refund.RestockQuantity,
+		}, c)
+		c.JSON(http.StatusOK, gin.H{"message": "Refund processed", "refund": refund})
+		return
+	}
+
 	refund.Status = req.Status
 	refund.ProcessedBy = adminID.(uint)
 	now := time.Now()
@@ -117,7 +172,6 @@ func UpdateRefundStatus(c *gin.Context) {
 	if req.Notes != "" {
 		refund.Notes = req.Notes
 	}
-
 	if err := database.DB.Save(&refund).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update refund"})
 		return
@@ -126,3 +180,23 @@ func UpdateRefundStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Refund status updated", "refund": refund})
 }
 
+// respondRefundError reports why a refund couldn't be processed
+func respondRefundError(c *gin.Context, err error) {
+	var refundErr *refundError
+	var gatewayErr *payments.GatewayError
+	var transitionErr *orderTransitionError
+	switch {
+	case errors.As(err, &refundErr):
+		c.JSON(refundErr.Status, gin.H{"error": refundErr.Message})
+	case errors.As(err, &transitionErr):
+		c.JSON(http.StatusConflict, gin.H{"error": transitionErr.Error()})
+	case errors.Is(err, payments.ErrNotSupported):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This payment gateway can't refund payments; refund to store credit instead"})
+	case errors.Is(err, payments.ErrNotConfigured), errors.Is(err, payments.ErrUnknownGateway):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Payment gateway not available"})
+	case errors.As(err, &gatewayErr):
+		c.JSON(http.StatusBadGateway, gin.H{"error": "The payment gateway declined the refund: " + gatewayErr.Message})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process refund"})
+	}
+}
@@ -0,0 +1,525 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"ecom-backend/database"
+	"ecom-backend/mailer"
+	"ecom-backend/models"
+	"ecom-backend/money"
+	"ecom-backend/payments"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// refundError is a refund that can't be processed as asked, reported with its HTTP status
+type refundError struct {
+	Status  int
+	Message string
+}
+
+func (e *refundError) Error() string {
+	return e.Message
+}
+
+// refundOptions are the admin's choices when processing a refund
+type refundOptions struct {
+	ToStoreCredit   bool
+	Restock         bool
+	RestockQuantity int // Zero returns every unit of the item not yet returned
+	Notes           string
+}
+
+// refundEmailTemplate is the email telling a customer their refund was processed
+var refundEmailTemplate = template.Must(template.New("refund").Parse(`<p>Hi {{.Name}},</p>
+<p>We've refunded <strong>{{.Amount}}</strong> for order {{.OrderNumber}}{{if .StoreCredit}} to your store credit, ready to use on your next order{{else}} to your original payment method. Depending on your bank, it can take a few days to appear{{end}}.</p>
+{{if .Reason}}<p>Reason: {{.Reason}}</p>{{end}}
+<p>Thank you for shopping with {{.StoreName}}.</p>`))
+
+// processRefund returns a refund's money and completes it. The amount goes back through the
+// order's captured payments, gateway and in-person payments first and gift cards and store
+// credit last, or into the customer's store credit. The refunded item can be returned to
+// stock, the order moves to refunded or partially_refunded and the customer is notified.
+//
+// Each payment's part is recorded as soon as its money has moved, so when a gateway fails
+// part way the refund is marked failed and processing it again only returns what is left.
+func processRefund(ctx context.Context, refund models.Refund, opts refundOptions, actorID uint) (models.Refund, error) {
+	// Claim the refund, so two admins processing it at once can't both send the money
+	previous := refund.Status
+	claim := database.DB.Model(&models.Refund{}).
+		Where("id = ? AND status = ? AND status IN ?", refund.ID, previous,
+			[]string{models.RefundStatusPending, models.RefundStatusApproved, models.RefundStatusFailed}).
+		Update("status", models.RefundStatusProcessing)
+	if claim.Error != nil {
+		return refund, claim.Error
+	}
+	if claim.RowsAffected == 0 {
+		return refund, &refundError{Status: http.StatusConflict, Message: "This refund has already been processed or rejected"}
+	}
+
+	order, err := executeRefund(ctx, &refund, opts, actorID)
+	if err != nil {
+		updates := map[string]interface{}{"status": models.RefundStatusFailed, "error": err.Error()}
+		var moved int64
+		database.DB.Model(&models.RefundPayment{}).Where("refund_id = ?", refund.ID).Count(&moved)
+		if _, ok := err.(*refundError); ok && moved == 0 {
+			// Nothing was wrong with the money, only with the request
+			updates = map[string]interface{}{"status": previous}
+		}
+		if dbErr := database.DB.Model(&models.Refund{}).Where("id = ?", refund.ID).Updates(updates).Error; dbErr != nil {
+			log.Printf("Failed to record refund %d failure: %v", refund.ID, dbErr)
+		}
+		return refund, err
+	}
+
+	go notifyRefundProcessed(order, refund)
+	return refund, nil
+}
+
+// executeRefund validates a claimed refund, moves its money and completes it
+func executeRefund(ctx context.Context, refund *models.Refund, opts refundOptions, actorID uint) (models.Order, error) {
+	var order models.Order
+	if err := database.DB.Preload("User").First(&order, refund.OrderID).Error; err != nil {
+		return order, err
+	}
+	if opts.ToStoreCredit && order.UserID == nil {
+		return order, &refundError{Status: http.StatusBadRequest, Message: "Guest orders can't be refunded to store credit"}
+	}
+	if !refund.Amount.IsPositive() {
+		return order, &refundError{Status: http.StatusBadRequest, Message: "Refund amount must be greater than 0"}
+	}
+	if !orderTakesRefunds(order.Status) {
+		return order, &refundError{Status: http.StatusConflict, Message: fmt.Sprintf("Orders that are %s can't be refunded", order.Status)}
+	}
+
+	var item models.OrderItem
+	if refund.OrderItemID != 0 {
+		if err := database.DB.Where("id = ? AND order_id = ?", refund.OrderItemID, order.ID).First(&item).Error; err != nil {
+			return order, &refundError{Status: http.StatusBadRequest, Message: "The refunded item isn't part of this order"}
+		}
+	}
+	if opts.Restock {
+		if refund.OrderItemID == 0 {
+			return order, &refundError{Status: http.StatusBadRequest, Message: "Only refunds for an order item can restock"}
+		}
+		restockable := item.Quantity - item.BackorderedQty - item.RestockedQty
+		if opts.RestockQuantity == 0 {
+			opts.RestockQuantity = restockable
+		}
+		if opts.RestockQuantity <= 0 || opts.RestockQuantity > restockable {
+			return order, &refundError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Only %d units of this item can be returned to stock", max(restockable, 0))}
+		}
+	}
+
+	// Check what is left under the order's lock. Refunds already claimed for processing hold
+	// their amount until they finish, so two refunds of one order can't both spend it.
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.Order{}, order.ID).Error; err != nil {
+			return err
+		}
+		refundable, err := orderAmountRefundable(tx, &order, refund.ID)
+		if err != nil {
+			return err
+		}
+		inFlight, err := orderRefundsInFlight(tx, order.ID, refund.ID)
+		if err != nil {
+			return err
+		}
+		refundable = refundable.Sub(inFlight)
+		if refund.Amount > refundable {
+			if refundable.IsNegative() {
+				refundable = 0
+			}
+			message := "Only " + orderCurrency(order).Format(refundable) + " of this order's payments is left to refund"
+			if inFlight.IsPositive() {
+				message += ", as other refunds of it are still being processed"
+			}
+			return &refundError{Status: http.StatusBadRequest, Message: message}
+		}
+		return nil
+	})
+	if err != nil {
+		return order, err
+	}
+
+	if err := returnRefundMoney(ctx, refund, &order, opts.ToStoreCredit, actorID); err != nil {
+		return order, err
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, order.ID).Error; err != nil {
+			return err
+		}
+
+		if opts.Restock {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&item, item.ID).Error; err != nil {
+				return err
+			}
+			if opts.RestockQuantity > item.Quantity-item.BackorderedQty-item.RestockedQty {
+				return &refundError{Status: http.StatusConflict, Message: "The item was returned to stock in the meantime"}
+			}
+			if err := returnItemStock(tx, &order, item, opts.RestockQuantity); err != nil {
+				return err
+			}
+			if err := tx.Model(&item).Update("restocked_qty", gorm.Expr("restocked_qty + ?", opts.RestockQuantity)).Error; err != nil {
+				return err
+			}
+			refund.RestockQuantity = opts.RestockQuantity
+		}
+
+		now := time.Now()
+		refund.Status = models.RefundStatusProcessed
+		refund.Method = models.RefundMethodOriginal
+		if opts.ToStoreCredit {
+			refund.Method = models.PaymentMethodStoreCredit
+		}
+		refund.ProcessedBy = actorID
+		refund.ProcessedAt = &now
+		refund.Error = ""
+		if opts.Notes != "" {
+			refund.Notes = opts.Notes
+		}
+		if err := tx.Omit("Order", "Payments").Save(refund).Error; err != nil {
+			return err
+		}
+
+		if err := updateRefundedOrderStatus(tx, &order, *refund, actorID); err != nil {
+			return err
+		}
+
+		if order.UserID == nil {
+			return nil
+		}
+		return tx.Create(&models.Notification{
+			Type:    "order",
+			Title:   "Refund processed",
+			Message: fmt.Sprintf("We've refunded %s for order %s", orderCurrency(order).Format(refund.Amount), orderReference(order)),
+			UserID:  *order.UserID,
+		}).Error
+	})
+	if err != nil {
+		return order, err
+	}
+
+	return order, database.DB.Preload("Payments").First(refund, refund.ID).Error
+}
+
+// returnRefundMoney returns whatever of a refund hasn't been returned yet through the order's
+// captured payments. Orders marked paid without a payment record are refunded manually.
+func returnRefundMoney(ctx context.Context, refund *models.Refund, order *models.Order, toStoreCredit bool, actorID uint) error {
+	var returned money.Money
+	if err := database.DB.Model(&models.RefundPayment{}).Where("refund_id = ?", refund.ID).
+		Select("COALESCE(SUM(amount), 0)").Scan(&returned).Error; err != nil {
+		return err
+	}
+	remaining := refund.Amount.Sub(returned)
+	if !remaining.IsPositive() {
+		return nil
+	}
+
+	var orderPayments []models.Payment
+	if err := database.DB.Where("order_id = ? AND status = ?", order.ID, models.PaymentStatusCaptured).
+		Order("created_at DESC").Find(&orderPayments).Error; err != nil {
+		return err
+	}
+	if len(orderPayments) == 0 {
+		hasPayments, err := orderHasCapturedPayments(database.DB, order.ID)
+		if err != nil {
+			return err
+		}
+		if !hasPayments {
+			return refundPayment(ctx, refund, order, nil, remaining, toStoreCredit, actorID)
+		}
+	}
+	sort.SliceStable(orderPayments, func(i, j int) bool {
+		return !isStoredValueMethod(orderPayments[i].Method) && isStoredValueMethod(orderPayments[j].Method)
+	})
+
+	for _, payment := range orderPayments {
+		portion := min(remaining, payment.Collected())
+		if !portion.IsPositive() {
+			continue
+		}
+		if err := refundPayment(ctx, refund, order, &payment, portion, toStoreCredit, actorID); err != nil {
+			return err
+		}
+		remaining = remaining.Sub(portion)
+		if !remaining.IsPositive() {
+			return nil
+		}
+	}
+	// Refunded elsewhere in the meantime, e.g. from the gateway's dashboard
+	return &refundError{Status: http.StatusConflict, Message: "The order's payments don't cover this refund: " +
+		orderCurrency(*order).Format(remaining) + " of it has nothing left to be refunded from"}
+}
+
+// refundPayment returns part of a refund through one payment, or manually when payment is
+// nil, and records it. Gateway payments are refunded at the gateway, gift card and store
+// credit payments go back to their balance, and in-person payments are recorded as paid
+// back at the till. Refunds to store credit only credit the customer's wallet.
+func refundPayment(ctx context.Context, refund *models.Refund, order *models.Order, payment *models.Payment, amount money.Money, toStoreCredit bool, actorID uint) error {
+	part := models.RefundPayment{
+		RefundID: refund.ID,
+		Method:   models.RefundMethodManual,
+		Amount:   amount,
+		Status:   payments.RefundSucceeded,
+	}
+	if payment != nil {
+		part.PaymentID, part.Method = &payment.ID, payment.Method
+	}
+
+	switch {
+	case toStoreCredit:
+		part.Method = models.PaymentMethodStoreCredit
+	case payment != nil && payment.Gateway != "":
+		provider, err := payments.Load(payment.Gateway)
+		if err != nil {
+			return err
+		}
+		transactionID := payment.CaptureID
+		if transactionID == "" {
+			transactionID = payment.TransactionID
+		}
+		result, err := provider.Refund(ctx, payments.RefundRequest{
+			Reference:     payment.Reference,
+			TransactionID: transactionID,
+			Amount:        amount,
+			Currency:      orderCurrency(*order),
+			Reason:        refund.Reason,
+		})
+		if err != nil {
+			return err
+		}
+		if result.Status == payments.RefundFailed {
+			return &payments.GatewayError{Gateway: payment.Gateway, Message: "the refund was declined"}
+		}
+		part.Method, part.GatewayRefundID, part.Status = payment.Gateway, result.ID, result.Status
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		note := "Refund for order " + orderReference(*order)
+		switch {
+		case toStoreCredit:
+			// Store credit is held in the base currency
+			if _, err := changeStoreCredit(tx, *order.UserID, order.ExchangeRate.ToBase(amount), models.StoreCreditTransaction{
+				Type: models.CreditRefund, OrderID: &order.ID, RefundID: &refund.ID, ActorID: &actorID, Note: note,
+			}); err != nil {
+				return err
+			}
+		case payment != nil && isStoredValueMethod(payment.Method):
+			if err := returnToStoredValue(tx, order, payment.Method, amount, actorID, note); err != nil {
+				return err
+			}
+		}
+
+		if payment != nil {
+			if err := addPaymentRefund(tx, payment, amount, part.GatewayRefundID); err != nil {
+				return err
+			}
+		}
+		return tx.Create(&part).Error
+	})
+	if err != nil && part.GatewayRefundID != "" {
+		log.Printf("Refund %d: %s refund %s succeeded but could not be recorded: %v", refund.ID, part.Method, part.GatewayRefundID, err)
+	}
+	return err
+}
+
+// addPaymentRefund adds a refund to a payment's refunded amount, marking the payment refunded
+// once nothing captured is left. A refund the gateway's webhook has already reported isn't
+// counted again, and one larger than what the payment has left fails.
+func addPaymentRefund(tx *gorm.DB, payment *models.Payment, amount money.Money, gatewayRefundID string) error {
+	// A webhook reporting this refund waits on the lock, then finds the refund recorded
+	var locked models.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, payment.ID).Error; err != nil {
+		return err
+	}
+	if gatewayRefundID != "" {
+		var reported int64
+		if err := tx.Model(&models.PaymentWebhookEvent{}).
+			Where("gateway = ? AND refund_id = ? AND status = ?", payment.Gateway, gatewayRefundID, models.WebhookProcessed).
+			Count(&reported).Error; err != nil {
+			return err
+		}
+		if reported > 0 {
+			return nil
+		}
+	}
+	if locked.Collected() < amount {
+		return &refundError{Status: http.StatusConflict, Message: fmt.Sprintf("Payment #%d only has %s left to refund",
+			payment.ID, money.Max(locked.Collected(), 0))}
+	}
+	refunded := locked.RefundedAmount.Add(amount)
+	status := locked.Status
+	if refunded >= locked.CapturedAmount {
+		status = models.PaymentStatusRefunded
+	}
+	return tx.Model(&models.Payment{}).Where("id = ?", payment.ID).Updates(map[string]interface{}{
+		"refunded_amount": refunded,
+		"status":          status,
+	}).Error
+}
+
+// returnToStoredValue credits part of a refund back to the gift card or store credit wallet
+// an order was paid from. The credit is tied to the order, so cancelling the order later
+// only returns what is still spent.
+func returnToStoredValue(tx *gorm.DB, order *models.Order, method string, amount money.Money, actorID uint, note string) error {
+	credit := order.ExchangeRate.ToBase(amount)
+	if method == models.PaymentMethodGiftCard {
+		var cardID uint
+		if err := tx.Model(&models.GiftCardTransaction{}).Select("gift_card_id").
+			Where("order_id = ?", order.ID).Group("gift_card_id").Having("SUM(amount) < 0").
+			Order("gift_card_id").Limit(1).Scan(&cardID).Error; err != nil {
+			return err
+		}
+		if cardID == 0 {
+			return fmt.Errorf("no gift card spending found for order %d", order.ID)
+		}
+		_, err := changeGiftCardBalance(tx, cardID, credit, models.GiftCardTransaction{
+			Type: models.CreditRefund, OrderID: &order.ID, ActorID: &actorID, Note: note,
+		})
+		return err
+	}
+
+	var userID uint
+	if err := tx.Model(&models.StoreCreditTransaction{}).Select("user_id").
+		Where("order_id = ? AND type = ?", order.ID, models.CreditRedeem).Limit(1).Scan(&userID).Error; err != nil {
+		return err
+	}
+	if userID == 0 {
+		return fmt.Errorf("no store credit spending found for order %d", order.ID)
+	}
+	_, err := changeStoreCredit(tx, userID, credit, models.StoreCreditTransaction{
+		Type: models.CreditRefund, OrderID: &order.ID, ActorID: &actorID, Note: note,
+	})
+	return err
+}
+
+// orderTakesRefunds reports whether an order's status lets it record a refund. Cancelled
+// orders keep their status; any other order must be able to move to a refunded status.
+func orderTakesRefunds(status string) bool {
+	status = normalizeOrderStatus(status)
+	return status == models.OrderStatusCancelled ||
+		canTransitionOrder(status, models.OrderStatusPartiallyRefunded) ||
+		canTransitionOrder(status, models.OrderStatusRefunded)
+}
+
+// updateRefundedOrderStatus moves an order to partially_refunded, or to refunded once its
+// payments have all been refunded. Cancelled orders stay cancelled.
+func updateRefundedOrderStatus(tx *gorm.DB, order *models.Order, refund models.Refund, actorID uint) error {
+	if normalizeOrderStatus(order.Status) == models.OrderStatusCancelled {
+		return nil
+	}
+	refundable, err := orderAmountRefundable(tx, order, 0)
+	if err != nil {
+		return err
+	}
+
+	status := models.OrderStatusPartiallyRefunded
+	if !refundable.IsPositive() {
+		status = models.OrderStatusRefunded
+	}
+	if status == order.Status {
+		return nil
+	}
+	note := fmt.Sprintf("Refund #%d of %s", refund.ID, orderCurrency(*order).Format(refund.Amount))
+	return transitionOrderStatus(tx, order, status, &actorID, note)
+}
+
+// orderHasCapturedPayments reports whether any of an order's payments captured money
+func orderHasCapturedPayments(db *gorm.DB, orderID uint) (bool, error) {
+	var count int64
+	err := db.Model(&models.Payment{}).Where("order_id = ? AND captured_amount > 0", orderID).Count(&count).Error
+	return count > 0, err
+}
+
+// orderAmountRefunded returns the sum of an order's processed refunds, leaving out one refund
+// when excludeID is set
+func orderAmountRefunded(db *gorm.DB, orderID, excludeID uint) (money.Money, error) {
+	var refunded money.Money
+	err := db.Model(&models.Refund{}).Where("order_id = ? AND status = ? AND id <> ?", orderID, models.RefundStatusProcessed, excludeID).
+		Select("COALESCE(SUM(amount), 0)").Scan(&refunded).Error
+	return refunded, err
+}
+
+// orderAmountRefundable returns how much of an order's payments is left to refund: what they
+// captured less what has been refunded from them, however it was refunded. Parts of refund
+// refundID that an earlier attempt already returned still count as refundable for it. Orders
+// marked paid without a payment record can refund what was paid less processed refunds.
+func orderAmountRefundable(db *gorm.DB, order *models.Order, refundID uint) (money.Money, error) {
+	hasPayments, err := orderHasCapturedPayments(db, order.ID)
+	if err != nil {
+		return 0, err
+	}
+	if !hasPayments {
+		paid, err := orderAmountPaid(db, order)
+		if err != nil {
+			return 0, err
+		}
+		refunded, err := orderAmountRefunded(db, order.ID, refundID)
+		if err != nil {
+			return 0, err
+		}
+		return paid.Sub(refunded), nil
+	}
+
+	var left, returned money.Money
+	if err := db.Model(&models.Payment{}).Where("order_id = ?", order.ID).
+		Select("COALESCE(SUM(captured_amount - refunded_amount), 0)").Scan(&left).Error; err != nil {
+		return 0, err
+	}
+	if err := db.Model(&models.RefundPayment{}).Where("refund_id = ? AND payment_id IS NOT NULL", refundID).
+		Select("COALESCE(SUM(amount), 0)").Scan(&returned).Error; err != nil {
+		return 0, err
+	}
+	return left.Add(returned), nil
+}
+
+// orderRefundsInFlight returns how much of an order's other refunds, claimed for processing
+// but not finished, is still to be paid out. Refund excludeID is left out.
+func orderRefundsInFlight(db *gorm.DB, orderID, excludeID uint) (money.Money, error) {
+	var inFlight money.Money
+	err := db.Model(&models.Refund{}).
+		Where("order_id = ? AND status = ? AND id <> ?", orderID, models.RefundStatusProcessing, excludeID).
+		Select("COALESCE(SUM(amount - (SELECT COALESCE(SUM(rp.amount), 0) FROM refund_payments rp WHERE rp.refund_id = refunds.id AND rp.payment_id IS NOT NULL)), 0)").
+		Scan(&inFlight).Error
+	return inFlight, err
+}
+
+// notifyRefundProcessed emails the customer that their refund was processed
+func notifyRefundProcessed(order models.Order, refund models.Refund) {
+	to, name := order.GuestEmail, order.GuestName
+	if order.User != nil {
+		to, name = order.User.Email, order.User.Name
+	}
+	if to == "" || !mailer.Configured() {
+		return
+	}
+	if name == "" {
+		name = "there"
+	}
+
+	var body bytes.Buffer
+	err := refundEmailTemplate.Execute(&body, map[string]interface{}{
+		"Name":        name,
+		"Amount":      orderCurrency(order).Format(refund.Amount),
+		"OrderNumber": orderReference(order),
+		"StoreCredit": refund.Method == models.PaymentMethodStoreCredit,
+		"Reason":      refund.Reason,
+		"StoreName":   database.GetSetting("site_name", "EcomStore"),
+	})
+	if err == nil {
+		err = mailer.Send(mailer.Message{To: to, Subject: "Your refund for order " + orderReference(order), HTML: body.String()})
+	}
+	if err != nil {
+		log.Printf("Failed to email refund %d notice: %v", refund.ID, err)
+	}
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"ecom-backend/database"
+	"ecom-backend/models"
+	"ecom-backend/money"
+	"ecom-backend/pricing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ReorderLine reports what happened to one item of the original order
+type ReorderLine struct {
+	OrderItemID       uint              `json:"order_item_id"`
+	ProductID         uint              `json:"product_id"`
+	ProductName       string            `json:"product_name"`
+	Variations        map[string]string `json:"variations,omitempty"`
+	RequestedQuantity int               `json:"requested_quantity"`
+	Quantity          int               `json:"quantity"` // Quantity added to the cart
+	OriginalPrice     money.Money       `json:"original_price"`
+	CurrentPrice      money.Money       `json:"current_price"`
+	PriceChanged      bool              `json:"price_changed"`
+	Reason            string            `json:"reason,omitempty"`
+	Message           string            `json:"message,omitempty"`
+}
+
+// ReorderOrder copies the items of a past order back into the customer's cart. Items whose
+// product or options are gone, or that are out of stock, are skipped; the response lists
+// what was added, what was skipped and which prices changed since the original order.
+func ReorderOrder(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var order models.Order
+	if err := orderByIDOrNumber(database.DB.Preload("Items"), c.Param("id")).Where("user_id = ?", userID).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	owner, ok := currentCartOwner(c, false)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// Compare prices in the currency the order was paid in, at today's rate. If that currency
+	// is no longer offered, compare in the base currency at the order's rate instead.
+	currency, rate, err := pricing.ResolveCurrency(database.DB, order.Currency)
+	originalToBase := false
+	if err != nil {
+		if _, ok := err.(*pricing.InputError); !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load currency"})
+			return
+		}
+		if currency, err = pricing.BaseCurrency(database.DB); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load currency"})
+			return
+		}
+		rate, originalToBase = money.Parity, true
+	}
+
+	added := []ReorderLine{}
+	skipped := []ReorderLine{}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, item := range order.Items {
+			line := ReorderLine{
+				OrderItemID:       item.ID,
+				ProductID:         item.ProductID,
+				Variations:        ParseVariations(item.Variations),
+				RequestedQuantity: item.Quantity,
+				OriginalPrice:     item.Price,
+			}
+			if originalToBase {
+				line.OriginalPrice = order.ExchangeRate.ToBase(item.Price)
+			}
+
+			quantity, err := reorderItem(tx, owner, item, currency, rate, &line)
+			if err != nil {
+				return err
+			}
+			line.Quantity = quantity
+			if quantity == 0 {
+				skipped = append(skipped, line)
+			} else {
+				added = append(added, line)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rebuild cart"})
+		return
+	}
+
+	priceChanges := 0
+	for _, line := range added {
+		if line.PriceChanged {
+			priceChanges++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       fmt.Sprintf("Added %d of %d items to your cart", len(added), len(order.Items)),
+		"currency":      currency.Code,
+		"added":         added,
+		"skipped":       skipped,
+		"price_changes": priceChanges,
+	})
+}
+
+// reorderItem adds as much of one past order line to the cart as is still available and
+// fills in the report line. It returns the quantity added, zero when the line was skipped.
+func reorderItem(tx *gorm.DB, owner cartOwner, item models.OrderItem, currency money.Currency, rate money.ExchangeRate, line *ReorderLine) (int, error) {
+	var product models.Product
+	if err := tx.Unscoped().First(&product, item.ProductID).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			return 0, err
+		}
+		line.Reason, line.Message = cartLineProductUnavailable, "This product is no longer available"
+		return 0, nil
+	}
+	line.ProductName = product.Name
+	if product.DeletedAt.Valid {
+		line.Reason, line.Message = cartLineProductUnavailable, "This product is no longer available"
+		return 0, nil
+	}
+
+	added, err := addCartLine(tx, owner, product, line.Variations, item.Quantity)
+	if err != nil {
+		return 0, err
+	}
+	if added.Resolved != nil {
+		line.Variations = added.Resolved.Selections
+		line.CurrentPrice = rate.Convert(product.Price.Add(added.Resolved.PriceModifier), currency)
+		line.PriceChanged = line.CurrentPrice != line.OriginalPrice
+	}
+	line.Reason, line.Message = added.Reason, added.Message
+	return added.Quantity, nil
+}
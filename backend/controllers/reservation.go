@@ -0,0 +1,280 @@
+package controllers
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"ecom-backend/database"
+	"ecom-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Subqueries for the units held by active reservations against the products or
+// variation_options row in scope
+const (
+	reservedProductSQL = "(SELECT COALESCE(SUM(r.quantity), 0) FROM inventory_reservations r WHERE r.product_id = products.id AND r.option_id IS NULL AND r.status = 'active')"
+	reservedOptionSQL  = "(SELECT COALESCE(SUM(r.quantity), 0) FROM inventory_reservations r WHERE r.option_id = variation_options.id AND r.status = 'active')"
+)
+
+// orderReservationTTLSetting is how many minutes a web order holds its stock after an online
+// payment is started before it is cancelled; 0 holds it until the order is paid or cancelled
+// by hand
+const orderReservationTTLSetting = "order_reservation_ttl_minutes"
+
+const defaultOrderReservationTTL = "30"
+
+// orderReservationTTL returns how long unpaid orders hold their stock, or 0 for no expiry
+func orderReservationTTL() time.Duration {
+	minutes, err := strconv.Atoi(settingValue(orderReservationTTLSetting, defaultOrderReservationTTL))
+	if err != nil || minutes <= 0 {
+		return 0
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// startReservationExpiry gives an order's stock reservation the configured time to be paid
+// for, from now. Orders without reserved stock, or with no expiry configured, are left alone.
+func startReservationExpiry(tx *gorm.DB, order *models.Order) error {
+	ttl := orderReservationTTL()
+	if !order.StockReserved || ttl <= 0 {
+		return nil
+	}
+	reservedUntil := time.Now().Add(ttl)
+	order.ReservedUntil = &reservedUntil
+	return tx.Model(order).Update("reserved_until", reservedUntil).Error
+}
+
+// reserveStock holds an order item's quantity of website stock and of its selected options'
+// stock. Rows are locked so concurrent checkouts see each other's reservations; units already
+// reserved for other unpaid orders can't be reserved again.
+func reserveStock(tx *gorm.DB, item models.OrderItem, product models.Product, options []models.VariationOption) error {
+	var locked models.Product
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "stock").First(&locked, product.ID).Error; err != nil {
+		return err
+	}
+	reserved, err := reservedProductStock(tx, product.ID)
+	if err != nil {
+		return err
+	}
+	if locked.Stock-reserved < item.Quantity {
+		return &orderConflictError{Message: "Insufficient stock for product: " + product.Name}
+	}
+
+	for _, option := range options {
+		var lockedOption models.VariationOption
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "stock").First(&lockedOption, option.ID).Error; err != nil {
+			return err
+		}
+		reserved, err := reservedOptionStock(tx, option.ID)
+		if err != nil {
+			return err
+		}
+		if lockedOption.Stock-reserved < item.Quantity {
+			return &orderConflictError{Message: "Insufficient stock for " + product.Name + " option: " + option.Value}
+		}
+	}
+
+	reservations := []models.InventoryReservation{{
+		OrderID:     item.OrderID,
+		OrderItemID: item.ID,
+		ProductID:   product.ID,
+		Quantity:    item.Quantity,
+		Status:      models.ReservationActive,
+	}}
+	for _, option := range options {
+		optionID := option.ID
+		reservations = append(reservations, models.InventoryReservation{
+			OrderID:     item.OrderID,
+			OrderItemID: item.ID,
+			ProductID:   product.ID,
+			OptionID:    &optionID,
+			Quantity:    item.Quantity,
+			Status:      models.ReservationActive,
+		})
+	}
+	return tx.Create(&reservations).Error
+}
+
+// reservedProductStock returns a product's website stock held by active reservations
+func reservedProductStock(tx *gorm.DB, productID uint) (int, error) {
+	var reserved int
+	err := tx.Model(&models.InventoryReservation{}).
+		Where("product_id = ? AND option_id IS NULL AND status = ?", productID, models.ReservationActive).
+		Select("COALESCE(SUM(quantity), 0)").Scan(&reserved).Error
+	return reserved, err
+}
+
+// reservedOptionStock returns a variation option's stock held by active reservations
+func reservedOptionStock(tx *gorm.DB, optionID uint) (int, error) {
+	var reserved int
+	err := tx.Model(&models.InventoryReservation{}).
+		Where("option_id = ? AND status = ?", optionID, models.ReservationActive).
+		Select("COALESCE(SUM(quantity), 0)").Scan(&reserved).Error
+	return reserved, err
+}
+
+// commitReservations turns an order's reservations into stock deductions once it goes ahead
+func commitReservations(tx *gorm.DB, order *models.Order) error {
+	var reservations []models.InventoryReservation
+	if err := tx.Where("order_id = ? AND status = ?", order.ID, models.ReservationActive).Find(&reservations).Error; err != nil {
+		return err
+	}
+	if len(reservations) > 0 {
+		// Mark them committed first so the deductions below don't count them as held
+		if err := tx.Model(&models.InventoryReservation{}).Where("order_id = ? AND status = ?", order.ID, models.ReservationActive).
+			Update("status", models.ReservationCommitted).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, reservation := range reservations {
+		var err error
+		if reservation.OptionID == nil {
+			err = deductProductStock(tx, reservation.ProductID, "website", reservation.Quantity)
+		} else {
+			err = deductOptionStock(tx, *reservation.OptionID, reservation.Quantity)
+		}
+		if err == errInsufficientStock {
+			// Stock was adjusted below what this order held
+			return &orderConflictError{Message: "Stock reserved for this order is no longer available"}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	order.StockReserved, order.ReservedUntil = false, nil
+	return tx.Model(order).Updates(map[string]interface{}{"stock_reserved": false, "reserved_until": nil}).Error
+}
+
+// releaseReservations frees an order's active reservations. It returns the IDs of the order
+// items that were only reserved, whose units were never taken from stock.
+func releaseReservations(tx *gorm.DB, order *models.Order) (map[uint]bool, error) {
+	var reservations []models.InventoryReservation
+	if err := tx.Where("order_id = ? AND status = ?", order.ID, models.ReservationActive).Find(&reservations).Error; err != nil {
+		return nil, err
+	}
+	released := make(map[uint]bool, len(reservations))
+	for _, reservation := range reservations {
+		released[reservation.OrderItemID] = true
+	}
+	if len(reservations) > 0 {
+		if err := tx.Model(&models.InventoryReservation{}).Where("order_id = ? AND status = ?", order.ID, models.ReservationActive).
+			Update("status", models.ReservationReleased).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if order.StockReserved {
+		order.StockReserved, order.ReservedUntil = false, nil
+		if err := tx.Model(order).Updates(map[string]interface{}{"stock_reserved": false, "reserved_until": nil}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return released, nil
+}
+
+// showAvailableStock subtracts units reserved for unpaid orders from products' and their
+// options' stock, so shoppers see what they can still buy
+func showAvailableStock(db *gorm.DB, products ...*models.Product) {
+	if len(products) == 0 {
+		return
+	}
+	productIDs := make([]uint, 0, len(products))
+	for _, product := range products {
+		productIDs = append(productIDs, product.ID)
+	}
+
+	var rows []struct {
+		ProductID uint
+		OptionID  *uint
+		Reserved  int
+	}
+	if err := db.Model(&models.InventoryReservation{}).
+		Select("product_id, option_id, SUM(quantity) AS reserved").
+		Where("status = ? AND product_id IN ?", models.ReservationActive, productIDs).
+		Group("product_id, option_id").Scan(&rows).Error; err != nil || len(rows) == 0 {
+		return
+	}
+
+	productReserved := make(map[uint]int)
+	optionReserved := make(map[uint]int)
+	for _, row := range rows {
+		if row.OptionID == nil {
+			productReserved[row.ProductID] = row.Reserved
+		} else {
+			optionReserved[*row.OptionID] = row.Reserved
+		}
+	}
+	for _, product := range products {
+		product.Stock = max(product.Stock-productReserved[product.ID], 0)
+		for i := range product.Variations {
+			for j := range product.Variations[i].Options {
+				option := &product.Variations[i].Options[j]
+				option.Stock = max(option.Stock-optionReserved[option.ID], 0)
+			}
+		}
+	}
+}
+
+// productRefs returns pointers to the products in a slice
+func productRefs(products []models.Product) []*models.Product {
+	refs := make([]*models.Product, len(products))
+	for i := range products {
+		refs[i] = &products[i]
+	}
+	return refs
+}
+
+// expiringPaymentSQL limits orders to those with an online payment still in progress
+const expiringPaymentSQL = "EXISTS (SELECT 1 FROM payments p WHERE p.order_id = orders.id AND p.status = ? AND p.deleted_at IS NULL)"
+
+// ExpireUnpaidOrders cancels pending web orders whose online payment was started but not
+// completed before their reservations ran out, releasing their stock. Orders paid offline,
+// such as cash on delivery, never expire. The background sweeper runs it every minute.
+func ExpireUnpaidOrders() error {
+	var orders []models.Order
+	if err := database.DB.Select("id").
+		Where("status = ? AND stock_reserved = ? AND reserved_until < ?", models.OrderStatusPending, true, time.Now()).
+		Where(expiringPaymentSQL, models.PaymentStatusPending).
+		Find(&orders).Error; err != nil {
+		return err
+	}
+
+	for _, expired := range orders {
+		// The customer may have paid without the gateway's callback reaching us
+		confirmPendingPayments(expired.ID)
+
+		var order models.Order
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			// Re-read under lock: a payment may have moved the order on since the query above
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, expired.ID).Error; err != nil {
+				return err
+			}
+			if order.Status != models.OrderStatusPending || !order.StockReserved ||
+				order.ReservedUntil == nil || order.ReservedUntil.After(time.Now()) {
+				return nil
+			}
+			// The payment may have completed, or been abandoned in favour of paying offline
+			var attempts int64
+			if err := tx.Model(&models.Order{}).Where("id = ?", order.ID).
+				Where(expiringPaymentSQL, models.PaymentStatusPending).Count(&attempts).Error; err != nil {
+				return err
+			}
+			if attempts == 0 {
+				return nil
+			}
+			return transitionOrderStatus(tx, &order, models.OrderStatusCancelled, nil, "Payment not received before the stock reservation expired")
+		})
+		if err != nil {
+			log.Printf("Failed to expire unpaid order %d: %v", expired.ID, err)
+			continue
+		}
+		// Release any authorization that didn't cover the whole order
+		settleOrderPayments(order)
+	}
+	return nil
+}
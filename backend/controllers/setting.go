@@ -6,6 +6,9 @@ import (
 
 	"ecom-backend/database"
 	"ecom-backend/models"
+	"ecom-backend/money"
+	"ecom-backend/pricing"
+	"ecom-backend/secrets"
 
 	"github.com/gin-gonic/gin"
 )
@@ -21,6 +24,10 @@ func GetSettings(c *gin.Context) {
 	// Convert to key-value map
 	settingsMap := make(map[string]interface{})
 	for _, setting := range settings {
+		if database.IsSecretSetting(setting.Key) {
+			settingsMap[setting.Key] = database.MaskedSetting(setting.Key, setting.Value)
+			continue
+		}
 		switch setting.Type {
 		case "number":
 			settingsMap[setting.Key] = setting.Value
@@ -45,9 +52,14 @@ func UpdateSettings(c *gin.Context) {
 	}
 
 	for key, value := range req {
-		var setting models.Setting
-		result := database.DB.Where("key = ?", key).First(&setting)
+		if str, ok := value.(string); ok && secretsKeyMissing(key, str) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Secret settings can't be saved until SECRETS_KEY is configured"})
+			return
+		}
+	}
 
+	changes := make(map[string]interface{})
+	for key, value := range req {
 		var valueStr string
 		var valueType string
 
@@ -70,22 +82,20 @@ func UpdateSettings(c *gin.Context) {
 			valueType = "string"
 		}
 
-		if result.Error != nil {
-			// Create new setting
-			setting = models.Setting{
-				Key:   key,
-				Value: valueStr,
-				Type:  valueType,
-			}
-			database.DB.Create(&setting)
-		} else {
-			// Update existing setting
-			setting.Value = valueStr
-			setting.Type = valueType
-			database.DB.Save(&setting)
+		// Secrets are write-only: a masked value sent back from the form leaves them unchanged
+		if database.IsSecretSetting(key) && secrets.IsMasked(valueStr) {
+			continue
+		}
+
+		if err := database.SetSetting(key, valueStr, valueType); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
+			return
 		}
+		changes[key] = value
 	}
 
+	LogAction(actorIDOrZero(c), "update", "settings", 0, changes, c)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Settings updated successfully"})
 }
 
@@ -97,6 +107,9 @@ func GetSetting(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Setting not found"})
 		return
 	}
+	if database.IsSecretSetting(setting.Key) {
+		setting.Value = database.MaskedSetting(setting.Key, setting.Value)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"setting": setting})
 }
@@ -105,7 +118,7 @@ func GetSetting(c *gin.Context) {
 func GetPublicSetting(c *gin.Context) {
 	key := c.Param("key")
 	// Only allow certain public settings
-	allowedKeys := []string{"tax_rate", "shipping_cost"}
+	allowedKeys := []string{"tax_rate", "shipping_cost", "order_cancellation_window_hours", pricing.BaseCurrencySetting}
 	isAllowed := false
 	for _, allowedKey := range allowedKeys {
 		if key == allowedKey {
@@ -120,10 +133,28 @@ func GetPublicSetting(c *gin.Context) {
 
 	var setting models.Setting
 	if err := database.DB.Where("key = ?", key).First(&setting).Error; err != nil {
-		c.JSON(http.StatusOK, gin.H{"setting": models.Setting{Key: key, Value: "0", Type: "number"}})
+		defaultValue, valueType := "0", "number"
+		switch key {
+		case "order_cancellation_window_hours":
+			defaultValue = fmt.Sprint(defaultCancellationWindowHours)
+		case pricing.BaseCurrencySetting:
+			defaultValue, valueType = money.DefaultCurrency.Code, "string"
+		}
+		c.JSON(http.StatusOK, gin.H{"setting": models.Setting{Key: key, Value: defaultValue, Type: valueType}})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"setting": setting})
 }
 
+
+// settingValue returns a setting's value, or fallback when it isn't set
+func settingValue(key string, fallback string) string {
+	return database.GetSetting(key, fallback)
+}
+
+// secretsKeyMissing reports whether saving a new value for a secret setting is blocked
+// because SECRETS_KEY isn't configured
+func secretsKeyMissing(key, value string) bool {
+	return database.IsSecretSetting(key) && value != "" && !secrets.IsMasked(value) && !secrets.Configured()
+}
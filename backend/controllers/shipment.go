@@ -0,0 +1,280 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"ecom-backend/database"
+	"ecom-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CreateShipmentRequest struct {
+	Carrier        string `json:"carrier" binding:"required"`
+	TrackingNumber string `json:"tracking_number"`
+	TrackingURL    string `json:"tracking_url"`
+	Notes          string `json:"notes"`
+	// Items to ship; leave empty to ship everything that hasn't shipped yet
+	Items []struct {
+		OrderItemID uint `json:"order_item_id" binding:"required"`
+		Quantity    int  `json:"quantity" binding:"required,min=1"`
+	} `json:"items"`
+}
+
+// shipmentError is a shipment request that doesn't fit the order, reported as 400 Bad Request
+type shipmentError struct {
+	Message string
+}
+
+func (e *shipmentError) Error() string {
+	return e.Message
+}
+
+// GetOrderShipments returns an order's shipments (admin only)
+func GetOrderShipments(c *gin.Context) {
+	var order models.Order
+	if err := orderByIDOrNumber(database.DB, c.Param("id")).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	var shipments []models.Shipment
+	if err := database.DB.Preload("Items").Preload("Items.OrderItem").Preload("Items.OrderItem.Product").
+		Where("order_id = ?", order.ID).Order("created_at ASC").Find(&shipments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shipments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"shipments": shipments})
+}
+
+// CreateShipment ships some or all of an order's remaining items and moves the order to
+// shipped or partially_shipped (admin only)
+func CreateShipment(c *gin.Context) {
+	var req CreateShipmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var order models.Order
+	if err := orderByIDOrNumber(database.DB, c.Param("id")).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	now := time.Now()
+	shipment := models.Shipment{
+		OrderID:        order.ID,
+		Carrier:        req.Carrier,
+		TrackingNumber: req.TrackingNumber,
+		TrackingURL:    req.TrackingURL,
+		Notes:          req.Notes,
+		ShippedAt:      &now,
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the order so two shipments can't both claim the same remaining items
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, order.ID).Error; err != nil {
+			return err
+		}
+
+		remaining, backordered, err := unshippedQuantities(tx, order.ID)
+		if err != nil {
+			return err
+		}
+
+		// Backordered units can't ship until stock has been allocated to them
+		toShip := make(map[uint]int)
+		if len(req.Items) == 0 {
+			for itemID, qty := range remaining {
+				if qty-backordered[itemID] > 0 {
+					toShip[itemID] = qty - backordered[itemID]
+				}
+			}
+		}
+		for _, item := range req.Items {
+			left, ok := remaining[item.OrderItemID]
+			if !ok {
+				return &shipmentError{Message: fmt.Sprintf("Order item %d does not belong to this order", item.OrderItemID)}
+			}
+			toShip[item.OrderItemID] += item.Quantity
+			if shippable := left - backordered[item.OrderItemID]; toShip[item.OrderItemID] > shippable {
+				return &shipmentError{Message: fmt.Sprintf("Only %d of order item %d ready to ship", max(shippable, 0), item.OrderItemID)}
+			}
+		}
+		if len(toShip) == 0 {
+			return &shipmentError{Message: "Nothing ready to ship"}
+		}
+
+		if err := tx.Create(&shipment).Error; err != nil {
+			return err
+		}
+		fullyShipped := true
+		for itemID, left := range remaining {
+			qty := toShip[itemID]
+			if qty > 0 {
+				if err := tx.Create(&models.ShipmentItem{ShipmentID: shipment.ID, OrderItemID: itemID, Quantity: qty}).Error; err != nil {
+					return err
+				}
+			}
+			if qty < left {
+				fullyShipped = false
+			}
+		}
+
+		status := models.OrderStatusPartiallyShipped
+		if fullyShipped {
+			status = models.OrderStatusShipped
+		}
+		if status == order.Status {
+			return nil
+		}
+		note := fmt.Sprintf("Shipment #%d via %s", shipment.ID, shipment.Carrier)
+		if shipment.TrackingNumber != "" {
+			note += " (" + shipment.TrackingNumber + ")"
+		}
+		return transitionOrderStatus(tx, &order, status, currentActorID(c), note)
+	})
+	if err != nil {
+		if shipErr, ok := err.(*shipmentError); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": shipErr.Message})
+			return
+		}
+		respondOrderTransitionError(c, err)
+		return
+	}
+
+	if userID, exists := c.Get("userID"); exists {
+		LogAction(userID.(uint), "create_shipment", "order", order.ID, gin.H{"shipment_id": shipment.ID, "status": order.Status}, c)
+	}
+	settleOrderPayments(order)
+
+	database.DB.Preload("Items").First(&shipment, shipment.ID)
+	c.JSON(http.StatusCreated, gin.H{"message": "Shipment created", "shipment": shipment, "order": order})
+}
+
+// UpdateShipment updates a shipment's carrier and tracking details (admin only)
+func UpdateShipment(c *gin.Context) {
+	var shipment models.Shipment
+	if err := database.DB.First(&shipment, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipment not found"})
+		return
+	}
+
+	var req struct {
+		Carrier        *string `json:"carrier"`
+		TrackingNumber *string `json:"tracking_number"`
+		TrackingURL    *string `json:"tracking_url"`
+		Notes          *string `json:"notes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Carrier != nil && *req.Carrier != "" {
+		shipment.Carrier = *req.Carrier
+	}
+	if req.TrackingNumber != nil {
+		shipment.TrackingNumber = *req.TrackingNumber
+	}
+	if req.TrackingURL != nil {
+		shipment.TrackingURL = *req.TrackingURL
+	}
+	if req.Notes != nil {
+		shipment.Notes = *req.Notes
+	}
+
+	if err := database.DB.Save(&shipment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update shipment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Shipment updated", "shipment": shipment})
+}
+
+// MarkShipmentDelivered records a shipment's delivery. Once every item of a shipped order has
+// been delivered the order moves to delivered (admin only).
+func MarkShipmentDelivered(c *gin.Context) {
+	var shipment models.Shipment
+	if err := database.DB.First(&shipment, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipment not found"})
+		return
+	}
+	if shipment.DeliveredAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Shipment already delivered"})
+		return
+	}
+
+	var order models.Order
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, shipment.OrderID).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		shipment.DeliveredAt = &now
+		if err := tx.Model(&shipment).Update("delivered_at", now).Error; err != nil {
+			return err
+		}
+
+		if order.Status != models.OrderStatusShipped {
+			return nil
+		}
+		var undelivered int64
+		if err := tx.Model(&models.Shipment{}).Where("order_id = ? AND delivered_at IS NULL", order.ID).
+			Count(&undelivered).Error; err != nil {
+			return err
+		}
+		if undelivered > 0 {
+			return nil
+		}
+		return transitionOrderStatus(tx, &order, models.OrderStatusDelivered, currentActorID(c), "All shipments delivered")
+	})
+	if err != nil {
+		respondOrderTransitionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Shipment marked as delivered", "shipment": shipment, "order": order})
+}
+
+// unshippedQuantities returns how many units of each of an order's items are still to ship,
+// and how many of those are still backordered. Units a refund returned to stock won't ship.
+func unshippedQuantities(tx *gorm.DB, orderID uint) (map[uint]int, map[uint]int, error) {
+	var items []models.OrderItem
+	if err := tx.Where("order_id = ?", orderID).Find(&items).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var shipped []struct {
+		OrderItemID uint
+		Quantity    int
+	}
+	if err := tx.Model(&models.ShipmentItem{}).
+		Select("shipment_items.order_item_id, SUM(shipment_items.quantity) AS quantity").
+		Joins("JOIN shipments ON shipments.id = shipment_items.shipment_id AND shipments.deleted_at IS NULL").
+		Where("shipments.order_id = ?", orderID).
+		Group("shipment_items.order_item_id").Scan(&shipped).Error; err != nil {
+		return nil, nil, err
+	}
+
+	remaining := make(map[uint]int, len(items))
+	backordered := make(map[uint]int, len(items))
+	for _, item := range items {
+		remaining[item.ID] = item.Quantity - item.RestockedQty
+		backordered[item.ID] = item.BackorderedQty
+	}
+	for _, s := range shipped {
+		remaining[s.OrderItemID] -= s.Quantity
+	}
+	for itemID, qty := range remaining {
+		remaining[itemID] = max(qty, 0)
+	}
+	return remaining, backordered, nil
+}
@@ -1,31 +1,93 @@
 package controllers
 
 import (
+	"fmt"
 	"net/http"
+	"time"
 
 	"ecom-backend/database"
 	"ecom-backend/models"
+	"ecom-backend/money"
+	"ecom-backend/pricing"
+	"ecom-backend/shipping"
 
 	"github.com/gin-gonic/gin"
 )
 
-// GetShippingMethods returns all active shipping methods
+// GetShippingMethods returns all active shipping methods with their estimated delivery dates (public, for checkout)
 func GetShippingMethods(c *gin.Context) {
 	var methods []models.ShippingMethod
-	query := database.DB.Where("is_active = ?", true)
+	query := database.DB.Where("is_active = ?", true).Order("cost ASC")
 
 	if err := query.Find(&methods).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shipping methods"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"shipping_methods": methods})
+	now := time.Now()
+	response := make([]gin.H, 0, len(methods))
+	for _, method := range methods {
+		response = append(response, gin.H{
+			"id":                      method.ID,
+			"name":                    method.Name,
+			"description":             method.Description,
+			"cost":                    method.Cost,
+			"estimated_days":          method.EstimatedDays,
+			"estimated_delivery_date": shipping.EstimatedDeliveryDate(now, method.EstimatedDays).Format("2006-01-02"),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"shipping_methods": response})
+}
+
+// EstimateShipping quotes every active shipping method for a destination and list of items (public)
+func EstimateShipping(c *gin.Context) {
+	var req struct {
+		Country    string `json:"country" binding:"required"`
+		State      string `json:"state"`
+		City       string `json:"city"`
+		PostalCode string `json:"postal_code"`
+		Items      []struct {
+			ProductID  uint              `json:"product_id" binding:"required"`
+			Quantity   int               `json:"quantity" binding:"required,min=1"`
+			Variations map[string]string `json:"variations"`
+		} `json:"items" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var items []shipping.Item
+	var subtotal money.Money
+	for _, item := range req.Items {
+		var product models.Product
+		if err := database.DB.First(&product, item.ProductID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		unitPrice := product.Price
+		if resolved, err := pricing.ResolveVariations(database.DB, product.ID, item.Variations); err == nil {
+			unitPrice = unitPrice.Add(resolved.PriceModifier)
+		}
+		subtotal = subtotal.Add(unitPrice.Mul(item.Quantity))
+		items = append(items, shipping.Item{Product: product, Quantity: item.Quantity})
+	}
+
+	dest := shipping.Destination{Country: req.Country, Region: req.State, City: req.City, PostalCode: req.PostalCode}
+	quotes, err := shipping.QuoteAll(database.DB, dest, items, subtotal)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate shipping"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"subtotal": subtotal, "quotes": quotes})
 }
 
 // GetAllShippingMethods returns all shipping methods (admin only)
 func GetAllShippingMethods(c *gin.Context) {
 	var methods []models.ShippingMethod
-	if err := database.DB.Find(&methods).Error; err != nil {
+	if err := database.DB.Preload("Rates").Preload("Rates.ShippingZone").Find(&methods).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shipping methods"})
 		return
 	}
@@ -38,7 +100,7 @@ func CreateShippingMethod(c *gin.Context) {
 	var req struct {
 		Name          string  `json:"name" binding:"required"`
 		Description   string  `json:"description"`
-		Cost          float64 `json:"cost" binding:"required"`
+		Cost          money.Money `json:"cost" binding:"required"`
 		EstimatedDays int     `json:"estimated_days"`
 		IsActive      bool    `json:"is_active"`
 	}
@@ -79,7 +141,7 @@ func UpdateShippingMethod(c *gin.Context) {
 	var req struct {
 		Name          string  `json:"name"`
 		Description   string  `json:"description"`
-		Cost          float64 `json:"cost"`
+		Cost          money.Money `json:"cost"`
 		EstimatedDays int     `json:"estimated_days"`
 		IsActive      bool    `json:"is_active"`
 	}
@@ -121,3 +183,243 @@ func DeleteShippingMethod(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Shipping method deleted"})
 }
 
+
+// GetShippingZones returns all shipping zones (admin only)
+func GetShippingZones(c *gin.Context) {
+	var zones []models.ShippingZone
+	if err := database.DB.Order("priority DESC, name ASC").Find(&zones).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shipping zones"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"shipping_zones": zones})
+}
+
+// CreateShippingZone creates a new shipping zone (admin only)
+func CreateShippingZone(c *gin.Context) {
+	var req models.ShippingZone
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name == "" || req.Country == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name and country are required"})
+		return
+	}
+
+	zone := models.ShippingZone{
+		Name:        req.Name,
+		Country:     req.Country,
+		Region:      req.Region,
+		City:        req.City,
+		PostalCodes: req.PostalCodes,
+		Priority:    req.Priority,
+		IsActive:    req.IsActive,
+	}
+	if err := database.DB.Create(&zone).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create shipping zone"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Shipping zone created", "zone": zone})
+}
+
+// UpdateShippingZone updates a shipping zone (admin only)
+func UpdateShippingZone(c *gin.Context) {
+	var zone models.ShippingZone
+	if err := database.DB.First(&zone, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipping zone not found"})
+		return
+	}
+
+	// Only the fields sent are changed; an empty region, city or postal codes clears it
+	var req struct {
+		Name        *string `json:"name"`
+		Country     *string `json:"country"`
+		Region      *string `json:"region"`
+		City        *string `json:"city"`
+		PostalCodes *string `json:"postal_codes"`
+		Priority    *int    `json:"priority"`
+		IsActive    *bool   `json:"is_active"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name != nil && *req.Name != "" {
+		zone.Name = *req.Name
+	}
+	if req.Country != nil && *req.Country != "" {
+		zone.Country = *req.Country
+	}
+	if req.Region != nil {
+		zone.Region = *req.Region
+	}
+	if req.City != nil {
+		zone.City = *req.City
+	}
+	if req.PostalCodes != nil {
+		zone.PostalCodes = *req.PostalCodes
+	}
+	if req.Priority != nil {
+		zone.Priority = *req.Priority
+	}
+	if req.IsActive != nil {
+		zone.IsActive = *req.IsActive
+	}
+
+	if err := database.DB.Save(&zone).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update shipping zone"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Shipping zone updated", "zone": zone})
+}
+
+// DeleteShippingZone deletes a shipping zone and its rates (admin only)
+func DeleteShippingZone(c *gin.Context) {
+	zoneID := c.Param("id")
+	if err := database.DB.Where("shipping_zone_id = ?", zoneID).Delete(&models.ShippingRate{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete shipping zone rates"})
+		return
+	}
+	if err := database.DB.Delete(&models.ShippingZone{}, zoneID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete shipping zone"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Shipping zone deleted"})
+}
+
+// GetShippingRates returns the rate table of a shipping method (admin only)
+func GetShippingRates(c *gin.Context) {
+	var rates []models.ShippingRate
+	if err := database.DB.Preload("ShippingZone").Where("shipping_method_id = ?", c.Param("id")).
+		Order("shipping_zone_id ASC, basis ASC, min_value ASC, min_subtotal ASC").Find(&rates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shipping rates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rates": rates})
+}
+
+// CreateShippingRate adds a row to a shipping method's rate table (admin only)
+func CreateShippingRate(c *gin.Context) {
+	var method models.ShippingMethod
+	if err := database.DB.First(&method, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipping method not found"})
+		return
+	}
+
+	var req models.ShippingRate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rate := models.ShippingRate{
+		ShippingMethodID:      method.ID,
+		ShippingZoneID:        req.ShippingZoneID,
+		Basis:                 req.Basis,
+		MinValue:              req.MinValue,
+		MaxValue:              req.MaxValue,
+		MinSubtotal:           req.MinSubtotal,
+		MaxSubtotal:           req.MaxSubtotal,
+		Cost:                  req.Cost,
+		CostPerKg:             req.CostPerKg,
+		FreeShippingThreshold: req.FreeShippingThreshold,
+	}
+	if err := validateShippingRate(&rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Create(&rate).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create shipping rate"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Shipping rate created", "rate": rate})
+}
+
+// UpdateShippingRate updates a rate table row (admin only)
+func UpdateShippingRate(c *gin.Context) {
+	var rate models.ShippingRate
+	if err := database.DB.First(&rate, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipping rate not found"})
+		return
+	}
+
+	var req models.ShippingRate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rate.ShippingZoneID = req.ShippingZoneID
+	rate.Basis = req.Basis
+	rate.MinValue = req.MinValue
+	rate.MaxValue = req.MaxValue
+	rate.MinSubtotal = req.MinSubtotal
+	rate.MaxSubtotal = req.MaxSubtotal
+	rate.Cost = req.Cost
+	rate.CostPerKg = req.CostPerKg
+	rate.FreeShippingThreshold = req.FreeShippingThreshold
+	if err := validateShippingRate(&rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Save(&rate).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update shipping rate"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Shipping rate updated", "rate": rate})
+}
+
+// DeleteShippingRate deletes a rate table row (admin only)
+func DeleteShippingRate(c *gin.Context) {
+	if err := database.DB.Delete(&models.ShippingRate{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete shipping rate"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Shipping rate deleted"})
+}
+
+// validateShippingRate normalises a rate row and checks its bounds
+func validateShippingRate(rate *models.ShippingRate) error {
+	if rate.Basis == "" {
+		rate.Basis = "weight"
+	}
+	if rate.Basis != "weight" && rate.Basis != "subtotal" {
+		return fmt.Errorf("basis must be weight or subtotal")
+	}
+	if rate.MinValue < 0 || rate.MinSubtotal < 0 || rate.Cost < 0 || rate.CostPerKg < 0 || rate.FreeShippingThreshold < 0 {
+		return fmt.Errorf("rate values cannot be negative")
+	}
+	if rate.Basis == "subtotal" {
+		if rate.MinValue != 0 || rate.MaxValue != 0 {
+			return fmt.Errorf("subtotal rates are bounded by min_subtotal and max_subtotal")
+		}
+		if !rate.MaxSubtotal.IsZero() && rate.MaxSubtotal <= rate.MinSubtotal {
+			return fmt.Errorf("max_subtotal must be greater than min_subtotal")
+		}
+	} else {
+		if !rate.MinSubtotal.IsZero() || !rate.MaxSubtotal.IsZero() {
+			return fmt.Errorf("weight rates are bounded by min_value and max_value")
+		}
+		if rate.MaxValue != 0 && rate.MaxValue <= rate.MinValue {
+			return fmt.Errorf("max_value must be greater than min_value")
+		}
+	}
+	if rate.ShippingZoneID != nil {
+		var zone models.ShippingZone
+		if err := database.DB.First(&zone, *rate.ShippingZoneID).Error; err != nil {
+			return fmt.Errorf("shipping zone not found")
+		}
+	}
+	return nil
+}
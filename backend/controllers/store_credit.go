@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"net/http"
+
+	"ecom-backend/database"
+	"ecom-backend/models"
+	"ecom-backend/money"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetMyStoreCredit returns the current user's store credit balance and ledger
+func GetMyStoreCredit(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	respondStoreCredit(c, userID.(uint))
+}
+
+// GetCustomerStoreCredit returns a customer's store credit balance and ledger (admin only)
+func GetCustomerStoreCredit(c *gin.Context) {
+	var user models.User
+	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+	respondStoreCredit(c, user.ID)
+}
+
+// AdjustStoreCredit adds to or removes from a customer's store credit (admin only)
+func AdjustStoreCredit(c *gin.Context) {
+	var req BalanceAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Amount.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount can't be 0"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	var wallet models.StoreCreditWallet
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		wallet, err = changeStoreCredit(tx, user.ID, req.Amount, models.StoreCreditTransaction{
+			Type:    models.CreditAdjust,
+			ActorID: currentActorID(c),
+			Note:    req.Note,
+		})
+		return err
+	})
+	if err == errInsufficientBalance {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Adjustment would take the balance below 0"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust store credit"})
+		return
+	}
+
+	LogAction(actorIDOrZero(c), "adjust", "store_credit", user.ID, gin.H{"amount": req.Amount, "balance_after": wallet.Balance, "note": req.Note}, c)
+	c.JSON(http.StatusOK, wallet)
+}
+
+// respondStoreCredit writes a user's wallet and recent ledger entries
+func respondStoreCredit(c *gin.Context, userID uint) {
+	balance, err := storeCreditBalance(database.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store credit"})
+		return
+	}
+
+	var transactions []models.StoreCreditTransaction
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at DESC, id DESC").Limit(100).
+		Find(&transactions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store credit"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":      userID,
+		"balance":      balance,
+		"transactions": transactions,
+	})
+}
+
+// storeCreditBalance returns a user's store credit, zero when they have no wallet yet
+func storeCreditBalance(db *gorm.DB, userID uint) (money.Money, error) {
+	var wallet models.StoreCreditWallet
+	if err := db.Where("user_id = ?", userID).Limit(1).Find(&wallet).Error; err != nil {
+		return 0, err
+	}
+	return wallet.Balance, nil
+}
+
+// changeStoreCredit adds delta to a user's store credit, creating their wallet on first use,
+// and records the change in their ledger. Debits fail with errInsufficientBalance rather than
+// take the balance below zero.
+func changeStoreCredit(tx *gorm.DB, userID uint, delta money.Money, entry models.StoreCreditTransaction) (models.StoreCreditWallet, error) {
+	if err := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "user_id"}}, DoNothing: true}).
+		Create(&models.StoreCreditWallet{UserID: userID}).Error; err != nil {
+		return models.StoreCreditWallet{}, err
+	}
+
+	var wallet models.StoreCreditWallet
+	query := tx.Model(&wallet).Clauses(clause.Returning{}).Where("user_id = ?", userID)
+	if delta.IsNegative() {
+		query = query.Where("balance >= ?", delta.Neg())
+	}
+	result := query.Update("balance", gorm.Expr("balance + ?", delta))
+	if result.Error != nil {
+		return wallet, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return wallet, errInsufficientBalance
+	}
+
+	entry.UserID = userID
+	entry.Amount = delta
+	entry.BalanceAfter = wallet.Balance
+	return wallet, tx.Create(&entry).Error
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"fmt"
+
+	"ecom-backend/models"
+	"ecom-backend/money"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// storedValueTender names the gift card or store credit wallet an order is paid from
+type storedValueTender struct {
+	Method     string // models.PaymentMethodGiftCard or models.PaymentMethodStoreCredit
+	GiftCardID uint
+	UserID     uint
+	Limit      money.Money // Most to spend, in the order's currency; zero for as much as is due
+}
+
+// isStoredValueMethod reports whether a payment was made from a gift card or store credit,
+// which are returned to their source rather than refunded as money
+func isStoredValueMethod(method string) bool {
+	return method == models.PaymentMethodGiftCard || method == models.PaymentMethodStoreCredit
+}
+
+// redeemStoredValue spends up to want, in the order's currency, from a gift card or store
+// credit wallet and records it as a payment on the order. Balances are held in the base
+// currency; spending the whole converted balance empties it so no rounding residue is left.
+// It returns the amount applied, which is less than want when the balance runs short.
+func redeemStoredValue(tx *gorm.DB, order *models.Order, tender storedValueTender, want money.Money, currency money.Currency, actorID *uint) (money.Money, error) {
+	var balance money.Money
+	var reference string
+	if tender.Method == models.PaymentMethodGiftCard {
+		var card models.GiftCard
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&card, tender.GiftCardID).Error; err != nil {
+			return 0, err
+		}
+		if _, err := findRedeemableGiftCard(tx, card.Code); err != nil {
+			return 0, &orderConflictError{Message: err.Error()}
+		}
+		balance, reference = card.Balance, giftCardPaymentReference(card)
+	} else {
+		var wallet models.StoreCreditWallet
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", tender.UserID).
+			Limit(1).Find(&wallet).Error; err != nil {
+			return 0, err
+		}
+		balance, reference = wallet.Balance, "Store credit"
+	}
+
+	rate := order.ExchangeRate
+	available := rate.Convert(balance, currency)
+	applied := min(want, available)
+	if !applied.IsPositive() {
+		return 0, nil
+	}
+	debit := balance
+	if applied < available {
+		debit = min(rate.ToBase(applied), balance)
+	}
+
+	note := fmt.Sprintf("Order %s", orderReference(*order))
+	var err error
+	if tender.Method == models.PaymentMethodGiftCard {
+		_, err = changeGiftCardBalance(tx, tender.GiftCardID, debit.Neg(), models.GiftCardTransaction{
+			Type: models.CreditRedeem, OrderID: &order.ID, ActorID: actorID, Note: note,
+		})
+	} else {
+		_, err = changeStoreCredit(tx, tender.UserID, debit.Neg(), models.StoreCreditTransaction{
+			Type: models.CreditRedeem, OrderID: &order.ID, ActorID: actorID, Note: note,
+		})
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return applied, tx.Create(&models.Payment{
+		OrderID:        order.ID,
+		Method:         tender.Method,
+		Amount:         applied,
+		CapturedAmount: applied,
+		Reference:      reference,
+	}).Error
+}
+
+// returnStoredValue credits back whatever gift card and store credit balance an order still
+// holds, e.g. when it is cancelled. Credits made through refunds are left out, so nothing is
+// returned twice.
+func returnStoredValue(tx *gorm.DB, order *models.Order) error {
+	note := fmt.Sprintf("Order %s cancelled", orderReference(*order))
+
+	var cards []struct {
+		GiftCardID uint
+		Net        money.Money
+	}
+	if err := tx.Model(&models.GiftCardTransaction{}).Select("gift_card_id, SUM(amount) AS net").
+		Where("order_id = ?", order.ID).Group("gift_card_id").Scan(&cards).Error; err != nil {
+		return err
+	}
+	for _, card := range cards {
+		if !card.Net.IsNegative() {
+			continue
+		}
+		if _, err := changeGiftCardBalance(tx, card.GiftCardID, card.Net.Neg(), models.GiftCardTransaction{
+			Type: models.CreditRefund, OrderID: &order.ID, Note: note,
+		}); err != nil {
+			return err
+		}
+	}
+
+	var wallets []struct {
+		UserID uint
+		Net    money.Money
+	}
+	if err := tx.Model(&models.StoreCreditTransaction{}).Select("user_id, SUM(amount) AS net").
+		Where("order_id = ? AND refund_id IS NULL", order.ID).Group("user_id").Scan(&wallets).Error; err != nil {
+		return err
+	}
+	for _, wallet := range wallets {
+		if !wallet.Net.IsNegative() {
+			continue
+		}
+		if _, err := changeStoreCredit(tx, wallet.UserID, wallet.Net.Neg(), models.StoreCreditTransaction{
+			Type: models.CreditRefund, OrderID: &order.ID, Note: note,
+		}); err != nil {
+			return err
+		}
+	}
+
+	// The payments no longer count as collected, so they can't be refunded again
+	return tx.Model(&models.Payment{}).
+		Where("order_id = ? AND method IN ? AND status = ?", order.ID,
+			[]string{models.PaymentMethodGiftCard, models.PaymentMethodStoreCredit}, models.PaymentStatusCaptured).
+		Updates(map[string]interface{}{"refunded_amount": gorm.Expr("captured_amount"), "status": models.PaymentStatusRefunded}).Error
+}
@@ -6,6 +6,7 @@ import (
 
 	"ecom-backend/database"
 	"ecom-backend/models"
+	"ecom-backend/money"
 
 	"github.com/gin-gonic/gin"
 )
@@ -53,35 +54,37 @@ func GetTaxReports(c *gin.Context) {
 	}
 
 	// Calculate tax statistics
-	var totalTax float64
-	var totalRevenue float64
+	var totalTax money.Money
+	var totalRevenue money.Money
 	var orderCount int
-	taxByCountry := make(map[string]float64)
-	taxByMonth := make(map[string]float64)
+	taxByCountry := make(map[string]money.Money)
+	taxByMonth := make(map[string]money.Money)
 
+	// Orders placed in other currencies are reported in the base currency at their checkout rate
 	for _, order := range orders {
-		if order.Tax > 0 {
-			totalTax += order.Tax
-			totalRevenue += order.Total
+		if order.Tax.IsPositive() {
+			tax := order.ExchangeRate.ToBase(order.Tax)
+			totalTax = totalTax.Add(tax)
+			totalRevenue = totalRevenue.Add(order.ExchangeRate.ToBase(order.Total))
 			orderCount++
 
 			// Group by country
-			taxByCountry[order.Country] += order.Tax
+			taxByCountry[order.Country] = taxByCountry[order.Country].Add(tax)
 
 			// Group by month
 			monthKey := order.CreatedAt.Format("2006-01")
-			taxByMonth[monthKey] += order.Tax
+			taxByMonth[monthKey] = taxByMonth[monthKey].Add(tax)
 		}
 	}
 
 	// Convert maps to slices for JSON
 	type TaxByCountry struct {
-		Country string  `json:"country"`
-		Tax     float64 `json:"tax"`
+		Country string      `json:"country"`
+		Tax     money.Money `json:"tax"`
 	}
 	type TaxByMonth struct {
-		Month string  `json:"month"`
-		Tax   float64 `json:"tax"`
+		Month string      `json:"month"`
+		Tax   money.Money `json:"tax"`
 	}
 
 	countries := make([]TaxByCountry, 0, len(taxByCountry))
@@ -103,7 +106,7 @@ func GetTaxReports(c *gin.Context) {
 			"total_tax":     totalTax,
 			"total_revenue": totalRevenue,
 			"order_count":   orderCount,
-			"average_tax":   totalTax / float64(max(orderCount, 1)),
+			"average_tax":   money.FromMinor(totalTax.Minor() / int64(max(orderCount, 1))),
 		},
 		"tax_by_country": countries,
 		"tax_by_month":   months,
@@ -6,8 +6,12 @@ import (
 
 	"ecom-backend/database"
 	"ecom-backend/models"
+	"ecom-backend/money"
+	"ecom-backend/pricing"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // GetProductVariations returns all variations for a product
@@ -109,7 +113,7 @@ func CreateVariationOption(c *gin.Context) {
 	variationID := c.Param("id")
 	var req struct {
 		Value         string  `json:"value" binding:"required"`
-		PriceModifier float64 `json:"price_modifier"`
+		PriceModifier money.Money `json:"price_modifier"`
 		Stock         int     `json:"stock"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -150,7 +154,7 @@ func UpdateVariationOption(c *gin.Context) {
 
 	var req struct {
 		Value         string  `json:"value"`
-		PriceModifier float64 `json:"price_modifier"`
+		PriceModifier money.Money `json:"price_modifier"`
 		Stock         int     `json:"stock"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -204,3 +208,41 @@ func SerializeVariations(variations map[string]string) string {
 	return string(data)
 }
 
+
+// lookupSelectedOptions finds the predefined options matching stored selections, skipping
+// any that no longer exist. Used when restocking past orders.
+func lookupSelectedOptions(db *gorm.DB, productID uint, selections map[string]string) ([]models.VariationOption, error) {
+	var variations []models.ProductVariation
+	if err := db.Preload("Options").Where("product_id = ?", productID).Find(&variations).Error; err != nil {
+		return nil, err
+	}
+
+	var options []models.VariationOption
+	for name, value := range selections {
+		if variation := pricing.FindVariation(variations, name); variation != nil {
+			if option := pricing.FindVariationOption(variation.Options, value); option != nil {
+				options = append(options, *option)
+			}
+		}
+	}
+	return options, nil
+}
+
+// deductOptionStock decrements a variation option's stock only if enough is left, not
+// counting units reserved for unpaid orders
+func deductOptionStock(tx *gorm.DB, optionID uint, quantity int) error {
+	// Lock first so the update below sees reservations committed while it waited
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Find(&models.VariationOption{}, optionID).Error; err != nil {
+		return err
+	}
+	result := tx.Model(&models.VariationOption{}).
+		Where("id = ? AND stock - "+reservedOptionSQL+" >= ?", optionID, quantity).
+		Update("stock", gorm.Expr("stock - ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInsufficientStock
+	}
+	return nil
+}
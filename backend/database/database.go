@@ -6,6 +6,7 @@ import (
 
 	"ecom-backend/config"
 	"ecom-backend/models"
+	"ecom-backend/money"
 	"ecom-backend/utils"
 
 	"gorm.io/driver/postgres"
@@ -89,6 +90,7 @@ func Migrate() {
 		&models.Order{},
 		&models.OrderItem{},
 		&models.Payment{},
+		&models.PaymentWebhookEvent{},
 		&models.Coupon{},
 		&models.Setting{},
 		&models.Notification{},
@@ -96,8 +98,11 @@ func Migrate() {
 		&models.VariationOption{},
 		&models.Review{},
 		&models.ShippingMethod{},
+		&models.ShippingZone{},
+		&models.ShippingRate{},
 		&models.ShippingAddress{},
 		&models.Refund{},
+		&models.RefundPayment{},
 		&models.AuditLog{},
 		&models.Wishlist{},
 		&models.Campaign{},
@@ -106,11 +111,38 @@ func Migrate() {
 		&models.ThemeCustomization{},
 		&models.Page{},
 		&models.TaxRate{},
+		&models.IdempotencyKey{},
+		&models.OrderStatusHistory{},
+		&models.Shipment{},
+		&models.ShipmentItem{},
+		&models.Currency{},
+		&models.OrderSequence{},
+		&models.AbandonedCart{},
+		&models.InventoryReservation{},
+		&models.GiftCard{},
+		&models.GiftCardTransaction{},
+		&models.StoreCreditWallet{},
+		&models.StoreCreditTransaction{},
 	)
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	// Payments recorded before captured and refunded amounts were tracked collected their full amount
+	if err := DB.Exec("UPDATE payments SET captured_amount = amount WHERE status IN ? AND captured_amount = 0",
+		[]string{models.PaymentStatusCaptured, models.PaymentStatusRefunded}).Error; err != nil {
+		log.Fatal("Failed to migrate payments:", err)
+	}
+	if err := DB.Exec("UPDATE payments SET refunded_amount = captured_amount WHERE status = ? AND refunded_amount = 0",
+		models.PaymentStatusRefunded).Error; err != nil {
+		log.Fatal("Failed to migrate payments:", err)
+	}
+
+	// Gateway endpoints are no longer configurable, so credentials only ever go to the real gateway
+	if err := DB.Where("key LIKE ?", "payment_gateway_%_api_url").Delete(&models.Setting{}).Error; err != nil {
+		log.Fatal("Failed to migrate settings:", err)
+	}
+
 	log.Println("Database migrated successfully")
 }
 
@@ -165,7 +197,7 @@ func SeedData() {
 		{
 			Name:        "Wireless Bluetooth Headphones",
 			Description: "Premium noise-cancelling wireless headphones with 30-hour battery life and crystal clear sound",
-			Price:       3500.00,
+			Price:       money.MustParse("3500.00"),
 			Image:       "https://images.unsplash.com/photo-1505740420928-5e560c06d30e?w=500",
 			Stock:       50,
 			CategoryID:  electronicsCategory.ID,
@@ -173,7 +205,7 @@ func SeedData() {
 		{
 			Name:        "Smart Watch Pro",
 			Description: "Feature-rich smartwatch with fitness tracking, heart rate monitor, and smartphone notifications",
-			Price:       8500.00,
+			Price:       money.MustParse("8500.00"),
 			Image:       "https://images.unsplash.com/photo-1523275335684-37898b6baf30?w=500",
 			Stock:       30,
 			CategoryID:  electronicsCategory.ID,
@@ -181,7 +213,7 @@ func SeedData() {
 		{
 			Name:        "USB-C Laptop Stand",
 			Description: "Ergonomic aluminum laptop stand for better posture and improved airflow",
-			Price:       2500.00,
+			Price:       money.MustParse("2500.00"),
 			Image:       "https://images.unsplash.com/photo-1527864550417-7fd91fc51a46?w=500",
 			Stock:       100,
 			CategoryID:  electronicsCategory.ID,
@@ -189,7 +221,7 @@ func SeedData() {
 		{
 			Name:        "Wireless Mouse",
 			Description: "Ergonomic wireless mouse with long battery life and precise tracking",
-			Price:       1200.00,
+			Price:       money.MustParse("1200.00"),
 			Image:       "https://images.unsplash.com/photo-1527814050087-3793815479db?w=500",
 			Stock:       80,
 			CategoryID:  electronicsCategory.ID,
@@ -197,7 +229,7 @@ func SeedData() {
 		{
 			Name:        "Portable Power Bank",
 			Description: "20000mAh fast charging power bank with USB-C and wireless charging support",
-			Price:       2800.00,
+			Price:       money.MustParse("2800.00"),
 			Image:       "https://images.unsplash.com/photo-1609091839311-d5365f9ff1c8?w=500",
 			Stock:       60,
 			CategoryID:  electronicsCategory.ID,
@@ -205,7 +237,7 @@ func SeedData() {
 		{
 			Name:        "Bluetooth Speaker",
 			Description: "Waterproof portable Bluetooth speaker with 360-degree sound and 12-hour battery",
-			Price:       3200.00,
+			Price:       money.MustParse("3200.00"),
 			Image:       "https://images.unsplash.com/photo-1608043152269-423dbba4e7e1?w=500",
 			Stock:       45,
 			CategoryID:  electronicsCategory.ID,
@@ -214,7 +246,7 @@ func SeedData() {
 		{
 			Name:        "Premium Cotton T-Shirt",
 			Description: "Comfortable 100% organic cotton t-shirt in various colors - perfect for everyday wear",
-			Price:       899.00,
+			Price:       money.MustParse("899.00"),
 			Image:       "https://images.unsplash.com/photo-1521572163474-6864f9cf17ab?w=500",
 			Stock:       200,
 			CategoryID:  clothingCategory.ID,
@@ -222,7 +254,7 @@ func SeedData() {
 		{
 			Name:        "Classic Denim Jeans",
 			Description: "Classic fit denim jeans with stretch comfort and modern styling",
-			Price:       2200.00,
+			Price:       money.MustParse("2200.00"),
 			Image:       "https://images.unsplash.com/photo-1542272604-787c3835535d?w=500",
 			Stock:       75,
 			CategoryID:  clothingCategory.ID,
@@ -230,7 +262,7 @@ func SeedData() {
 		{
 			Name:        "Running Sports Shoes",
 			Description: "Lightweight running shoes with cushioned sole and breathable mesh upper",
-			Price:       4500.00,
+			Price:       money.MustParse("4500.00"),
 			Image:       "https://images.unsplash.com/photo-1542291026-7eec264c27ff?w=500",
 			Stock:       60,
 			CategoryID:  clothingCategory.ID,
@@ -238,7 +270,7 @@ func SeedData() {
 		{
 			Name:        "Casual Hoodie",
 			Description: "Warm and comfortable hoodie perfect for cool weather and casual outings",
-			Price:       1800.00,
+			Price:       money.MustParse("1800.00"),
 			Image:       "https://images.unsplash.com/photo-1556821840-3a63f95609a7?w=500",
 			Stock:       90,
 			CategoryID:  clothingCategory.ID,
@@ -246,7 +278,7 @@ func SeedData() {
 		{
 			Name:        "Formal Dress Shirt",
 			Description: "Professional long-sleeve dress shirt suitable for office and formal occasions",
-			Price:       1500.00,
+			Price:       money.MustParse("1500.00"),
 			Image:       "https://images.unsplash.com/photo-1594938291221-94ad1b724ece?w=500",
 			Stock:       55,
 			CategoryID:  clothingCategory.ID,
@@ -254,7 +286,7 @@ func SeedData() {
 		{
 			Name:        "Summer Shorts",
 			Description: "Comfortable and stylish shorts perfect for hot weather and outdoor activities",
-			Price:       1200.00,
+			Price:       money.MustParse("1200.00"),
 			Image:       "https://images.unsplash.com/photo-1591047139829-d91aecb6caea?w=500",
 			Stock:       110,
 			CategoryID:  clothingCategory.ID,
@@ -263,7 +295,7 @@ func SeedData() {
 		{
 			Name:        "The Complete Programming Guide",
 			Description: "Comprehensive guide to modern programming languages and best practices",
-			Price:       850.00,
+			Price:       money.MustParse("850.00"),
 			Image:       "https://images.unsplash.com/photo-1544947950-fa07a98d237f?w=500",
 			Stock:       40,
 			CategoryID:  booksCategory.ID,
@@ -271,7 +303,7 @@ func SeedData() {
 		{
 			Name:        "Web Development Handbook",
 			Description: "Essential handbook for web developers covering HTML, CSS, JavaScript, and frameworks",
-			Price:       950.00,
+			Price:       money.MustParse("950.00"),
 			Image:       "https://images.unsplash.com/photo-1507003211169-0a1dd7228f2d?w=500",
 			Stock:       35,
 			CategoryID:  booksCategory.ID,
@@ -279,7 +311,7 @@ func SeedData() {
 		{
 			Name:        "Business Strategy Book",
 			Description: "Insights into modern business strategies and entrepreneurship",
-			Price:       750.00,
+			Price:       money.MustParse("750.00"),
 			Image:       "https://images.unsplash.com/photo-1481627834876-b7833e8f5570?w=500",
 			Stock:       50,
 			CategoryID:  booksCategory.ID,
@@ -288,7 +320,7 @@ func SeedData() {
 		{
 			Name:        "Indoor Plant Pot Set",
 			Description: "Beautiful ceramic plant pot set perfect for indoor gardening and home decoration",
-			Price:       1800.00,
+			Price:       money.MustParse("1800.00"),
 			Image:       "https://images.unsplash.com/photo-1485955900006-10f4d324d411?w=500",
 			Stock:       70,
 			CategoryID:  homeGardenCategory.ID,
@@ -296,7 +328,7 @@ func SeedData() {
 		{
 			Name:        "LED Desk Lamp",
 			Description: "Modern LED desk lamp with adjustable brightness and USB charging port",
-			Price:       1500.00,
+			Price:       money.MustParse("1500.00"),
 			Image:       "https://images.unsplash.com/photo-1507473885765-e6ed057f782c?w=500",
 			Stock:       65,
 			CategoryID:  homeGardenCategory.ID,
@@ -304,7 +336,7 @@ func SeedData() {
 		{
 			Name:        "Kitchen Knife Set",
 			Description: "Professional stainless steel knife set with wooden block for your kitchen",
-			Price:       3500.00,
+			Price:       money.MustParse("3500.00"),
 			Image:       "https://images.unsplash.com/photo-1594736797933-d0a69e3c6288?w=500",
 			Stock:       40,
 			CategoryID:  homeGardenCategory.ID,
@@ -312,7 +344,7 @@ func SeedData() {
 		{
 			Name:        "Coffee Maker Machine",
 			Description: "Automatic coffee maker with programmable timer and thermal carafe",
-			Price:       5200.00,
+			Price:       money.MustParse("5200.00"),
 			Image:       "https://images.unsplash.com/photo-1517668808823-f8c02e6c3e92?w=500",
 			Stock:       25,
 			CategoryID:  homeGardenCategory.ID,
@@ -321,7 +353,7 @@ func SeedData() {
 		{
 			Name:        "Yoga Mat Premium",
 			Description: "Non-slip yoga mat with extra cushioning and carrying strap",
-			Price:       2500.00,
+			Price:       money.MustParse("2500.00"),
 			Image:       "https://images.unsplash.com/photo-1544367567-0f2fcb009e0b?w=500",
 			Stock:       80,
 			CategoryID:  sportsCategory.ID,
@@ -329,7 +361,7 @@ func SeedData() {
 		{
 			Name:        "Dumbbell Set 10kg",
 			Description: "Adjustable dumbbell set perfect for home workouts and strength training",
-			Price:       4200.00,
+			Price:       money.MustParse("4200.00"),
 			Image:       "https://images.unsplash.com/photo-1571019613454-1cb2f99b2d8b?w=500",
 			Stock:       35,
 			CategoryID:  sportsCategory.ID,
@@ -337,7 +369,7 @@ func SeedData() {
 		{
 			Name:        "Basketball Official Size",
 			Description: "High-quality basketball with excellent grip and durability",
-			Price:       1800.00,
+			Price:       money.MustParse("1800.00"),
 			Image:       "https://images.unsplash.com/photo-1546519638-68e109498ffc?w=500",
 			Stock:       50,
 			CategoryID:  sportsCategory.ID,
@@ -345,7 +377,7 @@ func SeedData() {
 		{
 			Name:        "Fitness Resistance Bands",
 			Description: "Set of 5 resistance bands with different resistance levels for full-body workouts",
-			Price:       1200.00,
+			Price:       money.MustParse("1200.00"),
 			Image:       "https://images.unsplash.com/photo-1576678927484-cc907957088c?w=500",
 			Stock:       90,
 			CategoryID:  sportsCategory.ID,
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"errors"
+	"log"
+
+	"ecom-backend/models"
+	"ecom-backend/secrets"
+)
+
+// secretSettings are the settings holding credentials. They are encrypted at rest, masked
+// when read through the admin API and left out of audit logs.
+var secretSettings = map[string]bool{
+	"payment_gateway_stripe_secret_key":         true,
+	"payment_gateway_stripe_webhook_secret":     true,
+	"payment_gateway_paypal_client_secret":      true,
+	"payment_gateway_sslcommerz_store_password": true,
+	"smtp_password": true,
+}
+
+// IsSecretSetting reports whether a setting holds a credential
+func IsSecretSetting(key string) bool {
+	return secretSettings[key]
+}
+
+// GetSetting returns a setting's value, or fallback when it isn't set. Secret settings are
+// decrypted; one that can't be decrypted is treated as unset.
+func GetSetting(key string, fallback string) string {
+	var setting models.Setting
+	if err := DB.Where("key = ?", key).First(&setting).Error; err != nil || setting.Value == "" {
+		return fallback
+	}
+	if !IsSecretSetting(key) {
+		return setting.Value
+	}
+	value, err := secrets.Decrypt(setting.Value)
+	if err != nil {
+		log.Printf("Failed to decrypt setting %s: %v", key, err)
+		return fallback
+	}
+	return value
+}
+
+// SetSetting creates or updates a setting, encrypting secret settings. A secret can't be
+// saved until SECRETS_KEY is configured, and a masked secret sent back by a form leaves the
+// stored one unchanged.
+func SetSetting(key, value, settingType string) error {
+	if IsSecretSetting(key) && secrets.IsMasked(value) {
+		return nil
+	}
+	if IsSecretSetting(key) && value != "" {
+		encrypted, err := secrets.Encrypt(value)
+		if err != nil {
+			return err
+		}
+		value = encrypted
+	}
+
+	var setting models.Setting
+	err := DB.Where("key = ?", key).First(&setting).Error
+	if err != nil {
+		setting = models.Setting{Key: key, Value: value, Type: settingType}
+		return DB.Create(&setting).Error
+	}
+	setting.Value = value
+	if settingType != "" {
+		setting.Type = settingType
+	}
+	return DB.Save(&setting).Error
+}
+
+// MaskedSetting returns a secret setting's value for display, e.g. "sk_live_****1234"
+func MaskedSetting(key, stored string) string {
+	value, err := secrets.Decrypt(stored)
+	if err != nil {
+		return "****"
+	}
+	return secrets.Mask(value)
+}
+
+// ReencryptSecretSettings encrypts secret settings still stored as plaintext, and those
+// encrypted with a previous key, with the current SECRETS_KEY. It runs at startup, so
+// rotating the key only needs the old one moved to SECRETS_PREVIOUS_KEYS.
+func ReencryptSecretSettings() {
+	if !secrets.Configured() {
+		log.Println("Warning: SECRETS_KEY is not set; payment and SMTP secrets can't be encrypted")
+		return
+	}
+
+	keys := make([]string, 0, len(secretSettings))
+	for key := range secretSettings {
+		keys = append(keys, key)
+	}
+	var settings []models.Setting
+	if err := DB.Where("key IN ?", keys).Find(&settings).Error; err != nil {
+		log.Printf("Failed to load secret settings: %v", err)
+		return
+	}
+
+	for _, setting := range settings {
+		if !secrets.NeedsRotation(setting.Value) {
+			continue
+		}
+		value, err := secrets.Decrypt(setting.Value)
+		if err != nil {
+			if errors.Is(err, secrets.ErrUnknownKey) {
+				err = errors.New("encrypted with a key not in SECRETS_KEY or SECRETS_PREVIOUS_KEYS")
+			}
+			log.Printf("Failed to re-encrypt setting %s: %v", setting.Key, err)
+			continue
+		}
+		encrypted, err := secrets.Encrypt(value)
+		if err != nil {
+			log.Printf("Failed to re-encrypt setting %s: %v", setting.Key, err)
+			continue
+		}
+		if err := DB.Model(&setting).Update("value", encrypted).Error; err != nil {
+			log.Printf("Failed to re-encrypt setting %s: %v", setting.Key, err)
+		}
+	}
+}
+
+// RedactSecrets returns a copy of a settings map with secret values replaced, for audit logs
+func RedactSecrets(values map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		if IsSecretSetting(key) {
+			value = "[redacted]"
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
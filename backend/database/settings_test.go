@@ -0,0 +1,76 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"ecom-backend/secrets"
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv("SECRETS_KEY", "settings-test-key")
+	os.Exit(m.Run())
+}
+
+func TestSetSettingIgnoresMaskedSecrets(t *testing.T) {
+	// No database is connected, so anything past the masked check would fail
+	saved := DB
+	DB = nil
+	defer func() { DB = saved }()
+
+	for _, value := range []string{"sk_live_****1234", "****", secrets.Mask("a-stored-smtp-password")} {
+		if err := SetSetting("payment_gateway_stripe_secret_key", value, "string"); err != nil {
+			t.Errorf("SetSetting(%q) error = %v, want the stored secret left alone", value, err)
+		}
+		if err := SetSetting("smtp_password", value, "string"); err != nil {
+			t.Errorf("SetSetting(smtp_password, %q) error = %v, want the stored secret left alone", value, err)
+		}
+	}
+}
+
+func TestMaskedSetting(t *testing.T) {
+	stored, err := secrets.Encrypt("sk_live_51HxYzAbCdEf1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		stored:                     "sk_live_****1234",
+		"legacy-plaintext-pass99":  "****ss99",
+		"":                         "",
+		"enc:v1:deadbeef:AAAAAAAA": "****",
+	}
+	for value, want := range tests {
+		if got := MaskedSetting("payment_gateway_stripe_secret_key", value); got != want {
+			t.Errorf("MaskedSetting(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	values := map[string]interface{}{
+		"payment_gateway_stripe_secret_key":         "sk_live_51HxYzAbCdEf1234",
+		"payment_gateway_stripe_webhook_secret":     "whsec_abc",
+		"payment_gateway_paypal_client_secret":      "paypal-secret",
+		"payment_gateway_sslcommerz_store_password": "store-pass",
+		"smtp_password":                  "hunter2",
+		"payment_gateway_stripe_enabled": true,
+		"store_name":                     "Acme",
+	}
+	redacted := RedactSecrets(values)
+
+	for key, value := range redacted {
+		if IsSecretSetting(key) {
+			if value != "[redacted]" {
+				t.Errorf("%s = %v in the audit copy, want it redacted", key, value)
+			}
+		} else if value != values[key] {
+			t.Errorf("%s = %v in the audit copy, want %v", key, value, values[key])
+		}
+	}
+	if len(redacted) != len(values) {
+		t.Errorf("audit copy has %d keys, want %d", len(redacted), len(values))
+	}
+	if values["smtp_password"] != "hunter2" {
+		t.Error("RedactSecrets changed the map it was given")
+	}
+}
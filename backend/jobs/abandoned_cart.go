@@ -0,0 +1,326 @@
+package jobs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"ecom-backend/database"
+	"ecom-backend/mailer"
+	"ecom-backend/models"
+	"ecom-backend/money"
+	"ecom-backend/pricing"
+	"ecom-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// abandonedCartInterval is how often idle carts are checked
+const abandonedCartInterval = 15 * time.Minute
+
+// abandonedCartLookback limits detection to carts touched in the last week, so old carts
+// aren't all emailed when the feature is first turned on. It also bounds email retries.
+const abandonedCartLookback = 7 * 24 * time.Hour
+
+// Settings that control abandoned cart detection and the recovery email
+const (
+	abandonedCartThresholdSetting    = "abandoned_cart_threshold_hours" // 0 turns detection off
+	abandonedCartCouponSetting       = "abandoned_cart_coupon_percent"  // 0 sends no coupon
+	abandonedCartCouponDaysSetting   = "abandoned_cart_coupon_valid_days"
+	abandonedCartSubjectSetting      = "abandoned_cart_email_subject"
+	abandonedCartTemplateSetting     = "abandoned_cart_email_template"
+	defaultAbandonedCartThreshold    = "24"
+	defaultAbandonedCartCouponDays   = "7"
+	defaultAbandonedCartEmailSubject = "You left something in your cart"
+)
+
+const defaultAbandonedCartTemplate = `<p>Hi {{.Name}},</p>
+<p>You left these items in your cart at {{.StoreName}}:</p>
+<ul>
+{{range .Items}}<li>{{.Quantity}} &times; {{.Name}}{{range $name, $value := .Variations}} ({{$name}}: {{$value}}){{end}} &ndash; {{.LineTotal}}</li>
+{{end}}</ul>
+<p>Cart total: {{.CartValue}}</p>
+{{if .CouponCode}}<p>Use code <strong>{{.CouponCode}}</strong> for {{.CouponPercent}}% off, valid until {{.CouponExpires}}.</p>
+{{end}}<p><a href="{{.RecoveryURL}}">Return to your cart</a></p>`
+
+// recoveryEmail is the data available to the recovery email template
+type recoveryEmail struct {
+	Name          string
+	StoreName     string
+	Items         []recoveryEmailItem
+	CartValue     string
+	RecoveryURL   string
+	CouponCode    string
+	CouponPercent string
+	CouponExpires string
+}
+
+type recoveryEmailItem struct {
+	Name       string
+	Quantity   int
+	Variations map[string]string
+	LineTotal  string
+}
+
+// idleCart is a cart owner whose cart hasn't changed since LastActivity
+type idleCart struct {
+	UserID       *uint
+	GuestID      string
+	LastActivity time.Time
+}
+
+// DetectAbandonedCarts records carts idle past the configured threshold and emails their
+// owners a link that restores the cart. Guest carts kept in Redis aren't seen here; guests
+// have no address to email, and Redis expires their carts on its own.
+func DetectAbandonedCarts() error {
+	hours, err := strconv.ParseFloat(database.GetSetting(abandonedCartThresholdSetting, defaultAbandonedCartThreshold), 64)
+	if err != nil || hours <= 0 {
+		return nil
+	}
+	now := time.Now()
+	cutoff := now.Add(-time.Duration(hours * float64(time.Hour)))
+
+	var idle []idleCart
+	if err := database.DB.Model(&models.Cart{}).
+		Select("user_id, CASE WHEN user_id IS NULL THEN guest_id ELSE '' END AS guest_id, MAX(updated_at) AS last_activity").
+		Group("1, 2").
+		Having("MAX(updated_at) < ? AND MAX(updated_at) > ?", cutoff, now.Add(-abandonedCartLookback)).
+		Scan(&idle).Error; err != nil {
+		return err
+	}
+
+	for _, cart := range idle {
+		if err := recordAbandonedCart(cart); err != nil {
+			log.Printf("Failed to record abandoned cart: %v", err)
+		}
+	}
+	return sendRecoveryEmails(now)
+}
+
+// recordAbandonedCart snapshots an idle cart, unless it was already recorded since its last change
+func recordAbandonedCart(cart idleCart) error {
+	owner := ownerScope(cart.UserID, cart.GuestID)
+
+	var recorded int64
+	if err := owner(database.DB.Model(&models.AbandonedCart{})).
+		Where("last_activity_at >= ?", cart.LastActivity).Count(&recorded).Error; err != nil {
+		return err
+	}
+	if recorded > 0 {
+		return nil
+	}
+
+	var lines []models.Cart
+	if err := owner(database.DB.Preload("Product")).Order("id ASC").Find(&lines).Error; err != nil {
+		return err
+	}
+
+	event := models.AbandonedCart{UserID: cart.UserID, GuestID: cart.GuestID, LastActivityAt: cart.LastActivity}
+	var items []models.AbandonedCartItem
+	for _, line := range lines {
+		if line.Product.ID == 0 {
+			continue // Product deleted since it was added
+		}
+		item := models.AbandonedCartItem{
+			ProductID: line.ProductID,
+			Name:      line.Product.Name,
+			Quantity:  line.Quantity,
+			UnitPrice: line.Product.Price,
+		}
+		if line.Variations != "" {
+			json.Unmarshal([]byte(line.Variations), &item.Variations)
+		}
+		if resolved, err := pricing.ResolveVariations(database.DB, line.ProductID, item.Variations); err == nil {
+			item.Variations = resolved.Selections
+			item.UnitPrice = line.Product.Price.Add(resolved.PriceModifier)
+		}
+		items = append(items, item)
+		event.ItemCount += item.Quantity
+		event.CartValue = event.CartValue.Add(item.UnitPrice.Mul(item.Quantity))
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	snapshot, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	event.Items = string(snapshot)
+
+	if cart.UserID != nil {
+		var user models.User
+		if err := database.DB.Select("id", "email").First(&user, *cart.UserID).Error; err == nil {
+			event.Email = user.Email
+		}
+	}
+	return database.DB.Create(&event).Error
+}
+
+// sendRecoveryEmails emails every recorded cart that has an address and hasn't been emailed,
+// recovered or checked out yet. Failed sends are retried on later runs.
+func sendRecoveryEmails(now time.Time) error {
+	var events []models.AbandonedCart
+	if err := database.DB.Where("email <> '' AND email_sent_at IS NULL AND recovered_at IS NULL AND converted_at IS NULL").
+		Where("created_at > ?", now.Add(-abandonedCartLookback)).
+		Order("created_at ASC").Find(&events).Error; err != nil {
+		return err
+	}
+
+	for i := range events {
+		if err := sendRecoveryEmail(&events[i], now); err != nil {
+			if errors.Is(err, mailer.ErrNotConfigured) {
+				return nil // Nothing can be sent until SMTP is set up
+			}
+			log.Printf("Failed to send recovery email for abandoned cart %d: %v", events[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// sendRecoveryEmail renders and sends one recovery email with a fresh recovery link
+func sendRecoveryEmail(event *models.AbandonedCart, now time.Time) error {
+	if !mailer.Configured() {
+		return mailer.ErrNotConfigured
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	base, err := pricing.BaseCurrency(database.DB)
+	if err != nil {
+		return err
+	}
+	data := recoveryEmail{
+		Name:        "there",
+		StoreName:   database.GetSetting("site_name", "EcomStore"),
+		CartValue:   base.Format(event.CartValue),
+		RecoveryURL: strings.TrimRight(database.GetSetting("store_url", "http://localhost:10001"), "/") + "/recover/" + token,
+	}
+	if event.UserID != nil {
+		var user models.User
+		if err := database.DB.Select("id", "name").First(&user, *event.UserID).Error; err == nil && user.Name != "" {
+			data.Name = user.Name
+		}
+	}
+	for _, item := range event.CartItems() {
+		data.Items = append(data.Items, recoveryEmailItem{
+			Name:       item.Name,
+			Quantity:   item.Quantity,
+			Variations: item.Variations,
+			LineTotal:  base.Format(item.UnitPrice.Mul(item.Quantity)),
+		})
+	}
+
+	coupon, err := recoveryCoupon(event, now)
+	if err != nil {
+		return err
+	}
+	if coupon != nil {
+		data.CouponCode = coupon.Code
+		data.CouponPercent = coupon.Value.String()
+		data.CouponExpires = coupon.ValidUntil.Format("January 2, 2006")
+	}
+
+	body, err := renderRecoveryEmail(data)
+	if err != nil {
+		return err
+	}
+	subject := database.GetSetting(abandonedCartSubjectSetting, defaultAbandonedCartEmailSubject)
+	if err := mailer.Send(mailer.Message{To: event.Email, Subject: subject, HTML: body}); err != nil {
+		return err
+	}
+
+	return database.DB.Model(event).Updates(map[string]interface{}{
+		"token_hash":    utils.HashToken(token),
+		"email_sent_at": now,
+	}).Error
+}
+
+// recoveryCoupon returns the single-use coupon offered with a recovery email, creating it on
+// the first attempt. It returns nil when recovery coupons are turned off.
+func recoveryCoupon(event *models.AbandonedCart, now time.Time) (*models.Coupon, error) {
+	if event.CouponID != nil {
+		var coupon models.Coupon
+		if err := database.DB.First(&coupon, *event.CouponID).Error; err == nil {
+			return &coupon, nil
+		}
+	}
+
+	percent, err := money.Parse(database.GetSetting(abandonedCartCouponSetting, "0"))
+	if err != nil || !percent.IsPositive() {
+		return nil, nil
+	}
+	days, err := strconv.Atoi(database.GetSetting(abandonedCartCouponDaysSetting, defaultAbandonedCartCouponDays))
+	if err != nil || days <= 0 {
+		days, _ = strconv.Atoi(defaultAbandonedCartCouponDays)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	coupon := models.Coupon{
+		Code:       fmt.Sprintf("COMEBACK-%X", suffix),
+		Type:       "percentage",
+		Value:      percent,
+		UsageLimit: 1,
+		ValidFrom:  now,
+		ValidUntil: now.AddDate(0, 0, days),
+		IsActive:   true,
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&coupon).Error; err != nil {
+			return err
+		}
+		return tx.Model(event).Updates(map[string]interface{}{"coupon_id": coupon.ID, "coupon_code": coupon.Code}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	event.CouponID, event.CouponCode = &coupon.ID, coupon.Code
+	return &coupon, nil
+}
+
+// renderRecoveryEmail fills the configured template, falling back to the built-in one when
+// the configured template doesn't parse or render
+func renderRecoveryEmail(data recoveryEmail) (string, error) {
+	if custom := database.GetSetting(abandonedCartTemplateSetting, ""); custom != "" {
+		body, err := executeTemplate(custom, data)
+		if err == nil {
+			return body, nil
+		}
+		log.Printf("Abandoned cart email template is invalid, using the default: %v", err)
+	}
+	return executeTemplate(defaultAbandonedCartTemplate, data)
+}
+
+func executeTemplate(text string, data recoveryEmail) (string, error) {
+	tmpl, err := template.New("recovery").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("render: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// ownerScope restricts a query to one cart owner's rows, matching how carts are owned
+func ownerScope(userID *uint, guestID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if userID != nil {
+			return db.Where("user_id = ?", *userID)
+		}
+		return db.Where("guest_id = ? AND user_id IS NULL", guestID)
+	}
+}
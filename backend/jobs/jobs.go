@@ -0,0 +1,29 @@
+// Package jobs runs the store's periodic background work.
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"ecom-backend/controllers"
+)
+
+// reservationSweepInterval is how often unpaid orders are checked for expired reservations
+const reservationSweepInterval = time.Minute
+
+// Start launches the background jobs. Each runs on its own ticker for the life of the process.
+func Start() {
+	go every("abandoned carts", abandonedCartInterval, DetectAbandonedCarts)
+	go every("expired reservations", reservationSweepInterval, controllers.ExpireUnpaidOrders)
+}
+
+// every runs job once per interval, logging failures instead of stopping
+func every(name string, interval time.Duration, job func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := job(); err != nil {
+			log.Printf("Background job %q failed: %v", name, err)
+		}
+	}
+}
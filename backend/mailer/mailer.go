@@ -0,0 +1,54 @@
+// Package mailer sends transactional email through the SMTP server configured in the
+// admin settings (smtp_host, smtp_port, smtp_user, smtp_password and smtp_from_email).
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"ecom-backend/database"
+)
+
+// ErrNotConfigured is returned when the SMTP settings are missing
+var ErrNotConfigured = errors.New("email service not configured")
+
+// Message is an HTML email to one recipient
+type Message struct {
+	To      string
+	Subject string
+	HTML    string
+}
+
+// Configured reports whether SMTP settings are present
+func Configured() bool {
+	return database.GetSetting("smtp_host", "") != "" && database.GetSetting("smtp_user", "") != ""
+}
+
+// Send delivers a message through the configured SMTP server
+func Send(msg Message) error {
+	host := database.GetSetting("smtp_host", "")
+	user := database.GetSetting("smtp_user", "")
+	password := database.GetSetting("smtp_password", "")
+	if host == "" || user == "" {
+		return ErrNotConfigured
+	}
+	port := database.GetSetting("smtp_port", "587")
+	from := database.GetSetting("smtp_from_email", user)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", from)
+	fmt.Fprintf(&body, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&body, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/html; charset=\"utf-8\"\r\n\r\n")
+	body.WriteString(msg.HTML)
+
+	auth := smtp.PlainAuth("", user, password, host)
+	return smtp.SendMail(net.JoinHostPort(host, port), auth, from, []string{msg.To}, []byte(body.String()))
+}
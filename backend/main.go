@@ -7,6 +7,7 @@ import (
 	"ecom-backend/cache"
 	"ecom-backend/config"
 	"ecom-backend/database"
+	"ecom-backend/jobs"
 	"ecom-backend/routes"
 )
 
@@ -23,9 +24,15 @@ func main() {
 	// Run migrations
 	database.Migrate()
 
+	// Encrypt secret settings saved in plaintext or under a rotated-out key
+	database.ReencryptSecretSettings()
+
 	// Seed initial data
 	database.SeedData()
 
+	// Start background jobs
+	jobs.Start()
+
 	// Setup routes
 	r := routes.SetupRoutes()
 
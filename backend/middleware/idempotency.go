@@ -0,0 +1,258 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"ecom-backend/cache"
+	"ecom-backend/config"
+	"ecom-backend/database"
+	"ecom-backend/models"
+	"ecom-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyKeyTTL is how long a stored response can be replayed
+const IdempotencyKeyTTL = 24 * time.Hour
+
+const idempotencyCachePrefix = "idempotency:"
+
+// idempotencyRecord is the stored state of a request made with an Idempotency-Key
+type idempotencyRecord struct {
+	RequestHash  string `json:"request_hash"`
+	Completed    bool   `json:"completed"`
+	StatusCode   int    `json:"status_code"`
+	ResponseBody string `json:"response_body"`
+}
+
+// responseRecorder captures the response body so it can be stored for replays
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware honours the Idempotency-Key header on mutating endpoints.
+// The first response for a key is stored in Redis (or Postgres when Redis is down) and
+// replayed for retries with the same key and body. Reusing a key with a different body,
+// or while the first request is still running, returns 409 Conflict.
+func IdempotencyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		headerKey := c.GetHeader("Idempotency-Key")
+		if headerKey == "" {
+			c.Next()
+			return
+		}
+		if len(headerKey) > 255 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.Sum256(body)
+		requestHash := hex.EncodeToString(hash[:])
+
+		// Keys are scoped to the caller and route so different users can't collide. Guests are
+		// scoped by their signed cart; a guest without one has nothing to scope a key to, so
+		// the request runs without idempotency.
+		caller := ""
+		if userID, exists := c.Get("userID"); exists {
+			caller = fmt.Sprintf("%v", userID)
+		} else if guestID, ok := idempotencyGuestID(c); ok {
+			caller = "guest-" + guestID
+		} else {
+			c.Next()
+			return
+		}
+		key := fmt.Sprintf("%s:%s %s:%s", caller, c.Request.Method, c.FullPath(), headerKey)
+
+		reserved, inCache, err := reserveIdempotencyKey(key, requestHash)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process Idempotency-Key"})
+			c.Abort()
+			return
+		}
+
+		if !reserved {
+			record, err := loadIdempotencyRecord(key, inCache)
+			if err != nil || record == nil {
+				c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is already in progress"})
+				c.Abort()
+				return
+			}
+			if record.RequestHash != requestHash {
+				c.JSON(http.StatusConflict, gin.H{"error": "Idempotency-Key was already used with a different request body"})
+				c.Abort()
+				return
+			}
+			if !record.Completed {
+				c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is already in progress"})
+				c.Abort()
+				return
+			}
+
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(record.StatusCode, "application/json; charset=utf-8", []byte(record.ResponseBody))
+			c.Abort()
+			return
+		}
+
+		// Server errors, including a panicking handler, are not stored so the client can safely
+		// retry with the same key. A panic is passed on to the recovery middleware once the key
+		// is released.
+		saved := false
+		defer func() {
+			if !saved {
+				releaseIdempotencyKey(key, inCache)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+
+		saved = true
+		saveIdempotencyRecord(key, inCache, idempotencyRecord{
+			RequestHash:  requestHash,
+			Completed:    true,
+			StatusCode:   status,
+			ResponseBody: recorder.body.String(),
+		})
+	}
+}
+
+// idempotencyGuestID returns the guest cart ID from a valid cart token, sent in the
+// X-Cart-Token header or the cart cookie
+func idempotencyGuestID(c *gin.Context) (string, bool) {
+	token := c.GetHeader("X-Cart-Token")
+	if token == "" {
+		token, _ = c.Cookie(utils.CartTokenCookie)
+	}
+	if token == "" {
+		return "", false
+	}
+	guestID, err := utils.ValidateCartToken(token, config.LoadConfig().JWTSecret)
+	if err != nil {
+		return "", false
+	}
+	return guestID, true
+}
+
+// reserveIdempotencyKey claims a key for a new request. It returns false if the key is
+// already known (in progress or completed), and whether the key lives in Redis or in the
+// Postgres fallback, which is used when Redis isn't configured or doesn't answer.
+func reserveIdempotencyKey(key, requestHash string) (bool, bool, error) {
+	if cache.Client != nil {
+		data, _ := json.Marshal(idempotencyRecord{RequestHash: requestHash})
+		reserved, err := cache.SetNX(idempotencyCachePrefix+key, string(data), IdempotencyKeyTTL)
+		if err == nil {
+			if !reserved {
+				return false, true, nil
+			}
+			// A key claimed in Postgres while Redis was down stays there until it expires
+			var claimed int64
+			database.DB.Model(&models.IdempotencyKey{}).Where("key = ? AND expires_at >= ?", key, time.Now()).Count(&claimed)
+			if claimed > 0 {
+				cache.Delete(idempotencyCachePrefix + key)
+				return false, false, nil
+			}
+			return true, true, nil
+		}
+		log.Printf("Idempotency key store unavailable, falling back to Postgres: %v", err)
+	}
+
+	// Postgres fallback: clear an expired row, then rely on the unique index to claim the key
+	database.DB.Where("key = ? AND expires_at < ?", key, time.Now()).Delete(&models.IdempotencyKey{})
+
+	row := models.IdempotencyKey{
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   time.Now().Add(IdempotencyKeyTTL),
+	}
+	result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&row)
+	if result.Error != nil {
+		return false, false, result.Error
+	}
+	return result.RowsAffected == 1, false, nil
+}
+
+// loadIdempotencyRecord returns the stored record for a key, or nil if there is none
+func loadIdempotencyRecord(key string, inCache bool) (*idempotencyRecord, error) {
+	if inCache {
+		data, err := cache.Get(idempotencyCachePrefix + key)
+		if err != nil {
+			return nil, err
+		}
+		var record idempotencyRecord
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			return nil, err
+		}
+		return &record, nil
+	}
+
+	var row models.IdempotencyKey
+	if err := database.DB.Where("key = ? AND expires_at >= ?", key, time.Now()).First(&row).Error; err != nil {
+		return nil, err
+	}
+	return &idempotencyRecord{
+		RequestHash:  row.RequestHash,
+		Completed:    row.Completed,
+		StatusCode:   row.StatusCode,
+		ResponseBody: row.ResponseBody,
+	}, nil
+}
+
+// saveIdempotencyRecord stores the final response for a key
+func saveIdempotencyRecord(key string, inCache bool, record idempotencyRecord) {
+	if inCache {
+		data, _ := json.Marshal(record)
+		cache.Set(idempotencyCachePrefix+key, string(data), IdempotencyKeyTTL)
+		return
+	}
+
+	database.DB.Model(&models.IdempotencyKey{}).Where("key = ?", key).Updates(map[string]interface{}{
+		"completed":     true,
+		"status_code":   record.StatusCode,
+		"response_body": record.ResponseBody,
+	})
+}
+
+// releaseIdempotencyKey forgets a key so the request can be retried
+func releaseIdempotencyKey(key string, inCache bool) {
+	if inCache {
+		cache.Delete(idempotencyCachePrefix + key)
+		return
+	}
+	database.DB.Where("key = ?", key).Delete(&models.IdempotencyKey{})
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"ecom-backend/config"
+	"ecom-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OptionalAuthMiddleware authenticates the request when an Authorization header is sent and
+// lets it through as a guest otherwise. A header that is present but invalid is still rejected
+// so an expired session doesn't silently turn into a guest checkout.
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			c.Next()
+			return
+		}
+
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+			c.Abort()
+			return
+		}
+
+		cfg := config.LoadConfig()
+		claims, err := utils.ValidateToken(parts[1], cfg.JWTSecret)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+
+		c.Set("userID", claims.UserID)
+		c.Set("userEmail", claims.Email)
+		c.Next()
+	}
+}
@@ -12,58 +12,69 @@ import (
 // RateLimitMiddleware limits requests per IP address
 func RateLimitMiddleware(requestsPerMinute int) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Skip rate limiting if Redis is not available
-		if cache.Client == nil {
-			c.Next()
-			return
-		}
+		limitRequests(c, "rate_limit:"+c.ClientIP(), requestsPerMinute)
+	}
+}
 
-		ip := c.ClientIP()
-		key := "rate_limit:" + ip
+// RouteRateLimitMiddleware limits requests per IP address to one route, with its own budget
+// on top of the global limit. Use it for endpoints that could be used to guess codes.
+func RouteRateLimitMiddleware(route string, requestsPerMinute int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limitRequests(c, "rate_limit:"+route+":"+c.ClientIP(), requestsPerMinute)
+	}
+}
 
-		// Increment request count
-		count, err := cache.Increment(key)
-		if err != nil {
-			// If Redis fails, allow request
-			c.Next()
-			return
-		}
+// limitRequests counts a request against key's one-minute window and aborts with 429 once
+// the limit is exceeded
+func limitRequests(c *gin.Context, key string, requestsPerMinute int) {
+	// Skip rate limiting if Redis is not available
+	if cache.Client == nil {
+		c.Next()
+		return
+	}
 
-		// Set expiration on first request
-		if count == 1 {
-			cache.Set(key, "1", time.Minute)
-		}
+	// Increment request count
+	count, err := cache.Increment(key)
+	if err != nil {
+		// If Redis fails, allow request
+		c.Next()
+		return
+	}
 
-		// Check if limit exceeded
-		if count > int64(requestsPerMinute) {
-			// Calculate retry-after header (seconds until next window)
-			ttl, err := cache.GetTTL(key)
-			retryAfter := 60 // Default to 60 seconds
-			if err == nil && ttl > 0 {
-				retryAfter = int(ttl.Seconds())
-				if retryAfter < 1 {
-					retryAfter = 1
-				}
-			}
-			c.Header("Retry-After", strconv.Itoa(retryAfter))
-			
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "Rate limit exceeded. Please try again later.",
-				"retry_after": retryAfter,
-			})
-			c.Abort()
-			return
-		}
+	// Set expiration on first request
+	if count == 1 {
+		cache.Set(key, "1", time.Minute)
+	}
 
-		// Add remaining requests to header
-		remaining := requestsPerMinute - int(count)
-		if remaining < 0 {
-			remaining = 0
+	// Check if limit exceeded
+	if count > int64(requestsPerMinute) {
+		// Calculate retry-after header (seconds until next window)
+		ttl, err := cache.GetTTL(key)
+		retryAfter := 60 // Default to 60 seconds
+		if err == nil && ttl > 0 {
+			retryAfter = int(ttl.Seconds())
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
 		}
-		c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
-		c.Header("X-RateLimit-Limit", strconv.Itoa(requestsPerMinute))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error": "Rate limit exceeded. Please try again later.",
+			"retry_after": retryAfter,
+		})
+		c.Abort()
+		return
+	}
 
-		c.Next()
+	// Add remaining requests to header
+	remaining := requestsPerMinute - int(count)
+	if remaining < 0 {
+		remaining = 0
 	}
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	c.Header("X-RateLimit-Limit", strconv.Itoa(requestsPerMinute))
+
+	c.Next()
 }
 
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"ecom-backend/money"
+
+	"gorm.io/gorm"
+)
+
+// AbandonedCart records a cart left idle past the abandonment threshold, with a snapshot of
+// its items so the recovery link can restore it even after the cart has changed.
+type AbandonedCart struct {
+	ID               uint           `json:"id" gorm:"primaryKey"`
+	UserID           *uint          `json:"user_id" gorm:"index"` // Null for guest carts
+	User             *User          `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	GuestID          string         `json:"-" gorm:"index"`
+	Email            string         `json:"email"`               // Where the recovery email goes; empty for guests
+	Items            string         `json:"-" gorm:"type:jsonb"` // JSON snapshot of AbandonedCartItem
+	ItemCount        int            `json:"item_count"`
+	CartValue        money.Money    `json:"cart_value"` // In the base currency
+	LastActivityAt   time.Time      `json:"last_activity_at" gorm:"index"`
+	TokenHash        string         `json:"-" gorm:"index"` // SHA-256 of the recovery link token
+	CouponID         *uint          `json:"coupon_id"`
+	CouponCode       string         `json:"coupon_code"`
+	EmailSentAt      *time.Time     `json:"email_sent_at"`
+	RecoveredAt      *time.Time     `json:"recovered_at"`
+	ConvertedAt      *time.Time     `json:"converted_at"`
+	ConvertedOrderID *uint          `json:"converted_order_id"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// AbandonedCartItem is one cart line in an abandoned cart snapshot
+type AbandonedCartItem struct {
+	ProductID  uint              `json:"product_id"`
+	Name       string            `json:"name"`
+	Quantity   int               `json:"quantity"`
+	Variations map[string]string `json:"variations,omitempty"`
+	UnitPrice  money.Money       `json:"unit_price"`
+}
+
+// CartItems decodes the items snapshot
+func (a AbandonedCart) CartItems() []AbandonedCartItem {
+	var items []AbandonedCartItem
+	if a.Items != "" {
+		json.Unmarshal([]byte(a.Items), &items)
+	}
+	return items
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"time"
 
+	"ecom-backend/money"
+
 	"gorm.io/gorm"
 )
 
@@ -10,9 +12,9 @@ type Coupon struct {
 	ID          uint           `json:"id" gorm:"primaryKey"`
 	Code        string         `json:"code" gorm:"unique;not null"`
 	Type        string         `json:"type" gorm:"not null"` // "percentage" or "fixed"
-	Value       float64        `json:"value" gorm:"not null"`
-	MinPurchase float64        `json:"min_purchase"`
-	MaxDiscount float64        `json:"max_discount"`
+	Value       money.Money    `json:"value" gorm:"not null"` // Amount for fixed coupons, percentage for percentage coupons
+	MinPurchase money.Money    `json:"min_purchase"`
+	MaxDiscount money.Money    `json:"max_discount"`
 	UsageLimit  int            `json:"usage_limit"`
 	UsedCount   int            `json:"used_count" gorm:"default:0"`
 	ValidFrom   time.Time      `json:"valid_from" gorm:"not null"`
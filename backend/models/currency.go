@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"ecom-backend/money"
+
+	"gorm.io/gorm"
+)
+
+// Currency is a currency customers can shop in, with its rate against the store's base currency
+type Currency struct {
+	ID           uint               `json:"id" gorm:"primaryKey"`
+	Code         string             `json:"code" gorm:"size:3;uniqueIndex;not null"` // ISO 4217 code, e.g. "USD"
+	Name         string             `json:"name"`
+	Symbol       string             `json:"symbol" gorm:"not null"`
+	Decimals     int                `json:"decimals" gorm:"default:2"`     // Minor unit digits shown and charged
+	ExchangeRate money.ExchangeRate `json:"exchange_rate" gorm:"not null"` // Units of this currency per unit of base currency
+	IsActive     bool               `json:"is_active" gorm:"default:true"`
+	CreatedAt    time.Time          `json:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt     `json:"-" gorm:"index"`
+}
+
+// Rules returns the rounding and display rules for amounts in this currency
+func (c Currency) Rules() money.Currency {
+	rules, ok := money.LookupCurrency(c.Code)
+	if !ok {
+		rules = money.Currency{Code: c.Code, Rounding: money.HalfUp}
+	}
+	if c.Symbol != "" {
+		rules.Symbol = c.Symbol
+	}
+	rules.Decimals = c.Decimals
+	return rules
+}
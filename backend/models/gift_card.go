@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"ecom-backend/money"
+
+	"gorm.io/gorm"
+)
+
+// Payment methods for store-issued tender, used on web and POS orders
+const (
+	PaymentMethodGiftCard    = "gift_card"
+	PaymentMethodStoreCredit = "store_credit"
+)
+
+// Gift card statuses
+const (
+	GiftCardActive = "active"
+	GiftCardVoided = "voided"
+)
+
+// Ledger entry types for gift cards and store credit
+const (
+	CreditIssue  = "issue"  // Card issued or credit granted
+	CreditRedeem = "redeem" // Spent on an order
+	CreditRefund = "refund" // Returned from a cancelled order or a refund
+	CreditAdjust = "adjust" // Manual correction by an admin
+	CreditVoid   = "void"   // Remaining balance removed when a card is voided
+)
+
+// GiftCard is a prepaid balance, in the base currency, redeemable by anyone holding its code
+type GiftCard struct {
+	ID             uint                  `json:"id" gorm:"primaryKey"`
+	Code           string                `json:"code" gorm:"uniqueIndex;not null"`
+	InitialBalance money.Money           `json:"initial_balance" gorm:"not null"`
+	Balance        money.Money           `json:"balance" gorm:"not null;default:0"`
+	Status         string                `json:"status" gorm:"not null;default:active;index"`
+	ExpiresAt      *time.Time            `json:"expires_at"` // Null for cards that never expire
+	RecipientEmail string                `json:"recipient_email"`
+	Note           string                `json:"note"`
+	IssuedByID     *uint                 `json:"issued_by_id"`
+	CreatedAt      time.Time             `json:"created_at"`
+	UpdatedAt      time.Time             `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt        `json:"-" gorm:"index"`
+	Transactions   []GiftCardTransaction `json:"transactions,omitempty"`
+}
+
+// GiftCardTransaction is one entry in a gift card's ledger
+type GiftCardTransaction struct {
+	ID           uint        `json:"id" gorm:"primaryKey"`
+	GiftCardID   uint        `json:"gift_card_id" gorm:"not null;index"`
+	Type         string      `json:"type" gorm:"not null"`
+	Amount       money.Money `json:"amount" gorm:"not null"` // Positive for credits, negative for debits
+	BalanceAfter money.Money `json:"balance_after" gorm:"not null"`
+	OrderID      *uint       `json:"order_id" gorm:"index"`
+	ActorID      *uint       `json:"actor_id"` // Admin or customer who made the change; null for the system
+	Note         string      `json:"note"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
+
+// StoreCreditWallet holds a customer's store credit, in the base currency
+type StoreCreditWallet struct {
+	ID        uint        `json:"id" gorm:"primaryKey"`
+	UserID    uint        `json:"user_id" gorm:"uniqueIndex;not null"`
+	Balance   money.Money `json:"balance" gorm:"not null;default:0"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// StoreCreditTransaction is one entry in a customer's store credit ledger
+type StoreCreditTransaction struct {
+	ID           uint        `json:"id" gorm:"primaryKey"`
+	UserID       uint        `json:"user_id" gorm:"not null;index"`
+	Type         string      `json:"type" gorm:"not null"`
+	Amount       money.Money `json:"amount" gorm:"not null"` // Positive for credits, negative for debits
+	BalanceAfter money.Money `json:"balance_after" gorm:"not null"`
+	OrderID      *uint       `json:"order_id" gorm:"index"`
+	RefundID     *uint       `json:"refund_id"`
+	ActorID      *uint       `json:"actor_id"`
+	Note         string      `json:"note"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// IdempotencyKey stores the first response for an Idempotency-Key when Redis is unavailable
+type IdempotencyKey struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	Key          string    `json:"key" gorm:"uniqueIndex;not null"` // Scoped key (user + route + header value)
+	RequestHash  string    `json:"request_hash" gorm:"not null"`    // SHA-256 of the request body
+	Completed    bool      `json:"completed" gorm:"default:false"`  // False while the first request is still running
+	StatusCode   int       `json:"status_code"`
+	ResponseBody string    `json:"response_body" gorm:"type:text"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
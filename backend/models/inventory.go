@@ -0,0 +1,22 @@
+package models
+
+// Inventory policies decide what happens when a product is ordered beyond its website stock
+const (
+	InventoryPolicyDeny      = "deny"      // Refuse orders beyond stock
+	InventoryPolicyBackorder = "backorder" // Accept them and fill the shortfall when stock arrives
+	InventoryPolicyPreorder  = "preorder"  // Accept them ahead of the product's availability date
+)
+
+// ValidInventoryPolicy reports whether policy is a known inventory policy
+func ValidInventoryPolicy(policy string) bool {
+	switch policy {
+	case InventoryPolicyDeny, InventoryPolicyBackorder, InventoryPolicyPreorder:
+		return true
+	}
+	return false
+}
+
+// AllowsBackorder reports whether the product can be ordered beyond its website stock
+func (p Product) AllowsBackorder() bool {
+	return p.InventoryPolicy == InventoryPolicyBackorder || p.InventoryPolicy == InventoryPolicyPreorder
+}
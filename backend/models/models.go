@@ -3,6 +3,8 @@ package models
 import (
 	"time"
 
+	"ecom-backend/money"
+
 	"gorm.io/gorm"
 )
 
@@ -39,13 +41,20 @@ type Product struct {
 	ID          uint           `json:"id" gorm:"primaryKey"`
 	Name        string         `json:"name" gorm:"not null"`
 	Description string         `json:"description"`
-	Price       float64        `json:"price" gorm:"not null"`
+	Price       money.Money    `json:"price" gorm:"not null"`
+	Currency    string         `json:"currency,omitempty" gorm:"-"` // Set when Price was converted for display (computed)
 	Image       string         `json:"image"`
 	Images      string         `json:"images" gorm:"type:text"` // JSON array of image URLs for gallery
 	DisplayType string         `json:"display_type" gorm:"default:single"` // single, slider, gallery
 	SKU         string         `json:"sku" gorm:"unique"` // Stock Keeping Unit
 	Stock       int            `json:"stock" gorm:"default:0"` // Website stock
 	PosStock    int            `json:"pos_stock" gorm:"default:0"` // POS/Showroom stock
+	InventoryPolicy string     `json:"inventory_policy" gorm:"default:deny"` // deny, backorder or preorder when website stock runs out
+	AvailableAt *time.Time     `json:"available_at"` // Expected availability date for pre-orders and backorders
+	Weight      float64        `json:"weight" gorm:"default:0"` // Shipping weight in kg
+	Length      float64        `json:"length" gorm:"default:0"` // Package dimensions in cm
+	Width       float64        `json:"width" gorm:"default:0"`
+	Height      float64        `json:"height" gorm:"default:0"`
 	CategoryID  uint           `json:"category_id"`
 	Category    Category       `json:"category,omitempty" gorm:"foreignKey:CategoryID"`
 	Variations  []ProductVariation `json:"variations,omitempty" gorm:"foreignKey:ProductID"`
@@ -57,12 +66,16 @@ type Product struct {
 
 type Cart struct {
 	ID        uint           `json:"id" gorm:"primaryKey"`
-	UserID    uint           `json:"user_id" gorm:"not null"`
-	User      User           `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	UserID    *uint          `json:"user_id"` // Null for guest carts
+	User      *User          `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	GuestID   string         `json:"-" gorm:"index"` // Guest cart identifier from the signed cart token
 	ProductID uint           `json:"product_id" gorm:"not null"`
 	Product   Product        `json:"product,omitempty" gorm:"foreignKey:ProductID"`
 	Quantity  int            `json:"quantity" gorm:"default:1"`
 	Variations string        `json:"variations" gorm:"type:jsonb"` // JSON string storing variation selections
+	UnitPrice money.Money    `json:"unit_price" gorm:"-"` // Base price plus variation modifiers (computed)
+	LineTotal money.Money    `json:"line_total" gorm:"-"` // UnitPrice * Quantity (computed)
+	Issue     string         `json:"issue,omitempty" gorm:"-"` // Why the line can't be checked out as-is (computed)
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
@@ -70,37 +83,81 @@ type Cart struct {
 
 type Order struct {
 	ID         uint           `json:"id" gorm:"primaryKey"`
-	UserID     uint           `json:"user_id" gorm:"not null"`
-	User       User           `json:"user,omitempty" gorm:"foreignKey:UserID"`
-	Subtotal   float64        `json:"subtotal" gorm:"default:0"` // Subtotal before tax and discount
-	Tax        float64        `json:"tax" gorm:"default:0"` // Tax amount
-	Discount   float64        `json:"discount" gorm:"default:0"` // Discount amount
-	Shipping   float64        `json:"shipping" gorm:"default:0"` // Shipping cost
-	Total      float64        `json:"total" gorm:"not null"`
+	OrderNumber string        `json:"order_number" gorm:"size:64;uniqueIndex"` // Customer-facing number, e.g. WEB-2026-000123
+	UserID     *uint          `json:"user_id"` // Null for guest orders
+	User       *User          `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	GuestEmail string         `json:"guest_email" gorm:"index"` // Contact details for guest orders
+	GuestName  string         `json:"guest_name"`
+	GuestPhone string         `json:"guest_phone"`
+	LookupTokenHash string    `json:"-" gorm:"index"` // SHA-256 of the guest's order lookup token
+	Subtotal   money.Money    `json:"subtotal" gorm:"default:0"` // Subtotal before tax and discount
+	Tax        money.Money    `json:"tax" gorm:"default:0"` // Tax amount
+	Discount   money.Money    `json:"discount" gorm:"default:0"` // Discount amount
+	CouponID   *uint          `json:"coupon_id"`  // Coupon applied at checkout, if any
+	CouponCode string         `json:"coupon_code"` // Snapshot of the coupon code at checkout
+	Shipping   money.Money    `json:"shipping" gorm:"default:0"` // Shipping cost
+	ShippingMethodID   *uint           `json:"shipping_method_id"` // Chosen shipping method, null for flat-rate orders
+	ShippingMethod     *ShippingMethod `json:"shipping_method,omitempty" gorm:"foreignKey:ShippingMethodID"`
+	ShippingMethodName string          `json:"shipping_method_name"` // Snapshot of the method name at checkout
+	EstimatedDeliveryAt *time.Time     `json:"estimated_delivery_at"`
+	Total      money.Money    `json:"total" gorm:"not null"`
 	Status     string         `json:"status" gorm:"default:pending"`
 	Address    string         `json:"address" gorm:"not null"`
 	City       string         `json:"city" gorm:"not null"`
+	State      string         `json:"state"`
 	PostalCode string         `json:"postal_code" gorm:"not null"`
 	Country    string         `json:"country" gorm:"not null"`
-	TaxRate    float64        `json:"tax_rate" gorm:"default:0"` // Tax rate used for this order
+	Phone      string         `json:"phone"` // Delivery contact number
+	TaxRate    money.Rate     `json:"tax_rate" gorm:"default:0"` // Tax rate used for this order
+	Currency     string             `json:"currency" gorm:"size:3;default:'BDT'"` // Currency the order was placed and charged in
+	ExchangeRate money.ExchangeRate `json:"exchange_rate" gorm:"default:1"` // Rate against the base currency at checkout
 	IsPOS      bool           `json:"is_pos" gorm:"default:false"` // Mark POS orders
+	StockType  string         `json:"stock_type"` // Stock the items were taken from: "website" or "showroom" (POS)
+	StockReserved bool        `json:"stock_reserved" gorm:"default:false"` // Items are held by reservations until the order is paid
+	ReservedUntil *time.Time  `json:"reserved_until" gorm:"index"` // Set once an online payment starts: when the order is cancelled if still unpaid
 	CreatedAt  time.Time      `json:"created_at"`
 	UpdatedAt  time.Time      `json:"updated_at"`
 	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
 	Items      []OrderItem    `json:"items,omitempty"`
 	Payments   []Payment      `json:"payments,omitempty" gorm:"foreignKey:OrderID"`
+	Shipments  []Shipment     `json:"shipments,omitempty" gorm:"foreignKey:OrderID"`
 }
 
+// Payment statuses. Only captured payments count as money collected; in-person payments are
+// captured when they are recorded. Online payments may be authorized at checkout and captured
+// later, e.g. when the order ships.
+const (
+	PaymentStatusPending    = "pending"    // Sent to a gateway, waiting for the customer
+	PaymentStatusAuthorized = "authorized" // Approved by the gateway but not yet collected
+	PaymentStatusCaptured   = "captured"   // Collected; may since have been partly refunded
+	PaymentStatusVoided     = "voided"     // Authorization released without collecting
+	PaymentStatusFailed     = "failed"
+	PaymentStatusCancelled  = "cancelled" // Abandoned or expired before completion
+	PaymentStatusRefunded   = "refunded"  // Everything captured was refunded
+)
+
 type Payment struct {
-	ID            uint           `json:"id" gorm:"primaryKey"`
-	OrderID       uint           `json:"order_id" gorm:"not null"`
-	Order         Order          `json:"order,omitempty" gorm:"foreignKey:OrderID"`
-	Method        string         `json:"method" gorm:"not null"` // cash, card, mobile, etc.
-	Amount        float64        `json:"amount" gorm:"not null"`
-	Reference     string         `json:"reference"` // Transaction reference, receipt number, etc.
-	CreatedAt     time.Time      `json:"created_at"`
-	UpdatedAt     time.Time      `json:"updated_at"`
-	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	OrderID         uint           `json:"order_id" gorm:"not null"`
+	Order           Order          `json:"order,omitempty" gorm:"foreignKey:OrderID"`
+	Method          string         `json:"method" gorm:"not null"` // cash, card, mobile, etc.
+	Amount          money.Money    `json:"amount" gorm:"not null"` // Amount charged, or authorized for online payments
+	CapturedAmount  money.Money    `json:"captured_amount" gorm:"default:0"` // Amount collected; a partial capture collects less than Amount
+	RefundedAmount  money.Money    `json:"refunded_amount" gorm:"default:0"`
+	Reference       string         `json:"reference" gorm:"index"` // Transaction reference, receipt number, etc.; the gateway's session ID for online payments
+	Gateway         string         `json:"gateway,omitempty"`      // Online payment gateway, e.g. stripe
+	Status          string         `json:"status" gorm:"not null;default:captured;index"`
+	TransactionID   string         `json:"transaction_id,omitempty" gorm:"index"` // Gateway's payment or authorization ID, used to capture and void
+	CaptureID       string         `json:"capture_id,omitempty" gorm:"index"`     // Gateway's ID for the capture, used for refunds
+	GatewayResponse string         `json:"gateway_response,omitempty" gorm:"type:text"` // Gateway's latest raw response, for support and disputes
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// Collected returns what the payment has collected and not refunded
+func (p Payment) Collected() money.Money {
+	return p.CapturedAmount.Sub(p.RefundedAmount)
 }
 
 type OrderItem struct {
@@ -110,8 +167,12 @@ type OrderItem struct {
 	ProductID uint           `json:"product_id" gorm:"not null"`
 	Product   Product        `json:"product,omitempty" gorm:"foreignKey:ProductID"`
 	Quantity  int            `json:"quantity" gorm:"not null"`
-	Price     float64        `json:"price" gorm:"not null"`
+	Price     money.Money    `json:"price" gorm:"not null"`
 	Variations string        `json:"variations" gorm:"type:jsonb"` // JSON string storing variation selections
+	BackorderedQty int       `json:"backordered_qty" gorm:"default:0;index"` // Units still waiting on stock
+	RestockedQty   int       `json:"restocked_qty" gorm:"default:0"` // Units returned to stock by refunds
+	IsPreorder bool          `json:"is_preorder" gorm:"default:false"`
+	ExpectedAt *time.Time    `json:"expected_at"` // Product's expected availability when ordered
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
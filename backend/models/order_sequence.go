@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// OrderSequence is a gap-free counter behind order numbers. Each rendered pattern prefix
+// (e.g. "web:WEB-2026-") counts separately, so yearly or per-store patterns restart at 1.
+type OrderSequence struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"uniqueIndex;not null"`
+	LastValue int64     `json:"last_value" gorm:"not null;default:0"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
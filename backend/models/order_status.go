@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Order lifecycle statuses
+const (
+	OrderStatusPending    = "pending"
+	OrderStatusPaid       = "paid"
+	OrderStatusProcessing = "processing"
+	OrderStatusShipped    = "shipped"
+	OrderStatusPartiallyShipped = "partially_shipped" // Some items shipped, the rest still to follow
+	OrderStatusDelivered  = "delivered"
+	OrderStatusCancelled  = "cancelled"
+	OrderStatusRefunded   = "refunded"
+	OrderStatusPartiallyRefunded = "partially_refunded" // Part of the payment refunded, the rest kept
+	OrderStatusPartial    = "partial" // Partially paid (POS)
+
+	// OrderStatusCompleted is the legacy name for delivered, still sent by older admin screens
+	OrderStatusCompleted = "completed"
+)
+
+// OrderStatusHistory records every status change of an order
+type OrderStatusHistory struct {
+	ID         uint           `json:"id" gorm:"primaryKey"`
+	OrderID    uint           `json:"order_id" gorm:"not null;index"`
+	FromStatus string         `json:"from_status"` // Empty for the initial status
+	ToStatus   string         `json:"to_status" gorm:"not null"`
+	ActorID    *uint          `json:"actor_id"` // Null for system changes
+	Actor      *User          `json:"actor,omitempty" gorm:"foreignKey:ActorID"`
+	Note       string         `json:"note" gorm:"type:text"`
+	CreatedAt  time.Time      `json:"created_at"`
+	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"ecom-backend/money"
+)
+
+// Webhook event processing states
+const (
+	WebhookReceived   = "received"
+	WebhookProcessing = "processing" // Claimed by one delivery or replay while it is applied
+	WebhookProcessed  = "processed"
+	WebhookIgnored    = "ignored" // Verified, but there was nothing to apply it to
+	WebhookFailed     = "failed"
+)
+
+// PaymentWebhookEvent is a verified callback from a payment gateway, stored once per
+// gateway event ID so retried deliveries are applied only once
+type PaymentWebhookEvent struct {
+	ID            uint        `json:"id" gorm:"primaryKey"`
+	Gateway       string      `json:"gateway" gorm:"not null;uniqueIndex:idx_payment_webhook_event"`
+	EventID       string      `json:"event_id" gorm:"not null;uniqueIndex:idx_payment_webhook_event"`
+	Type          string      `json:"type"`
+	Payload       string      `json:"payload,omitempty" gorm:"type:text"` // Raw body as delivered
+	Reference     string      `json:"reference"`                          // Gateway session the event is about
+	TransactionID string      `json:"transaction_id"`
+	PaymentStatus string      `json:"payment_status"` // Status the event reports for the payment; empty when it reports none
+	Amount        money.Money `json:"amount"`
+	Currency      string      `json:"currency"`
+	RefundID      string      `json:"refund_id,omitempty" gorm:"index"` // Gateway's refund ID, for refund events
+	Status        string      `json:"status" gorm:"not null;default:received;index"`
+	Error         string      `json:"error"`
+	Attempts      int         `json:"attempts" gorm:"default:0"`
+	PaymentID     *uint       `json:"payment_id" gorm:"index"`
+	ProcessedAt   *time.Time  `json:"processed_at"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
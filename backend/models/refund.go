@@ -3,22 +3,56 @@ package models
 import (
 	"time"
 
+	"ecom-backend/money"
+
 	"gorm.io/gorm"
 )
 
+// Refund statuses. A refund moves money once, when it is processed.
+const (
+	RefundStatusPending    = "pending"
+	RefundStatusApproved   = "approved"
+	RefundStatusRejected   = "rejected"
+	RefundStatusProcessing = "processing" // Money is being returned
+	RefundStatusProcessed  = "processed"
+	RefundStatusFailed     = "failed" // Processing stopped part way; processing again resumes it
+)
+
+// Where a refund's money goes: back through the order's payments, or to store credit
+// (PaymentMethodStoreCredit). Manual parts of a refund were paid back outside the system.
+const (
+	RefundMethodOriginal = "original"
+	RefundMethodManual   = "manual" // Returned outside the system, for orders paid without a payment record
+)
+
 type Refund struct {
 	ID          uint           `json:"id" gorm:"primaryKey"`
 	OrderID     uint           `json:"order_id" gorm:"not null"`
 	Order       Order          `json:"order,omitempty" gorm:"foreignKey:OrderID"`
 	OrderItemID uint           `json:"order_item_id"` // Optional: refund specific item
-	Amount      float64        `json:"amount" gorm:"not null"`
+	Amount      money.Money    `json:"amount" gorm:"not null"`
 	Reason      string         `json:"reason" gorm:"not null"`
-	Status      string         `json:"status" gorm:"default:pending"` // pending, approved, rejected, processed
+	Status      string         `json:"status" gorm:"default:pending"` // pending, approved, rejected, processing, processed, failed
 	ProcessedBy uint           `json:"processed_by"` // Admin user ID
 	ProcessedAt *time.Time     `json:"processed_at"`
 	Notes       string         `json:"notes"`
+	Method      string         `json:"method"` // Where the money went: original or store_credit
+	RestockQuantity int        `json:"restock_quantity" gorm:"default:0"` // Units of the order item returned to stock
+	Error       string         `json:"error,omitempty"` // Why processing last failed
+	Payments    []RefundPayment `json:"payments,omitempty" gorm:"foreignKey:RefundID"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+// RefundPayment records the part of a refund returned through one of the order's payments
+type RefundPayment struct {
+	ID              uint        `json:"id" gorm:"primaryKey"`
+	RefundID        uint        `json:"refund_id" gorm:"not null;index"`
+	PaymentID       *uint       `json:"payment_id" gorm:"index"` // Null for manual refunds
+	Method          string      `json:"method"`                  // Payment method or gateway the money went back through
+	Amount          money.Money `json:"amount" gorm:"not null"`
+	GatewayRefundID string      `json:"gateway_refund_id,omitempty"`
+	Status          string      `json:"status"` // succeeded, or pending while the gateway completes it
+	CreatedAt       time.Time   `json:"created_at"`
+}
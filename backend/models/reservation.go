@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Inventory reservation statuses
+const (
+	ReservationActive    = "active"    // Units are held for the order
+	ReservationCommitted = "committed" // The order was paid and the units deducted from stock
+	ReservationReleased  = "released"  // The order was cancelled or expired and the units freed
+)
+
+// InventoryReservation holds website stock for an unpaid order. Each order item has one
+// reservation against its product and one per selected variation option.
+type InventoryReservation struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	OrderID     uint      `json:"order_id" gorm:"not null;index"`
+	OrderItemID uint      `json:"order_item_id" gorm:"not null;index"`
+	ProductID   uint      `json:"product_id" gorm:"not null;index"`
+	OptionID    *uint     `json:"option_id" gorm:"index"` // Null for the product's own stock
+	Quantity    int       `json:"quantity" gorm:"not null"`
+	Status      string    `json:"status" gorm:"not null;default:active;index"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Shipment is one parcel sent for an order. An order can ship in several parcels when only
+// some items are ready.
+type Shipment struct {
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	OrderID        uint           `json:"order_id" gorm:"not null;index"`
+	Carrier        string         `json:"carrier" gorm:"not null"`
+	TrackingNumber string         `json:"tracking_number"`
+	TrackingURL    string         `json:"tracking_url"`
+	Notes          string         `json:"notes"`
+	ShippedAt      *time.Time     `json:"shipped_at"`
+	DeliveredAt    *time.Time     `json:"delivered_at"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+	Items          []ShipmentItem `json:"items,omitempty" gorm:"foreignKey:ShipmentID"`
+}
+
+// ShipmentItem is a quantity of an order item packed in a shipment
+type ShipmentItem struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	ShipmentID  uint           `json:"shipment_id" gorm:"not null;index"`
+	OrderItemID uint           `json:"order_item_id" gorm:"not null;index"`
+	OrderItem   *OrderItem     `json:"order_item,omitempty" gorm:"foreignKey:OrderItemID"`
+	Quantity    int            `json:"quantity" gorm:"not null"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"time"
 
+	"ecom-backend/money"
+
 	"gorm.io/gorm"
 )
 
@@ -10,19 +12,55 @@ type ShippingMethod struct {
 	ID          uint           `json:"id" gorm:"primaryKey"`
 	Name        string         `json:"name" gorm:"not null"`
 	Description string         `json:"description"`
-	Cost        float64        `json:"cost" gorm:"not null"`
+	Cost        money.Money    `json:"cost" gorm:"not null"`
 	IsActive    bool           `json:"is_active" gorm:"default:true"`
 	EstimatedDays int          `json:"estimated_days" gorm:"default:7"`
+	Rates       []ShippingRate `json:"rates,omitempty" gorm:"foreignKey:ShippingMethodID"` // Empty means a flat Cost everywhere
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+// ShippingZone groups destinations that share shipping rates (e.g. Inside Dhaka, Outside Dhaka)
+type ShippingZone struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	Name        string         `json:"name" gorm:"not null"`
+	Country     string         `json:"country" gorm:"not null"`
+	Region      string         `json:"region"`       // State/Division, optional
+	City        string         `json:"city"`         // City, optional
+	PostalCodes string         `json:"postal_codes"` // Comma-separated patterns, "*" matches any suffix (e.g. "12*,1310"), optional
+	Priority    int            `json:"priority" gorm:"default:0"` // Higher priority zones are matched first
+	IsActive    bool           `json:"is_active" gorm:"default:true"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// ShippingRate is one row of a shipping method's rate table
+type ShippingRate struct {
+	ID                    uint           `json:"id" gorm:"primaryKey"`
+	ShippingMethodID      uint           `json:"shipping_method_id" gorm:"not null;index"`
+	ShippingZoneID        *uint          `json:"shipping_zone_id"` // Null applies to destinations outside every zone
+	ShippingZone          *ShippingZone  `json:"shipping_zone,omitempty" gorm:"foreignKey:ShippingZoneID"`
+	Basis                 string         `json:"basis" gorm:"default:weight"`   // "weight" (kg) or "subtotal"
+	MinValue              float64        `json:"min_value" gorm:"default:0"`    // Inclusive lower weight bound in kg (weight basis)
+	MaxValue              float64        `json:"max_value" gorm:"default:0"`    // Exclusive upper weight bound in kg, 0 for no limit (weight basis)
+	MinSubtotal           money.Money    `json:"min_subtotal" gorm:"default:0"` // Inclusive lower subtotal bound (subtotal basis)
+	MaxSubtotal           money.Money    `json:"max_subtotal" gorm:"default:0"` // Exclusive upper subtotal bound, 0 for no limit (subtotal basis)
+	Cost                  money.Money    `json:"cost" gorm:"not null"`
+	CostPerKg             money.Money    `json:"cost_per_kg" gorm:"default:0"`             // Extra charge per kg above MinValue (weight basis)
+	FreeShippingThreshold money.Money    `json:"free_shipping_threshold" gorm:"default:0"` // Subtotal at or above which shipping is free, 0 disables
+	CreatedAt             time.Time      `json:"created_at"`
+	UpdatedAt             time.Time      `json:"updated_at"`
+	DeletedAt             gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
 type ShippingAddress struct {
 	ID        uint           `json:"id" gorm:"primaryKey"`
 	UserID    uint           `json:"user_id" gorm:"not null"`
 	User      User           `json:"user,omitempty" gorm:"foreignKey:UserID"`
 	OrderID   uint           `json:"order_id"` // Link to order
+	Label     string         `json:"label"` // e.g. "Home", "Office"
 	Address   string         `json:"address" gorm:"not null"`
 	City      string         `json:"city" gorm:"not null"`
 	State     string         `json:"state"`
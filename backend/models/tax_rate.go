@@ -3,6 +3,8 @@ package models
 import (
 	"time"
 
+	"ecom-backend/money"
+
 	"gorm.io/gorm"
 )
 
@@ -11,7 +13,7 @@ type TaxRate struct {
 	Country   string         `json:"country" gorm:"not null"`
 	Region    string         `json:"region"` // State/Province, optional
 	City      string         `json:"city"`   // City, optional
-	Rate      float64        `json:"rate" gorm:"not null"` // Tax rate as percentage
+	Rate      money.Rate     `json:"rate" gorm:"not null"` // Tax rate as percentage
 	IsDefault bool           `json:"is_default" gorm:"default:false"` // Default rate if no match found
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
@@ -3,6 +3,8 @@ package models
 import (
 	"time"
 
+	"ecom-backend/money"
+
 	"gorm.io/gorm"
 )
 
@@ -26,7 +28,7 @@ type VariationOption struct {
 	VariationID uint           `json:"variation_id" gorm:"not null"`
 	Variation   ProductVariation `json:"variation,omitempty" gorm:"foreignKey:VariationID"`
 	Value       string         `json:"value" gorm:"not null"` // e.g., "Red", "Large", "Cotton"
-	PriceModifier float64      `json:"price_modifier" gorm:"default:0"` // Additional price for this option
+	PriceModifier money.Money  `json:"price_modifier" gorm:"default:0"` // Additional price for this option
 	Stock       int            `json:"stock" gorm:"default:0"` // Stock for this specific variation option
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
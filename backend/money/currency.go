@@ -0,0 +1,104 @@
+package money
+
+import (
+	"math/big"
+	"strings"
+)
+
+// RoundingMode decides which way amounts between two minor units go
+type RoundingMode int
+
+const (
+	// HalfUp rounds halves away from zero (0.125 -> 0.13)
+	HalfUp RoundingMode = iota
+	// HalfEven rounds halves to the nearest even digit (0.125 -> 0.12), as banks do
+	HalfEven
+	// Down truncates towards zero
+	Down
+)
+
+// Currency describes how amounts in a currency are rounded and displayed
+type Currency struct {
+	Code     string       `json:"code"`
+	Symbol   string       `json:"symbol"`
+	Decimals int          `json:"decimals"` // Minor unit digits actually used, at most Scale
+	Rounding RoundingMode `json:"-"`
+}
+
+// DefaultCurrency is the store's base currency
+var DefaultCurrency = Currency{Code: "BDT", Symbol: "৳", Decimals: 2, Rounding: HalfUp}
+
+// currencies holds the rounding rules of supported currencies
+var currencies = map[string]Currency{
+	"BDT": DefaultCurrency,
+	"USD": {Code: "USD", Symbol: "$", Decimals: 2, Rounding: HalfEven},
+	"EUR": {Code: "EUR", Symbol: "€", Decimals: 2, Rounding: HalfEven},
+	"GBP": {Code: "GBP", Symbol: "£", Decimals: 2, Rounding: HalfEven},
+	"INR": {Code: "INR", Symbol: "₹", Decimals: 2, Rounding: HalfUp},
+	"JPY": {Code: "JPY", Symbol: "¥", Decimals: 0, Rounding: HalfUp},
+}
+
+// LookupCurrency returns the rounding rules for a currency code
+func LookupCurrency(code string) (Currency, bool) {
+	currency, ok := currencies[strings.ToUpper(strings.TrimSpace(code))]
+	return currency, ok
+}
+
+// CurrencyOrDefault returns the rules for a currency code, or the default currency's
+func CurrencyOrDefault(code string) Currency {
+	if currency, ok := LookupCurrency(code); ok {
+		return currency
+	}
+	return DefaultCurrency
+}
+
+// Round rounds an amount to the currency's minor unit
+func (c Currency) Round(m Money) Money {
+	if c.Decimals >= Scale {
+		return m
+	}
+	step := int64(1)
+	for i := c.Decimals; i < Scale; i++ {
+		step *= 10
+	}
+	return Money(divRound(big.NewInt(int64(m)), big.NewInt(step), c.Rounding) * step)
+}
+
+// Percent returns rate percent of an amount, rounded by the currency's rules
+func (c Currency) Percent(m Money, rate Rate) Money {
+	return c.Round(m.Percent(rate, c.Rounding))
+}
+
+// Format renders an amount with the currency symbol, e.g. "৳1250.00"
+func (c Currency) Format(m Money) string {
+	s := c.Round(m).String()
+	if c.Decimals == 0 {
+		s = strings.TrimSuffix(s, ".00")
+	}
+	if strings.HasPrefix(s, "-") {
+		return "-" + c.Symbol + s[1:]
+	}
+	return c.Symbol + s
+}
+
+// divRound divides n by d (d > 0) and rounds the quotient with the given mode
+func divRound(n, d *big.Int, mode RoundingMode) int64 {
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+	if r.Sign() == 0 || mode == Down {
+		return q.Int64()
+	}
+
+	// Compare twice the remainder's magnitude with the divisor to find halves
+	twice := new(big.Int).Abs(r)
+	twice.Mul(twice, big.NewInt(2))
+	cmp := twice.Cmp(d)
+	away := cmp > 0 || (cmp == 0 && (mode == HalfUp || q.Bit(0) == 1))
+	if away {
+		if n.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q.Int64()
+}
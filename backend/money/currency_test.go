@@ -0,0 +1,113 @@
+package money
+
+import "testing"
+
+var (
+	bdt = CurrencyOrDefault("BDT")
+	usd = CurrencyOrDefault("USD")
+	jpy = CurrencyOrDefault("JPY")
+)
+
+func TestCurrencyOrDefault(t *testing.T) {
+	if got := CurrencyOrDefault(" jpy "); got.Code != "JPY" || got.Decimals != 0 {
+		t.Errorf("CurrencyOrDefault(\" jpy \") = %+v, want JPY with 0 decimals", got)
+	}
+	if got := CurrencyOrDefault("XYZ"); got != DefaultCurrency {
+		t.Errorf("CurrencyOrDefault(\"XYZ\") = %+v, want the default currency", got)
+	}
+	if _, ok := LookupCurrency("XYZ"); ok {
+		t.Error("LookupCurrency(\"XYZ\") found a currency")
+	}
+}
+
+func TestCurrencyRound(t *testing.T) {
+	tests := []struct {
+		currency Currency
+		amount   string
+		want     string
+	}{
+		// Two-decimal currencies already match Money's scale
+		{bdt, "12.34", "12.34"},
+		{usd, "-0.01", "-0.01"},
+
+		// Yen has no minor unit, and rounds halves away from zero
+		{jpy, "12.49", "12.00"},
+		{jpy, "12.50", "13.00"},
+		{jpy, "13.50", "14.00"},
+		{jpy, "-12.50", "-13.00"},
+		{jpy, "-12.49", "-12.00"},
+		{jpy, "0.50", "1.00"},
+		{jpy, "1000", "1000.00"},
+	}
+	for _, tt := range tests {
+		if got := tt.currency.Round(MustParse(tt.amount)); got != MustParse(tt.want) {
+			t.Errorf("%s.Round(%s) = %s, want %s", tt.currency.Code, tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestCurrencyRoundHalfEven(t *testing.T) {
+	noDecimals := Currency{Code: "XTS", Decimals: 0, Rounding: HalfEven}
+	tests := map[string]string{
+		"12.50":  "12.00",
+		"13.50":  "14.00",
+		"12.51":  "13.00",
+		"-12.50": "-12.00",
+	}
+	for amount, want := range tests {
+		if got := noDecimals.Round(MustParse(amount)); got != MustParse(want) {
+			t.Errorf("Round(%s) half-even = %s, want %s", amount, got, want)
+		}
+	}
+}
+
+func TestCurrencyPercent(t *testing.T) {
+	tests := []struct {
+		currency Currency
+		amount   string
+		rate     string
+		want     string
+	}{
+		// Half a cent rounds up in half-up currencies and to even in half-even ones
+		{bdt, "0.25", "50", "0.13"},
+		{usd, "0.25", "50", "0.12"},
+		{usd, "0.75", "50", "0.38"},
+		{bdt, "-0.25", "50", "-0.13"},
+		{bdt, "199.99", "15", "30.00"},
+		{bdt, "100", "7.5", "7.50"},
+
+		// Yen amounts come out in whole yen
+		{jpy, "1000", "7.5", "75.00"},
+		{jpy, "1010", "7.5", "76.00"},
+		{jpy, "1030", "5", "52.00"},
+		{jpy, "1010", "5", "51.00"},
+	}
+	for _, tt := range tests {
+		rate, err := ParseRate(tt.rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tt.currency.Percent(MustParse(tt.amount), rate); got != MustParse(tt.want) {
+			t.Errorf("%s.Percent(%s, %s%%) = %s, want %s", tt.currency.Code, tt.amount, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestCurrencyFormat(t *testing.T) {
+	tests := []struct {
+		currency Currency
+		amount   string
+		want     string
+	}{
+		{bdt, "1250", "৳1250.00"},
+		{bdt, "-12.3", "-৳12.30"},
+		{usd, "0.05", "$0.05"},
+		{jpy, "1234.5", "¥1235"},
+		{jpy, "-80", "-¥80"},
+	}
+	for _, tt := range tests {
+		if got := tt.currency.Format(MustParse(tt.amount)); got != tt.want {
+			t.Errorf("%s.Format(%s) = %q, want %q", tt.currency.Code, tt.amount, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ExchangeRateScale is the number of decimal places held by ExchangeRate
+const ExchangeRateScale = 8
+
+// exchangeUnit is 10^ExchangeRateScale
+const exchangeUnit = 100000000
+
+// ExchangeRate is how many units of a currency one unit of the base currency buys,
+// to eight decimal places. A rate of 1 (Parity) is the base currency itself.
+type ExchangeRate int64
+
+// Parity is the exchange rate of the base currency against itself
+const Parity ExchangeRate = exchangeUnit
+
+// ParseExchangeRate reads a rate such as "0.00912" exactly
+func ParseExchangeRate(s string) (ExchangeRate, error) {
+	value, err := parseDecimal(s, ExchangeRateScale)
+	if err != nil {
+		return 0, fmt.Errorf("invalid exchange rate %q", s)
+	}
+	return ExchangeRate(value), nil
+}
+
+// IsPositive reports whether r is greater than zero
+func (r ExchangeRate) IsPositive() bool {
+	return r > 0
+}
+
+// OrParity returns r, or Parity when r is unset
+func (r ExchangeRate) OrParity() ExchangeRate {
+	if r <= 0 {
+		return Parity
+	}
+	return r
+}
+
+// Convert turns a base-currency amount into the target currency, rounded by its rules
+func (r ExchangeRate) Convert(m Money, to Currency) Money {
+	r = r.OrParity()
+	if r == Parity {
+		return to.Round(m)
+	}
+	n := new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(int64(r)))
+	return to.Round(Money(divRound(n, big.NewInt(exchangeUnit), to.Rounding)))
+}
+
+// ToBase turns an amount in the rate's currency back into the base currency, for reporting
+func (r ExchangeRate) ToBase(m Money) Money {
+	r = r.OrParity()
+	if r == Parity {
+		return m
+	}
+	n := new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(exchangeUnit))
+	return Money(divRound(n, big.NewInt(int64(r)), HalfUp))
+}
+
+// String formats r without trailing zeros, e.g. "0.0091"
+func (r ExchangeRate) String() string {
+	s := strings.TrimRight(formatDecimal(int64(r), ExchangeRateScale), "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// MarshalJSON writes r as a JSON number
+func (r ExchangeRate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a numeric string
+func (r *ExchangeRate) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(strings.TrimSpace(string(data)), `"`)
+	if s == "" || s == "null" {
+		*r = 0
+		return nil
+	}
+	parsed, err := ParseExchangeRate(s)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// GormDataType stores exchange rates as exact decimals
+func (ExchangeRate) GormDataType() string {
+	return "numeric(18,8)"
+}
+
+// Value implements driver.Valuer
+func (r ExchangeRate) Value() (driver.Value, error) {
+	return formatDecimal(int64(r), ExchangeRateScale), nil
+}
+
+// Scan implements sql.Scanner for numeric, float and integer columns
+func (r *ExchangeRate) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*r = 0
+	case []byte:
+		return r.scanString(string(v))
+	case string:
+		return r.scanString(v)
+	case float64:
+		return r.scanString(fmt.Sprintf("%.8f", v))
+	case int64:
+		*r = ExchangeRate(v * exchangeUnit)
+	default:
+		return fmt.Errorf("money: cannot scan %T into ExchangeRate", src)
+	}
+	return nil
+}
+
+func (r *ExchangeRate) scanString(s string) error {
+	parsed, err := ParseExchangeRate(s)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
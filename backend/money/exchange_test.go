@@ -0,0 +1,163 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func mustRate(t *testing.T, s string) ExchangeRate {
+	t.Helper()
+	rate, err := ParseExchangeRate(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rate
+}
+
+func TestParseExchangeRate(t *testing.T) {
+	tests := map[string]ExchangeRate{
+		"1":           Parity,
+		"0.0091":      910000,
+		"0.00912":     912000,
+		"1.25":        125000000,
+		"0.123456785": 12345679,
+	}
+	for in, want := range tests {
+		if got := mustRate(t, in); got != want {
+			t.Errorf("ParseExchangeRate(%q) = %d, want %d", in, got, want)
+		}
+	}
+	for _, in := range []string{"", "abc", "--1"} {
+		if _, err := ParseExchangeRate(in); err == nil {
+			t.Errorf("ParseExchangeRate(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestExchangeRateConvert(t *testing.T) {
+	tests := []struct {
+		rate   string
+		amount string
+		to     Currency
+		want   string
+	}{
+		{"0.0091", "1000", usd, "9.10"},
+		{"0.0091", "1234.56", usd, "11.23"},
+		{"0.0091", "-1000", usd, "-9.10"},
+		{"1.25", "800", jpy, "1000.00"},
+		{"1.25", "800.39", jpy, "1000.00"},
+		{"1.25", "800.40", jpy, "1001.00"},
+		{"1", "12.34", bdt, "12.34"},
+		{"1", "12.50", jpy, "13.00"},
+	}
+	for _, tt := range tests {
+		if got := mustRate(t, tt.rate).Convert(MustParse(tt.amount), tt.to); got != MustParse(tt.want) {
+			t.Errorf("Convert(%s at %s to %s) = %s, want %s", tt.amount, tt.rate, tt.to.Code, got, tt.want)
+		}
+	}
+
+	// An unset rate is treated as parity
+	if got := ExchangeRate(0).Convert(MustParse("12.34"), bdt); got != MustParse("12.34") {
+		t.Errorf("zero rate Convert = %s, want 12.34", got)
+	}
+}
+
+func TestExchangeRateToBase(t *testing.T) {
+	tests := []struct {
+		rate   string
+		amount string
+		want   string
+	}{
+		{"0.0091", "9.10", "1000.00"},
+		{"0.0091", "11.23", "1234.07"},
+		{"0.0091", "-9.10", "-1000.00"},
+		{"1.25", "1000", "800.00"},
+		{"1.25", "1001", "800.80"},
+		{"1", "12.34", "12.34"},
+		{"0", "12.34", "12.34"},
+	}
+	for _, tt := range tests {
+		if got := mustRate(t, tt.rate).ToBase(MustParse(tt.amount)); got != MustParse(tt.want) {
+			t.Errorf("ToBase(%s at %s) = %s, want %s", tt.amount, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestExchangeRateRoundTrip(t *testing.T) {
+	tests := []struct {
+		rate string
+		to   Currency
+	}{
+		{"0.0091", usd},
+		{"0.00843", usd},
+		{"1.25", jpy},
+		{"1.3379", jpy},
+		{"1", bdt},
+	}
+	amounts := []string{"0", "0.01", "1", "9.99", "42.42", "1001", "123456.78", "-75.50"}
+	for _, tt := range tests {
+		rate := mustRate(t, tt.rate)
+		for _, amount := range amounts {
+			// An amount in the target currency survives a trip through the base currency,
+			// which is always the finer of the two here
+			want := tt.to.Round(MustParse(amount))
+			if got := rate.Convert(rate.ToBase(want), tt.to); got != want {
+				t.Errorf("at %s: Convert(ToBase(%s)) = %s", tt.rate, want, got)
+			}
+
+			// A base amount comes back within what the target currency can express
+			base := MustParse(amount)
+			back := rate.ToBase(rate.Convert(base, tt.to))
+			step := Money(1)
+			for i := tt.to.Decimals; i < Scale; i++ {
+				step *= 10
+			}
+			limit := rate.ToBase(step)/2 + 1
+			if diff := back.Sub(base); diff > limit || diff < -limit {
+				t.Errorf("at %s: ToBase(Convert(%s)) = %s, off by more than %s", tt.rate, base, back, limit)
+			}
+		}
+	}
+}
+
+func TestExchangeRateEncoding(t *testing.T) {
+	rate := mustRate(t, "0.00912")
+	if rate.String() != "0.00912" || Parity.String() != "1" {
+		t.Errorf("String() = %q and %q, want \"0.00912\" and \"1\"", rate.String(), Parity.String())
+	}
+
+	data, err := json.Marshal(struct {
+		Rate ExchangeRate `json:"rate"`
+	}{rate})
+	if err != nil || string(data) != `{"rate":0.00912}` {
+		t.Errorf("Marshal = %s, %v", data, err)
+	}
+
+	var decoded struct {
+		Rate ExchangeRate `json:"rate"`
+	}
+	if err := json.Unmarshal([]byte(`{"rate":"1.25"}`), &decoded); err != nil || decoded.Rate != mustRate(t, "1.25") {
+		t.Errorf("Unmarshal = %d, %v, want 1.25", decoded.Rate, err)
+	}
+
+	value, err := rate.Value()
+	if err != nil || value != "0.00912000" {
+		t.Errorf("Value() = %#v, %v, want \"0.00912000\"", value, err)
+	}
+	scanned := []struct {
+		src  interface{}
+		want ExchangeRate
+	}{
+		{value, rate},
+		{[]byte("1.25"), mustRate(t, "1.25")},
+		{0.0091, mustRate(t, "0.0091")},
+		{int64(2), 2 * Parity},
+		{nil, 0},
+	}
+	for _, tt := range scanned {
+		var got ExchangeRate
+		if err := got.Scan(tt.src); err != nil || got != tt.want {
+			t.Errorf("Scan(%#v) = %d, %v, want %d", tt.src, got, err, tt.want)
+		}
+	}
+}
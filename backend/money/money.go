@@ -0,0 +1,257 @@
+// Package money represents amounts exactly as integer minor units so totals, tax and
+// discounts add up to the cent. Amounts are stored in Postgres as numeric(12,2) and
+// serialised to JSON as plain numbers, so API clients see the same values as before.
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of decimal places held by Money
+const Scale = 2
+
+// minorPerUnit is 10^Scale
+const minorPerUnit = 100
+
+// Money is an amount in minor units (hundredths) of a currency
+type Money int64
+
+// Zero is the zero amount
+const Zero Money = 0
+
+// FromMinor returns an amount of minor units, e.g. FromMinor(1234) is 12.34
+func FromMinor(minor int64) Money {
+	return Money(minor)
+}
+
+// FromFloat converts a float to the nearest minor unit, rounding half away from zero. Only
+// use it at boundaries (e.g. values computed from weights); prefer Parse for user input.
+func FromFloat(f float64) Money {
+	return Money(math.Round(f * minorPerUnit))
+}
+
+// Parse reads a decimal string such as "12.345" exactly, rounding half away from zero to
+// two decimal places
+func Parse(s string) (Money, error) {
+	minor, err := parseDecimal(s, Scale)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return Money(minor), nil
+}
+
+// MustParse is Parse for constants; it panics on invalid input
+func MustParse(s string) Money {
+	m, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Minor returns the amount in minor units
+func (m Money) Minor() int64 {
+	return int64(m)
+}
+
+// Float64 returns the amount as a float, for display and charting only
+func (m Money) Float64() float64 {
+	return float64(m) / minorPerUnit
+}
+
+// Add returns m + o
+func (m Money) Add(o Money) Money {
+	return m + o
+}
+
+// Sub returns m - o
+func (m Money) Sub(o Money) Money {
+	return m - o
+}
+
+// Mul returns m multiplied by a whole quantity
+func (m Money) Mul(quantity int) Money {
+	return m * Money(quantity)
+}
+
+// Neg returns -m
+func (m Money) Neg() Money {
+	return -m
+}
+
+// IsZero reports whether m is zero
+func (m Money) IsZero() bool {
+	return m == 0
+}
+
+// IsPositive reports whether m is greater than zero
+func (m Money) IsPositive() bool {
+	return m > 0
+}
+
+// IsNegative reports whether m is less than zero
+func (m Money) IsNegative() bool {
+	return m < 0
+}
+
+// Percent returns rate percent of m, rounded to the minor unit with the given mode
+func (m Money) Percent(rate Rate, mode RoundingMode) Money {
+	// m (hundredths) * rate (ten-thousandths of a percent) / (100 * 10^4)
+	product := new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(int64(rate)))
+	return Money(divRound(product, big.NewInt(100*rateUnit), mode))
+}
+
+// Min returns the smaller of a and b
+func Min(a, b Money) Money {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Max returns the larger of a and b
+func Max(a, b Money) Money {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Sum adds amounts together
+func Sum(amounts ...Money) Money {
+	var total Money
+	for _, amount := range amounts {
+		total += amount
+	}
+	return total
+}
+
+// String formats m with two decimal places, e.g. "-12.30"
+func (m Money) String() string {
+	return formatDecimal(int64(m), Scale)
+}
+
+// MarshalJSON writes m as a JSON number with two decimal places
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a numeric string
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(strings.TrimSpace(string(data)), `"`)
+	if s == "" || s == "null" {
+		*m = 0
+		return nil
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// GormDataType stores amounts as exact decimals
+func (Money) GormDataType() string {
+	return "numeric(12,2)"
+}
+
+// Value implements driver.Valuer
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan implements sql.Scanner for numeric, float and integer columns
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	case float64:
+		*m = FromFloat(v)
+	case int64:
+		*m = Money(v * minorPerUnit)
+	default:
+		return fmt.Errorf("money: cannot scan %T", src)
+	}
+	return nil
+}
+
+func (m *Money) scanString(s string) error {
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// parseDecimal converts a decimal string to an integer with the given number of decimal
+// places, rounding half away from zero. Exponent notation falls back to float parsing.
+func parseDecimal(s string, places int) (int64, error) {
+	s = strings.TrimSpace(s)
+	if strings.ContainsAny(s, "eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, err
+		}
+		return int64(math.Round(f * math.Pow10(places))), nil
+	}
+
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("empty number")
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	// Only one sign is allowed, ahead of the digits
+	for _, r := range whole + frac {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("invalid digit")
+		}
+	}
+
+	roundUp := false
+	if len(frac) > places {
+		roundUp = frac[places] >= '5'
+		frac = frac[:places]
+	}
+	frac += strings.Repeat("0", places-len(frac))
+
+	value, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if roundUp {
+		value++
+	}
+	if negative {
+		value = -value
+	}
+	return value, nil
+}
+
+// formatDecimal writes an integer with the given number of implied decimal places
+func formatDecimal(value int64, places int) string {
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	digits := strconv.FormatInt(value, 10)
+	if len(digits) <= places {
+		digits = strings.Repeat("0", places-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-places] + "." + digits[len(digits)-places:]
+}
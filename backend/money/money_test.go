@@ -0,0 +1,210 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{"12", 1200},
+		{"12.3", 1230},
+		{"12.34", 1234},
+		{"0.01", 1},
+		{".5", 50},
+		{"7.", 700},
+		{"+4.20", 420},
+		{"  3.10 ", 310},
+		{"-12.34", -1234},
+		{"-0.5", -50},
+
+		// Extra decimals round half away from zero
+		{"12.345", 1235},
+		{"12.344", 1234},
+		{"1.999", 200},
+		{"0.125", 13},
+		{"-12.345", -1235},
+		{"-0.005", -1},
+		{"-0.004", 0},
+		{"1.2349999", 123},
+
+		{"1e2", 10000},
+		{"-2.5E1", -2500},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseRejectsInvalid(t *testing.T) {
+	for _, in := range []string{"", " ", "-", ".", "abc", "12.3.4", "1,000", "12.3x", "1.23x5", "--1", "+-1", "1.-5", "- 1", "99999999999999999999"} {
+		if got, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) = %d, want an error", in, got)
+		}
+	}
+}
+
+func TestParseDecimalPlaces(t *testing.T) {
+	tests := []struct {
+		in     string
+		places int
+		want   int64
+	}{
+		{"7.5", 4, 75000},
+		{"0.00912", 8, 912000},
+		{"12.5", 0, 13},
+		{"12.4", 0, 12},
+		{"-12.5", 0, -13},
+		{"0.123456785", 8, 12345679},
+	}
+	for _, tt := range tests {
+		got, err := parseDecimal(tt.in, tt.places)
+		if err != nil {
+			t.Errorf("parseDecimal(%q, %d) error = %v", tt.in, tt.places, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseDecimal(%q, %d) = %d, want %d", tt.in, tt.places, got, tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := map[Money]string{
+		0:       "0.00",
+		5:       "0.05",
+		-5:      "-0.05",
+		1230:    "12.30",
+		-1230:   "-12.30",
+		1234567: "12345.67",
+	}
+	for m, want := range tests {
+		if got := m.String(); got != want {
+			t.Errorf("Money(%d).String() = %q, want %q", m, got, want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	type line struct {
+		Price Money `json:"price"`
+	}
+
+	data, err := json.Marshal(line{Price: MustParse("-12.3")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"price":-12.30}` {
+		t.Errorf("Marshal = %s, want {\"price\":-12.30}", data)
+	}
+
+	tests := map[string]Money{
+		`{"price":12.5}`:      1250,
+		`{"price":"12.345"}`:  1235,
+		`{"price":-0.01}`:     -1,
+		`{"price":null}`:      0,
+		`{"price":""}`:        0,
+		`{"price":1.5e1}`:     1500,
+		`{"price":"  9.99 "}`: 999,
+	}
+	for in, want := range tests {
+		var got line
+		if err := json.Unmarshal([]byte(in), &got); err != nil {
+			t.Errorf("Unmarshal(%s) error = %v", in, err)
+			continue
+		}
+		if got.Price != want {
+			t.Errorf("Unmarshal(%s) = %d, want %d", in, got.Price, want)
+		}
+	}
+
+	var got line
+	if err := json.Unmarshal([]byte(`{"price":"twelve"}`), &got); err == nil {
+		t.Errorf("Unmarshal of a non-numeric string = %d, want an error", got.Price)
+	}
+}
+
+func TestScanAndValue(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want Money
+	}{
+		{[]byte("12.34"), 1234},
+		{"-0.50", -50},
+		{"12.345", 1235},
+		{12.5, 1250},
+		{int64(7), 700},
+		{nil, 0},
+	}
+	for _, tt := range tests {
+		m := Money(99)
+		if err := m.Scan(tt.src); err != nil {
+			t.Errorf("Scan(%#v) error = %v", tt.src, err)
+			continue
+		}
+		if m != tt.want {
+			t.Errorf("Scan(%#v) = %d, want %d", tt.src, m, tt.want)
+		}
+	}
+
+	var m Money
+	if err := m.Scan(true); err == nil {
+		t.Error("Scan(bool) succeeded, want an error")
+	}
+	if err := m.Scan("n/a"); err == nil {
+		t.Error("Scan of a non-numeric string succeeded, want an error")
+	}
+
+	value, err := MustParse("-1234.5").Value()
+	if err != nil || value != "-1234.50" {
+		t.Errorf("Value() = %#v, %v, want \"-1234.50\"", value, err)
+	}
+	var back Money
+	if err := back.Scan(value); err != nil || back != MustParse("-1234.5") {
+		t.Errorf("Scan(Value()) = %d, %v, want -123450", back, err)
+	}
+}
+
+func TestPercent(t *testing.T) {
+	half := Rate(50 * rateUnit)
+	tests := []struct {
+		amount string
+		rate   Rate
+		mode   RoundingMode
+		want   Money
+	}{
+		{"0.25", half, HalfUp, 13},
+		{"0.25", half, HalfEven, 12},
+		{"0.75", half, HalfEven, 38},
+		{"0.25", half, Down, 12},
+		{"-0.25", half, HalfUp, -13},
+		{"-0.25", half, Down, -12},
+		{"100.00", 75000, HalfUp, 750},
+		{"10.05", 50000, HalfUp, 50},
+		{"10.10", 50000, HalfUp, 51},
+	}
+	for _, tt := range tests {
+		if got := MustParse(tt.amount).Percent(tt.rate, tt.mode); got != tt.want {
+			t.Errorf("%s.Percent(%s, %d) = %d, want %d", tt.amount, tt.rate, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestMustParsePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("MustParse(\"oops\") didn't panic")
+		}
+	}()
+	MustParse("oops")
+}
@@ -0,0 +1,108 @@
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// RateScale is the number of decimal places held by Rate
+const RateScale = 4
+
+// rateUnit is 10^RateScale
+const rateUnit = 10000
+
+// Rate is a percentage with four decimal places, e.g. 7.5% is stored as 75000
+type Rate int64
+
+// ParseRate reads a percentage such as "7.5" exactly
+func ParseRate(s string) (Rate, error) {
+	value, err := parseDecimal(s, RateScale)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	return Rate(value), nil
+}
+
+// RateFromMoney reads a percentage held in a Money field (e.g. a percentage coupon's value)
+func RateFromMoney(m Money) Rate {
+	return Rate(int64(m) * (rateUnit / minorPerUnit))
+}
+
+// Float64 returns the rate as a float percentage, for display only
+func (r Rate) Float64() float64 {
+	return float64(r) / rateUnit
+}
+
+// IsZero reports whether r is zero
+func (r Rate) IsZero() bool {
+	return r == 0
+}
+
+// String formats r without trailing zeros, e.g. "7.5"
+func (r Rate) String() string {
+	s := strings.TrimRight(formatDecimal(int64(r), RateScale), "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// MarshalJSON writes r as a JSON number
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a numeric string
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(strings.TrimSpace(string(data)), `"`)
+	if s == "" || s == "null" {
+		*r = 0
+		return nil
+	}
+	parsed, err := ParseRate(s)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// GormDataType stores rates as exact decimals
+func (Rate) GormDataType() string {
+	return "numeric(9,4)"
+}
+
+// Value implements driver.Valuer
+func (r Rate) Value() (driver.Value, error) {
+	return formatDecimal(int64(r), RateScale), nil
+}
+
+// Scan implements sql.Scanner for numeric, float and integer columns
+func (r *Rate) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*r = 0
+	case []byte:
+		return r.scanString(string(v))
+	case string:
+		return r.scanString(v)
+	case float64:
+		parsed, err := ParseRate(fmt.Sprintf("%.4f", v))
+		if err != nil {
+			return err
+		}
+		*r = parsed
+	case int64:
+		*r = Rate(v * rateUnit)
+	default:
+		return fmt.Errorf("money: cannot scan %T into Rate", src)
+	}
+	return nil
+}
+
+func (r *Rate) scanString(s string) error {
+	parsed, err := ParseRate(s)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
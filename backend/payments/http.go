@@ -0,0 +1,137 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"ecom-backend/money"
+)
+
+// defaultHTTPClient is used when a Config has no HTTPClient
+var defaultHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// apiClient sends requests to one gateway's API
+type apiClient struct {
+	gateway string
+	baseURL string
+	http    *http.Client
+}
+
+func newAPIClient(gateway string, cfg Config, liveURL, testURL string) apiClient {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = liveURL
+		if cfg.TestMode {
+			baseURL = testURL
+		}
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	return apiClient{gateway: gateway, baseURL: strings.TrimRight(baseURL, "/"), http: client}
+}
+
+// do sends a request and decodes a JSON response into out. decorate sets auth headers.
+// Responses outside 2xx become a GatewayError carrying errorMessage's reading of the body.
+func (c apiClient) do(ctx context.Context, method, path string, body io.Reader, contentType string, decorate func(*http.Request), errorMessage func([]byte) string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	if decorate != nil {
+		decorate(req)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return &GatewayError{Gateway: c.gateway, Message: err.Error()}
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return &GatewayError{Gateway: c.gateway, StatusCode: resp.StatusCode, Message: err.Error()}
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message := ""
+		if errorMessage != nil {
+			message = errorMessage(data)
+		}
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		return &GatewayError{Gateway: c.gateway, StatusCode: resp.StatusCode, Message: message}
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return &GatewayError{Gateway: c.gateway, StatusCode: resp.StatusCode, Message: "unexpected response: " + err.Error()}
+	}
+	return nil
+}
+
+// rawResponse decodes a response into out and keeps the raw JSON as well
+type rawResponse struct {
+	out  interface{}
+	data json.RawMessage
+}
+
+// withRaw wraps out for do, so the response can be stored as it was received
+func withRaw(out interface{}) *rawResponse {
+	return &rawResponse{out: out}
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (r *rawResponse) UnmarshalJSON(data []byte) error {
+	r.data = append(r.data[:0], data...)
+	return json.Unmarshal(data, r.out)
+}
+
+// String returns the raw response
+func (r *rawResponse) String() string {
+	return string(r.data)
+}
+
+// form encodes form values as a request body
+func form(values url.Values) io.Reader {
+	return strings.NewReader(values.Encode())
+}
+
+// jsonBody encodes a value as a request body
+func jsonBody(v interface{}) (io.Reader, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// minorUnits returns an amount in the currency's smallest unit, e.g. cents, as gateways such
+// as Stripe expect
+func minorUnits(m money.Money, currency money.Currency) int64 {
+	minor := m.Minor()
+	for i := currency.Decimals; i < money.Scale; i++ {
+		minor /= 10
+	}
+	return minor
+}
+
+// fromMinorUnits is the inverse of minorUnits
+func fromMinorUnits(minor int64, currency money.Currency) money.Money {
+	for i := currency.Decimals; i < money.Scale; i++ {
+		minor *= 10
+	}
+	return money.FromMinor(minor)
+}
@@ -0,0 +1,202 @@
+// Package payments talks to online payment gateways. Each gateway is an adapter behind the
+// Provider interface, configured from the admin's payment_gateway_<name>_* settings. Adapters
+// take their API endpoint from Config, so they can be pointed at a local HTTP fake.
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"ecom-backend/money"
+)
+
+// Gateway names, as used in settings and URLs
+const (
+	GatewayStripe     = "stripe"
+	GatewayPayPal     = "paypal"
+	GatewaySSLCommerz = "sslcommerz"
+)
+
+// Gateways lists the supported gateways in the order checkout offers them
+var Gateways = []string{GatewayStripe, GatewaySSLCommerz, GatewayPayPal}
+
+var (
+	// ErrUnknownGateway is returned for a gateway name with no adapter
+	ErrUnknownGateway = errors.New("unknown payment gateway")
+	// ErrNotConfigured is returned when a gateway's credentials are missing
+	ErrNotConfigured = errors.New("payment gateway not configured")
+	// ErrNotSupported is returned for operations a gateway doesn't offer
+	ErrNotSupported = errors.New("operation not supported by this payment gateway")
+	// ErrInvalidSignature is returned for webhooks that fail verification
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// Provider is an online payment gateway
+type Provider interface {
+	// Name returns the gateway name, e.g. "stripe"
+	Name() string
+	// CreateSession starts a payment and returns where to send the customer to complete it
+	CreateSession(ctx context.Context, req SessionRequest) (*Session, error)
+	// Confirm asks the gateway for the current state of a payment started by CreateSession
+	Confirm(ctx context.Context, reference string) (*Result, error)
+	// Capture collects some or all of an authorized payment. A partial capture releases the rest.
+	Capture(ctx context.Context, req CaptureRequest) (*Result, error)
+	// Void releases an authorized payment without collecting it
+	Void(ctx context.Context, req VoidRequest) (*Result, error)
+	// Refund returns money from a captured payment
+	Refund(ctx context.Context, req RefundRequest) (*RefundResult, error)
+	// ParseWebhook verifies a callback from the gateway and decodes it
+	ParseWebhook(ctx context.Context, header http.Header, body []byte) (*Event, error)
+}
+
+// Config holds a gateway's credentials and endpoint
+type Config struct {
+	TestMode      bool
+	ManualCapture bool         // Only authorize at checkout; the payment is captured later with Capture
+	BaseURL       string       // Overrides the gateway's API endpoint; only for tests against a local fake
+	HTTPClient    *http.Client // Defaults to a client with a 30 second timeout
+
+	// Stripe
+	SecretKey     string
+	WebhookSecret string
+
+	// SSLCommerz
+	StoreID       string
+	StorePassword string
+
+	// PayPal
+	ClientID     string
+	ClientSecret string
+	WebhookID    string
+}
+
+// Customer is who is paying, for gateways that collect billing details
+type Customer struct {
+	Name       string
+	Email      string
+	Phone      string
+	Address    string
+	City       string
+	PostalCode string
+	Country    string
+}
+
+// SessionRequest describes a payment to start
+type SessionRequest struct {
+	PaymentID   uint // Our payment record, unique per attempt
+	OrderID     uint
+	OrderNumber string
+	Description string
+	Amount      money.Money
+	Currency    money.Currency
+	Customer    Customer
+	ReturnURL   string // Where the customer is sent after paying
+	CancelURL   string // Where the customer is sent if they give up
+	NotifyURL   string // Server-to-server callback, for gateways that take one per payment
+}
+
+// Session is a started payment
+type Session struct {
+	Reference   string `json:"reference"`    // Gateway's ID for the payment session
+	RedirectURL string `json:"redirect_url"` // Hosted payment page to send the customer to
+}
+
+// Result is a payment's state as reported by the gateway
+type Result struct {
+	Reference     string
+	TransactionID string // Gateway's ID for the money movement, used for capture and refunds
+	Status        string // One of the models.PaymentStatus values
+	Amount        money.Money
+	Currency      string
+	Raw           string // Gateway's response, kept on the payment for support and disputes
+	RefundID      string // Gateway's ID for the refund a refunded result reports
+}
+
+// CaptureRequest collects an authorized payment. A zero Amount captures it in full.
+type CaptureRequest struct {
+	Reference     string
+	TransactionID string
+	Amount        money.Money
+	Currency      money.Currency
+}
+
+// VoidRequest releases an authorized payment
+type VoidRequest struct {
+	Reference     string
+	TransactionID string
+}
+
+// RefundRequest returns money from a captured payment
+type RefundRequest struct {
+	Reference     string
+	TransactionID string
+	Amount        money.Money
+	Currency      money.Currency
+	Reason        string
+}
+
+// RefundResult is the gateway's answer to a refund
+type RefundResult struct {
+	ID     string
+	Status string // pending, succeeded or failed
+}
+
+// Refund statuses
+const (
+	RefundPending   = "pending"
+	RefundSucceeded = "succeeded"
+	RefundFailed    = "failed"
+)
+
+// Event is a verified webhook. Status is empty for event types that don't change a payment.
+// Refund events report refunded with the amount refunded, which may be part of the payment.
+type Event struct {
+	ID            string
+	Type          string
+	Reference     string
+	TransactionID string
+	Status        string
+	Amount        money.Money
+	Currency      string
+	RefundID      string // Gateway's ID for the refund a refund event reports
+}
+
+// GatewayError is an error response from a gateway's API
+type GatewayError struct {
+	Gateway    string
+	StatusCode int
+	Message    string
+}
+
+func (e *GatewayError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%s: %s", e.Gateway, e.Message)
+	}
+	return fmt.Sprintf("%s: %s (HTTP %d)", e.Gateway, e.Message, e.StatusCode)
+}
+
+// New returns the adapter for a gateway
+func New(gateway string, cfg Config) (Provider, error) {
+	switch strings.ToLower(gateway) {
+	case GatewayStripe:
+		return NewStripe(cfg)
+	case GatewaySSLCommerz:
+		return NewSSLCommerz(cfg)
+	case GatewayPayPal:
+		return NewPayPal(cfg)
+	}
+	return nil, ErrUnknownGateway
+}
+
+// IsGateway reports whether name is a supported gateway
+func IsGateway(name string) bool {
+	for _, gateway := range Gateways {
+		if gateway == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"ecom-backend/money"
+)
+
+// fakeRequest is a request received by a fakeGateway
+type fakeRequest struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// Form returns the request's form-encoded body
+func (r fakeRequest) Form() url.Values {
+	values, _ := url.ParseQuery(string(r.Body))
+	return values
+}
+
+// fakeRoute answers one gateway endpoint with a status code and a response body
+type fakeRoute func(req fakeRequest) (int, string)
+
+// fakeGateway is a local HTTP stand-in for a gateway's API. Routes are keyed by
+// "METHOD /path"; requests to anything else fail the test.
+type fakeGateway struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []fakeRequest
+}
+
+func newFakeGateway(t *testing.T, routes map[string]fakeRoute) *fakeGateway {
+	t.Helper()
+	fake := &fakeGateway{}
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := fakeRequest{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query(), Header: r.Header.Clone(), Body: body}
+		fake.mu.Lock()
+		fake.requests = append(fake.requests, req)
+		fake.mu.Unlock()
+
+		route, ok := routes[r.Method+" "+r.URL.Path]
+		if !ok {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		status, response := route(req)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, response)
+	}))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+// received returns the requests made to one endpoint, in order
+func (f *fakeGateway) received(method, path string) []fakeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var matched []fakeRequest
+	for _, req := range f.requests {
+		if req.Method == method && req.Path == path {
+			matched = append(matched, req)
+		}
+	}
+	return matched
+}
+
+// only returns the single request made to an endpoint, failing the test otherwise
+func (f *fakeGateway) only(t *testing.T, method, path string) fakeRequest {
+	t.Helper()
+	matched := f.received(method, path)
+	if len(matched) != 1 {
+		t.Fatalf("%s %s received %d requests, want 1", method, path, len(matched))
+	}
+	return matched[0]
+}
+
+// respond returns a route that always answers with status and body
+func respond(status int, body string) fakeRoute {
+	return func(fakeRequest) (int, string) {
+		return status, body
+	}
+}
+
+var (
+	usd = money.CurrencyOrDefault("USD")
+	jpy = money.CurrencyOrDefault("JPY")
+)
+
+func TestNewRejectsUnknownGateway(t *testing.T) {
+	if _, err := New("bitcoin", Config{}); !errors.Is(err, ErrUnknownGateway) {
+		t.Fatalf("New(bitcoin) error = %v, want ErrUnknownGateway", err)
+	}
+}
+
+func TestNewRequiresCredentials(t *testing.T) {
+	for _, gateway := range Gateways {
+		if _, err := New(gateway, Config{}); !errors.Is(err, ErrNotConfigured) {
+			t.Errorf("New(%s) without credentials error = %v, want ErrNotConfigured", gateway, err)
+		}
+	}
+}
+
+func TestMinorUnits(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency money.Currency
+		want     int64
+	}{
+		{"12.50", usd, 1250},
+		{"0.01", usd, 1},
+		{"1000.00", jpy, 1000},
+		{"-3.25", usd, -325},
+	}
+	for _, tt := range tests {
+		amount := money.MustParse(tt.amount)
+		got := minorUnits(amount, tt.currency)
+		if got != tt.want {
+			t.Errorf("minorUnits(%s %s) = %d, want %d", tt.amount, tt.currency.Code, got, tt.want)
+		}
+		if back := fromMinorUnits(got, tt.currency); back != amount {
+			t.Errorf("fromMinorUnits(%d %s) = %s, want %s", got, tt.currency.Code, back, amount)
+		}
+	}
+}
+
+func TestGatewayErrorCarriesStatusAndMessage(t *testing.T) {
+	fake := newFakeGateway(t, map[string]fakeRoute{
+		"POST /v1/refunds": respond(http.StatusPaymentRequired, `{"error":{"message":"Charge has already been refunded."}}`),
+	})
+	stripe := newTestStripe(t, fake, false)
+
+	_, err := stripe.Refund(context.Background(), RefundRequest{TransactionID: "pi_1", Amount: money.MustParse("5.00"), Currency: usd})
+	var gatewayErr *GatewayError
+	if !errors.As(err, &gatewayErr) {
+		t.Fatalf("Refund error = %v, want a GatewayError", err)
+	}
+	if gatewayErr.StatusCode != http.StatusPaymentRequired || gatewayErr.Message != "Charge has already been refunded." {
+		t.Errorf("GatewayError = %+v", gatewayErr)
+	}
+}
+
+func TestUnreachableGatewayIsAGatewayError(t *testing.T) {
+	fake := newFakeGateway(t, nil)
+	stripe := newTestStripe(t, fake, false)
+	fake.Close()
+
+	_, err := stripe.Confirm(context.Background(), "cs_1")
+	var gatewayErr *GatewayError
+	if !errors.As(err, &gatewayErr) || gatewayErr.Gateway != GatewayStripe {
+		t.Fatalf("Confirm against a closed server error = %v, want a stripe GatewayError", err)
+	}
+}
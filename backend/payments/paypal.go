@@ -0,0 +1,454 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ecom-backend/models"
+	"ecom-backend/money"
+)
+
+const (
+	paypalLiveURL    = "https://api-m.paypal.com"
+	paypalSandboxURL = "https://api-m.sandbox.paypal.com"
+)
+
+// paypalTokens caches OAuth access tokens per API endpoint and client ID
+var paypalTokens = struct {
+	sync.Mutex
+	byClient map[string]paypalToken
+}{byClient: map[string]paypalToken{}}
+
+type paypalToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+// PayPal takes payments through PayPal Checkout orders
+type PayPal struct {
+	api           apiClient
+	clientID      string
+	clientSecret  string
+	webhookID     string
+	manualCapture bool
+}
+
+// NewPayPal returns a PayPal adapter
+func NewPayPal(cfg Config) (*PayPal, error) {
+	if cfg.ClientID == "" || cfg.ClientSecret == "" {
+		return nil, ErrNotConfigured
+	}
+	return &PayPal{
+		api:           newAPIClient(GatewayPayPal, cfg, paypalLiveURL, paypalSandboxURL),
+		clientID:      cfg.ClientID,
+		clientSecret:  cfg.ClientSecret,
+		webhookID:     cfg.WebhookID,
+		manualCapture: cfg.ManualCapture,
+	}, nil
+}
+
+// Name implements Provider
+func (p *PayPal) Name() string {
+	return GatewayPayPal
+}
+
+// paypalAmount is PayPal's money object
+type paypalAmount struct {
+	CurrencyCode string `json:"currency_code"`
+	Value        string `json:"value"`
+}
+
+// paypalCapture is the part of a capture we read
+type paypalCapture struct {
+	ID                string       `json:"id"`
+	Status            string       `json:"status"`
+	Amount            paypalAmount `json:"amount"`
+	SupplementaryData struct {
+		RelatedIDs struct {
+			OrderID string `json:"order_id"`
+		} `json:"related_ids"`
+	} `json:"supplementary_data"`
+}
+
+// paypalOrder is the part of a Checkout order we read
+type paypalOrder struct {
+	ID     string `json:"id"`
+	Intent string `json:"intent"` // CAPTURE or AUTHORIZE
+	Status string `json:"status"` // CREATED, APPROVED, COMPLETED, VOIDED, PAYER_ACTION_REQUIRED
+	Links  []struct {
+		Href string `json:"href"`
+		Rel  string `json:"rel"`
+	} `json:"links"`
+	PurchaseUnits []struct {
+		Payments struct {
+			Authorizations []paypalCapture `json:"authorizations"`
+			Captures       []paypalCapture `json:"captures"`
+		} `json:"payments"`
+	} `json:"purchase_units"`
+}
+
+// CreateSession implements Provider by creating a Checkout order for the customer to approve
+func (p *PayPal) CreateSession(ctx context.Context, req SessionRequest) (*Session, error) {
+	orderRef := req.OrderNumber
+	if orderRef == "" {
+		orderRef = strconv.FormatUint(uint64(req.OrderID), 10)
+	}
+	intent := "CAPTURE"
+	if p.manualCapture {
+		intent = "AUTHORIZE"
+	}
+	body := map[string]interface{}{
+		"intent": intent,
+		"purchase_units": []map[string]interface{}{{
+			"reference_id": orderRef,
+			"custom_id":    strconv.FormatUint(uint64(req.OrderID), 10),
+			"invoice_id":   fmt.Sprintf("%s-%d", orderRef, req.PaymentID),
+			"description":  req.Description,
+			"amount":       paypalMoney(req.Amount, req.Currency),
+		}},
+		"application_context": map[string]string{
+			"return_url":          req.ReturnURL,
+			"cancel_url":          req.CancelURL,
+			"user_action":         "PAY_NOW",
+			"shipping_preference": "NO_SHIPPING",
+		},
+	}
+
+	var order paypalOrder
+	requestID := fmt.Sprintf("payment-%d", req.PaymentID)
+	if err := p.call(ctx, http.MethodPost, "/v2/checkout/orders", body, requestID, &order); err != nil {
+		return nil, err
+	}
+	for _, link := range order.Links {
+		if link.Rel == "approve" || link.Rel == "payer-action" {
+			return &Session{Reference: order.ID, RedirectURL: link.Href}, nil
+		}
+	}
+	return nil, &GatewayError{Gateway: GatewayPayPal, Message: "order has no approval link"}
+}
+
+// Confirm implements Provider. An order the customer has approved is captured here, or
+// authorized when it was created for manual capture, since PayPal only acts once the
+// merchant asks it to.
+func (p *PayPal) Confirm(ctx context.Context, reference string) (*Result, error) {
+	var order paypalOrder
+	raw := withRaw(&order)
+	orderPath := "/v2/checkout/orders/" + url.PathEscape(reference)
+	if err := p.call(ctx, http.MethodGet, orderPath, nil, "", raw); err != nil {
+		return nil, err
+	}
+	if order.Status == "APPROVED" {
+		action := "capture"
+		if order.Intent == "AUTHORIZE" {
+			action = "authorize"
+		}
+		if err := p.call(ctx, http.MethodPost, orderPath+"/"+action, map[string]interface{}{}, action+"-"+reference, raw); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &Result{Reference: order.ID, Status: models.PaymentStatusPending, Raw: raw.String()}
+	switch order.Status {
+	case "VOIDED":
+		result.Status = models.PaymentStatusCancelled
+	case "COMPLETED":
+		for _, unit := range order.PurchaseUnits {
+			for _, authorization := range unit.Payments.Authorizations {
+				result.TransactionID = authorization.ID
+				result.Status = paypalAuthorizationStatus(authorization.Status)
+				result.Amount, _ = money.Parse(authorization.Amount.Value)
+				result.Currency = authorization.Amount.CurrencyCode
+			}
+			// Once an authorization is captured, the capture is what refunds go against
+			for _, capture := range unit.Payments.Captures {
+				result.TransactionID = capture.ID
+				result.Status = paypalCaptureStatus(capture.Status)
+				result.Amount, _ = money.Parse(capture.Amount.Value)
+				result.Currency = capture.Amount.CurrencyCode
+			}
+		}
+	}
+	return result, nil
+}
+
+// Capture implements Provider for authorized payments. The capture is final: capturing less
+// than was authorized releases the rest.
+func (p *PayPal) Capture(ctx context.Context, req CaptureRequest) (*Result, error) {
+	body := map[string]interface{}{"final_capture": true}
+	if req.Amount.IsPositive() {
+		body["amount"] = paypalMoney(req.Amount, req.Currency)
+	}
+
+	var capture paypalCapture
+	raw := withRaw(&capture)
+	requestID := fmt.Sprintf("capture-%s-%s", req.TransactionID, req.Amount)
+	if err := p.call(ctx, http.MethodPost, "/v2/payments/authorizations/"+url.PathEscape(req.TransactionID)+"/capture", body, requestID, raw); err != nil {
+		return nil, err
+	}
+	amount, _ := money.Parse(capture.Amount.Value)
+	return &Result{
+		Reference:     req.Reference,
+		TransactionID: capture.ID,
+		Status:        paypalCaptureStatus(capture.Status),
+		Amount:        amount,
+		Currency:      capture.Amount.CurrencyCode,
+		Raw:           raw.String(),
+	}, nil
+}
+
+// Void implements Provider for authorized payments
+func (p *PayPal) Void(ctx context.Context, req VoidRequest) (*Result, error) {
+	var authorization paypalCapture
+	raw := withRaw(&authorization)
+	if err := p.call(ctx, http.MethodPost, "/v2/payments/authorizations/"+url.PathEscape(req.TransactionID)+"/void", nil, "void-"+req.TransactionID, raw); err != nil {
+		return nil, err
+	}
+	// PayPal answers with no content unless asked for the updated authorization
+	return &Result{
+		Reference:     req.Reference,
+		TransactionID: req.TransactionID,
+		Status:        models.PaymentStatusVoided,
+		Raw:           raw.String(),
+	}, nil
+}
+
+// Refund implements Provider against a capture
+func (p *PayPal) Refund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	body := map[string]interface{}{"amount": paypalMoney(req.Amount, req.Currency)}
+	if req.Reason != "" {
+		body["note_to_payer"] = req.Reason
+	}
+
+	var refund struct {
+		ID     string `json:"id"`
+		Status string `json:"status"` // COMPLETED, PENDING, CANCELLED, FAILED
+	}
+	if err := p.call(ctx, http.MethodPost, "/v2/payments/captures/"+url.PathEscape(req.TransactionID)+"/refund", body, "", &refund); err != nil {
+		return nil, err
+	}
+	status := RefundPending
+	switch refund.Status {
+	case "COMPLETED":
+		status = RefundSucceeded
+	case "CANCELLED", "FAILED":
+		status = RefundFailed
+	}
+	return &RefundResult{ID: refund.ID, Status: status}, nil
+}
+
+// ParseWebhook implements Provider, asking PayPal to verify the transmission signature
+// against the configured webhook ID
+func (p *PayPal) ParseWebhook(ctx context.Context, header http.Header, body []byte) (*Event, error) {
+	if p.webhookID == "" {
+		return nil, ErrNotConfigured
+	}
+	verification := map[string]interface{}{
+		"auth_algo":         header.Get("PAYPAL-AUTH-ALGO"),
+		"cert_url":          header.Get("PAYPAL-CERT-URL"),
+		"transmission_id":   header.Get("PAYPAL-TRANSMISSION-ID"),
+		"transmission_sig":  header.Get("PAYPAL-TRANSMISSION-SIG"),
+		"transmission_time": header.Get("PAYPAL-TRANSMISSION-TIME"),
+		"webhook_id":        p.webhookID,
+		"webhook_event":     json.RawMessage(body),
+	}
+	var verified struct {
+		VerificationStatus string `json:"verification_status"`
+	}
+	if err := p.call(ctx, http.MethodPost, "/v1/notifications/verify-webhook-signature", verification, "", &verified); err != nil {
+		return nil, err
+	}
+	if verified.VerificationStatus != "SUCCESS" {
+		return nil, ErrInvalidSignature
+	}
+
+	var payload struct {
+		ID        string          `json:"id"`
+		EventType string          `json:"event_type"`
+		Resource  json.RawMessage `json:"resource"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid paypal event: %w", err)
+	}
+	event := &Event{ID: payload.ID, Type: payload.EventType}
+
+	switch {
+	case strings.HasPrefix(payload.EventType, "CHECKOUT.ORDER."):
+		var order paypalOrder
+		if err := json.Unmarshal(payload.Resource, &order); err != nil {
+			return nil, fmt.Errorf("invalid paypal event: %w", err)
+		}
+		event.Reference = order.ID
+		switch order.Status {
+		case "APPROVED":
+			// Approved but not captured; confirming the payment captures it
+			event.Status = models.PaymentStatusPending
+		case "VOIDED":
+			event.Status = models.PaymentStatusCancelled
+		}
+
+	case strings.HasPrefix(payload.EventType, "PAYMENT.CAPTURE."), strings.HasPrefix(payload.EventType, "PAYMENT.AUTHORIZATION."):
+		var capture paypalCapture
+		if err := json.Unmarshal(payload.Resource, &capture); err != nil {
+			return nil, fmt.Errorf("invalid paypal event: %w", err)
+		}
+		event.Reference = capture.SupplementaryData.RelatedIDs.OrderID
+		event.TransactionID = capture.ID
+		event.Amount, _ = money.Parse(capture.Amount.Value)
+		event.Currency = capture.Amount.CurrencyCode
+		switch payload.EventType {
+		case "PAYMENT.CAPTURE.COMPLETED":
+			event.Status = models.PaymentStatusCaptured
+		case "PAYMENT.CAPTURE.PENDING":
+			event.Status = models.PaymentStatusPending
+		case "PAYMENT.CAPTURE.DENIED", "PAYMENT.CAPTURE.DECLINED":
+			event.Status = models.PaymentStatusFailed
+		case "PAYMENT.CAPTURE.REFUNDED":
+			// Sent for partial refunds too. The resource is the refund, with the amount
+			// refunded; its "up" link names the capture.
+			event.Status = models.PaymentStatusRefunded
+			event.RefundID = capture.ID
+			event.TransactionID = paypalParentID(payload.Resource)
+		case "PAYMENT.AUTHORIZATION.CREATED":
+			event.Status = models.PaymentStatusAuthorized
+		case "PAYMENT.AUTHORIZATION.VOIDED":
+			event.Status = models.PaymentStatusVoided
+		}
+	}
+	return event, nil
+}
+
+// call sends a JSON request with a bearer token. requestID, when set, makes PayPal treat
+// retries of the request as one.
+func (p *PayPal) call(ctx context.Context, method, apiPath string, body interface{}, requestID string, out interface{}) error {
+	token, err := p.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	contentType := ""
+	var reader io.Reader
+	if body != nil {
+		if reader, err = jsonBody(body); err != nil {
+			return err
+		}
+		contentType = "application/json"
+	}
+	return p.api.do(ctx, method, apiPath, reader, contentType, func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+token)
+		if requestID != "" {
+			req.Header.Set("PayPal-Request-Id", requestID)
+		}
+	}, paypalErrorMessage, out)
+}
+
+// accessToken returns a cached OAuth token, fetching a new one when it is about to expire
+func (p *PayPal) accessToken(ctx context.Context) (string, error) {
+	key := p.api.baseURL + "|" + p.clientID
+	paypalTokens.Lock()
+	token, ok := paypalTokens.byClient[key]
+	paypalTokens.Unlock()
+	if ok && time.Now().Before(token.expiresAt) {
+		return token.value, nil
+	}
+
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	err := p.api.do(ctx, http.MethodPost, "/v1/oauth2/token", form(url.Values{"grant_type": {"client_credentials"}}),
+		"application/x-www-form-urlencoded", func(req *http.Request) {
+			req.SetBasicAuth(p.clientID, p.clientSecret)
+		}, paypalErrorMessage, &resp)
+	if err != nil {
+		return "", err
+	}
+
+	// Refresh a minute early so a token never expires mid-request
+	token = paypalToken{value: resp.AccessToken, expiresAt: time.Now().Add(time.Duration(resp.ExpiresIn)*time.Second - time.Minute)}
+	paypalTokens.Lock()
+	paypalTokens.byClient[key] = token
+	paypalTokens.Unlock()
+	return token.value, nil
+}
+
+// paypalErrorMessage reads the message from a PayPal error response
+func paypalErrorMessage(body []byte) string {
+	var payload struct {
+		Message          string `json:"message"`
+		ErrorDescription string `json:"error_description"`
+		Details          []struct {
+			Description string `json:"description"`
+		} `json:"details"`
+	}
+	json.Unmarshal(body, &payload)
+	if len(payload.Details) > 0 && payload.Details[0].Description != "" {
+		return payload.Details[0].Description
+	}
+	if payload.Message != "" {
+		return payload.Message
+	}
+	return payload.ErrorDescription
+}
+
+// paypalMoney formats an amount with the currency's decimal places, as PayPal requires
+func paypalMoney(m money.Money, currency money.Currency) paypalAmount {
+	value := m.String()
+	if currency.Decimals == 0 {
+		value = strconv.FormatInt(minorUnits(m, currency), 10)
+	}
+	return paypalAmount{CurrencyCode: currency.Code, Value: value}
+}
+
+// paypalCaptureStatus maps a capture status onto a payment status
+func paypalCaptureStatus(status string) string {
+	switch status {
+	case "COMPLETED", "PARTIALLY_REFUNDED":
+		return models.PaymentStatusCaptured
+	case "DECLINED", "FAILED":
+		return models.PaymentStatusFailed
+	case "REFUNDED":
+		return models.PaymentStatusRefunded
+	}
+	return models.PaymentStatusPending
+}
+
+// paypalAuthorizationStatus maps an authorization status onto a payment status
+func paypalAuthorizationStatus(status string) string {
+	switch status {
+	case "CREATED", "PARTIALLY_CAPTURED":
+		return models.PaymentStatusAuthorized
+	case "CAPTURED":
+		return models.PaymentStatusCaptured
+	case "VOIDED", "EXPIRED":
+		return models.PaymentStatusVoided
+	case "DENIED":
+		return models.PaymentStatusFailed
+	}
+	return models.PaymentStatusPending
+}
+
+// paypalParentID returns the ID at the end of a resource's "up" link
+func paypalParentID(resource json.RawMessage) string {
+	var links struct {
+		Links []struct {
+			Href string `json:"href"`
+			Rel  string `json:"rel"`
+		} `json:"links"`
+	}
+	json.Unmarshal(resource, &links)
+	for _, link := range links.Links {
+		if link.Rel == "up" {
+			return path.Base(link.Href)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,371 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"ecom-backend/models"
+	"ecom-backend/money"
+)
+
+// paypalRoutes adds the OAuth token endpoint to a fake PayPal API
+func paypalRoutes(routes map[string]fakeRoute) map[string]fakeRoute {
+	routes["POST /v1/oauth2/token"] = respond(http.StatusOK, `{"access_token":"A21AAtoken","token_type":"Bearer","expires_in":32400}`)
+	return routes
+}
+
+func newTestPayPal(t *testing.T, fake *fakeGateway, manualCapture bool) *PayPal {
+	t.Helper()
+	paypal, err := NewPayPal(Config{
+		ClientID:      "client-id",
+		ClientSecret:  "client-secret",
+		WebhookID:     "WH-1",
+		BaseURL:       fake.URL,
+		ManualCapture: manualCapture,
+	})
+	if err != nil {
+		t.Fatalf("NewPayPal: %v", err)
+	}
+	return paypal
+}
+
+// decodeJSON reads a request's JSON body
+func decodeJSON(t *testing.T, req fakeRequest) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		t.Fatalf("request body %q: %v", req.Body, err)
+	}
+	return body
+}
+
+func TestPayPalAuthenticatesWithCachedToken(t *testing.T) {
+	fake := newFakeGateway(t, paypalRoutes(map[string]fakeRoute{
+		"GET /v2/checkout/orders/ORDER-1": respond(http.StatusOK, `{"id":"ORDER-1","status":"CREATED"}`),
+	}))
+	paypal := newTestPayPal(t, fake, false)
+	for i := 0; i < 2; i++ {
+		if _, err := paypal.Confirm(context.Background(), "ORDER-1"); err != nil {
+			t.Fatalf("Confirm: %v", err)
+		}
+	}
+
+	token := fake.only(t, http.MethodPost, "/v1/oauth2/token")
+	if user, pass, ok := (&http.Request{Header: token.Header}).BasicAuth(); !ok || user != "client-id" || pass != "client-secret" {
+		t.Errorf("token request basic auth = %q, %q", user, pass)
+	}
+	if token.Form().Get("grant_type") != "client_credentials" {
+		t.Errorf("grant_type = %q", token.Form().Get("grant_type"))
+	}
+	for _, req := range fake.received(http.MethodGet, "/v2/checkout/orders/ORDER-1") {
+		if got := req.Header.Get("Authorization"); got != "Bearer A21AAtoken" {
+			t.Errorf("Authorization = %q", got)
+		}
+	}
+}
+
+func TestPayPalCreateSession(t *testing.T) {
+	for _, manual := range []bool{false, true} {
+		t.Run(fmt.Sprintf("manual=%v", manual), func(t *testing.T) {
+			fake := newFakeGateway(t, paypalRoutes(map[string]fakeRoute{
+				"POST /v2/checkout/orders": respond(http.StatusCreated, `{"id":"ORDER-1","status":"CREATED","links":[{"href":"https://api.sandbox.paypal.com/v2/checkout/orders/ORDER-1","rel":"self"},{"href":"https://www.sandbox.paypal.com/checkoutnow?token=ORDER-1","rel":"approve"}]}`),
+			}))
+			session, err := newTestPayPal(t, fake, manual).CreateSession(context.Background(), SessionRequest{
+				PaymentID:   7,
+				OrderID:     42,
+				OrderNumber: "WEB-2024-000042",
+				Description: "Order WEB-2024-000042",
+				Amount:      money.MustParse("12.50"),
+				Currency:    usd,
+				ReturnURL:   "https://api.example.com/api/payments/7/return",
+				CancelURL:   "https://api.example.com/api/payments/7/return?cancelled=1",
+			})
+			if err != nil {
+				t.Fatalf("CreateSession: %v", err)
+			}
+			if session.Reference != "ORDER-1" || session.RedirectURL != "https://www.sandbox.paypal.com/checkoutnow?token=ORDER-1" {
+				t.Errorf("session = %+v", session)
+			}
+
+			req := fake.only(t, http.MethodPost, "/v2/checkout/orders")
+			if got := req.Header.Get("PayPal-Request-Id"); got != "payment-7" {
+				t.Errorf("PayPal-Request-Id = %q, want payment-7", got)
+			}
+			body := decodeJSON(t, req)
+			wantIntent := "CAPTURE"
+			if manual {
+				wantIntent = "AUTHORIZE"
+			}
+			if body["intent"] != wantIntent {
+				t.Errorf("intent = %v, want %s", body["intent"], wantIntent)
+			}
+			unit := body["purchase_units"].([]interface{})[0].(map[string]interface{})
+			amount := unit["amount"].(map[string]interface{})
+			if amount["value"] != "12.50" || amount["currency_code"] != "USD" || unit["invoice_id"] != "WEB-2024-000042-7" {
+				t.Errorf("purchase unit = %v", unit)
+			}
+		})
+	}
+}
+
+func TestPayPalCreateSessionWithoutApprovalLink(t *testing.T) {
+	fake := newFakeGateway(t, paypalRoutes(map[string]fakeRoute{
+		"POST /v2/checkout/orders": respond(http.StatusCreated, `{"id":"ORDER-1","status":"CREATED","links":[]}`),
+	}))
+	_, err := newTestPayPal(t, fake, false).CreateSession(context.Background(), SessionRequest{OrderID: 42, Amount: money.MustParse("1.00"), Currency: usd})
+	var gatewayErr *GatewayError
+	if !errors.As(err, &gatewayErr) {
+		t.Fatalf("CreateSession error = %v, want a GatewayError", err)
+	}
+}
+
+func TestPayPalConfirmCapturesApprovedOrder(t *testing.T) {
+	fake := newFakeGateway(t, paypalRoutes(map[string]fakeRoute{
+		"GET /v2/checkout/orders/ORDER-1":          respond(http.StatusOK, `{"id":"ORDER-1","intent":"CAPTURE","status":"APPROVED"}`),
+		"POST /v2/checkout/orders/ORDER-1/capture": respond(http.StatusCreated, `{"id":"ORDER-1","intent":"CAPTURE","status":"COMPLETED","purchase_units":[{"payments":{"captures":[{"id":"CAP-1","status":"COMPLETED","amount":{"currency_code":"USD","value":"12.50"}}]}}]}`),
+	}))
+	result, err := newTestPayPal(t, fake, false).Confirm(context.Background(), "ORDER-1")
+	if err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	if result.Status != models.PaymentStatusCaptured || result.TransactionID != "CAP-1" || result.Amount != money.MustParse("12.50") || result.Currency != "USD" {
+		t.Errorf("result = %+v", result)
+	}
+	if got := fake.only(t, http.MethodPost, "/v2/checkout/orders/ORDER-1/capture").Header.Get("PayPal-Request-Id"); got != "capture-ORDER-1" {
+		t.Errorf("PayPal-Request-Id = %q, want capture-ORDER-1", got)
+	}
+}
+
+func TestPayPalConfirmAuthorizesApprovedOrder(t *testing.T) {
+	fake := newFakeGateway(t, paypalRoutes(map[string]fakeRoute{
+		"GET /v2/checkout/orders/ORDER-1":            respond(http.StatusOK, `{"id":"ORDER-1","intent":"AUTHORIZE","status":"APPROVED"}`),
+		"POST /v2/checkout/orders/ORDER-1/authorize": respond(http.StatusCreated, `{"id":"ORDER-1","intent":"AUTHORIZE","status":"COMPLETED","purchase_units":[{"payments":{"authorizations":[{"id":"AUTH-1","status":"CREATED","amount":{"currency_code":"USD","value":"12.50"}}]}}]}`),
+	}))
+	result, err := newTestPayPal(t, fake, true).Confirm(context.Background(), "ORDER-1")
+	if err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	if result.Status != models.PaymentStatusAuthorized || result.TransactionID != "AUTH-1" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestPayPalConfirmOrderStates(t *testing.T) {
+	tests := []struct {
+		name       string
+		order      string
+		wantStatus string
+		wantTrans  string
+	}{
+		{"not approved yet", `{"id":"ORDER-1","status":"CREATED"}`, models.PaymentStatusPending, ""},
+		{"voided", `{"id":"ORDER-1","status":"VOIDED"}`, models.PaymentStatusCancelled, ""},
+		{
+			"authorization captured later",
+			`{"id":"ORDER-1","status":"COMPLETED","purchase_units":[{"payments":{"authorizations":[{"id":"AUTH-1","status":"CAPTURED","amount":{"currency_code":"USD","value":"12.50"}}],"captures":[{"id":"CAP-1","status":"COMPLETED","amount":{"currency_code":"USD","value":"10.00"}}]}}]}`,
+			models.PaymentStatusCaptured, "CAP-1",
+		},
+		{
+			"capture refunded",
+			`{"id":"ORDER-1","status":"COMPLETED","purchase_units":[{"payments":{"captures":[{"id":"CAP-1","status":"REFUNDED","amount":{"currency_code":"USD","value":"12.50"}}]}}]}`,
+			models.PaymentStatusRefunded, "CAP-1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeGateway(t, paypalRoutes(map[string]fakeRoute{
+				"GET /v2/checkout/orders/ORDER-1": respond(http.StatusOK, tt.order),
+			}))
+			result, err := newTestPayPal(t, fake, false).Confirm(context.Background(), "ORDER-1")
+			if err != nil {
+				t.Fatalf("Confirm: %v", err)
+			}
+			if result.Status != tt.wantStatus || result.TransactionID != tt.wantTrans {
+				t.Errorf("result = %+v, want status %s transaction %q", result, tt.wantStatus, tt.wantTrans)
+			}
+		})
+	}
+}
+
+func TestPayPalCapture(t *testing.T) {
+	fake := newFakeGateway(t, paypalRoutes(map[string]fakeRoute{
+		"POST /v2/payments/authorizations/AUTH-1/capture": respond(http.StatusCreated, `{"id":"CAP-1","status":"COMPLETED","amount":{"currency_code":"USD","value":"10.00"}}`),
+	}))
+	result, err := newTestPayPal(t, fake, true).Capture(context.Background(), CaptureRequest{
+		Reference: "ORDER-1", TransactionID: "AUTH-1", Amount: money.MustParse("10.00"), Currency: usd,
+	})
+	if err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	if result.Status != models.PaymentStatusCaptured || result.TransactionID != "CAP-1" || result.Amount != money.MustParse("10.00") {
+		t.Errorf("result = %+v", result)
+	}
+
+	body := decodeJSON(t, fake.only(t, http.MethodPost, "/v2/payments/authorizations/AUTH-1/capture"))
+	if body["final_capture"] != true || body["amount"].(map[string]interface{})["value"] != "10.00" {
+		t.Errorf("capture body = %v", body)
+	}
+}
+
+func TestPayPalVoid(t *testing.T) {
+	fake := newFakeGateway(t, paypalRoutes(map[string]fakeRoute{
+		"POST /v2/payments/authorizations/AUTH-1/void": respond(http.StatusNoContent, ""),
+	}))
+	result, err := newTestPayPal(t, fake, true).Void(context.Background(), VoidRequest{Reference: "ORDER-1", TransactionID: "AUTH-1"})
+	if err != nil {
+		t.Fatalf("Void: %v", err)
+	}
+	if result.Status != models.PaymentStatusVoided || result.TransactionID != "AUTH-1" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestPayPalRefund(t *testing.T) {
+	tests := []struct {
+		gatewayStatus string
+		want          string
+	}{
+		{"COMPLETED", RefundSucceeded},
+		{"PENDING", RefundPending},
+		{"FAILED", RefundFailed},
+		{"CANCELLED", RefundFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.gatewayStatus, func(t *testing.T) {
+			fake := newFakeGateway(t, paypalRoutes(map[string]fakeRoute{
+				"POST /v2/payments/captures/CAP-1/refund": respond(http.StatusCreated, `{"id":"REF-1","status":"`+tt.gatewayStatus+`"}`),
+			}))
+			result, err := newTestPayPal(t, fake, false).Refund(context.Background(), RefundRequest{
+				TransactionID: "CAP-1", Amount: money.MustParse("1500"), Currency: jpy, Reason: "Damaged",
+			})
+			if err != nil {
+				t.Fatalf("Refund: %v", err)
+			}
+			if result.ID != "REF-1" || result.Status != tt.want {
+				t.Errorf("result = %+v, want status %s", result, tt.want)
+			}
+
+			body := decodeJSON(t, fake.only(t, http.MethodPost, "/v2/payments/captures/CAP-1/refund"))
+			amount := body["amount"].(map[string]interface{})
+			// Zero-decimal currencies are sent without decimals
+			if amount["value"] != "1500" || amount["currency_code"] != "JPY" || body["note_to_payer"] != "Damaged" {
+				t.Errorf("refund body = %v", body)
+			}
+		})
+	}
+}
+
+func TestPayPalRefundError(t *testing.T) {
+	fake := newFakeGateway(t, paypalRoutes(map[string]fakeRoute{
+		"POST /v2/payments/captures/CAP-1/refund": respond(http.StatusUnprocessableEntity, `{"name":"UNPROCESSABLE_ENTITY","message":"The requested action could not be performed.","details":[{"issue":"REFUND_AMOUNT_EXCEEDED","description":"The refund amount must be less than or equal to the capture amount that has not yet been refunded."}]}`),
+	}))
+	_, err := newTestPayPal(t, fake, false).Refund(context.Background(), RefundRequest{TransactionID: "CAP-1", Amount: money.MustParse("99.00"), Currency: usd})
+	var gatewayErr *GatewayError
+	if !errors.As(err, &gatewayErr) {
+		t.Fatalf("Refund error = %v, want a GatewayError", err)
+	}
+	if gatewayErr.StatusCode != http.StatusUnprocessableEntity || gatewayErr.Message != "The refund amount must be less than or equal to the capture amount that has not yet been refunded." {
+		t.Errorf("GatewayError = %+v", gatewayErr)
+	}
+}
+
+func TestPayPalParseWebhook(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus string
+		wantRef    string
+		wantTrans  string
+		wantRefund string
+		wantAmount string
+	}{
+		{
+			name:       "order approved",
+			body:       `{"id":"WH-EVT-1","event_type":"CHECKOUT.ORDER.APPROVED","resource":{"id":"ORDER-1","status":"APPROVED"}}`,
+			wantStatus: models.PaymentStatusPending,
+			wantRef:    "ORDER-1",
+		},
+		{
+			name:       "capture completed",
+			body:       `{"id":"WH-EVT-2","event_type":"PAYMENT.CAPTURE.COMPLETED","resource":{"id":"CAP-1","status":"COMPLETED","amount":{"currency_code":"USD","value":"12.50"},"supplementary_data":{"related_ids":{"order_id":"ORDER-1"}}}}`,
+			wantStatus: models.PaymentStatusCaptured,
+			wantRef:    "ORDER-1",
+			wantTrans:  "CAP-1",
+			wantAmount: "12.50",
+		},
+		{
+			name:       "capture denied",
+			body:       `{"id":"WH-EVT-3","event_type":"PAYMENT.CAPTURE.DENIED","resource":{"id":"CAP-1","status":"DECLINED","amount":{"currency_code":"USD","value":"12.50"}}}`,
+			wantStatus: models.PaymentStatusFailed,
+			wantTrans:  "CAP-1",
+			wantAmount: "12.50",
+		},
+		{
+			name:       "partial refund",
+			body:       `{"id":"WH-EVT-4","event_type":"PAYMENT.CAPTURE.REFUNDED","resource":{"id":"REF-1","status":"COMPLETED","amount":{"currency_code":"USD","value":"2.50"},"links":[{"href":"https://api.paypal.com/v2/payments/refunds/REF-1","rel":"self"},{"href":"https://api.paypal.com/v2/payments/captures/CAP-1","rel":"up"}]}}`,
+			wantStatus: models.PaymentStatusRefunded,
+			wantTrans:  "CAP-1",
+			wantRefund: "REF-1",
+			wantAmount: "2.50",
+		},
+		{
+			name:       "authorization voided",
+			body:       `{"id":"WH-EVT-5","event_type":"PAYMENT.AUTHORIZATION.VOIDED","resource":{"id":"AUTH-1","status":"VOIDED","amount":{"currency_code":"USD","value":"12.50"}}}`,
+			wantStatus: models.PaymentStatusVoided,
+			wantTrans:  "AUTH-1",
+			wantAmount: "12.50",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeGateway(t, paypalRoutes(map[string]fakeRoute{
+				"POST /v1/notifications/verify-webhook-signature": respond(http.StatusOK, `{"verification_status":"SUCCESS"}`),
+			}))
+			header := http.Header{
+				"Paypal-Transmission-Id":   {"tx-1"},
+				"Paypal-Transmission-Sig":  {"sig"},
+				"Paypal-Transmission-Time": {"2024-01-01T00:00:00Z"},
+				"Paypal-Auth-Algo":         {"SHA256withRSA"},
+				"Paypal-Cert-Url":          {"https://api.paypal.com/v1/notifications/certs/CERT-1"},
+			}
+			event, err := newTestPayPal(t, fake, false).ParseWebhook(context.Background(), header, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("ParseWebhook: %v", err)
+			}
+			if event.Status != tt.wantStatus || event.Reference != tt.wantRef || event.TransactionID != tt.wantTrans || event.RefundID != tt.wantRefund {
+				t.Errorf("event = %+v, want status %q reference %q transaction %q refund %q", event, tt.wantStatus, tt.wantRef, tt.wantTrans, tt.wantRefund)
+			}
+			if tt.wantAmount != "" && event.Amount.String() != tt.wantAmount {
+				t.Errorf("Amount = %s, want %s", event.Amount, tt.wantAmount)
+			}
+
+			verification := decodeJSON(t, fake.only(t, http.MethodPost, "/v1/notifications/verify-webhook-signature"))
+			if verification["webhook_id"] != "WH-1" || verification["transmission_id"] != "tx-1" || verification["webhook_event"] == nil {
+				t.Errorf("verification request = %v", verification)
+			}
+		})
+	}
+}
+
+func TestPayPalParseWebhookRejectsUnverified(t *testing.T) {
+	fake := newFakeGateway(t, paypalRoutes(map[string]fakeRoute{
+		"POST /v1/notifications/verify-webhook-signature": respond(http.StatusOK, `{"verification_status":"FAILURE"}`),
+	}))
+	body := []byte(`{"id":"WH-EVT-1","event_type":"PAYMENT.CAPTURE.COMPLETED","resource":{"id":"CAP-1"}}`)
+	if _, err := newTestPayPal(t, fake, false).ParseWebhook(context.Background(), http.Header{}, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("ParseWebhook error = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestPayPalParseWebhookNeedsWebhookID(t *testing.T) {
+	paypal, err := NewPayPal(Config{ClientID: "client-id", ClientSecret: "client-secret"})
+	if err != nil {
+		t.Fatalf("NewPayPal: %v", err)
+	}
+	if _, err := paypal.ParseWebhook(context.Background(), http.Header{}, []byte(`{}`)); !errors.Is(err, ErrNotConfigured) {
+		t.Fatalf("ParseWebhook without a webhook ID error = %v, want ErrNotConfigured", err)
+	}
+}
@@ -0,0 +1,56 @@
+package payments
+
+import (
+	"ecom-backend/database"
+)
+
+// Capture modes, set per gateway with payment_gateway_<name>_capture_mode
+const (
+	CaptureAutomatic = "automatic" // Collect the payment at checkout
+	CaptureManual    = "manual"    // Authorize at checkout and capture when the order ships
+)
+
+// Load returns the provider for a gateway, configured from its payment_gateway_<name>_*
+// settings. Gateways switched off in the admin are reported as not configured.
+func Load(gateway string) (Provider, error) {
+	if !IsGateway(gateway) {
+		return nil, ErrUnknownGateway
+	}
+	if !Active(gateway) {
+		return nil, ErrNotConfigured
+	}
+
+	setting := func(name string) string {
+		return database.GetSetting("payment_gateway_"+gateway+"_"+name, "")
+	}
+	return New(gateway, Config{
+		TestMode:      setting("test_mode") == "true",
+		ManualCapture: setting("capture_mode") == CaptureManual,
+		SecretKey:     setting("secret_key"),
+		WebhookSecret: setting("webhook_secret"),
+		StoreID:       setting("store_id"),
+		StorePassword: setting("store_password"),
+		ClientID:      setting("client_id"),
+		ClientSecret:  setting("client_secret"),
+		WebhookID:     setting("webhook_id"),
+	})
+}
+
+// Active reports whether a gateway is switched on in the admin
+func Active(gateway string) bool {
+	return database.GetSetting("payment_gateway_"+gateway+"_active", "") == "true"
+}
+
+// DefaultGateway returns the gateway checkout uses: payment_gateway_default when it is
+// active, otherwise the first active gateway, or "" when none is
+func DefaultGateway() string {
+	if gateway := database.GetSetting("payment_gateway_default", ""); IsGateway(gateway) && Active(gateway) {
+		return gateway
+	}
+	for _, gateway := range Gateways {
+		if Active(gateway) {
+			return gateway
+		}
+	}
+	return ""
+}
@@ -0,0 +1,290 @@
+package payments
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ecom-backend/models"
+	"ecom-backend/money"
+)
+
+const (
+	sslcommerzLiveURL    = "https://securepay.sslcommerz.com"
+	sslcommerzSandboxURL = "https://sandbox.sslcommerz.com"
+)
+
+// SSLCommerz takes payments through the SSLCommerz hosted payment page. Payments are
+// captured as soon as the customer pays; there is no separate capture step.
+type SSLCommerz struct {
+	api           apiClient
+	storeID       string
+	storePassword string
+}
+
+// NewSSLCommerz returns an SSLCommerz adapter
+func NewSSLCommerz(cfg Config) (*SSLCommerz, error) {
+	if cfg.StoreID == "" || cfg.StorePassword == "" {
+		return nil, ErrNotConfigured
+	}
+	return &SSLCommerz{
+		api:           newAPIClient(GatewaySSLCommerz, cfg, sslcommerzLiveURL, sslcommerzSandboxURL),
+		storeID:       cfg.StoreID,
+		storePassword: cfg.StorePassword,
+	}, nil
+}
+
+// Name implements Provider
+func (s *SSLCommerz) Name() string {
+	return GatewaySSLCommerz
+}
+
+// sslcommerzTransaction is one entry of a validation API response
+type sslcommerzTransaction struct {
+	Status     string `json:"status"` // VALID, VALIDATED, PENDING, FAILED, CANCELLED, UNATTEMPTED, EXPIRED
+	TranID     string `json:"tran_id"`
+	ValID      string `json:"val_id"`
+	BankTranID string `json:"bank_tran_id"`
+	Amount     string `json:"amount"`
+	Currency   string `json:"currency"`
+}
+
+// CreateSession implements Provider by opening a gateway session. The session's reference
+// is our transaction ID, which SSLCommerz echoes back in callbacks.
+func (s *SSLCommerz) CreateSession(ctx context.Context, req SessionRequest) (*Session, error) {
+	orderRef := req.OrderNumber
+	if orderRef == "" {
+		orderRef = strconv.FormatUint(uint64(req.OrderID), 10)
+	}
+	tranID := fmt.Sprintf("%s-%d", orderRef, req.PaymentID)
+
+	values := url.Values{
+		"store_id":         {s.storeID},
+		"store_passwd":     {s.storePassword},
+		"total_amount":     {req.Amount.String()},
+		"currency":         {req.Currency.Code},
+		"tran_id":          {tranID},
+		"success_url":      {req.ReturnURL},
+		"fail_url":         {req.ReturnURL},
+		"cancel_url":       {req.CancelURL},
+		"cus_name":         {orNA(req.Customer.Name)},
+		"cus_email":        {orNA(req.Customer.Email)},
+		"cus_phone":        {orNA(req.Customer.Phone)},
+		"cus_add1":         {orNA(req.Customer.Address)},
+		"cus_city":         {orNA(req.Customer.City)},
+		"cus_postcode":     {orNA(req.Customer.PostalCode)},
+		"cus_country":      {orNA(req.Customer.Country)},
+		"shipping_method":  {"NO"},
+		"num_of_item":      {"1"},
+		"product_name":     {req.Description},
+		"product_category": {"General"},
+		"product_profile":  {"general"},
+		"value_a":          {strconv.FormatUint(uint64(req.OrderID), 10)},
+		"value_b":          {strconv.FormatUint(uint64(req.PaymentID), 10)},
+	}
+	if req.NotifyURL != "" {
+		values.Set("ipn_url", req.NotifyURL)
+	}
+
+	var resp struct {
+		Status         string `json:"status"`
+		FailedReason   string `json:"failedreason"`
+		GatewayPageURL string `json:"GatewayPageURL"`
+	}
+	if err := s.api.do(ctx, http.MethodPost, "/gwprocess/v4/api.php", form(values), "application/x-www-form-urlencoded", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Status != "SUCCESS" || resp.GatewayPageURL == "" {
+		return nil, &GatewayError{Gateway: GatewaySSLCommerz, Message: orDefault(resp.FailedReason, "session was not created")}
+	}
+	return &Session{Reference: tranID, RedirectURL: resp.GatewayPageURL}, nil
+}
+
+// Confirm implements Provider with the transaction query API
+func (s *SSLCommerz) Confirm(ctx context.Context, reference string) (*Result, error) {
+	query := url.Values{
+		"tran_id":      {reference},
+		"store_id":     {s.storeID},
+		"store_passwd": {s.storePassword},
+		"format":       {"json"},
+	}
+	var resp struct {
+		APIConnect string                  `json:"APIConnect"`
+		Element    []sslcommerzTransaction `json:"element"`
+	}
+	raw := withRaw(&resp)
+	if err := s.api.do(ctx, http.MethodGet, "/validator/api/merchantTransIDvalidationAPI.php?"+query.Encode(), nil, "", nil, nil, raw); err != nil {
+		return nil, err
+	}
+	if resp.APIConnect != "DONE" {
+		return nil, &GatewayError{Gateway: GatewaySSLCommerz, Message: "transaction query failed: " + resp.APIConnect}
+	}
+
+	result := &Result{Reference: reference, Status: models.PaymentStatusPending, Raw: raw.String()}
+	// A transaction ID can have several attempts; a successful one settles it, otherwise the
+	// last one listed is reported
+	for _, txn := range resp.Element {
+		result.Status, result.TransactionID = sslcommerzStatus(txn.Status), txn.BankTranID
+		result.Amount, _ = money.Parse(txn.Amount)
+		result.Currency = txn.Currency
+		if result.Status == models.PaymentStatusCaptured {
+			break
+		}
+	}
+	return result, nil
+}
+
+// Capture implements Provider; SSLCommerz payments are captured when made
+func (s *SSLCommerz) Capture(ctx context.Context, req CaptureRequest) (*Result, error) {
+	return nil, ErrNotSupported
+}
+
+// Void implements Provider; SSLCommerz payments are captured when made, so there is nothing to void
+func (s *SSLCommerz) Void(ctx context.Context, req VoidRequest) (*Result, error) {
+	return nil, ErrNotSupported
+}
+
+// Refund implements Provider with the refund API, keyed by the bank transaction ID
+func (s *SSLCommerz) Refund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	query := url.Values{
+		"bank_tran_id":   {req.TransactionID},
+		"refund_amount":  {req.Amount.String()},
+		"refund_remarks": {orDefault(req.Reason, "Refund")},
+		"refe_id":        {req.Reference},
+		"store_id":       {s.storeID},
+		"store_passwd":   {s.storePassword},
+		"format":         {"json"},
+	}
+	var resp struct {
+		APIConnect  string `json:"APIConnect"`
+		Status      string `json:"status"` // success, processing, failed
+		RefundRefID string `json:"refund_ref_id"`
+		ErrorReason string `json:"errorReason"`
+	}
+	raw := withRaw(&resp)
+	if err := s.api.do(ctx, http.MethodGet, "/validator/api/merchantTransIDvalidationAPI.php?"+query.Encode(), nil, "", nil, nil, raw); err != nil {
+		return nil, err
+	}
+	if resp.APIConnect != "DONE" || resp.Status == "failed" {
+		return nil, &GatewayError{Gateway: GatewaySSLCommerz, Message: orDefault(resp.ErrorReason, "refund was not accepted")}
+	}
+
+	status := RefundPending
+	if resp.Status == "success" {
+		status = RefundSucceeded
+	}
+	return &RefundResult{ID: resp.RefundRefID, Status: status}, nil
+}
+
+// ParseWebhook implements Provider for IPN callbacks. The form's verify_sign is checked
+// against the store password, and successful payments are re-validated with the validation
+// API so a forged IPN can't mark an order paid.
+func (s *SSLCommerz) ParseWebhook(ctx context.Context, header http.Header, body []byte) (*Event, error) {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid sslcommerz notification: %w", err)
+	}
+	if !s.validSignature(values) {
+		return nil, ErrInvalidSignature
+	}
+
+	event := &Event{
+		ID:            values.Get("val_id"),
+		Type:          values.Get("status"),
+		Reference:     values.Get("tran_id"),
+		TransactionID: values.Get("bank_tran_id"),
+		Status:        sslcommerzStatus(values.Get("status")),
+		Currency:      values.Get("currency"),
+	}
+	event.Amount, _ = money.Parse(values.Get("amount"))
+	if event.ID == "" {
+		event.ID = event.Reference + ":" + event.Type
+	}
+
+	if event.Status == models.PaymentStatusCaptured {
+		txn, err := s.validate(ctx, values.Get("val_id"))
+		if err != nil {
+			return nil, err
+		}
+		if txn.TranID != event.Reference || sslcommerzStatus(txn.Status) != models.PaymentStatusCaptured {
+			return nil, ErrInvalidSignature
+		}
+		event.TransactionID, event.Currency = txn.BankTranID, txn.Currency
+		event.Amount, _ = money.Parse(txn.Amount)
+	}
+	return event, nil
+}
+
+// validate looks up a payment by its validation ID
+func (s *SSLCommerz) validate(ctx context.Context, valID string) (*sslcommerzTransaction, error) {
+	query := url.Values{
+		"val_id":       {valID},
+		"store_id":     {s.storeID},
+		"store_passwd": {s.storePassword},
+		"format":       {"json"},
+	}
+	var txn sslcommerzTransaction
+	if err := s.api.do(ctx, http.MethodGet, "/validator/api/validationserverAPI.php?"+query.Encode(), nil, "", nil, nil, &txn); err != nil {
+		return nil, err
+	}
+	return &txn, nil
+}
+
+// validSignature checks an IPN's verify_sign: the MD5 of the fields named in verify_key plus
+// the MD5 of the store password, sorted by name and joined as a query string
+func (s *SSLCommerz) validSignature(values url.Values) bool {
+	sign, keys := values.Get("verify_sign"), values.Get("verify_key")
+	if sign == "" || keys == "" {
+		return false
+	}
+
+	passwordHash := md5.Sum([]byte(s.storePassword))
+	fields := map[string]string{"store_passwd": hex.EncodeToString(passwordHash[:])}
+	for _, key := range strings.Split(keys, ",") {
+		fields[key] = values.Get(key)
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + "=" + fields[name]
+	}
+	expected := md5.Sum([]byte(strings.Join(parts, "&")))
+	return strings.EqualFold(hex.EncodeToString(expected[:]), sign)
+}
+
+// sslcommerzStatus maps an SSLCommerz transaction status onto a payment status
+func sslcommerzStatus(status string) string {
+	switch strings.ToUpper(status) {
+	case "VALID", "VALIDATED":
+		return models.PaymentStatusCaptured
+	case "FAILED":
+		return models.PaymentStatusFailed
+	case "CANCELLED", "EXPIRED", "UNATTEMPTED":
+		return models.PaymentStatusCancelled
+	}
+	return models.PaymentStatusPending
+}
+
+// orNA fills a field SSLCommerz requires but we may not know
+func orNA(s string) string {
+	return orDefault(s, "N/A")
+}
+
+// orDefault returns s, or fallback when s is empty
+func orDefault(s, fallback string) string {
+	if strings.TrimSpace(s) == "" {
+		return fallback
+	}
+	return s
+}
@@ -0,0 +1,336 @@
+package payments
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"ecom-backend/models"
+	"ecom-backend/money"
+)
+
+const testSSLCommerzPassword = "store@ssl"
+
+func newTestSSLCommerz(t *testing.T, fake *fakeGateway) *SSLCommerz {
+	t.Helper()
+	gateway, err := NewSSLCommerz(Config{StoreID: "teststore", StorePassword: testSSLCommerzPassword, BaseURL: fake.URL})
+	if err != nil {
+		t.Fatalf("NewSSLCommerz: %v", err)
+	}
+	return gateway
+}
+
+// signIPN adds verify_key and verify_sign to an IPN the way SSLCommerz does
+func signIPN(values url.Values, password string) url.Values {
+	signed := url.Values{}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		signed.Set(key, values.Get(key))
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	signed.Set("verify_key", strings.Join(keys, ","))
+
+	passwordHash := md5.Sum([]byte(password))
+	parts := []string{}
+	for _, key := range append(keys, "store_passwd") {
+		value := values.Get(key)
+		if key == "store_passwd" {
+			value = hex.EncodeToString(passwordHash[:])
+		}
+		parts = append(parts, key+"="+value)
+	}
+	sort.Strings(parts)
+	sign := md5.Sum([]byte(strings.Join(parts, "&")))
+	signed.Set("verify_sign", hex.EncodeToString(sign[:]))
+	return signed
+}
+
+// validIPN is a signed notification for a successful payment
+func validIPN() url.Values {
+	return signIPN(url.Values{
+		"status":       {"VALID"},
+		"tran_id":      {"WEB-2024-000042-7"},
+		"val_id":       {"val_1"},
+		"bank_tran_id": {"bank_1"},
+		"amount":       {"1250.00"},
+		"currency":     {"BDT"},
+	}, testSSLCommerzPassword)
+}
+
+func TestSSLCommerzCreateSession(t *testing.T) {
+	fake := newFakeGateway(t, map[string]fakeRoute{
+		"POST /gwprocess/v4/api.php": respond(http.StatusOK, `{"status":"SUCCESS","GatewayPageURL":"https://sandbox.sslcommerz.com/pay/abc"}`),
+	})
+	session, err := newTestSSLCommerz(t, fake).CreateSession(context.Background(), SessionRequest{
+		PaymentID:   7,
+		OrderID:     42,
+		OrderNumber: "WEB-2024-000042",
+		Description: "Order WEB-2024-000042",
+		Amount:      money.MustParse("1250.00"),
+		Currency:    money.DefaultCurrency,
+		Customer:    Customer{Name: "Rahim", Email: "rahim@example.com"},
+		ReturnURL:   "https://api.example.com/api/payments/7/return",
+		CancelURL:   "https://api.example.com/api/payments/7/return?cancelled=1",
+		NotifyURL:   "https://api.example.com/api/webhooks/payments/sslcommerz",
+	})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if session.Reference != "WEB-2024-000042-7" || session.RedirectURL != "https://sandbox.sslcommerz.com/pay/abc" {
+		t.Errorf("session = %+v", session)
+	}
+
+	form := fake.only(t, http.MethodPost, "/gwprocess/v4/api.php").Form()
+	for field, want := range map[string]string{
+		"store_id":     "teststore",
+		"store_passwd": testSSLCommerzPassword,
+		"total_amount": "1250.00",
+		"currency":     "BDT",
+		"tran_id":      "WEB-2024-000042-7",
+		"cus_name":     "Rahim",
+		"cus_phone":    "N/A",
+		"ipn_url":      "https://api.example.com/api/webhooks/payments/sslcommerz",
+		"value_a":      "42",
+		"value_b":      "7",
+	} {
+		if got := form.Get(field); got != want {
+			t.Errorf("%s = %q, want %q", field, got, want)
+		}
+	}
+}
+
+func TestSSLCommerzCreateSessionFailure(t *testing.T) {
+	fake := newFakeGateway(t, map[string]fakeRoute{
+		"POST /gwprocess/v4/api.php": respond(http.StatusOK, `{"status":"FAILED","failedreason":"Store Credential Error Or Store is De-active"}`),
+	})
+	_, err := newTestSSLCommerz(t, fake).CreateSession(context.Background(), SessionRequest{OrderID: 42, Amount: money.MustParse("10.00"), Currency: money.DefaultCurrency})
+	var gatewayErr *GatewayError
+	if !errors.As(err, &gatewayErr) || gatewayErr.Message != "Store Credential Error Or Store is De-active" {
+		t.Fatalf("CreateSession error = %v, want the gateway's reason", err)
+	}
+}
+
+func TestSSLCommerzConfirm(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   string
+		wantStatus string
+		wantTrans  string
+	}{
+		{
+			name:       "a later attempt succeeded",
+			response:   `{"APIConnect":"DONE","element":[{"status":"FAILED","tran_id":"T1","bank_tran_id":"bank_0","amount":"1250.00","currency":"BDT"},{"status":"VALID","tran_id":"T1","bank_tran_id":"bank_1","amount":"1250.00","currency":"BDT"}]}`,
+			wantStatus: models.PaymentStatusCaptured,
+			wantTrans:  "bank_1",
+		},
+		{
+			name:       "success is not overridden by a later attempt",
+			response:   `{"APIConnect":"DONE","element":[{"status":"VALIDATED","tran_id":"T1","bank_tran_id":"bank_1","amount":"1250.00","currency":"BDT"},{"status":"FAILED","tran_id":"T1","bank_tran_id":"bank_2","amount":"1250.00","currency":"BDT"}]}`,
+			wantStatus: models.PaymentStatusCaptured,
+			wantTrans:  "bank_1",
+		},
+		{
+			name:       "cancelled",
+			response:   `{"APIConnect":"DONE","element":[{"status":"CANCELLED","tran_id":"T1","amount":"1250.00","currency":"BDT"}]}`,
+			wantStatus: models.PaymentStatusCancelled,
+		},
+		{
+			name:       "no attempts yet",
+			response:   `{"APIConnect":"DONE","element":[]}`,
+			wantStatus: models.PaymentStatusPending,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeGateway(t, map[string]fakeRoute{
+				"GET /validator/api/merchantTransIDvalidationAPI.php": respond(http.StatusOK, tt.response),
+			})
+			result, err := newTestSSLCommerz(t, fake).Confirm(context.Background(), "T1")
+			if err != nil {
+				t.Fatalf("Confirm: %v", err)
+			}
+			if result.Status != tt.wantStatus || result.TransactionID != tt.wantTrans || result.Reference != "T1" {
+				t.Errorf("result = %+v, want status %s transaction %q", result, tt.wantStatus, tt.wantTrans)
+			}
+			query := fake.only(t, http.MethodGet, "/validator/api/merchantTransIDvalidationAPI.php").Query
+			if query.Get("tran_id") != "T1" || query.Get("store_id") != "teststore" {
+				t.Errorf("query = %v", query)
+			}
+		})
+	}
+}
+
+func TestSSLCommerzConfirmAPIFailure(t *testing.T) {
+	fake := newFakeGateway(t, map[string]fakeRoute{
+		"GET /validator/api/merchantTransIDvalidationAPI.php": respond(http.StatusOK, `{"APIConnect":"INVALID_REQUEST"}`),
+	})
+	var gatewayErr *GatewayError
+	if _, err := newTestSSLCommerz(t, fake).Confirm(context.Background(), "T1"); !errors.As(err, &gatewayErr) {
+		t.Fatalf("Confirm error = %v, want a GatewayError", err)
+	}
+}
+
+func TestSSLCommerzCaptureAndVoidNotSupported(t *testing.T) {
+	gateway := newTestSSLCommerz(t, newFakeGateway(t, nil))
+	if _, err := gateway.Capture(context.Background(), CaptureRequest{TransactionID: "bank_1"}); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Capture error = %v, want ErrNotSupported", err)
+	}
+	if _, err := gateway.Void(context.Background(), VoidRequest{TransactionID: "bank_1"}); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Void error = %v, want ErrNotSupported", err)
+	}
+}
+
+func TestSSLCommerzRefund(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   string
+		wantStatus string
+		wantErr    bool
+	}{
+		{"accepted", `{"APIConnect":"DONE","status":"success","refund_ref_id":"ref_1"}`, RefundSucceeded, false},
+		{"processing", `{"APIConnect":"DONE","status":"processing","refund_ref_id":"ref_1"}`, RefundPending, false},
+		{"declined", `{"APIConnect":"DONE","status":"failed","errorReason":"Refund amount exceeds"}`, "", true},
+		{"api failure", `{"APIConnect":"INVALID_REQUEST"}`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeGateway(t, map[string]fakeRoute{
+				"GET /validator/api/merchantTransIDvalidationAPI.php": respond(http.StatusOK, tt.response),
+			})
+			result, err := newTestSSLCommerz(t, fake).Refund(context.Background(), RefundRequest{
+				Reference: "T1", TransactionID: "bank_1", Amount: money.MustParse("500.00"), Currency: money.DefaultCurrency,
+			})
+			if tt.wantErr {
+				var gatewayErr *GatewayError
+				if !errors.As(err, &gatewayErr) {
+					t.Fatalf("Refund error = %v, want a GatewayError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Refund: %v", err)
+			}
+			if result.ID != "ref_1" || result.Status != tt.wantStatus {
+				t.Errorf("result = %+v, want status %s", result, tt.wantStatus)
+			}
+
+			query := fake.only(t, http.MethodGet, "/validator/api/merchantTransIDvalidationAPI.php").Query
+			if query.Get("bank_tran_id") != "bank_1" || query.Get("refund_amount") != "500.00" || query.Get("refund_remarks") != "Refund" {
+				t.Errorf("query = %v", query)
+			}
+		})
+	}
+}
+
+func TestSSLCommerzParseWebhookRevalidatesPayments(t *testing.T) {
+	fake := newFakeGateway(t, map[string]fakeRoute{
+		// The validation API is the source of truth for the amount
+		"GET /validator/api/validationserverAPI.php": respond(http.StatusOK, `{"status":"VALID","tran_id":"WEB-2024-000042-7","val_id":"val_1","bank_tran_id":"bank_9","amount":"1200.00","currency":"BDT"}`),
+	})
+	event, err := newTestSSLCommerz(t, fake).ParseWebhook(context.Background(), http.Header{}, []byte(validIPN().Encode()))
+	if err != nil {
+		t.Fatalf("ParseWebhook: %v", err)
+	}
+	if event.Status != models.PaymentStatusCaptured || event.Reference != "WEB-2024-000042-7" || event.ID != "val_1" {
+		t.Errorf("event = %+v", event)
+	}
+	if event.TransactionID != "bank_9" || event.Amount != money.MustParse("1200.00") {
+		t.Errorf("event took the IPN's values over the validation API's: %+v", event)
+	}
+	if got := fake.only(t, http.MethodGet, "/validator/api/validationserverAPI.php").Query.Get("val_id"); got != "val_1" {
+		t.Errorf("validated val_id = %q, want val_1", got)
+	}
+}
+
+func TestSSLCommerzParseWebhookRejectsForgedIPN(t *testing.T) {
+	tests := []struct {
+		name       string
+		validation string
+	}{
+		{"unknown validation ID", `{"status":"INVALID_TRANSACTION"}`},
+		{"validation ID of another transaction", `{"status":"VALID","tran_id":"WEB-2024-000001-1","val_id":"val_1","amount":"1250.00","currency":"BDT"}`},
+		{"payment not successful", `{"status":"FAILED","tran_id":"WEB-2024-000042-7","val_id":"val_1","amount":"1250.00","currency":"BDT"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeGateway(t, map[string]fakeRoute{
+				"GET /validator/api/validationserverAPI.php": respond(http.StatusOK, tt.validation),
+			})
+			_, err := newTestSSLCommerz(t, fake).ParseWebhook(context.Background(), http.Header{}, []byte(validIPN().Encode()))
+			if !errors.Is(err, ErrInvalidSignature) {
+				t.Fatalf("ParseWebhook error = %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
+
+func TestSSLCommerzParseWebhookRejectsBadSignature(t *testing.T) {
+	fake := newFakeGateway(t, nil)
+	ipn := validIPN()
+	ipn.Set("amount", "1.00")
+
+	if _, err := newTestSSLCommerz(t, fake).ParseWebhook(context.Background(), http.Header{}, []byte(ipn.Encode())); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("ParseWebhook error = %v, want ErrInvalidSignature", err)
+	}
+	if len(fake.received(http.MethodGet, "/validator/api/validationserverAPI.php")) != 0 {
+		t.Error("a badly signed IPN was sent to the validation API")
+	}
+}
+
+func TestSSLCommerzParseWebhookFailedPayment(t *testing.T) {
+	fake := newFakeGateway(t, nil)
+	ipn := signIPN(url.Values{
+		"status":  {"FAILED"},
+		"tran_id": {"WEB-2024-000042-7"},
+		"amount":  {"1250.00"},
+	}, testSSLCommerzPassword)
+
+	event, err := newTestSSLCommerz(t, fake).ParseWebhook(context.Background(), http.Header{}, []byte(ipn.Encode()))
+	if err != nil {
+		t.Fatalf("ParseWebhook: %v", err)
+	}
+	if event.Status != models.PaymentStatusFailed || event.ID != "WEB-2024-000042-7:FAILED" {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+func TestSSLCommerzValidSignature(t *testing.T) {
+	gateway := newTestSSLCommerz(t, newFakeGateway(t, nil))
+
+	tampered := validIPN()
+	tampered.Set("tran_id", "WEB-2024-000001-1")
+	unsigned := validIPN()
+	unsigned.Del("verify_sign")
+	noKeys := validIPN()
+	noKeys.Del("verify_key")
+	upper := validIPN()
+	upper.Set("verify_sign", strings.ToUpper(upper.Get("verify_sign")))
+
+	tests := []struct {
+		name   string
+		values url.Values
+		want   bool
+	}{
+		{"valid", validIPN(), true},
+		{"hex case doesn't matter", upper, true},
+		{"tampered field", tampered, false},
+		{"signed with another store's password", signIPN(url.Values{"status": {"VALID"}, "tran_id": {"T1"}}, "other"), false},
+		{"missing verify_sign", unsigned, false},
+		{"missing verify_key", noKeys, false},
+		{"empty", url.Values{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gateway.validSignature(tt.values); got != tt.want {
+				t.Errorf("validSignature = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
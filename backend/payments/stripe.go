@@ -0,0 +1,370 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"ecom-backend/models"
+	"ecom-backend/money"
+)
+
+// stripeAPIURL serves both live and test mode; the secret key decides which
+const stripeAPIURL = "https://api.stripe.com"
+
+// stripeWebhookTolerance is how old a signed webhook may be before it is treated as a replay
+const stripeWebhookTolerance = 5 * time.Minute
+
+// Stripe takes payments through Stripe Checkout
+type Stripe struct {
+	api           apiClient
+	secretKey     string
+	webhookSecret string
+	manualCapture bool
+}
+
+// NewStripe returns a Stripe adapter
+func NewStripe(cfg Config) (*Stripe, error) {
+	if cfg.SecretKey == "" {
+		return nil, ErrNotConfigured
+	}
+	return &Stripe{
+		api:           newAPIClient(GatewayStripe, cfg, stripeAPIURL, stripeAPIURL),
+		secretKey:     cfg.SecretKey,
+		webhookSecret: cfg.WebhookSecret,
+		manualCapture: cfg.ManualCapture,
+	}, nil
+}
+
+// Name implements Provider
+func (s *Stripe) Name() string {
+	return GatewayStripe
+}
+
+// stripeSession is the part of a Checkout Session we read
+type stripeSession struct {
+	ID            string          `json:"id"`
+	URL           string          `json:"url"`
+	Status        string          `json:"status"`         // open, complete, expired
+	PaymentStatus string          `json:"payment_status"` // paid, unpaid, no_payment_required
+	AmountTotal   int64           `json:"amount_total"`
+	Currency      string          `json:"currency"`
+	PaymentIntent json.RawMessage `json:"payment_intent"` // ID, or the object when expanded
+}
+
+// stripePaymentIntent is the part of a PaymentIntent we read
+type stripePaymentIntent struct {
+	ID             string `json:"id"`
+	Status         string `json:"status"`
+	Amount         int64  `json:"amount"`
+	AmountReceived int64  `json:"amount_received"`
+	Currency       string `json:"currency"`
+}
+
+// CreateSession implements Provider by creating a Checkout Session
+func (s *Stripe) CreateSession(ctx context.Context, req SessionRequest) (*Session, error) {
+	orderID := strconv.FormatUint(uint64(req.OrderID), 10)
+	values := url.Values{
+		"mode":                                   {"payment"},
+		"success_url":                            {req.ReturnURL},
+		"cancel_url":                             {req.CancelURL},
+		"client_reference_id":                    {orderID},
+		"line_items[0][quantity]":                {"1"},
+		"line_items[0][price_data][currency]":    {strings.ToLower(req.Currency.Code)},
+		"line_items[0][price_data][unit_amount]": {strconv.FormatInt(minorUnits(req.Amount, req.Currency), 10)},
+		"line_items[0][price_data][product_data][name]": {req.Description},
+		"metadata[order_id]":                            {orderID},
+		"metadata[payment_id]":                          {strconv.FormatUint(uint64(req.PaymentID), 10)},
+		"payment_intent_data[metadata][order_id]":       {orderID},
+	}
+	if req.Customer.Email != "" {
+		values.Set("customer_email", req.Customer.Email)
+	}
+	if s.manualCapture {
+		values.Set("payment_intent_data[capture_method]", "manual")
+	}
+
+	var session stripeSession
+	if err := s.call(ctx, http.MethodPost, "/v1/checkout/sessions", values, &session); err != nil {
+		return nil, err
+	}
+	return &Session{Reference: session.ID, RedirectURL: session.URL}, nil
+}
+
+// Confirm implements Provider by reading the Checkout Session and its PaymentIntent
+func (s *Stripe) Confirm(ctx context.Context, reference string) (*Result, error) {
+	var session stripeSession
+	raw := withRaw(&session)
+	path := "/v1/checkout/sessions/" + url.PathEscape(reference) + "?expand[]=payment_intent"
+	if err := s.call(ctx, http.MethodGet, path, nil, raw); err != nil {
+		return nil, err
+	}
+
+	currency := money.CurrencyOrDefault(strings.ToUpper(session.Currency))
+	result := &Result{
+		Reference: session.ID,
+		Status:    models.PaymentStatusPending,
+		Amount:    fromMinorUnits(session.AmountTotal, currency),
+		Currency:  currency.Code,
+		Raw:       raw.String(),
+	}
+	var intent stripePaymentIntent
+	if len(session.PaymentIntent) > 0 && session.PaymentIntent[0] == '{' {
+		if err := json.Unmarshal(session.PaymentIntent, &intent); err != nil {
+			return nil, &GatewayError{Gateway: GatewayStripe, Message: "unexpected payment intent: " + err.Error()}
+		}
+		result.TransactionID = intent.ID
+		result.Status = stripeIntentStatus(intent.Status)
+		if result.Status == models.PaymentStatusCaptured {
+			result.Amount = fromMinorUnits(intent.AmountReceived, currency)
+		}
+	}
+	if session.Status == "expired" {
+		result.Status = models.PaymentStatusCancelled
+	}
+	return result, nil
+}
+
+// Capture implements Provider for PaymentIntents created with manual capture. Stripe
+// captures a PaymentIntent once; capturing less than was authorized releases the rest.
+func (s *Stripe) Capture(ctx context.Context, req CaptureRequest) (*Result, error) {
+	values := url.Values{}
+	if req.Amount.IsPositive() {
+		values.Set("amount_to_capture", strconv.FormatInt(minorUnits(req.Amount, req.Currency), 10))
+	}
+
+	var intent stripePaymentIntent
+	raw := withRaw(&intent)
+	if err := s.call(ctx, http.MethodPost, "/v1/payment_intents/"+url.PathEscape(req.TransactionID)+"/capture", values, raw); err != nil {
+		return nil, err
+	}
+	currency := money.CurrencyOrDefault(strings.ToUpper(intent.Currency))
+	return &Result{
+		Reference:     req.Reference,
+		TransactionID: intent.ID,
+		Status:        stripeIntentStatus(intent.Status),
+		Amount:        fromMinorUnits(intent.AmountReceived, currency),
+		Currency:      currency.Code,
+		Raw:           raw.String(),
+	}, nil
+}
+
+// Void implements Provider by cancelling an uncaptured PaymentIntent
+func (s *Stripe) Void(ctx context.Context, req VoidRequest) (*Result, error) {
+	var intent stripePaymentIntent
+	raw := withRaw(&intent)
+	if err := s.call(ctx, http.MethodPost, "/v1/payment_intents/"+url.PathEscape(req.TransactionID)+"/cancel", url.Values{}, raw); err != nil {
+		return nil, err
+	}
+	status := stripeIntentStatus(intent.Status)
+	if status == models.PaymentStatusCancelled {
+		status = models.PaymentStatusVoided
+	}
+	currency := money.CurrencyOrDefault(strings.ToUpper(intent.Currency))
+	return &Result{
+		Reference:     req.Reference,
+		TransactionID: intent.ID,
+		Status:        status,
+		Amount:        fromMinorUnits(intent.Amount, currency),
+		Currency:      currency.Code,
+		Raw:           raw.String(),
+	}, nil
+}
+
+// Refund implements Provider
+func (s *Stripe) Refund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	values := url.Values{
+		"payment_intent": {req.TransactionID},
+		"amount":         {strconv.FormatInt(minorUnits(req.Amount, req.Currency), 10)},
+	}
+	if req.Reason != "" {
+		values.Set("metadata[reason]", req.Reason)
+	}
+
+	var refund struct {
+		ID     string `json:"id"`
+		Status string `json:"status"` // pending, requires_action, succeeded, failed, canceled
+	}
+	if err := s.call(ctx, http.MethodPost, "/v1/refunds", values, &refund); err != nil {
+		return nil, err
+	}
+	status := RefundPending
+	switch refund.Status {
+	case "succeeded":
+		status = RefundSucceeded
+	case "failed", "canceled":
+		status = RefundFailed
+	}
+	return &RefundResult{ID: refund.ID, Status: status}, nil
+}
+
+// ParseWebhook implements Provider, checking the Stripe-Signature header against the
+// endpoint's signing secret
+func (s *Stripe) ParseWebhook(ctx context.Context, header http.Header, body []byte) (*Event, error) {
+	if s.webhookSecret == "" {
+		return nil, ErrNotConfigured
+	}
+	if err := verifyStripeSignature(header.Get("Stripe-Signature"), body, s.webhookSecret, time.Now()); err != nil {
+		return nil, err
+	}
+
+	var payload struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid stripe event: %w", err)
+	}
+	event := &Event{ID: payload.ID, Type: payload.Type}
+
+	switch {
+	case strings.HasPrefix(payload.Type, "checkout.session."):
+		var session struct {
+			stripeSession
+			PaymentIntent string `json:"payment_intent"`
+		}
+		if err := json.Unmarshal(payload.Data.Object, &session); err != nil {
+			return nil, fmt.Errorf("invalid stripe event: %w", err)
+		}
+		currency := money.CurrencyOrDefault(strings.ToUpper(session.Currency))
+		event.Reference, event.TransactionID = session.ID, session.PaymentIntent
+		event.Amount, event.Currency = fromMinorUnits(session.AmountTotal, currency), currency.Code
+		switch payload.Type {
+		case "checkout.session.completed", "checkout.session.async_payment_succeeded":
+			// Completed sessions with manual capture are only authorized; Confirm tells them apart
+			event.Status = models.PaymentStatusPending
+			if session.PaymentStatus == "paid" {
+				event.Status = models.PaymentStatusCaptured
+			}
+		case "checkout.session.async_payment_failed":
+			event.Status = models.PaymentStatusFailed
+		case "checkout.session.expired":
+			event.Status = models.PaymentStatusCancelled
+		}
+
+	case strings.HasPrefix(payload.Type, "payment_intent."):
+		var intent stripePaymentIntent
+		if err := json.Unmarshal(payload.Data.Object, &intent); err != nil {
+			return nil, fmt.Errorf("invalid stripe event: %w", err)
+		}
+		currency := money.CurrencyOrDefault(strings.ToUpper(intent.Currency))
+		event.TransactionID, event.Currency = intent.ID, currency.Code
+		event.Amount = fromMinorUnits(intent.Amount, currency)
+		switch payload.Type {
+		case "payment_intent.succeeded":
+			event.Status = models.PaymentStatusCaptured
+			event.Amount = fromMinorUnits(intent.AmountReceived, currency)
+		case "payment_intent.amount_capturable_updated":
+			event.Status = models.PaymentStatusAuthorized
+		case "payment_intent.payment_failed":
+			event.Status = models.PaymentStatusFailed
+		case "payment_intent.canceled":
+			event.Status = models.PaymentStatusCancelled
+		}
+
+	case payload.Type == "charge.refunded":
+		var charge struct {
+			PaymentIntent  string `json:"payment_intent"`
+			AmountRefunded int64  `json:"amount_refunded"`
+			Currency       string `json:"currency"`
+			Refunded       bool   `json:"refunded"`
+		}
+		if err := json.Unmarshal(payload.Data.Object, &charge); err != nil {
+			return nil, fmt.Errorf("invalid stripe event: %w", err)
+		}
+		currency := money.CurrencyOrDefault(strings.ToUpper(charge.Currency))
+		event.TransactionID, event.Currency = charge.PaymentIntent, currency.Code
+		event.Amount = fromMinorUnits(charge.AmountRefunded, currency)
+		// amount_refunded is the running total, so only a fully refunded charge is reported
+		if charge.Refunded {
+			event.Status = models.PaymentStatusRefunded
+		}
+	}
+	return event, nil
+}
+
+// call sends a form-encoded request authenticated with the secret key
+func (s *Stripe) call(ctx context.Context, method, path string, values url.Values, out interface{}) error {
+	var body io.Reader
+	contentType := ""
+	if values != nil {
+		body, contentType = form(values), "application/x-www-form-urlencoded"
+	}
+	return s.api.do(ctx, method, path, body, contentType, func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+s.secretKey)
+	}, stripeErrorMessage, out)
+}
+
+// stripeErrorMessage reads the message from a Stripe error response
+func stripeErrorMessage(body []byte) string {
+	var payload struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &payload)
+	return payload.Error.Message
+}
+
+// stripeIntentStatus maps a PaymentIntent status onto a payment status
+func stripeIntentStatus(status string) string {
+	switch status {
+	case "succeeded":
+		return models.PaymentStatusCaptured
+	case "requires_capture":
+		return models.PaymentStatusAuthorized
+	case "canceled":
+		return models.PaymentStatusCancelled
+	}
+	// Declined attempts return the intent to requires_payment_method; the customer may retry
+	return models.PaymentStatusPending
+}
+
+// verifyStripeSignature checks a Stripe-Signature header: "t=<unix time>,v1=<hex HMAC>", where
+// the HMAC-SHA256 is of "<t>.<body>" keyed with the signing secret
+func verifyStripeSignature(signature string, body []byte, secret string, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(signature, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > stripeWebhookTolerance || age < -stripeWebhookTolerance {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+	for _, candidate := range signatures {
+		if decoded, err := hex.DecodeString(candidate); err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
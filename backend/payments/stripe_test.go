@@ -0,0 +1,377 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"ecom-backend/models"
+	"ecom-backend/money"
+)
+
+const testStripeWebhookSecret = "whsec_test"
+
+func newTestStripe(t *testing.T, fake *fakeGateway, manualCapture bool) *Stripe {
+	t.Helper()
+	stripe, err := NewStripe(Config{
+		SecretKey:     "sk_test_123",
+		WebhookSecret: testStripeWebhookSecret,
+		BaseURL:       fake.URL,
+		ManualCapture: manualCapture,
+	})
+	if err != nil {
+		t.Fatalf("NewStripe: %v", err)
+	}
+	return stripe
+}
+
+// signStripe builds a Stripe-Signature header for body at time ts
+func signStripe(body []byte, secret string, ts time.Time) string {
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestStripeCreateSession(t *testing.T) {
+	for _, manual := range []bool{false, true} {
+		t.Run(fmt.Sprintf("manual=%v", manual), func(t *testing.T) {
+			fake := newFakeGateway(t, map[string]fakeRoute{
+				"POST /v1/checkout/sessions": respond(http.StatusOK, `{"id":"cs_test_1","url":"https://checkout.stripe.com/c/cs_test_1"}`),
+			})
+			stripe := newTestStripe(t, fake, manual)
+
+			session, err := stripe.CreateSession(context.Background(), SessionRequest{
+				PaymentID:   7,
+				OrderID:     42,
+				Description: "Order WEB-2024-000042",
+				Amount:      money.MustParse("12.50"),
+				Currency:    usd,
+				Customer:    Customer{Email: "jane@example.com"},
+				ReturnURL:   "https://api.example.com/api/payments/7/return",
+				CancelURL:   "https://api.example.com/api/payments/7/return?cancelled=1",
+			})
+			if err != nil {
+				t.Fatalf("CreateSession: %v", err)
+			}
+			if session.Reference != "cs_test_1" || session.RedirectURL != "https://checkout.stripe.com/c/cs_test_1" {
+				t.Errorf("session = %+v", session)
+			}
+
+			req := fake.only(t, http.MethodPost, "/v1/checkout/sessions")
+			if got := req.Header.Get("Authorization"); got != "Bearer sk_test_123" {
+				t.Errorf("Authorization = %q", got)
+			}
+			form := req.Form()
+			for field, want := range map[string]string{
+				"mode":                                   "payment",
+				"line_items[0][price_data][currency]":    "usd",
+				"line_items[0][price_data][unit_amount]": "1250",
+				"metadata[order_id]":                     "42",
+				"metadata[payment_id]":                   "7",
+				"customer_email":                         "jane@example.com",
+			} {
+				if got := form.Get(field); got != want {
+					t.Errorf("%s = %q, want %q", field, got, want)
+				}
+			}
+			wantCapture := ""
+			if manual {
+				wantCapture = "manual"
+			}
+			if got := form.Get("payment_intent_data[capture_method]"); got != wantCapture {
+				t.Errorf("capture_method = %q, want %q", got, wantCapture)
+			}
+		})
+	}
+}
+
+func TestStripeConfirm(t *testing.T) {
+	tests := []struct {
+		name        string
+		session     string
+		wantStatus  string
+		wantAmount  string
+		wantTransID string
+	}{
+		{
+			name:        "paid",
+			session:     `{"id":"cs_1","status":"complete","payment_status":"paid","amount_total":1250,"currency":"usd","payment_intent":{"id":"pi_1","status":"succeeded","amount":1250,"amount_received":1250,"currency":"usd"}}`,
+			wantStatus:  models.PaymentStatusCaptured,
+			wantAmount:  "12.50",
+			wantTransID: "pi_1",
+		},
+		{
+			name:        "authorized for manual capture",
+			session:     `{"id":"cs_1","status":"complete","payment_status":"unpaid","amount_total":1250,"currency":"usd","payment_intent":{"id":"pi_1","status":"requires_capture","amount":1250,"amount_received":0,"currency":"usd"}}`,
+			wantStatus:  models.PaymentStatusAuthorized,
+			wantAmount:  "12.50",
+			wantTransID: "pi_1",
+		},
+		{
+			name:       "not paid yet",
+			session:    `{"id":"cs_1","status":"open","payment_status":"unpaid","amount_total":1250,"currency":"usd","payment_intent":null}`,
+			wantStatus: models.PaymentStatusPending,
+			wantAmount: "12.50",
+		},
+		{
+			name:       "expired",
+			session:    `{"id":"cs_1","status":"expired","payment_status":"unpaid","amount_total":1250,"currency":"usd"}`,
+			wantStatus: models.PaymentStatusCancelled,
+			wantAmount: "12.50",
+		},
+		{
+			name:        "zero-decimal currency",
+			session:     `{"id":"cs_1","status":"complete","payment_status":"paid","amount_total":1500,"currency":"jpy","payment_intent":{"id":"pi_1","status":"succeeded","amount":1500,"amount_received":1500,"currency":"jpy"}}`,
+			wantStatus:  models.PaymentStatusCaptured,
+			wantAmount:  "1500.00",
+			wantTransID: "pi_1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeGateway(t, map[string]fakeRoute{
+				"GET /v1/checkout/sessions/cs_1": respond(http.StatusOK, tt.session),
+			})
+			result, err := newTestStripe(t, fake, false).Confirm(context.Background(), "cs_1")
+			if err != nil {
+				t.Fatalf("Confirm: %v", err)
+			}
+			if result.Status != tt.wantStatus || result.Amount.String() != tt.wantAmount || result.TransactionID != tt.wantTransID {
+				t.Errorf("result = %+v, want status %s amount %s transaction %q", result, tt.wantStatus, tt.wantAmount, tt.wantTransID)
+			}
+			if result.Raw != tt.session {
+				t.Errorf("Raw = %q, want the gateway response", result.Raw)
+			}
+			if got := fake.only(t, http.MethodGet, "/v1/checkout/sessions/cs_1").Query.Get("expand[]"); got != "payment_intent" {
+				t.Errorf("expand[] = %q, want payment_intent", got)
+			}
+		})
+	}
+}
+
+func TestStripeCapture(t *testing.T) {
+	fake := newFakeGateway(t, map[string]fakeRoute{
+		"POST /v1/payment_intents/pi_1/capture": respond(http.StatusOK, `{"id":"pi_1","status":"succeeded","amount":1250,"amount_received":1000,"currency":"usd"}`),
+	})
+	result, err := newTestStripe(t, fake, true).Capture(context.Background(), CaptureRequest{
+		Reference: "cs_1", TransactionID: "pi_1", Amount: money.MustParse("10.00"), Currency: usd,
+	})
+	if err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	if result.Status != models.PaymentStatusCaptured || result.Amount != money.MustParse("10.00") || result.TransactionID != "pi_1" {
+		t.Errorf("result = %+v", result)
+	}
+	if got := fake.only(t, http.MethodPost, "/v1/payment_intents/pi_1/capture").Form().Get("amount_to_capture"); got != "1000" {
+		t.Errorf("amount_to_capture = %q, want 1000", got)
+	}
+}
+
+func TestStripeCaptureInFullSendsNoAmount(t *testing.T) {
+	fake := newFakeGateway(t, map[string]fakeRoute{
+		"POST /v1/payment_intents/pi_1/capture": respond(http.StatusOK, `{"id":"pi_1","status":"succeeded","amount":1250,"amount_received":1250,"currency":"usd"}`),
+	})
+	if _, err := newTestStripe(t, fake, true).Capture(context.Background(), CaptureRequest{TransactionID: "pi_1", Currency: usd}); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	if form := fake.only(t, http.MethodPost, "/v1/payment_intents/pi_1/capture").Form(); form.Has("amount_to_capture") {
+		t.Errorf("amount_to_capture sent for a full capture: %v", form)
+	}
+}
+
+func TestStripeVoid(t *testing.T) {
+	fake := newFakeGateway(t, map[string]fakeRoute{
+		"POST /v1/payment_intents/pi_1/cancel": respond(http.StatusOK, `{"id":"pi_1","status":"canceled","amount":1250,"currency":"usd"}`),
+	})
+	result, err := newTestStripe(t, fake, true).Void(context.Background(), VoidRequest{Reference: "cs_1", TransactionID: "pi_1"})
+	if err != nil {
+		t.Fatalf("Void: %v", err)
+	}
+	if result.Status != models.PaymentStatusVoided || result.Amount != money.MustParse("12.50") {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestStripeRefund(t *testing.T) {
+	tests := []struct {
+		gatewayStatus string
+		want          string
+	}{
+		{"succeeded", RefundSucceeded},
+		{"pending", RefundPending},
+		{"requires_action", RefundPending},
+		{"failed", RefundFailed},
+		{"canceled", RefundFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.gatewayStatus, func(t *testing.T) {
+			fake := newFakeGateway(t, map[string]fakeRoute{
+				"POST /v1/refunds": respond(http.StatusOK, `{"id":"re_1","status":"`+tt.gatewayStatus+`"}`),
+			})
+			result, err := newTestStripe(t, fake, false).Refund(context.Background(), RefundRequest{
+				TransactionID: "pi_1", Amount: money.MustParse("4.99"), Currency: usd, Reason: "Damaged",
+			})
+			if err != nil {
+				t.Fatalf("Refund: %v", err)
+			}
+			if result.ID != "re_1" || result.Status != tt.want {
+				t.Errorf("result = %+v, want status %s", result, tt.want)
+			}
+
+			form := fake.only(t, http.MethodPost, "/v1/refunds").Form()
+			if form.Get("payment_intent") != "pi_1" || form.Get("amount") != "499" || form.Get("metadata[reason]") != "Damaged" {
+				t.Errorf("refund form = %v", form)
+			}
+		})
+	}
+}
+
+func TestStripeParseWebhook(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus string
+		wantAmount string
+		wantRef    string
+		wantTrans  string
+	}{
+		{
+			name:       "checkout completed and paid",
+			body:       `{"id":"evt_1","type":"checkout.session.completed","data":{"object":{"id":"cs_1","payment_status":"paid","amount_total":1250,"currency":"usd","payment_intent":"pi_1"}}}`,
+			wantStatus: models.PaymentStatusCaptured,
+			wantAmount: "12.50",
+			wantRef:    "cs_1",
+			wantTrans:  "pi_1",
+		},
+		{
+			name:       "checkout completed but only authorized",
+			body:       `{"id":"evt_2","type":"checkout.session.completed","data":{"object":{"id":"cs_1","payment_status":"unpaid","amount_total":1250,"currency":"usd","payment_intent":"pi_1"}}}`,
+			wantStatus: models.PaymentStatusPending,
+			wantAmount: "12.50",
+			wantRef:    "cs_1",
+			wantTrans:  "pi_1",
+		},
+		{
+			name:       "checkout expired",
+			body:       `{"id":"evt_3","type":"checkout.session.expired","data":{"object":{"id":"cs_1","amount_total":1250,"currency":"usd"}}}`,
+			wantStatus: models.PaymentStatusCancelled,
+			wantAmount: "12.50",
+			wantRef:    "cs_1",
+		},
+		{
+			name:       "payment intent authorized",
+			body:       `{"id":"evt_4","type":"payment_intent.amount_capturable_updated","data":{"object":{"id":"pi_1","status":"requires_capture","amount":1250,"currency":"usd"}}}`,
+			wantStatus: models.PaymentStatusAuthorized,
+			wantAmount: "12.50",
+			wantTrans:  "pi_1",
+		},
+		{
+			name:       "payment intent succeeded after partial capture",
+			body:       `{"id":"evt_5","type":"payment_intent.succeeded","data":{"object":{"id":"pi_1","status":"succeeded","amount":1250,"amount_received":1000,"currency":"usd"}}}`,
+			wantStatus: models.PaymentStatusCaptured,
+			wantAmount: "10.00",
+			wantTrans:  "pi_1",
+		},
+		{
+			name:       "charge fully refunded",
+			body:       `{"id":"evt_6","type":"charge.refunded","data":{"object":{"payment_intent":"pi_1","amount_refunded":1250,"currency":"usd","refunded":true}}}`,
+			wantStatus: models.PaymentStatusRefunded,
+			wantAmount: "12.50",
+			wantTrans:  "pi_1",
+		},
+		{
+			name:       "charge partially refunded",
+			body:       `{"id":"evt_7","type":"charge.refunded","data":{"object":{"payment_intent":"pi_1","amount_refunded":500,"currency":"usd","refunded":false}}}`,
+			wantStatus: "",
+			wantAmount: "5.00",
+			wantTrans:  "pi_1",
+		},
+		{
+			name: "unrelated event",
+			body: `{"id":"evt_8","type":"customer.created","data":{"object":{"id":"cus_1"}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeGateway(t, nil)
+			body := []byte(tt.body)
+			header := http.Header{"Stripe-Signature": {signStripe(body, testStripeWebhookSecret, time.Now())}}
+
+			event, err := newTestStripe(t, fake, false).ParseWebhook(context.Background(), header, body)
+			if err != nil {
+				t.Fatalf("ParseWebhook: %v", err)
+			}
+			if event.Status != tt.wantStatus || event.Reference != tt.wantRef || event.TransactionID != tt.wantTrans {
+				t.Errorf("event = %+v, want status %q reference %q transaction %q", event, tt.wantStatus, tt.wantRef, tt.wantTrans)
+			}
+			if tt.wantAmount != "" && event.Amount.String() != tt.wantAmount {
+				t.Errorf("Amount = %s, want %s", event.Amount, tt.wantAmount)
+			}
+		})
+	}
+}
+
+func TestStripeParseWebhookRejectsBadSignature(t *testing.T) {
+	fake := newFakeGateway(t, nil)
+	body := []byte(`{"id":"evt_1","type":"checkout.session.completed","data":{"object":{"id":"cs_1","payment_status":"paid"}}}`)
+	header := http.Header{"Stripe-Signature": {signStripe(body, "whsec_other", time.Now())}}
+
+	if _, err := newTestStripe(t, fake, false).ParseWebhook(context.Background(), header, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("ParseWebhook error = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestStripeParseWebhookNeedsSecret(t *testing.T) {
+	stripe, err := NewStripe(Config{SecretKey: "sk_test_123"})
+	if err != nil {
+		t.Fatalf("NewStripe: %v", err)
+	}
+	if _, err := stripe.ParseWebhook(context.Background(), http.Header{}, []byte(`{}`)); !errors.Is(err, ErrNotConfigured) {
+		t.Fatalf("ParseWebhook without a secret error = %v, want ErrNotConfigured", err)
+	}
+}
+
+func TestVerifyStripeSignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"evt_1"}`)
+	valid := signStripe(body, testStripeWebhookSecret, now)
+
+	tests := []struct {
+		name      string
+		signature string
+		body      []byte
+		wantErr   bool
+	}{
+		{"valid", valid, body, false},
+		{"valid among rotated secrets", valid + ",v1=" + hex.EncodeToString([]byte("old-secret-signature")), body, false},
+		{"tampered body", valid, []byte(`{"id":"evt_2"}`), true},
+		{"wrong secret", signStripe(body, "whsec_other", now), body, true},
+		{"stale timestamp", signStripe(body, testStripeWebhookSecret, now.Add(-stripeWebhookTolerance-time.Second)), body, true},
+		{"future timestamp", signStripe(body, testStripeWebhookSecret, now.Add(stripeWebhookTolerance+time.Second)), body, true},
+		{"within tolerance", signStripe(body, testStripeWebhookSecret, now.Add(-stripeWebhookTolerance+time.Second)), body, false},
+		{"missing v1", "t=" + strconv.FormatInt(now.Unix(), 10), body, true},
+		{"missing timestamp", "v1=" + hex.EncodeToString([]byte("x")), body, true},
+		{"not hex", "t=" + strconv.FormatInt(now.Unix(), 10) + ",v1=zz", body, true},
+		{"empty", "", body, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyStripeSignature(tt.signature, tt.body, testStripeWebhookSecret, now)
+			if tt.wantErr && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("error = %v, want ErrInvalidSignature", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("error = %v, want nil", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package pricing
+
+import (
+	"time"
+
+	"ecom-backend/models"
+	"ecom-backend/money"
+
+	"gorm.io/gorm"
+)
+
+// LookupCoupon loads an active coupon and checks it can be applied to a base-currency subtotal. The
+// returned message explains why a coupon was rejected; the error is only set on database
+// failures.
+func LookupCoupon(db *gorm.DB, code string, subtotal money.Money) (*models.Coupon, string, error) {
+	var coupon models.Coupon
+	if err := db.Where("code = ? AND is_active = ?", code, true).First(&coupon).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, "Invalid or inactive coupon code", nil
+		}
+		return nil, "", err
+	}
+
+	// Check validity period (inclusive start and end to match ValidateCoupon)
+	now := time.Now()
+	if now.Before(coupon.ValidFrom) || now.After(coupon.ValidUntil) {
+		return nil, "Coupon is not valid at this time", nil
+	}
+	if coupon.UsageLimit > 0 && coupon.UsedCount >= coupon.UsageLimit {
+		return nil, "Coupon usage limit reached", nil
+	}
+	if subtotal < coupon.MinPurchase {
+		return nil, "Order does not meet the coupon's minimum purchase", nil
+	}
+	return &coupon, "", nil
+}
+
+// CouponDiscount returns the discount a coupon gives on a subtotal, never more than the
+// subtotal. Percentage discounts are rounded by the currency's rules; fixed amounts and
+// caps are entered in the base currency and converted at rate.
+func CouponDiscount(coupon *models.Coupon, subtotal money.Money, currency money.Currency, rate money.ExchangeRate) money.Money {
+	var discount money.Money
+	if coupon.Type == "percentage" {
+		discount = currency.Percent(subtotal, money.RateFromMoney(coupon.Value))
+		if coupon.MaxDiscount.IsPositive() {
+			discount = money.Min(discount, rate.Convert(coupon.MaxDiscount, currency))
+		}
+	} else {
+		discount = rate.Convert(coupon.Value, currency)
+	}
+	return money.Min(discount, subtotal)
+}
@@ -0,0 +1,61 @@
+package pricing
+
+import (
+	"strings"
+
+	"ecom-backend/models"
+	"ecom-backend/money"
+
+	"gorm.io/gorm"
+)
+
+// BaseCurrencySetting is the setting naming the currency product prices are entered in
+const BaseCurrencySetting = "base_currency"
+
+// BaseCurrencyCode returns the store's base currency code, from the base_currency setting
+func BaseCurrencyCode(db *gorm.DB) string {
+	var setting models.Setting
+	if err := db.Where("key = ?", BaseCurrencySetting).First(&setting).Error; err == nil && strings.TrimSpace(setting.Value) != "" {
+		return strings.ToUpper(strings.TrimSpace(setting.Value))
+	}
+	return money.DefaultCurrency.Code
+}
+
+// BaseCurrency returns the rounding and display rules of the store's base currency
+func BaseCurrency(db *gorm.DB) (money.Currency, error) {
+	currency, _, err := ResolveCurrency(db, "")
+	return currency, err
+}
+
+// ResolveCurrency returns the rules and exchange rate of a currency customers can shop in.
+// An empty code means the base currency, which always converts at parity. Unknown or
+// inactive currencies are reported as an InputError.
+func ResolveCurrency(db *gorm.DB, code string) (money.Currency, money.ExchangeRate, error) {
+	base := BaseCurrencyCode(db)
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		code = base
+	}
+
+	var currency models.Currency
+	err := db.Where("code = ?", code).First(&currency).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return money.Currency{}, 0, err
+	}
+
+	if code == base {
+		if err == gorm.ErrRecordNotFound {
+			rules, ok := money.LookupCurrency(code)
+			if !ok {
+				rules = money.Currency{Code: code, Symbol: code + " ", Decimals: money.Scale, Rounding: money.HalfUp}
+			}
+			return rules, money.Parity, nil
+		}
+		return currency.Rules(), money.Parity, nil
+	}
+
+	if err == gorm.ErrRecordNotFound || !currency.IsActive || !currency.ExchangeRate.IsPositive() {
+		return money.Currency{}, 0, &InputError{Message: "Unsupported currency " + code}
+	}
+	return currency.Rules(), currency.ExchangeRate, nil
+}
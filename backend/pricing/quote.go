@@ -0,0 +1,232 @@
+// Package pricing computes checkout totals. The storefront quote, web checkout and POS all
+// price orders here so the total a customer is shown is the total they are charged.
+package pricing
+
+import (
+	"time"
+
+	"ecom-backend/models"
+	"ecom-backend/money"
+	"ecom-backend/shipping"
+
+	"gorm.io/gorm"
+)
+
+// Line is a product and quantity to be priced
+type Line struct {
+	Product    models.Product
+	Quantity   int
+	Variations map[string]string
+	UnitPrice  *money.Money // Price override (POS); replaces base price and variation modifiers
+}
+
+// Request is everything needed to price an order
+type Request struct {
+	Lines            []Line
+	CouponCode       string
+	Destination      shipping.Destination
+	ShippingMethodID uint               // Zero uses the flat shipping_cost setting
+	InStore          bool               // Counter sales are handed over in store and never charged shipping
+	Currency         money.Currency     // Currency to charge in; the zero value means the default currency
+	ExchangeRate     money.ExchangeRate // Rate from the base currency to Currency; zero means parity
+}
+
+// QuoteLine is one priced line of a quote
+type QuoteLine struct {
+	ProductID     uint                     `json:"product_id"`
+	ProductName   string                   `json:"product_name"`
+	Quantity      int                      `json:"quantity"`
+	BasePrice     money.Money              `json:"base_price"`
+	PriceModifier money.Money              `json:"price_modifier"`
+	UnitPrice     money.Money              `json:"unit_price"`
+	LineTotal     money.Money              `json:"line_total"`
+	Variations    map[string]string        `json:"variations"`
+	Options       []models.VariationOption `json:"-"` // Selected options, for stock deduction
+}
+
+// Quote is an itemised order total: subtotal - discount + tax + shipping
+type Quote struct {
+	Lines               []QuoteLine            `json:"lines"`
+	Currency            string                 `json:"currency"`
+	ExchangeRate        money.ExchangeRate     `json:"exchange_rate"`
+	Subtotal            money.Money            `json:"subtotal"`
+	CouponCode          string                 `json:"coupon_code,omitempty"`
+	CouponError         string                 `json:"coupon_error,omitempty"` // Why the requested coupon wasn't applied
+	Coupon              *models.Coupon         `json:"-"`
+	Discount            money.Money            `json:"discount"`
+	TaxRate             money.Rate             `json:"tax_rate"`
+	Taxes               []TaxLine              `json:"taxes"`
+	Tax                 money.Money            `json:"tax"`
+	ShippingMethod      *models.ShippingMethod `json:"-"`
+	ShippingMethodName  string                 `json:"shipping_method_name,omitempty"`
+	EstimatedDeliveryAt *time.Time             `json:"estimated_delivery_at,omitempty"`
+	Shipping            money.Money            `json:"shipping"`
+	Total               money.Money            `json:"total"`
+}
+
+// InputError is a problem with the request itself (bad variation, unknown shipping method)
+// rather than a server failure. Callers report it as 400 Bad Request.
+type InputError struct {
+	Message string
+}
+
+func (e *InputError) Error() string {
+	return e.Message
+}
+
+// Calculate prices a request. Tax is charged on the subtotal after discount; shipping is
+// not taxed. Percentages are rounded once per amount using the currency's rounding rules.
+// Base-currency prices are converted to the request's currency per unit, so line totals,
+// coupons and shipping add up exactly in the currency the customer pays in; coupon minimums
+// and free-shipping thresholds are still compared in the base currency.
+func Calculate(db *gorm.DB, req Request) (*Quote, error) {
+	currency := currencyOf(req)
+	rate := req.ExchangeRate.OrParity()
+	quote := &Quote{Currency: currency.Code, ExchangeRate: rate, Lines: make([]QuoteLine, 0, len(req.Lines)), Taxes: []TaxLine{}}
+
+	for _, line := range req.Lines {
+		resolved, err := ResolveVariations(db, line.Product.ID, line.Variations)
+		if err != nil {
+			if _, ok := err.(*SelectionError); ok {
+				return nil, &InputError{Message: line.Product.Name + ": " + err.Error()}
+			}
+			return nil, err
+		}
+
+		quoteLine := QuoteLine{
+			ProductID:     line.Product.ID,
+			ProductName:   line.Product.Name,
+			Quantity:      line.Quantity,
+			BasePrice:     rate.Convert(line.Product.Price, currency),
+			PriceModifier: rate.Convert(resolved.PriceModifier, currency),
+			Variations:    resolved.Selections,
+			Options:       resolved.Options,
+		}
+		quoteLine.UnitPrice = quoteLine.BasePrice.Add(quoteLine.PriceModifier)
+		if line.UnitPrice != nil {
+			quoteLine.UnitPrice = *line.UnitPrice
+		}
+		quoteLine.LineTotal = quoteLine.UnitPrice.Mul(line.Quantity)
+
+		quote.Lines = append(quote.Lines, quoteLine)
+		quote.Subtotal = quote.Subtotal.Add(quoteLine.LineTotal)
+	}
+
+	baseSubtotal := rate.ToBase(quote.Subtotal)
+
+	if req.CouponCode != "" {
+		coupon, reason, err := LookupCoupon(db, req.CouponCode, baseSubtotal)
+		if err != nil {
+			return nil, err
+		}
+		if coupon != nil {
+			quote.Coupon = coupon
+			quote.CouponCode = coupon.Code
+			quote.Discount = CouponDiscount(coupon, quote.Subtotal, currency, rate)
+		} else {
+			quote.CouponError = reason
+		}
+	}
+
+	taxRate, err := LookupTaxRate(db, req.Destination)
+	if err != nil {
+		return nil, err
+	}
+	taxable := quote.Subtotal.Sub(quote.Discount)
+	quote.TaxRate = taxRate.Rate
+	if taxRate.Rate > 0 {
+		taxLine := TaxLine{
+			Label:         taxLabel(taxRate),
+			Rate:          taxRate.Rate,
+			TaxableAmount: taxable,
+			Amount:        currency.Percent(taxable, taxRate.Rate),
+		}
+		if taxRate.ID != 0 {
+			taxLine.TaxRateID = &taxRate.ID
+		}
+		quote.Taxes = append(quote.Taxes, taxLine)
+		quote.Tax = quote.Tax.Add(taxLine.Amount)
+	}
+
+	if err := priceShipping(db, req, baseSubtotal, quote); err != nil {
+		return nil, err
+	}
+
+	quote.Total = quote.Subtotal.Sub(quote.Discount).Add(quote.Tax).Add(quote.Shipping)
+	return quote, nil
+}
+
+// ApplyTo copies the quote's totals, coupon and shipping method onto an order
+func (q *Quote) ApplyTo(order *models.Order) {
+	order.Currency = q.Currency
+	order.ExchangeRate = q.ExchangeRate
+	order.Subtotal = q.Subtotal
+	order.Discount = q.Discount
+	order.TaxRate = q.TaxRate
+	order.Tax = q.Tax
+	order.Shipping = q.Shipping
+	order.Total = q.Total
+	if q.Coupon != nil {
+		order.CouponID = &q.Coupon.ID
+		order.CouponCode = q.Coupon.Code
+	}
+	if q.ShippingMethod != nil {
+		order.ShippingMethodID = &q.ShippingMethod.ID
+		order.ShippingMethodName = q.ShippingMethod.Name
+		order.EstimatedDeliveryAt = q.EstimatedDeliveryAt
+	}
+}
+
+// priceShipping charges the chosen shipping method, or the flat shipping_cost setting when
+// none was chosen. Rate tables are in the base currency and so is the subtotal they are
+// checked against.
+func priceShipping(db *gorm.DB, req Request, baseSubtotal money.Money, quote *Quote) error {
+	if req.InStore {
+		return nil
+	}
+
+	if req.ShippingMethodID == 0 {
+		var shippingSetting models.Setting
+		if err := db.Where("key = ?", "shipping_cost").First(&shippingSetting).Error; err == nil {
+			if cost, err := money.Parse(shippingSetting.Value); err == nil {
+				quote.Shipping = quote.ExchangeRate.Convert(cost, currencyOf(req))
+			}
+		}
+		return nil
+	}
+
+	var method models.ShippingMethod
+	if err := db.Where("id = ? AND is_active = ?", req.ShippingMethodID, true).First(&method).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return &InputError{Message: "Invalid shipping method"}
+		}
+		return err
+	}
+
+	items := make([]shipping.Item, 0, len(req.Lines))
+	for _, line := range req.Lines {
+		items = append(items, shipping.Item{Product: line.Product, Quantity: line.Quantity})
+	}
+	shippingQuote, err := shipping.Calculate(db, method, req.Destination, items, baseSubtotal)
+	if err == shipping.ErrNotAvailable {
+		return &InputError{Message: method.Name + " is not available for this address"}
+	}
+	if err != nil {
+		return err
+	}
+
+	estimatedDelivery := shipping.EstimatedDeliveryDate(time.Now(), method.EstimatedDays)
+	quote.ShippingMethod = &method
+	quote.ShippingMethodName = method.Name
+	quote.EstimatedDeliveryAt = &estimatedDelivery
+	quote.Shipping = quote.ExchangeRate.Convert(shippingQuote.Cost, currencyOf(req))
+	return nil
+}
+
+// currencyOf returns the currency a request is charged in
+func currencyOf(req Request) money.Currency {
+	if req.Currency.Code == "" {
+		return money.DefaultCurrency
+	}
+	return req.Currency
+}
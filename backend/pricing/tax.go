@@ -0,0 +1,83 @@
+package pricing
+
+import (
+	"ecom-backend/models"
+	"ecom-backend/money"
+	"ecom-backend/shipping"
+
+	"gorm.io/gorm"
+)
+
+// TaxLine is the tax charged at one rate
+type TaxLine struct {
+	TaxRateID     *uint       `json:"tax_rate_id"` // Nil when the rate came from the tax_rate setting
+	Label         string      `json:"label"`
+	Rate          money.Rate  `json:"rate"` // Percentage
+	TaxableAmount money.Money `json:"taxable_amount"`
+	Amount        money.Money `json:"amount"`
+}
+
+// LookupTaxRate finds the tax rate for a destination, most specific match first: city, then
+// region, then country, then the default rate and finally the tax_rate setting
+func LookupTaxRate(db *gorm.DB, dest shipping.Destination) (*models.TaxRate, error) {
+	var taxRate models.TaxRate
+
+	if dest.City != "" {
+		err := db.Where("country = ? AND city = ? AND (region = '' OR region IS NULL)", dest.Country, dest.City).First(&taxRate).Error
+		if err == nil {
+			return &taxRate, nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return nil, err
+		}
+	}
+
+	if dest.Region != "" {
+		err := db.Where("country = ? AND region = ? AND (city = '' OR city IS NULL)", dest.Country, dest.Region).First(&taxRate).Error
+		if err == nil {
+			return &taxRate, nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return nil, err
+		}
+	}
+
+	err := db.Where("country = ? AND (region = '' OR region IS NULL) AND (city = '' OR city IS NULL)", dest.Country).First(&taxRate).Error
+	if err == nil {
+		return &taxRate, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	err = db.Where("is_default = ?", true).First(&taxRate).Error
+	if err == nil {
+		return &taxRate, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	// Final fallback to settings
+	var taxSetting models.Setting
+	if err := db.Where("key = ?", "tax_rate").First(&taxSetting).Error; err == nil {
+		if rate, err := money.ParseRate(taxSetting.Value); err == nil {
+			return &models.TaxRate{Country: dest.Country, Rate: rate}, nil
+		}
+	}
+	return &models.TaxRate{Country: dest.Country}, nil
+}
+
+// taxLabel describes where a tax rate applies, e.g. "Tax (Dhaka, BD)"
+func taxLabel(rate *models.TaxRate) string {
+	switch {
+	case rate.ID == 0 || rate.IsDefault:
+		return "Tax"
+	case rate.City != "":
+		return "Tax (" + rate.City + ", " + rate.Country + ")"
+	case rate.Region != "":
+		return "Tax (" + rate.Region + ", " + rate.Country + ")"
+	default:
+		return "Tax (" + rate.Country + ")"
+	}
+}
@@ -0,0 +1,102 @@
+package pricing
+
+import (
+	"fmt"
+	"strings"
+
+	"ecom-backend/models"
+	"ecom-backend/money"
+
+	"gorm.io/gorm"
+)
+
+// Variations is a cart or order line's variation selections matched against the product's
+// ProductVariation/VariationOption records
+type Variations struct {
+	Selections    map[string]string        // Canonical variation name -> option value
+	Options       []models.VariationOption // Selected predefined options (custom values have none)
+	PriceModifier money.Money              // Sum of the selected options' price modifiers
+}
+
+// SelectionError describes an invalid, unknown or missing variation selection
+type SelectionError struct {
+	Message string
+}
+
+func (e *SelectionError) Error() string {
+	return e.Message
+}
+
+// ResolveVariations validates selections against a product's variations. Every selected
+// variation must exist, every value must be one of its options (unless custom values are
+// allowed) and every required variation must be selected.
+func ResolveVariations(db *gorm.DB, productID uint, selections map[string]string) (*Variations, error) {
+	var variations []models.ProductVariation
+	if err := db.Preload("Options").Where("product_id = ?", productID).Find(&variations).Error; err != nil {
+		return nil, err
+	}
+
+	resolved := &Variations{Selections: make(map[string]string)}
+	for name, value := range selections {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		variation := FindVariation(variations, name)
+		if variation == nil {
+			return nil, &SelectionError{Message: fmt.Sprintf("Unknown variation: %s", name)}
+		}
+
+		option := FindVariationOption(variation.Options, value)
+		if option == nil {
+			if !variation.AllowCustom {
+				return nil, &SelectionError{Message: fmt.Sprintf("Invalid option %q for %s", value, variation.Name)}
+			}
+			resolved.Selections[variation.Name] = value
+			continue
+		}
+
+		resolved.Selections[variation.Name] = option.Value
+		resolved.Options = append(resolved.Options, *option)
+		resolved.PriceModifier = resolved.PriceModifier.Add(option.PriceModifier)
+	}
+
+	for _, variation := range variations {
+		if _, selected := resolved.Selections[variation.Name]; variation.IsRequired && !selected {
+			return nil, &SelectionError{Message: fmt.Sprintf("Please select a %s", variation.Name)}
+		}
+	}
+
+	return resolved, nil
+}
+
+// CheckOptionStock verifies every selected option has at least quantity units in stock
+func (v *Variations) CheckOptionStock(quantity int) error {
+	for _, option := range v.Options {
+		if option.Stock < quantity {
+			return &SelectionError{Message: fmt.Sprintf("Insufficient stock for option: %s", option.Value)}
+		}
+	}
+	return nil
+}
+
+// FindVariation returns the variation with the given name, ignoring case
+func FindVariation(variations []models.ProductVariation, name string) *models.ProductVariation {
+	for i := range variations {
+		if strings.EqualFold(variations[i].Name, strings.TrimSpace(name)) {
+			return &variations[i]
+		}
+	}
+	return nil
+}
+
+// FindVariationOption returns the option with the given value, ignoring case
+func FindVariationOption(options []models.VariationOption, value string) *models.VariationOption {
+	for i := range options {
+		if strings.EqualFold(options[i].Value, strings.TrimSpace(value)) {
+			return &options[i]
+		}
+	}
+	return nil
+}
@@ -22,7 +22,8 @@ func SetupRoutes() *gin.Engine {
 		"http://127.0.0.1:10001",
 	}
 	config.AllowCredentials = true
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "Idempotency-Key", "X-Cart-Token"}
+	config.ExposeHeaders = []string{"X-Cart-Token", "Idempotent-Replayed"}
 	r.Use(cors.New(config))
 
 	// Rate limiting middleware (500 requests per minute per IP - increased for SPA)
@@ -76,12 +77,29 @@ func SetupRoutes() *gin.Engine {
 		// Public payment gateways (for checkout)
 		api.GET("/payment-gateways", controllers.GetActivePaymentGateways)
 
+		// Public shipping methods (for checkout)
+		api.GET("/shipping-methods", controllers.GetShippingMethods)
+		api.POST("/shipping/estimate", controllers.EstimateShipping)
+
 		// Public settings (for checkout calculations)
 		api.GET("/settings/:key", controllers.GetPublicSetting)
 
 		// Public tax rate lookup
 		api.GET("/tax-rate", controllers.GetTaxRateForLocation)
 
+		// Currencies customers can shop in
+		api.GET("/currencies", controllers.GetActiveCurrencies)
+
+		// Gateways send customers back here after paying
+		api.GET("/payments/:id/return", controllers.PaymentReturn)
+		api.POST("/payments/:id/return", controllers.PaymentReturn)
+
+		// Payment gateway callbacks, verified by each gateway's signature scheme
+		api.POST("/webhooks/payments/:gateway", controllers.ReceivePaymentWebhook)
+
+		// Gift card balance lookup by code, with a tight limit of its own so codes can't be guessed
+		api.POST("/gift-cards/balance", middleware.RouteRateLimitMiddleware("gift_card_balance", 10), controllers.CheckGiftCardBalance)
+
 		// Chat routes (public)
 		api.POST("/chat", controllers.HandleChat)
 		api.GET("/chat/active", controllers.GetActiveChat) // Find active chat by user/IP (useful when localStorage is cleared)
@@ -90,6 +108,32 @@ func SetupRoutes() *gin.Engine {
 		api.GET("/chat/:id", controllers.GetChatMessages)
 	}
 
+	// Cart and checkout: signed-in users, or guests identified by the X-Cart-Token header
+	guest := api.Group("")
+	guest.Use(middleware.OptionalAuthMiddleware())
+	{
+		cart := guest.Group("/cart")
+		{
+			cart.GET("", controllers.GetCart)
+			cart.POST("", controllers.AddToCart)
+			cart.PUT("/:id", controllers.UpdateCartItem)
+			cart.DELETE("/:id", controllers.RemoveFromCart)
+			cart.DELETE("", controllers.ClearCart)
+		}
+
+		// Checkout quote (same pricing as order creation)
+		guest.POST("/checkout/quote", controllers.GetCheckoutQuote)
+
+		guest.POST("/orders", middleware.IdempotencyMiddleware(), controllers.CreateOrder)
+		guest.POST("/orders/:id/pay", controllers.PayOrder)
+
+		// Recovery email link for abandoned carts
+		guest.GET("/recover/:token", controllers.RecoverCart)
+	}
+
+	// Guest order lookup link
+	api.GET("/orders/lookup/:token", controllers.GetOrderByLookupToken)
+
 	// Protected routes
 	protected := api.Group("")
 	protected.Use(middleware.AuthMiddleware())
@@ -99,22 +143,25 @@ func SetupRoutes() *gin.Engine {
 		protected.PUT("/auth/profile", controllers.UpdateProfile)
 		protected.PUT("/auth/change-password", controllers.ChangePassword)
 
-		// Cart routes
-		cart := protected.Group("/cart")
+		// Address book
+		addresses := protected.Group("/addresses")
 		{
-			cart.GET("", controllers.GetCart)
-			cart.POST("", controllers.AddToCart)
-			cart.PUT("/:id", controllers.UpdateCartItem)
-			cart.DELETE("/:id", controllers.RemoveFromCart)
-			cart.DELETE("", controllers.ClearCart)
+			addresses.GET("", controllers.GetAddresses)
+			addresses.POST("", controllers.CreateAddress)
+			addresses.PUT("/:id", controllers.UpdateAddress)
+			addresses.PUT("/:id/default", controllers.SetDefaultAddress)
+			addresses.DELETE("/:id", controllers.DeleteAddress)
 		}
 
 		// Order routes
 		orders := protected.Group("/orders")
 		{
-			orders.POST("", controllers.CreateOrder)
+			orders.POST("/claim", controllers.ClaimGuestOrder)
 			orders.GET("", controllers.GetOrders)
 			orders.GET("/:id", controllers.GetOrder)
+			orders.GET("/:id/history", controllers.GetOrderHistory)
+			orders.POST("/:id/cancel", controllers.CancelOrder)
+			orders.POST("/:id/reorder", controllers.ReorderOrder)
 		}
 
 		// Reviews
@@ -124,6 +171,9 @@ func SetupRoutes() *gin.Engine {
 		protected.GET("/refunds", controllers.GetRefunds)
 		protected.POST("/refunds", controllers.CreateRefundRequest)
 
+		// Store credit
+		protected.GET("/store-credit", controllers.GetMyStoreCredit)
+
 		// Wishlist routes
 		wishlist := protected.Group("/wishlist")
 		{
@@ -151,6 +201,8 @@ func SetupRoutes() *gin.Engine {
 		admin.GET("/users", controllers.GetUsers)
 		admin.GET("/customers", controllers.GetCustomers)
 		admin.GET("/customers/:id", controllers.GetCustomer)
+		admin.GET("/customers/:id/store-credit", controllers.GetCustomerStoreCredit)
+		admin.POST("/customers/:id/store-credit/adjust", controllers.AdjustStoreCredit)
 
 		// Support/Chat management
 		// More specific routes must come before less specific ones
@@ -161,11 +213,18 @@ func SetupRoutes() *gin.Engine {
 
 		// Orders management
 		admin.GET("/orders", controllers.GetAllOrders)
+		admin.GET("/orders/backordered", controllers.GetBackorderedOrders)
 		admin.PUT("/orders/:id/status", controllers.UpdateOrderStatus)
+		admin.GET("/orders/:id/history", controllers.GetOrderHistoryAdmin)
+		admin.GET("/orders/:id/shipments", controllers.GetOrderShipments)
+		admin.GET("/orders/:id/payments", controllers.GetOrderPayments)
+		admin.POST("/orders/:id/shipments", controllers.CreateShipment)
+		admin.PUT("/shipments/:id", controllers.UpdateShipment)
+		admin.POST("/shipments/:id/deliver", controllers.MarkShipmentDelivered)
 
 		// POS system
 		// POS routes
-		admin.POST("/pos/order", controllers.CreatePOSOrder)
+		admin.POST("/pos/order", middleware.IdempotencyMiddleware(), controllers.CreatePOSOrder)
 		admin.GET("/pos/orders", controllers.GetPOSOrders)
 		admin.GET("/pos/orders/:id", controllers.GetPOSOrder)
 
@@ -185,6 +244,13 @@ func SetupRoutes() *gin.Engine {
 		admin.PUT("/coupons/:id", controllers.UpdateCoupon)
 		admin.DELETE("/coupons/:id", controllers.DeleteCoupon)
 
+		// Gift cards management
+		admin.GET("/gift-cards", controllers.GetGiftCards)
+		admin.POST("/gift-cards", controllers.IssueGiftCard)
+		admin.GET("/gift-cards/:id", controllers.GetGiftCard)
+		admin.POST("/gift-cards/:id/adjust", controllers.AdjustGiftCard)
+		admin.POST("/gift-cards/:id/void", controllers.VoidGiftCard)
+
 		// Campaigns management
 		admin.GET("/campaigns", controllers.GetCampaigns)
 		admin.GET("/campaigns/:id", controllers.GetCampaign)
@@ -222,6 +288,11 @@ func SetupRoutes() *gin.Engine {
 		admin.GET("/payment-gateways", controllers.GetPaymentGateways)
 		admin.PUT("/payment-gateways", controllers.UpdatePaymentGateway)
 		admin.PUT("/payment-gateways/default", controllers.SetDefaultPaymentGateway)
+		admin.GET("/payment-webhooks", controllers.GetPaymentWebhookEvents)
+		admin.GET("/payment-webhooks/:id", controllers.GetPaymentWebhookEvent)
+		admin.POST("/payment-webhooks/:id/replay", controllers.ReplayPaymentWebhookEvent)
+		admin.POST("/payments/:id/capture", controllers.CapturePayment)
+		admin.POST("/payments/:id/void", controllers.VoidPayment)
 
 		// Notifications management
 		admin.GET("/notifications", controllers.GetNotifications)
@@ -243,9 +314,19 @@ func SetupRoutes() *gin.Engine {
 		admin.PUT("/tax-rates/:id", controllers.UpdateTaxRate)
 		admin.DELETE("/tax-rates/:id", controllers.DeleteTaxRate)
 
+		// Currencies and exchange rates
+		admin.GET("/currencies", controllers.GetCurrencies)
+		admin.POST("/currencies", controllers.CreateCurrency)
+		admin.POST("/currencies/import", controllers.ImportExchangeRates)
+		admin.PUT("/currencies/:id", controllers.UpdateCurrency)
+		admin.DELETE("/currencies/:id", controllers.DeleteCurrency)
+
 		// Tax reports
 		admin.GET("/tax-reports", controllers.GetTaxReports)
 
+		// Abandoned cart recovery report
+		admin.GET("/reports/abandoned-carts", controllers.GetAbandonedCartReport)
+
 		// Bulk operations
 		admin.POST("/products/bulk-delete", controllers.BulkDeleteProducts)
 		admin.PUT("/products/bulk-update", controllers.BulkUpdateProductStatus)
@@ -261,6 +342,14 @@ func SetupRoutes() *gin.Engine {
 		admin.POST("/shipping-methods", controllers.CreateShippingMethod)
 		admin.PUT("/shipping-methods/:id", controllers.UpdateShippingMethod)
 		admin.DELETE("/shipping-methods/:id", controllers.DeleteShippingMethod)
+		admin.GET("/shipping-methods/:id/rates", controllers.GetShippingRates)
+		admin.POST("/shipping-methods/:id/rates", controllers.CreateShippingRate)
+		admin.PUT("/shipping-rates/:id", controllers.UpdateShippingRate)
+		admin.DELETE("/shipping-rates/:id", controllers.DeleteShippingRate)
+		admin.GET("/shipping-zones", controllers.GetShippingZones)
+		admin.POST("/shipping-zones", controllers.CreateShippingZone)
+		admin.PUT("/shipping-zones/:id", controllers.UpdateShippingZone)
+		admin.DELETE("/shipping-zones/:id", controllers.DeleteShippingZone)
 
 		// Refund management
 		admin.GET("/refunds", controllers.GetAllRefunds)
@@ -0,0 +1,172 @@
+// Package secrets encrypts sensitive values, such as gateway keys and SMTP passwords, for
+// storage with AES-256-GCM. The key comes from SECRETS_KEY; keys listed in
+// SECRETS_PREVIOUS_KEYS can still decrypt, so the key can be rotated without losing data.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+
+	"ecom-backend/config"
+)
+
+// prefix marks an encrypted value: "enc:v1:<key id>:<base64 nonce and ciphertext>"
+const prefix = "enc:v1:"
+
+var (
+	// ErrNoKey is returned when SECRETS_KEY isn't set
+	ErrNoKey = errors.New("SECRETS_KEY is not configured")
+	// ErrUnknownKey is returned for values encrypted with a key that is no longer configured
+	ErrUnknownKey = errors.New("secret was encrypted with an unknown key")
+	// ErrCorrupt is returned for encrypted values that fail to decrypt
+	ErrCorrupt = errors.New("secret could not be decrypted")
+)
+
+// key is an AES-256 key and the short ID stored alongside values it encrypts
+type key struct {
+	id   string
+	aead cipher.AEAD
+}
+
+var (
+	loadOnce sync.Once
+	current  *key
+	byID     map[string]*key
+)
+
+// loadKeys reads the current and previous keys from config once
+func loadKeys() {
+	loadOnce.Do(func() {
+		cfg := config.LoadConfig()
+		byID = map[string]*key{}
+		for _, raw := range strings.Split(cfg.SecretsPreviousKeys, ",") {
+			if k := newKey(raw); k != nil {
+				byID[k.id] = k
+			}
+		}
+		if current = newKey(cfg.SecretsKey); current != nil {
+			byID[current.id] = current
+		}
+	})
+}
+
+// newKey builds a key from 32 bytes given as base64 or hex, or from any other passphrase
+// by hashing it. It returns nil for an empty value.
+func newKey(raw string) *key {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	material, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil || len(material) != 32 {
+		if material, err = hex.DecodeString(raw); err != nil || len(material) != 32 {
+			sum := sha256.Sum256([]byte(raw))
+			material = sum[:]
+		}
+	}
+
+	block, err := aes.NewCipher(material)
+	if err != nil {
+		return nil
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil
+	}
+	fingerprint := sha256.Sum256(material)
+	return &key{id: hex.EncodeToString(fingerprint[:4]), aead: aead}
+}
+
+// Configured reports whether a key is set, so secrets can be encrypted
+func Configured() bool {
+	loadKeys()
+	return current != nil
+}
+
+// IsEncrypted reports whether a stored value is encrypted
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// NeedsRotation reports whether a stored value should be encrypted again with the current
+// key: it is plaintext, or was encrypted with a previous key
+func NeedsRotation(value string) bool {
+	loadKeys()
+	if value == "" || current == nil {
+		return false
+	}
+	return !strings.HasPrefix(value, prefix+current.id+":")
+}
+
+// Encrypt encrypts a value with the current key
+func Encrypt(plaintext string) (string, error) {
+	loadKeys()
+	if current == nil {
+		return "", ErrNoKey
+	}
+	nonce := make([]byte, current.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := current.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + current.id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plaintext of a stored value. Values that aren't encrypted, such as
+// secrets saved before encryption was set up, are returned as they are.
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	loadKeys()
+	id, data, ok := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	if !ok {
+		return "", ErrCorrupt
+	}
+	k := byID[id]
+	if k == nil {
+		return "", ErrUnknownKey
+	}
+	sealed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil || len(sealed) < k.aead.NonceSize() {
+		return "", ErrCorrupt
+	}
+	nonce, ciphertext := sealed[:k.aead.NonceSize()], sealed[k.aead.NonceSize():]
+	plaintext, err := k.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrCorrupt
+	}
+	return string(plaintext), nil
+}
+
+// maskMarker stands in for the hidden part of a masked secret
+const maskMarker = "****"
+
+// Mask hides all but the end of a secret for display, keeping a key-type prefix such as
+// "sk_live_": "sk_live_****1234". Short secrets are hidden entirely.
+func Mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) < 12 {
+		return maskMarker
+	}
+	head := ""
+	if i := strings.LastIndex(secret, "_"); i > 0 && i <= 8 {
+		head = secret[:i+1]
+	}
+	return head + maskMarker + secret[len(secret)-4:]
+}
+
+// IsMasked reports whether a value is a masked secret sent back unchanged, e.g. by a form
+// that was loaded with masked values
+func IsMasked(value string) bool {
+	return strings.Contains(value, maskMarker)
+}
@@ -0,0 +1,170 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	retiredKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=" // base64 of 32 bytes
+	activeKey  = "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"
+)
+
+// useKeys configures SECRETS_KEY and SECRETS_PREVIOUS_KEYS for one test
+func useKeys(t *testing.T, key, previous string) {
+	t.Helper()
+	t.Setenv("SECRETS_KEY", key)
+	t.Setenv("SECRETS_PREVIOUS_KEYS", previous)
+	reload := func() {
+		loadOnce = sync.Once{}
+		current, byID = nil, nil
+	}
+	reload()
+	t.Cleanup(reload)
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	useKeys(t, retiredKey, "")
+
+	for _, plaintext := range []string{"sk_live_51HxYz", "", "pässwörd with spaces", strings.Repeat("x", 4096)} {
+		encrypted, err := Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Encrypt(%q) error = %v", plaintext, err)
+		}
+		if !IsEncrypted(encrypted) || (plaintext != "" && strings.Contains(encrypted, plaintext)) {
+			t.Errorf("Encrypt(%q) = %q, want an opaque enc:v1: value", plaintext, encrypted)
+		}
+		decrypted, err := Decrypt(encrypted)
+		if err != nil || decrypted != plaintext {
+			t.Errorf("Decrypt(Encrypt(%q)) = %q, %v", plaintext, decrypted, err)
+		}
+	}
+
+	// Each encryption uses a fresh nonce
+	a, _ := Encrypt("same")
+	b, _ := Encrypt("same")
+	if a == b {
+		t.Error("encrypting the same value twice gave the same ciphertext")
+	}
+}
+
+func TestEncryptWithoutKey(t *testing.T) {
+	useKeys(t, "", "")
+
+	if Configured() {
+		t.Error("Configured() = true without SECRETS_KEY")
+	}
+	if _, err := Encrypt("secret"); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Encrypt without a key error = %v, want ErrNoKey", err)
+	}
+	if NeedsRotation("secret") {
+		t.Error("NeedsRotation() = true without a key to rotate to")
+	}
+}
+
+func TestDecryptPlaintextPassesThrough(t *testing.T) {
+	useKeys(t, "", "")
+
+	if got, err := Decrypt("legacy-password"); err != nil || got != "legacy-password" {
+		t.Errorf("Decrypt(plaintext) = %q, %v, want it unchanged", got, err)
+	}
+}
+
+func TestDecryptWithRotatedKey(t *testing.T) {
+	useKeys(t, retiredKey, "")
+	encrypted, err := Encrypt("sk_live_rotated")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The old key moves to SECRETS_PREVIOUS_KEYS: old values still decrypt, and need rotating
+	useKeys(t, activeKey, " other-retired-passphrase , "+retiredKey)
+	decrypted, err := Decrypt(encrypted)
+	if err != nil || decrypted != "sk_live_rotated" {
+		t.Errorf("Decrypt with a previous key = %q, %v", decrypted, err)
+	}
+	if !NeedsRotation(encrypted) {
+		t.Error("a value encrypted with a previous key doesn't need rotation")
+	}
+
+	reencrypted, err := Encrypt(decrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if NeedsRotation(reencrypted) {
+		t.Error("a value encrypted with the current key needs rotation")
+	}
+	if !NeedsRotation("plaintext") {
+		t.Error("a plaintext value doesn't need rotation")
+	}
+
+	// Once the old key is dropped entirely, its values can't be read
+	useKeys(t, activeKey, "")
+	if _, err := Decrypt(encrypted); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt with a dropped key error = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestDecryptRejectsTamperedValues(t *testing.T) {
+	useKeys(t, activeKey, "")
+	encrypted, err := Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip one bit of the ciphertext, keeping the encoding valid
+	header := prefix + current.id + ":"
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed[len(sealed)-1] ^= 1
+	tampered := header + base64.StdEncoding.EncodeToString(sealed)
+	for _, value := range []string{tampered, prefix + "nokeyid", prefix + current.id + ":not base64!", prefix + current.id + ":AAAA"} {
+		if _, err := Decrypt(value); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("Decrypt(%q) error = %v, want ErrCorrupt", value, err)
+		}
+	}
+}
+
+func TestKeyFormats(t *testing.T) {
+	// A 32-byte key is used as is whether given as base64 or hex; anything else is hashed
+	base64Key, hexKey := newKey(retiredKey), newKey("3031323334353637383961626364656630313233343536373839616263646566")
+	if base64Key == nil || hexKey == nil || base64Key.id != hexKey.id {
+		t.Errorf("the same key as base64 and hex got different IDs")
+	}
+	if passphrase := newKey("correct horse battery staple"); passphrase == nil || passphrase.id == base64Key.id {
+		t.Errorf("a passphrase didn't get a key of its own")
+	}
+	if newKey("   ") != nil {
+		t.Error("a blank key was accepted")
+	}
+}
+
+func TestMask(t *testing.T) {
+	tests := map[string]string{
+		"":                            "",
+		"short":                       "****",
+		"elevenchars":                 "****",
+		"sk_live_51HxYzAbCdEf1234":    "sk_live_****1234",
+		"whsec_abcdefghijklmnop9876":  "whsec_****9876",
+		"plainpassword2024":           "****2024",
+		"a_very_long_prefix_value999": "****e999",
+		"_leadingunderscore42":        "****re42",
+	}
+	for secret, want := range tests {
+		got := Mask(secret)
+		if got != want {
+			t.Errorf("Mask(%q) = %q, want %q", secret, got, want)
+		}
+		if secret != "" && !IsMasked(got) {
+			t.Errorf("IsMasked(Mask(%q)) = false", secret)
+		}
+	}
+	if IsMasked("sk_live_51HxYzAbCdEf1234") {
+		t.Error("IsMasked() = true for a real secret")
+	}
+}
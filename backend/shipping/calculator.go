@@ -0,0 +1,244 @@
+package shipping
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"ecom-backend/models"
+	"ecom-backend/money"
+
+	"gorm.io/gorm"
+)
+
+// VolumetricDivisor converts package volume in cm³ to a chargeable weight in kg
+const VolumetricDivisor = 5000.0
+
+// ErrNotAvailable is returned when a method has rate tables but none cover the destination or parcel
+var ErrNotAvailable = errors.New("shipping method is not available for this destination")
+
+// Destination is where an order is shipped to
+type Destination struct {
+	Country    string
+	Region     string
+	City       string
+	PostalCode string
+}
+
+// Item is a product and quantity being shipped
+type Item struct {
+	Product  models.Product
+	Quantity int
+}
+
+// Quote is the shipping cost of one method for a destination and parcel
+type Quote struct {
+	MethodID              uint        `json:"method_id"`
+	MethodName            string      `json:"method_name"`
+	Description           string      `json:"description"`
+	ZoneID                *uint       `json:"zone_id"`
+	ZoneName              string      `json:"zone_name"`
+	Cost                  money.Money `json:"cost"`
+	IsFree                bool        `json:"is_free"`
+	ChargeableWeight      float64     `json:"chargeable_weight"`
+	EstimatedDays         int         `json:"estimated_days"`
+	EstimatedDeliveryDate string      `json:"estimated_delivery_date"`
+}
+
+// EstimatedDeliveryDate returns the expected delivery date for a method that takes the given number of days
+func EstimatedDeliveryDate(from time.Time, days int) time.Time {
+	return from.AddDate(0, 0, days)
+}
+
+// ChargeableWeight returns the billable weight of the items in kg: for each product the
+// greater of its actual and volumetric weight, times quantity
+func ChargeableWeight(items []Item) float64 {
+	var total float64
+	for _, item := range items {
+		weight := item.Product.Weight
+		volumetric := item.Product.Length * item.Product.Width * item.Product.Height / VolumetricDivisor
+		if volumetric > weight {
+			weight = volumetric
+		}
+		total += weight * float64(item.Quantity)
+	}
+	return math.Round(total*1000) / 1000
+}
+
+// MatchZone returns the active zone that best matches the destination, or nil if none does.
+// Zones are tried by priority, then by how specific they are (postal code, city, region, country).
+func MatchZone(db *gorm.DB, dest Destination) (*models.ShippingZone, error) {
+	var zones []models.ShippingZone
+	if err := db.Where("is_active = ? AND LOWER(country) = LOWER(?)", true, dest.Country).Find(&zones).Error; err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(zones, func(i, j int) bool {
+		if zones[i].Priority != zones[j].Priority {
+			return zones[i].Priority > zones[j].Priority
+		}
+		return zoneSpecificity(zones[i]) > zoneSpecificity(zones[j])
+	})
+
+	for i := range zones {
+		if zoneMatches(zones[i], dest) {
+			return &zones[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Calculate prices a shipping method for the destination, items and order subtotal.
+// Methods without rate tables charge their flat Cost everywhere.
+func Calculate(db *gorm.DB, method models.ShippingMethod, dest Destination, items []Item, subtotal money.Money) (*Quote, error) {
+	weight := ChargeableWeight(items)
+	quote := &Quote{
+		MethodID:              method.ID,
+		MethodName:            method.Name,
+		Description:           method.Description,
+		ChargeableWeight:      weight,
+		EstimatedDays:         method.EstimatedDays,
+		EstimatedDeliveryDate: EstimatedDeliveryDate(time.Now(), method.EstimatedDays).Format("2006-01-02"),
+	}
+
+	var rates []models.ShippingRate
+	if err := db.Where("shipping_method_id = ?", method.ID).Order("min_value ASC, min_subtotal ASC").Find(&rates).Error; err != nil {
+		return nil, err
+	}
+	if len(rates) == 0 {
+		quote.Cost = method.Cost
+		return quote, nil
+	}
+
+	zone, err := MatchZone(db, dest)
+	if err != nil {
+		return nil, err
+	}
+	if zone != nil {
+		quote.ZoneID = &zone.ID
+		quote.ZoneName = zone.Name
+	}
+
+	rate := selectRate(rates, zone, weight, subtotal)
+	if rate == nil {
+		return nil, ErrNotAvailable
+	}
+
+	if rate.FreeShippingThreshold.IsPositive() && subtotal >= rate.FreeShippingThreshold {
+		quote.IsFree = true
+		return quote, nil
+	}
+
+	quote.Cost = rate.Cost
+	if rate.Basis != "subtotal" && rate.CostPerKg.IsPositive() && weight > rate.MinValue {
+		quote.Cost = quote.Cost.Add(rate.CostPerKg.Mul(int(math.Ceil(weight - rate.MinValue))))
+	}
+	return quote, nil
+}
+
+// QuoteAll prices every active shipping method, skipping methods that can't ship to the destination
+func QuoteAll(db *gorm.DB, dest Destination, items []Item, subtotal money.Money) ([]Quote, error) {
+	var methods []models.ShippingMethod
+	if err := db.Where("is_active = ?", true).Order("cost ASC").Find(&methods).Error; err != nil {
+		return nil, err
+	}
+
+	quotes := make([]Quote, 0, len(methods))
+	for _, method := range methods {
+		quote, err := Calculate(db, method, dest, items, subtotal)
+		if err == ErrNotAvailable {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		quotes = append(quotes, *quote)
+	}
+	return quotes, nil
+}
+
+// selectRate picks the rate row covering the parcel, preferring rows for the matched zone
+// over rows that apply outside every zone
+func selectRate(rates []models.ShippingRate, zone *models.ShippingZone, weight float64, subtotal money.Money) *models.ShippingRate {
+	var zoneRates, fallbackRates []models.ShippingRate
+	for _, rate := range rates {
+		switch {
+		case rate.ShippingZoneID == nil:
+			fallbackRates = append(fallbackRates, rate)
+		case zone != nil && *rate.ShippingZoneID == zone.ID:
+			zoneRates = append(zoneRates, rate)
+		}
+	}
+
+	candidates := zoneRates
+	if len(candidates) == 0 {
+		candidates = fallbackRates
+	}
+
+	for i := range candidates {
+		if rateCovers(candidates[i], weight, subtotal) {
+			return &candidates[i]
+		}
+	}
+	return nil
+}
+
+// rateCovers reports whether a rate row's bounds include the parcel's weight, or its subtotal
+// for subtotal-based rows
+func rateCovers(rate models.ShippingRate, weight float64, subtotal money.Money) bool {
+	if rate.Basis == "subtotal" {
+		return subtotal >= rate.MinSubtotal && (rate.MaxSubtotal.IsZero() || subtotal < rate.MaxSubtotal)
+	}
+	return weight >= rate.MinValue && (rate.MaxValue == 0 || weight < rate.MaxValue)
+}
+
+func zoneMatches(zone models.ShippingZone, dest Destination) bool {
+	if zone.Region != "" && !strings.EqualFold(zone.Region, strings.TrimSpace(dest.Region)) {
+		return false
+	}
+	if zone.City != "" && !strings.EqualFold(zone.City, strings.TrimSpace(dest.City)) {
+		return false
+	}
+	if zone.PostalCodes != "" && !postalCodeMatches(zone.PostalCodes, dest.PostalCode) {
+		return false
+	}
+	return true
+}
+
+// postalCodeMatches checks a postal code against comma-separated patterns such as "12*,1310"
+func postalCodeMatches(patterns, postalCode string) bool {
+	postalCode = strings.ToUpper(strings.ReplaceAll(postalCode, " ", ""))
+	if postalCode == "" {
+		return false
+	}
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.ToUpper(strings.ReplaceAll(pattern, " ", ""))
+		if pattern == "" {
+			continue
+		}
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(postalCode, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if pattern == postalCode {
+			return true
+		}
+	}
+	return false
+}
+
+func zoneSpecificity(zone models.ShippingZone) int {
+	specificity := 0
+	if zone.PostalCodes != "" {
+		specificity += 4
+	}
+	if zone.City != "" {
+		specificity += 2
+	}
+	if zone.Region != "" {
+		specificity++
+	}
+	return specificity
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// GenerateRandomToken returns a URL-safe random token with n bytes of entropy
+func GenerateRandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the SHA-256 hex digest of a token, for storing lookup tokens at rest
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CartTokenCookie carries the signed guest cart token for browsers, alongside the
+// X-Cart-Token header used by other clients
+const CartTokenCookie = "cart_token"
+
+// GenerateCartToken signs a guest cart ID so clients can't guess or forge other guests' carts
+func GenerateCartToken(guestID string, secret string) string {
+	return guestID + "." + signCartID(guestID, secret)
+}
+
+// ValidateCartToken checks a cart token's signature and returns the guest cart ID
+func ValidateCartToken(token string, secret string) (string, error) {
+	guestID, signature, ok := strings.Cut(token, ".")
+	if !ok || guestID == "" {
+		return "", errors.New("invalid cart token")
+	}
+	if !hmac.Equal([]byte(signature), []byte(signCartID(guestID, secret))) {
+		return "", errors.New("invalid cart token")
+	}
+	return guestID, nil
+}
+
+func signCartID(guestID string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("cart:" + guestID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}